@@ -0,0 +1,197 @@
+package batch_endpoint
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	dual "github.com/spycat55/KeymasterMultisigPool/pkg/dual_endpoint"
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+	triple "github.com/spycat55/KeymasterMultisigPool/pkg/triple_endpoint"
+)
+
+// 批量开池：一笔资金交易（A-Tx）为同一客户端开多个双端或三方池。
+//
+//	输入顺序:  [客户端 UTXO...]
+//	输出顺序:  [池 0 多签, 池 1 多签, ..., 客户端找零?]
+//
+// 客户端是唯一出资方，A-Tx 在构建时即完成签名、txid 确定，因此可以立即为每个池构建
+// 花费对应 vout 的退款 B-Tx 并附上客户端签名。每个服务器（或三方池的 B 方）只需核对并回签自己的那一笔，
+// 全部回签完成后客户端才广播 A-Tx。
+
+// PoolResult 描述批量开池中的一个池及其退款交易。
+type PoolResult struct {
+	Kind            PoolKind
+	Vout            uint32
+	Amount          uint64
+	Refund          *tx.Transaction // 花费 A-Tx 第 Vout 个输出的退款 B-Tx
+	ClientSignBytes *[]byte         // 客户端（三方池中为 A 方）对退款 B-Tx 的签名
+	ClientAmount    uint64          // 退款 B-Tx 中客户端（A 方）的金额
+}
+
+// BatchResponse 是 BuildBatchPools 的返回值。
+type BatchResponse struct {
+	Tx     *tx.Transaction
+	Pools  []PoolResult
+	Fee    uint64
+	Change uint64 // 客户端找零金额，为 0 时没有找零输出
+}
+
+// BuildBatchPools 构建并签名批量开池的 A-Tx，并为每个池构建退款 B-Tx。
+func BuildBatchPools(p BatchParams) (*BatchResponse, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	feeRate := feeRateOrDefault(p.FeeRate)
+	target := p.total()
+
+	// 手续费取决于交易大小，而选币结果又取决于手续费，迭代直到手续费足以覆盖交易大小
+	var (
+		transactionData *tx.Transaction
+		change          uint64
+	)
+	fee, err := libs.ConvergeFee(feeRate, func(fee uint64) (*tx.Transaction, error) {
+		utxos := p.ClientUTXOs
+		if p.SelectCoins {
+			selected, _, err := libs.SelectUTXOs(p.ClientUTXOs, target+fee)
+			if err != nil {
+				return nil, fmt.Errorf("client utxos: %w", err)
+			}
+			utxos = selected
+		}
+
+		var err error
+		transactionData, change, err = assembleBatchTx(&p, utxos, fee)
+		return transactionData, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pools := make([]PoolResult, 0, len(p.Pools))
+	for i, spec := range p.Pools {
+		result, err := buildRefund(&p, transactionData, uint32(i), spec)
+		if err != nil {
+			return nil, fmt.Errorf("pool %d refund: %w", i, err)
+		}
+		pools = append(pools, *result)
+	}
+
+	libs.Logger().Debug("batch_endpoint: batch base tx built",
+		"txid", transactionData.TxID().String(),
+		"inputs", len(transactionData.Inputs),
+		"pools", len(pools),
+		"change", change,
+		"fee", fee,
+	)
+	return &BatchResponse{Tx: transactionData, Pools: pools, Fee: fee, Change: change}, nil
+}
+
+// assembleBatchTx 按给定手续费组装并签名批量 A-Tx，返回交易与找零金额。
+func assembleBatchTx(p *BatchParams, utxos []libs.UTXO, fee uint64) (*tx.Transaction, uint64, error) {
+	clientPrivateKey := p.ClientPrivateKey
+	clientPublicKey := clientPrivateKey.PubKey()
+
+	clientAddress, err := p.Network.Address(clientPublicKey)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get address: %w", err)
+	}
+	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
+	unlockingScriptTemplate, err := p2pkh.Unlock(clientPrivateKey, &sigHash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create unlocking script template: %w", err)
+	}
+	prevScript, err := p2pkh.Lock(clientAddress)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create locking script: %w", err)
+	}
+	prevTxLockingScript := hex.EncodeToString(prevScript.Bytes())
+
+	transactionData := tx.NewTransaction()
+	var totalValue uint64
+	for _, u := range utxos {
+		if err := transactionData.AddInputFrom(u.TxID, u.Vout, prevTxLockingScript, u.Value, unlockingScriptTemplate); err != nil {
+			return nil, 0, fmt.Errorf("failed to add input: %w", err)
+		}
+		totalValue += u.Value
+	}
+	target := p.total()
+	if totalValue < target+fee {
+		return nil, 0, fmt.Errorf("pool amounts plus fee %d: %w", fee, &libs.InsufficientFundsError{Need: target + fee, Have: totalValue})
+	}
+
+	for i, spec := range p.Pools {
+		keys := []*ec.PublicKey{spec.ServerPublicKey, clientPublicKey}
+		if spec.Kind == PoolTriple {
+			keys = append(keys, spec.BPublicKey)
+		}
+		lockingScript, err := libs.Lock(keys, 2)
+		if err != nil {
+			return nil, 0, fmt.Errorf("pool %d: failed to create multisig locking script: %w", i, err)
+		}
+		transactionData.AddOutput(&tx.TransactionOutput{Satoshis: spec.Amount, LockingScript: lockingScript})
+	}
+
+	change := totalValue - target - fee
+	if change > 0 {
+		changeAddress := clientAddress
+		if p.ChangeAddress != "" {
+			changeAddress, err = p.Network.ParseAddress(p.ChangeAddress)
+			if err != nil {
+				return nil, 0, fmt.Errorf("change address: %w", err)
+			}
+		}
+		changeScript, err := p2pkh.Lock(changeAddress)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to create change locking script: %w", err)
+		}
+		transactionData.AddOutput(&tx.TransactionOutput{Satoshis: change, LockingScript: changeScript})
+	}
+
+	for i := range transactionData.Inputs {
+		unlockingScript, err := unlockingScriptTemplate.Sign(transactionData, uint32(i))
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to sign input %d: %w", i, err)
+		}
+		transactionData.Inputs[i].UnlockingScript = unlockingScript
+	}
+	return transactionData, change, nil
+}
+
+func buildRefund(p *BatchParams, baseTx *tx.Transaction, vout uint32, spec PoolSpec) (*PoolResult, error) {
+	if spec.Kind == PoolTriple {
+		res, err := triple.BuildTripleFeePoolSpendTXV2(triple.SpendParams{
+			BaseTx:          baseTx,
+			PoolVout:        vout,
+			EndHeight:       spec.EndHeight,
+			ServerPublicKey: spec.ServerPublicKey,
+			APrivateKey:     p.ClientPrivateKey,
+			BPublicKey:      spec.BPublicKey,
+			Network:         p.Network,
+			FeeRate:         p.FeeRate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &PoolResult{Kind: spec.Kind, Vout: vout, Amount: spec.Amount, Refund: res.Tx, ClientSignBytes: res.ASignBytes, ClientAmount: res.Amount}, nil
+	}
+
+	res, err := dual.BuildDualFeePoolSpendTXV2(dual.SpendParams{
+		BaseTx:           baseTx,
+		PoolVout:         vout,
+		ServerAmount:     spec.ServerAmount,
+		EndHeight:        spec.EndHeight,
+		ClientPrivateKey: p.ClientPrivateKey,
+		ServerPublicKey:  spec.ServerPublicKey,
+		Network:          p.Network,
+		FeeRate:          p.FeeRate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PoolResult{Kind: spec.Kind, Vout: vout, Amount: spec.Amount, Refund: res.Tx, ClientSignBytes: res.ClientSignBytes, ClientAmount: res.Amount}, nil
+}
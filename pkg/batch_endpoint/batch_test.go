@@ -0,0 +1,102 @@
+package batch_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+
+	dual "github.com/spycat55/KeymasterMultisigPool/pkg/dual_endpoint"
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+	triple "github.com/spycat55/KeymasterMultisigPool/pkg/triple_endpoint"
+)
+
+// 一笔 A-Tx 开多个池，每个退款 B-Tx 花费各自的 vout 并能通过脚本检查。
+func TestBuildBatchPools(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	server1, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	server2, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+
+	p := BatchParams{
+		ClientUTXOs: []libs.UTXO{
+			{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 0, Value: 100000},
+			{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 1, Value: 2000},
+		},
+		ClientPrivateKey: clientPriv,
+		Pools: []PoolSpec{
+			{Kind: PoolDual, Amount: 30000, ServerPublicKey: server1.PubKey(), EndHeight: 900000},
+			{Kind: PoolDual, Amount: 20000, ServerPublicKey: server2.PubKey(), EndHeight: 900000},
+			{Kind: PoolTriple, Amount: 25000, ServerPublicKey: server2.PubKey(), BPublicKey: bPriv.PubKey(), EndHeight: 900000},
+		},
+		SelectCoins: true,
+		FeeRate:     5,
+	}
+	res, err := BuildBatchPools(p)
+	if err != nil {
+		t.Fatalf("build batch: %v", err)
+	}
+	if len(res.Tx.Inputs) != 1 || len(res.Tx.Outputs) != 4 || res.Change != 100000-75000-res.Fee {
+		t.Fatalf("unexpected batch layout: %d inputs, %d outputs, change %d fee %d", len(res.Tx.Inputs), len(res.Tx.Outputs), res.Change, res.Fee)
+	}
+	txid := res.Tx.TxID().String()
+
+	// 双端池：服务器核对客户端签名后回签
+	for i, server := range []*ec.PrivateKey{server1, server2} {
+		pool := res.Pools[i]
+		in := pool.Refund.Inputs[0]
+		if in.SourceTXID.String() != txid || in.SourceTxOutIndex != uint32(i) {
+			t.Fatalf("pool %d refund spends %s:%d", i, in.SourceTXID, in.SourceTxOutIndex)
+		}
+		if _, err := dual.ServerVerifyClientSpendSig(pool.Refund, pool.Amount, server.PubKey(), clientPriv.PubKey(), pool.ClientSignBytes); err != nil {
+			t.Fatalf("pool %d verify: %v", i, err)
+		}
+		serverSig, err := dual.SpendTXServerSign(pool.Refund, pool.Amount, server, clientPriv.PubKey())
+		if err != nil {
+			t.Fatalf("pool %d server sign: %v", i, err)
+		}
+		refund, err := dual.MergeDualPoolSigForSpendTx(pool.Refund.Hex(), serverSig, pool.ClientSignBytes)
+		if err != nil {
+			t.Fatalf("pool %d merge: %v", i, err)
+		}
+		err = interpreter.NewEngine().Execute(
+			interpreter.WithTx(refund, 0, res.Tx.Outputs[pool.Vout]),
+			interpreter.WithForkID(),
+			interpreter.WithAfterGenesis(),
+		)
+		if err != nil {
+			t.Fatalf("pool %d refund failed script check: %v", i, err)
+		}
+	}
+
+	// 三方池：B 方核对 A 方签名后回签
+	pool := res.Pools[2]
+	if pool.Refund.Inputs[0].SourceTxOutIndex != 2 {
+		t.Fatalf("triple refund spends vout %d", pool.Refund.Inputs[0].SourceTxOutIndex)
+	}
+	if _, err := triple.ServerVerifyClientASig(pool.Refund, pool.Amount, server2.PubKey(), clientPriv.PubKey(), bPriv.PubKey(), pool.ClientSignBytes); err != nil {
+		t.Fatalf("triple verify: %v", err)
+	}
+	bSig, err := triple.SpendTXTripleFeePoolBSign(pool.Refund, pool.Amount, server2.PubKey(), clientPriv.PubKey(), bPriv)
+	if err != nil {
+		t.Fatalf("triple b sign: %v", err)
+	}
+	refund, err := triple.MergeTripleFeePoolSigForSpendTx(pool.Refund.Hex(), pool.ClientSignBytes, bSig)
+	if err != nil {
+		t.Fatalf("triple merge: %v", err)
+	}
+	err = interpreter.NewEngine().Execute(
+		interpreter.WithTx(refund, 0, res.Tx.Outputs[pool.Vout]),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("triple refund failed script check: %v", err)
+	}
+
+	p.Pools[0].Amount = 80000
+	if _, err := BuildBatchPools(p); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+}
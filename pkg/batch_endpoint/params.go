@@ -0,0 +1,188 @@
+package batch_endpoint
+
+import (
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// PoolKind 表示批量开池中某个输出的池类型。
+type PoolKind uint8
+
+const (
+	PoolDual   PoolKind = iota // 2-of-2 [server, client]
+	PoolTriple                 // 2-of-3 [server, A, B]，客户端作为 A 方
+)
+
+func (k PoolKind) String() string {
+	switch k {
+	case PoolDual:
+		return "dual"
+	case PoolTriple:
+		return "triple"
+	}
+	return fmt.Sprintf("pool(%d)", uint8(k))
+}
+
+// PoolSpec 描述批量开池中的一个池，输出顺序与 BatchParams.Pools 的顺序一致。
+type PoolSpec struct {
+	Kind            PoolKind
+	Amount          uint64        // 多签输出金额
+	ServerPublicKey *ec.PublicKey // 双端池的服务器，或三方池的仲裁方
+	BPublicKey      *ec.PublicKey // 仅三方池：接收方 B
+	ServerAmount    uint64        // 仅双端池：初始退款 B-Tx 中分配给服务器的金额，通常为 0
+	EndHeight       uint32        // 退款 B-Tx 的 locktime
+}
+
+// BatchParams 描述用一笔资金交易同时开多个池所需的参数。
+// 所有池的资金都来自同一个客户端，手续费也由客户端承担。
+type BatchParams struct {
+	ClientUTXOs      []libs.UTXO
+	ClientPrivateKey *ec.PrivateKey // 双端池的客户端，同时是三方池的 A 方
+	Pools            []PoolSpec
+	ChangeAddress    string // 找零地址；为空时找零回客户端地址
+	SelectCoins      bool   // 只选取足以覆盖所有池金额与手续费的 UTXO
+	Network          libs.Network
+	FeeRate          float64
+}
+
+func invalidParams(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", libs.ErrInvalidParams, fmt.Sprintf(format, args...))
+}
+
+func feeRateOrDefault(feeRate float64) float64 {
+	if feeRate == 0 {
+		return libs.DefaultFeeRate
+	}
+	return feeRate
+}
+
+// Validate 检查批量开池参数。
+func (p *BatchParams) Validate() error {
+	if p.ClientPrivateKey == nil {
+		return invalidParams("client private key is required")
+	}
+	if len(p.ClientUTXOs) == 0 {
+		return invalidParams("at least one client utxo is required")
+	}
+	if len(p.Pools) == 0 {
+		return invalidParams("at least one pool is required")
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	if err := p.Network.ValidateUTXOs(p.ClientUTXOs, p.ClientPrivateKey.PubKey()); err != nil {
+		return err
+	}
+	if p.ChangeAddress != "" {
+		if _, err := p.Network.ParseAddress(p.ChangeAddress); err != nil {
+			return fmt.Errorf("change address: %w", err)
+		}
+	}
+	for i, pool := range p.Pools {
+		if pool.Amount == 0 {
+			return invalidParams("pool %d: amount must be positive", i)
+		}
+		if pool.ServerPublicKey == nil {
+			return invalidParams("pool %d: server public key is required", i)
+		}
+		switch pool.Kind {
+		case PoolDual:
+			if pool.ServerAmount > pool.Amount {
+				return fmt.Errorf("pool %d server amount: %w", i, &libs.InsufficientFundsError{Need: pool.ServerAmount, Have: pool.Amount})
+			}
+		case PoolTriple:
+			if pool.BPublicKey == nil {
+				return invalidParams("pool %d: b public key is required for triple pools", i)
+			}
+		default:
+			return invalidParams("pool %d: unknown kind %d", i, uint8(pool.Kind))
+		}
+		if err := libs.CheckBlockHeightLocktime(pool.EndHeight); err != nil {
+			return fmt.Errorf("pool %d: %w", i, err)
+		}
+	}
+	if have := libs.SumUTXOs(p.ClientUTXOs); have < p.total() {
+		return fmt.Errorf("pool amounts: %w", &libs.InsufficientFundsError{Need: p.total(), Have: have})
+	}
+	return nil
+}
+
+func (p *BatchParams) total() uint64 {
+	var total uint64
+	for _, pool := range p.Pools {
+		total += pool.Amount
+	}
+	return total
+}
+
+// SettlementPool 描述一个参与批量合作结算的双端池。
+type SettlementPool struct {
+	Latest          *tx.Transaction // 最近一次双方签名的完整 B-Tx，合作结算失败时单独广播
+	PoolAmount      uint64          // 多签输出金额
+	ClientPublicKey *ec.PublicKey
+}
+
+// SettlementParams 描述批量合作结算所需的参数，服务器是所有池的同一方。
+type SettlementParams struct {
+	Pools            []SettlementPool
+	ServerPrivateKey *ec.PrivateKey
+	PayoutAddress    string // 服务器汇总输出地址；为空时使用服务器公钥地址
+	Network          libs.Network
+	FeeRate          float64
+	FeePolicy        libs.FeePolicy // 各池释放的 B-Tx 手续费与分摊额之差的结算方式，默认归客户端
+}
+
+// Validate 检查批量结算参数。
+func (p *SettlementParams) Validate() error {
+	if p.ServerPrivateKey == nil {
+		return invalidParams("server private key is required")
+	}
+	if len(p.Pools) == 0 {
+		return invalidParams("at least one pool is required")
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	if err := p.FeePolicy.Validate(); err != nil {
+		return err
+	}
+	if p.PayoutAddress != "" {
+		if _, err := p.Network.ParseAddress(p.PayoutAddress); err != nil {
+			return fmt.Errorf("payout address: %w", err)
+		}
+	}
+	seen := make(map[string]int, len(p.Pools))
+	for i, pool := range p.Pools {
+		if pool.ClientPublicKey == nil {
+			return invalidParams("pool %d: client public key is required", i)
+		}
+		if pool.Latest == nil || len(pool.Latest.Inputs) != 1 {
+			return fmt.Errorf("pool %d: %w: latest tx must have exactly one input", i, libs.ErrInvalidTransaction)
+		}
+		if pool.Latest.Inputs[0].UnlockingScript == nil {
+			return fmt.Errorf("pool %d: %w: latest tx is not fully signed", i, libs.ErrInvalidTransaction)
+		}
+		amounts, _, err := latestPayouts(pool.Latest, p.ServerPrivateKey.PubKey(), pool.ClientPublicKey)
+		if err != nil {
+			return fmt.Errorf("pool %d: %w", i, err)
+		}
+		if outputs := amounts[0] + amounts[1]; outputs > pool.PoolAmount {
+			return fmt.Errorf("pool %d: %w: latest outputs %d exceed pool amount %d", i, libs.ErrInvalidTransaction, outputs, pool.PoolAmount)
+		}
+		outpoint := settlementOutpoint(pool.Latest)
+		if j, ok := seen[outpoint]; ok {
+			return invalidParams("pools %d and %d spend the same outpoint %s", j, i, outpoint)
+		}
+		seen[outpoint] = i
+	}
+	return nil
+}
+
+func settlementOutpoint(latest *tx.Transaction) string {
+	in := latest.Inputs[0]
+	return fmt.Sprintf("%s:%d", in.SourceTXID.String(), in.SourceTxOutIndex)
+}
@@ -0,0 +1,312 @@
+package batch_endpoint
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	dual "github.com/spycat55/KeymasterMultisigPool/pkg/dual_endpoint"
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 批量合作结算：大量双端池同时到期时，服务器把在线客户端的池合并到一笔交易中结算，
+// 省去每笔 B-Tx 各自的交易开销。
+//
+//	输入顺序:  [池 0 多签, 池 1 多签, ...]（全部 FinalSequence，locktime 为 0，可立即广播）
+//	输出顺序:  [服务器汇总 P2PKH?, 池 0 客户端, 池 1 客户端, ...]
+//
+// 服务器金额沿用各池最近一次 B-Tx 的 outputs[0] 并汇总为一个输出（为 0 时省略）；
+// 客户端输出沿用 B-Tx outputs[1] 的锁定脚本。手续费按输入数平均分摊，每个池释放的 B-Tx 手续费
+// 与分摊额之差按 SettlementParams.FeePolicy 在双方之间结算（默认全部归客户端），
+// 客户端据此核对自己至少拿到最近一次 B-Tx 中的金额。
+// 未响应、拒签或签名无效的池被剔除并重新构建交易，这些池由调用方单独广播其最近的 B-Tx。
+
+// SignatureCollector 把合并结算交易发给第 pool 个池（SettlementParams.Pools 中的下标）的客户端，
+// 取回其对第 inputIndex 个输入的签名。客户端离线、超时或拒签时返回错误，该池转为单独广播。
+// SettleBatch 会并发调用，每次调用拿到的是独立的交易副本，实现需并发安全。
+type SignatureCollector func(pool int, settlement *tx.Transaction, inputIndex uint32) (*[]byte, error)
+
+// SettlementResult 是 SettleBatch 的返回值。
+type SettlementResult struct {
+	Tx           *tx.Transaction // 完整签名的合并结算交易，所有池都回退时为 nil
+	Settled      []int           // 由 Tx 结算的池，顺序与 Tx 的输入一致
+	Fallback     []int           // 需要单独广播最近一次 B-Tx 的池
+	Errors       map[int]error   // Fallback 中各池的回退原因
+	Fee          uint64
+	ServerPayout uint64
+}
+
+// SettleBatch 构建合并结算交易，收集并验证各客户端签名，剔除失败的池后重试，
+// 最后由服务器补签所有输入。每轮要么全部成功，要么至少剔除一个池，因此必然结束。
+func SettleBatch(p SettlementParams, collect SignatureCollector) (*SettlementResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if collect == nil {
+		return nil, invalidParams("signature collector is required")
+	}
+
+	result := &SettlementResult{Errors: map[int]error{}}
+	include := make([]int, len(p.Pools))
+	for i := range include {
+		include[i] = i
+	}
+
+	for len(include) > 0 {
+		settlement, fee, serverPayout, unpayable, err := buildSettlementTx(&p, include)
+		if err != nil {
+			return nil, err
+		}
+		if len(unpayable) > 0 {
+			include = dropFailedPools(include, unpayable, result)
+			continue
+		}
+
+		signs := collectSignatures(&p, settlement, include, collect)
+		failed := map[int]error{}
+		for i, pool := range include {
+			if signs[i].err != nil {
+				failed[pool] = signs[i].err
+				continue
+			}
+			if _, err := dual.ServerVerifyClientSpendSigAt(settlement, uint32(i), p.Pools[pool].PoolAmount, p.ServerPrivateKey.PubKey(), p.Pools[pool].ClientPublicKey, signs[i].sig); err != nil {
+				failed[pool] = err
+			}
+		}
+		if len(failed) > 0 {
+			include = dropFailedPools(include, failed, result)
+			continue
+		}
+
+		for i, pool := range include {
+			serverSignBytes, err := dual.SpendTXServerSignAt(settlement, uint32(i), p.Pools[pool].PoolAmount, p.ServerPrivateKey, p.Pools[pool].ClientPublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("pool %d: %w", pool, err)
+			}
+			unlockingScript, err := libs.BuildSignScript(&[][]byte{*serverSignBytes, *signs[i].sig})
+			if err != nil {
+				return nil, fmt.Errorf("pool %d: failed to build unlocking script: %w", pool, err)
+			}
+			settlement.Inputs[i].UnlockingScript = unlockingScript
+		}
+		result.Tx, result.Settled, result.Fee, result.ServerPayout = settlement, include, fee, serverPayout
+		break
+	}
+
+	sort.Ints(result.Fallback)
+	libs.Logger().Debug("batch_endpoint: batch settlement finished",
+		"settled", len(result.Settled),
+		"fallback", len(result.Fallback),
+		"fee", result.Fee,
+	)
+	return result, nil
+}
+
+// ClientSignSettlement 客户端核对合并结算交易后为自己的多签输入签名。
+// 要求第 inputIndex 个输入花费 latest 的多签输出、对应的客户端输出使用 latest 中的锁定脚本，
+// 且金额不少于 latest 中客户端的金额，即合作结算不会比单独广播 B-Tx 拿得更少。
+func ClientSignSettlement(
+	settlement *tx.Transaction,
+	inputIndex uint32,
+	latest *tx.Transaction,
+	poolAmount uint64,
+	clientPrivateKey *ec.PrivateKey,
+	serverPublicKey *ec.PublicKey,
+) (*[]byte, error) {
+	if clientPrivateKey == nil || serverPublicKey == nil {
+		return nil, invalidParams("client private key and server public key are required")
+	}
+	if latest == nil || len(latest.Inputs) != 1 {
+		return nil, fmt.Errorf("%w: latest tx must have exactly one input", libs.ErrInvalidTransaction)
+	}
+	amounts, scripts, err := latestPayouts(latest, serverPublicKey, clientPrivateKey.PubKey())
+	if err != nil {
+		return nil, err
+	}
+	if settlement == nil || int(inputIndex) >= len(settlement.Inputs) || len(settlement.Outputs) < len(settlement.Inputs) {
+		return nil, fmt.Errorf("%w: settlement tx has no input %d", libs.ErrInvalidTransaction, inputIndex)
+	}
+	if settlement.LockTime != 0 {
+		return nil, fmt.Errorf("%w: settlement tx must not be time-locked", libs.ErrInvalidTransaction)
+	}
+	in, prev := settlement.Inputs[inputIndex], latest.Inputs[0]
+	if !in.SourceTXID.Equal(*prev.SourceTXID) || in.SourceTxOutIndex != prev.SourceTxOutIndex || in.SequenceNumber != libs.FinalSequence {
+		return nil, fmt.Errorf("%w: input %d does not spend the pool outpoint", libs.ErrTransitionMismatch, inputIndex)
+	}
+	out := settlement.Outputs[settlementClientOutput(settlement, inputIndex)]
+	if !out.LockingScript.Equals(scripts[1]) {
+		return nil, fmt.Errorf("%w: client payout script changed", libs.ErrTransitionMismatch)
+	}
+	if out.Satoshis < amounts[1] {
+		return nil, fmt.Errorf("client payout: %w", &libs.InsufficientFundsError{Need: amounts[1], Have: out.Satoshis})
+	}
+
+	signBytes, err := dual.SpendTXDualFeePoolClientSignAt(settlement, inputIndex, poolAmount, clientPrivateKey, serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	libs.Logger().Debug("batch_endpoint: client signed settlement", "input", inputIndex, "payout", out.Satoshis)
+	return signBytes, nil
+}
+
+// errSettlementUnderpaid 表示手续费分摊后客户端所得低于其最近一次 B-Tx 中的金额。
+var errSettlementUnderpaid = fmt.Errorf("%w: fee share exceeds the client's savings over its own refund tx", libs.ErrInsufficientFunds)
+
+// buildSettlementTx 为 include 中的池构建未签名的合并结算交易。
+// 手续费分摊后无法结算的池（策略要求的扣费不足，或客户端所得低于其 B-Tx 金额）在 unpayable 中返回，
+// 此时交易金额不完整，调用方应剔除这些池后重建。
+func buildSettlementTx(p *SettlementParams, include []int) (*tx.Transaction, uint64, uint64, map[int]error, error) {
+	payoutAddress, err := p.Network.Address(p.ServerPrivateKey.PubKey())
+	if err != nil {
+		return nil, 0, 0, nil, fmt.Errorf("failed to get server address: %w", err)
+	}
+	if p.PayoutAddress != "" {
+		if payoutAddress, err = p.Network.ParseAddress(p.PayoutAddress); err != nil {
+			return nil, 0, 0, nil, fmt.Errorf("payout address: %w", err)
+		}
+	}
+	serverScript, err := p2pkh.Lock(payoutAddress)
+	if err != nil {
+		return nil, 0, 0, nil, fmt.Errorf("failed to create server locking script: %w", err)
+	}
+	fakeMultisig, err := libs.FakeSign(2)
+	if err != nil {
+		return nil, 0, 0, nil, fmt.Errorf("failed to build placeholder unlocking script: %w", err)
+	}
+
+	transactionData := tx.NewTransaction()
+	var (
+		serverPayout  uint64
+		payouts       [][]uint64
+		clientScripts []*script.Script
+	)
+	for _, i := range include {
+		pool := p.Pools[i]
+		multisigScript, err := libs.Lock([]*ec.PublicKey{p.ServerPrivateKey.PubKey(), pool.ClientPublicKey}, 2)
+		if err != nil {
+			return nil, 0, 0, nil, fmt.Errorf("pool %d: failed to create multisig locking script: %w", i, err)
+		}
+		prev := pool.Latest.Inputs[0]
+		if err := transactionData.AddInputFrom(prev.SourceTXID.String(), prev.SourceTxOutIndex, multisigScript.String(), pool.PoolAmount, nil); err != nil {
+			return nil, 0, 0, nil, fmt.Errorf("pool %d: failed to add pool input: %w", i, err)
+		}
+		transactionData.Inputs[len(transactionData.Inputs)-1].SequenceNumber = libs.FinalSequence
+		amounts, scripts, err := latestPayouts(pool.Latest, p.ServerPrivateKey.PubKey(), pool.ClientPublicKey)
+		if err != nil {
+			return nil, 0, 0, nil, fmt.Errorf("pool %d: %w", i, err)
+		}
+		serverPayout += amounts[0]
+		payouts = append(payouts, amounts)
+		clientScripts = append(clientScripts, scripts[1])
+	}
+	hasServerOutput := serverPayout > 0
+	if hasServerOutput {
+		transactionData.AddOutput(&tx.TransactionOutput{Satoshis: serverPayout, LockingScript: serverScript})
+	}
+	for k := range include {
+		transactionData.AddOutput(&tx.TransactionOutput{Satoshis: payouts[k][1], LockingScript: clientScripts[k]})
+	}
+
+	for _, in := range transactionData.Inputs {
+		in.UnlockingScript = fakeMultisig
+	}
+	fee := uint64(float64(transactionData.Size()) / 1000.0 * feeRateOrDefault(p.FeeRate))
+	for _, in := range transactionData.Inputs {
+		in.UnlockingScript = nil
+	}
+
+	// 手续费按输入平均分摊，向上取整，零头也归矿工；每个池释放的 B-Tx 手续费与分摊额之差按策略结算
+	n := uint64(len(include))
+	share := (fee + n - 1) / n
+	if share == 0 {
+		share = 1
+	}
+	serverPayout = 0
+	var unpayable map[int]error
+	offset := len(transactionData.Outputs) - len(include)
+	for k, i := range include {
+		pool := p.Pools[i]
+		serverAmount, clientAmount := payouts[k][0], payouts[k][1]
+		oldFee := pool.PoolAmount - serverAmount - clientAmount
+		serverOut, clientOut, err := p.FeePolicy.Resettle(serverAmount, clientAmount, oldFee, share)
+		if err == nil && clientOut < clientAmount {
+			err = errSettlementUnderpaid
+		}
+		if err != nil {
+			if unpayable == nil {
+				unpayable = map[int]error{}
+			}
+			unpayable[i] = err
+			continue
+		}
+		transactionData.Outputs[offset+k].Satoshis = clientOut
+		serverPayout += serverOut
+	}
+	if hasServerOutput {
+		transactionData.Outputs[0].Satoshis = serverPayout
+	}
+	return transactionData, share * n, serverPayout, unpayable, nil
+}
+
+// latestPayouts 返回 latest 中 [服务器, 客户端] 的支付金额与锁定脚本，金额为 0 而被省略的一方金额为 0、脚本为公钥的 P2PKH。
+func latestPayouts(latest *tx.Transaction, serverPublicKey, clientPublicKey *ec.PublicKey) ([]uint64, []*script.Script, error) {
+	scripts, err := dual.PayoutScripts(serverPublicKey, clientPublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return libs.SplitPayouts(latest, scripts)
+}
+
+// settlementClientOutput 返回第 inputIndex 个输入对应的客户端输出位置：客户端输出位于末尾，与输入一一对应。
+func settlementClientOutput(settlement *tx.Transaction, inputIndex uint32) int {
+	return len(settlement.Outputs) - len(settlement.Inputs) + int(inputIndex)
+}
+
+type collectedSign struct {
+	sig *[]byte
+	err error
+}
+
+// collectSignatures 并发向各客户端收集签名，结果按输入顺序返回。
+func collectSignatures(p *SettlementParams, settlement *tx.Transaction, include []int, collect SignatureCollector) []collectedSign {
+	raw := settlement.Hex()
+	signs := make([]collectedSign, len(include))
+	var wg sync.WaitGroup
+	for k, i := range include {
+		wg.Add(1)
+		go func(k, i int) {
+			defer wg.Done()
+			copyTx, err := tx.NewTransactionFromHex(raw)
+			if err != nil {
+				signs[k].err = fmt.Errorf("%w: decode tx hex: %w", libs.ErrInvalidTransaction, err)
+				return
+			}
+			signs[k].sig, signs[k].err = collect(i, copyTx, uint32(k))
+			if signs[k].err == nil && signs[k].sig == nil {
+				signs[k].err = fmt.Errorf("%w: empty signature", libs.ErrInvalidSignatureFormat)
+			}
+		}(k, i)
+	}
+	wg.Wait()
+	return signs
+}
+
+// dropFailedPools 把失败的池移入回退列表，返回剩余的池。
+func dropFailedPools(include []int, failed map[int]error, result *SettlementResult) []int {
+	kept := include[:0:0]
+	for _, i := range include {
+		if err, ok := failed[i]; ok {
+			result.Fallback = append(result.Fallback, i)
+			result.Errors[i] = err
+			libs.Logger().Debug("batch_endpoint: pool falls back to its own refund tx", "pool", i, "error", err)
+			continue
+		}
+		kept = append(kept, i)
+	}
+	return kept
+}
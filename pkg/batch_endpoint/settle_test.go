@@ -0,0 +1,140 @@
+package batch_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	dual "github.com/spycat55/KeymasterMultisigPool/pkg/dual_endpoint"
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 三个到期的池：一个客户端离线、一个返回错误签名，二者回退为单独广播；其余合并结算并通过脚本检查。
+func TestSettleBatch(t *testing.T) {
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	clients := make([]*ec.PrivateKey, 4)
+	for i := range clients {
+		clients[i], _ = ec.NewPrivateKey()
+	}
+	serverAmounts := []uint64{30000, 0, 12000, 5000}
+
+	p := SettlementParams{ServerPrivateKey: serverPriv, FeeRate: 5}
+	for i, clientPriv := range clients {
+		prevTxID := []string{
+			"00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+			"11112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+			"22112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+			"33112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		}[i]
+		latest, err := dual.BuildDualFeePoolSpendTXV2(dual.SpendParams{
+			PrevTxID:         prevTxID,
+			TotalAmount:      100000,
+			ServerAmount:     serverAmounts[i],
+			EndHeight:        800000,
+			ClientPrivateKey: clientPriv,
+			ServerPublicKey:  serverPriv.PubKey(),
+			FeeRate:          5,
+		})
+		if err != nil {
+			t.Fatalf("pool %d latest: %v", i, err)
+		}
+		serverSig, err := dual.SpendTXServerSign(latest.Tx, 100000, serverPriv, clientPriv.PubKey())
+		if err != nil {
+			t.Fatalf("pool %d server sign: %v", i, err)
+		}
+		signed, err := dual.MergeDualPoolSigForSpendTx(latest.Tx.Hex(), serverSig, latest.ClientSignBytes)
+		if err != nil {
+			t.Fatalf("pool %d merge: %v", i, err)
+		}
+		p.Pools = append(p.Pools, SettlementPool{Latest: signed, PoolAmount: 100000, ClientPublicKey: clientPriv.PubKey()})
+	}
+
+	offline := errors.New("client offline")
+	collect := func(pool int, settlement *tx.Transaction, inputIndex uint32) (*[]byte, error) {
+		switch pool {
+		case 1:
+			return nil, offline
+		case 3:
+			// 用错误的私钥签名，服务器验证失败后剔除
+			return ClientSignSettlement(settlement, inputIndex, p.Pools[pool].Latest, 100000, clients[0], serverPriv.PubKey())
+		}
+		return ClientSignSettlement(settlement, inputIndex, p.Pools[pool].Latest, 100000, clients[pool], serverPriv.PubKey())
+	}
+	res, err := SettleBatch(p, collect)
+	if err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if len(res.Settled) != 2 || res.Settled[0] != 0 || res.Settled[1] != 2 {
+		t.Fatalf("expected pools 0 and 2 settled, got %v", res.Settled)
+	}
+	if len(res.Fallback) != 2 || res.Fallback[0] != 1 || res.Fallback[1] != 3 || !errors.Is(res.Errors[1], offline) {
+		t.Fatalf("unexpected fallback %v %v", res.Fallback, res.Errors)
+	}
+	var sigErr *libs.SignatureError
+	if !errors.As(res.Errors[3], &sigErr) {
+		t.Fatalf("expected signature error for pool 3, got %v", res.Errors[3])
+	}
+	if res.ServerPayout != 42000 || len(res.Tx.Outputs) != 3 || res.Tx.Outputs[0].Satoshis != 42000 {
+		t.Fatalf("unexpected server payout %d", res.ServerPayout)
+	}
+
+	var outTotal uint64
+	for k, pool := range res.Settled {
+		latest := p.Pools[pool].Latest
+		if got := res.Tx.Outputs[1+k].Satoshis; got < latest.Outputs[1].Satoshis {
+			t.Fatalf("pool %d client payout %d below refund amount %d", pool, got, latest.Outputs[1].Satoshis)
+		}
+		redeem, _ := libs.Lock([]*ec.PublicKey{serverPriv.PubKey(), clients[pool].PubKey()}, 2)
+		err = interpreter.NewEngine().Execute(
+			interpreter.WithTx(res.Tx, k, &tx.TransactionOutput{Satoshis: 100000, LockingScript: redeem}),
+			interpreter.WithForkID(),
+			interpreter.WithAfterGenesis(),
+		)
+		if err != nil {
+			t.Fatalf("settlement input %d failed script check: %v", k, err)
+		}
+	}
+	for _, out := range res.Tx.Outputs {
+		outTotal += out.Satoshis
+	}
+	if outTotal+res.Fee != 200000 {
+		t.Fatalf("outputs %d plus fee %d must equal inputs", outTotal, res.Fee)
+	}
+}
+
+// 客户端拒绝减少自身金额的合并结算交易。
+func TestClientSignSettlementRejectsUnderpayment(t *testing.T) {
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	latest, err := dual.BuildDualFeePoolSpendTXV2(dual.SpendParams{
+		PrevTxID:         "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		TotalAmount:      100000,
+		ServerAmount:     10000,
+		EndHeight:        800000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	latest.Tx.Inputs[0].UnlockingScript = latest.Tx.Inputs[0].SourceTxOutput().LockingScript
+	p := SettlementParams{
+		Pools:            []SettlementPool{{Latest: latest.Tx, PoolAmount: 100000, ClientPublicKey: clientPriv.PubKey()}},
+		ServerPrivateKey: serverPriv,
+	}
+	settlement, _, _, unpayable, err := buildSettlementTx(&p, []int{0})
+	if err != nil || len(unpayable) != 0 {
+		t.Fatalf("build: %v", err)
+	}
+	if _, err := ClientSignSettlement(settlement, 0, latest.Tx, 100000, clientPriv, serverPriv.PubKey()); err != nil {
+		t.Fatalf("honest settlement should be signed: %v", err)
+	}
+	settlement.Outputs[1].Satoshis = latest.Tx.Outputs[1].Satoshis - 1
+	settlement.Outputs[0].Satoshis += 1
+	if _, err := ClientSignSettlement(settlement, 0, latest.Tx, 100000, clientPriv, serverPriv.PubKey()); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+}
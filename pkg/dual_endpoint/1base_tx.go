@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	script "github.com/bsv-blockchain/go-sdk/script"
 	// "go.uber.org/zap"
 
 	// primitives "github.com/bsv-blockchain/go-sdk/primitives/ec"
@@ -23,9 +24,12 @@ type BuildStep1Response struct {
 	Tx     *tx.Transaction
 	Amount uint64
 	Index  int
+	Fee    uint64 // A-Tx 手续费
+	Change uint64 // 客户端找零金额（outputs[1]）
 }
 
-// p2pkh to 2t2多签, 不找零
+// p2pkh to 2t2多签, 找零回客户端
+// 位置参数版本，保留兼容：不做 V2 的参数校验，feeRate 原样使用（为 0 时手续费按 1 sat 计）。
 func BuildDualFeePoolBaseTx(
 	clientUtxo *[]libs.UTXO, // 发起者 utxos, 我提供的金额就是这个 utxo 的全额
 	feepoolAmount uint64, // 费用池金额（主输出金额）
@@ -34,7 +38,43 @@ func BuildDualFeePoolBaseTx(
 	isMain bool,
 	feeRate float64,
 ) (*BuildStep1Response, error) {
-	clientAddress, err := libs.GetAddressFromPubKey(clientPrivateKey.PubKey(), isMain)
+	var utxos []libs.UTXO
+	if clientUtxo != nil {
+		utxos = *clientUtxo
+	}
+	return assembleDualFeePoolBaseTx(PoolParams{
+		ClientUTXOs:      utxos,
+		PoolAmount:       feepoolAmount,
+		ClientPrivateKey: clientPrivateKey,
+		ServerPublicKey:  serverPublicKey,
+		Network:          libs.NetworkFromIsMain(isMain),
+	}, nil, feeRate)
+}
+
+// BuildDualFeePoolBaseTxV2 构建 A-Tx：客户端 UTXO -> 2-of-2 多签输出 + 客户端找零。
+func BuildDualFeePoolBaseTxV2(p PoolParams) (*BuildStep1Response, error) {
+	return buildDualFeePoolBaseTx(p, nil)
+}
+
+// buildDualFeePoolBaseTx 校验参数后构建 A-Tx，poolScript 为空时池输出为双方的 2-of-2 多签。
+func buildDualFeePoolBaseTx(p PoolParams, poolScript *script.Script) (*BuildStep1Response, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return assembleDualFeePoolBaseTx(p, poolScript, feeRateOrDefault(p.FeeRate))
+}
+
+// assembleDualFeePoolBaseTx 按给定费率构建 A-Tx，不校验参数，p.FeeRate 不参与计算。
+func assembleDualFeePoolBaseTx(p PoolParams, poolScript *script.Script, feeRate float64) (*BuildStep1Response, error) {
+	if p.ClientPrivateKey == nil || p.ServerPublicKey == nil {
+		return nil, invalidParams("client private key and server public key are required")
+	}
+	clientUtxo := &p.ClientUTXOs
+	feepoolAmount := p.PoolAmount
+	clientPrivateKey := p.ClientPrivateKey
+	serverPublicKey := p.ServerPublicKey
+
+	clientAddress, err := p.Network.Address(clientPrivateKey.PubKey())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get address: %w", err)
 	}
@@ -81,13 +121,16 @@ func BuildDualFeePoolBaseTx(
 	}
 
 	if totalValue < feepoolAmount {
-		return nil, fmt.Errorf("not enough balance for feepoolAmount: need %d, have %d", feepoolAmount, totalValue)
+		return nil, fmt.Errorf("feepool amount: %w", &libs.InsufficientFundsError{Need: feepoolAmount, Have: totalValue})
 	}
 
 	// 创建初始交易的锁定脚本
-	outputMultisigScript, err := libs.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create server locking script: %w", err)
+	outputMultisigScript := poolScript
+	if outputMultisigScript == nil {
+		outputMultisigScript, err = libs.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create server locking script: %w", err)
+		}
 	}
 
 	// 添加主输出（费用池多签）
@@ -128,7 +171,7 @@ func BuildDualFeePoolBaseTx(
 
 	// 检查是否有足够的余额支付手续费
 	if totalValue < feepoolAmount+fee {
-		return nil, fmt.Errorf("not enough balance: need %d (feepool + fee), have %d", feepoolAmount+fee, totalValue)
+		return nil, fmt.Errorf("feepool amount plus fee %d: %w", fee, &libs.InsufficientFundsError{Need: feepoolAmount + fee, Have: totalValue})
 	}
 
 	// 更新找零输出：总额 - feepoolAmount - 手续费
@@ -145,9 +188,19 @@ func BuildDualFeePoolBaseTx(
 
 	finalAmount := feepoolAmount
 
+	libs.Logger().Debug("dual_endpoint: base tx built",
+		"txid", transactionData.TxID().String(),
+		"inputs", len(transactionData.Inputs),
+		"pool_amount", finalAmount,
+		"change", transactionData.Outputs[1].Satoshis,
+		"fee", fee,
+	)
+
 	return &BuildStep1Response{
 		Tx:     transactionData,
 		Amount: finalAmount,
 		Index:  0,
+		Fee:    fee,
+		Change: transactionData.Outputs[1].Satoshis,
 	}, nil
 }
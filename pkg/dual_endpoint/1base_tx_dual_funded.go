@@ -0,0 +1,341 @@
+package chain_utils
+
+import (
+	"bytes"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 双方出资开池流程：
+//  1. 任一方用 BuildDualFundedBaseTx 构建未签名的 A-Tx，双方各自重建并核对（VerifyDualFundedBaseTx）。
+//  2. 服务器用 SignDualFundedBaseTx 只签自己的输入，把部分签名的 A-Tx 交给客户端。
+//  3. 客户端核对服务器的出资和签名后签自己的输入，此时 A-Tx 完整、txid 确定；
+//     客户端用 BuildDualFundedRefundTX 构建退款 B-Tx 并签名，连同 A-Tx 一起交给服务器。
+//  4. 服务器用 ServerVerifyDualFundedRefund 核对退款交易后回签，客户端拿到完整退款交易后才广播 A-Tx。
+//
+// BSV 的 txid 包含解锁脚本，必须等所有输入签名后才能构建退款交易，因此退款交易在 A-Tx 签名之后、广播之前完成。
+
+// DualFundedResponse 是 BuildDualFundedBaseTx 的返回值。
+type DualFundedResponse struct {
+	Tx           *tx.Transaction
+	Amount       uint64 // 多签输出金额 = ClientAmount + ServerAmount
+	Index        int
+	Fee          uint64 // A-Tx 手续费，双方各承担一半，奇数部分由客户端承担
+	ClientChange uint64
+	ServerChange uint64
+}
+
+// BuildDualFundedBaseTx 构建双方出资的 A-Tx：客户端输入 + 服务器输入 -> 2-of-2 多签输出 + 双方找零。
+// 返回的交易未签名，找零为 0 的一方不产生找零输出。
+func BuildDualFundedBaseTx(p DualFundedParams) (*DualFundedResponse, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	feeRate := feeRateOrDefault(p.FeeRate)
+
+	// 找零输出是否存在会影响交易大小，迭代直到手续费足以覆盖交易大小
+	var res *DualFundedResponse
+	_, err := libs.ConvergeFee(feeRate, func(fee uint64) (*tx.Transaction, error) {
+		var err error
+		res, err = assembleDualFundedBaseTx(&p, fee)
+		if err != nil {
+			return nil, err
+		}
+		return res.Tx, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 占位解锁脚本只用于估算大小
+	for _, input := range res.Tx.Inputs {
+		input.UnlockingScript = nil
+	}
+
+	libs.Logger().Debug("dual_endpoint: dual funded base tx built",
+		"inputs", len(res.Tx.Inputs),
+		"pool_amount", res.Amount,
+		"client_change", res.ClientChange,
+		"server_change", res.ServerChange,
+		"fee", res.Fee,
+	)
+	return res, nil
+}
+
+func assembleDualFundedBaseTx(p *DualFundedParams, fee uint64) (*DualFundedResponse, error) {
+	serverFee := fee / 2
+	clientFee := fee - serverFee
+
+	clientTotal := libs.SumUTXOs(p.ClientUTXOs)
+	serverTotal := libs.SumUTXOs(p.ServerUTXOs)
+	if clientTotal < p.ClientAmount+clientFee {
+		return nil, fmt.Errorf("client contribution plus fee %d: %w", clientFee, &libs.InsufficientFundsError{Need: p.ClientAmount + clientFee, Have: clientTotal})
+	}
+	if serverTotal < p.ServerAmount+serverFee {
+		return nil, fmt.Errorf("server contribution plus fee %d: %w", serverFee, &libs.InsufficientFundsError{Need: p.ServerAmount + serverFee, Have: serverTotal})
+	}
+
+	clientAddress, err := p.Network.Address(p.ClientPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client address: %w", err)
+	}
+	serverAddress, err := p.Network.Address(p.ServerPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server address: %w", err)
+	}
+	clientScript, err := p2pkh.Lock(clientAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client locking script: %w", err)
+	}
+	serverScript, err := p2pkh.Lock(serverAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server locking script: %w", err)
+	}
+
+	transactionData := tx.NewTransaction()
+	for _, u := range p.ClientUTXOs {
+		if err := transactionData.AddInputFrom(u.TxID, u.Vout, clientScript.String(), u.Value, nil); err != nil {
+			return nil, fmt.Errorf("failed to add client input: %w", err)
+		}
+	}
+	for _, u := range p.ServerUTXOs {
+		if err := transactionData.AddInputFrom(u.TxID, u.Vout, serverScript.String(), u.Value, nil); err != nil {
+			return nil, fmt.Errorf("failed to add server input: %w", err)
+		}
+	}
+	for _, input := range transactionData.Inputs {
+		input.UnlockingScript = libs.FakeP2PKHSign()
+	}
+
+	outputMultisigScript, err := libs.Lock([]*ec.PublicKey{p.ServerPublicKey, p.ClientPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multisig locking script: %w", err)
+	}
+	poolAmount := p.ClientAmount + p.ServerAmount
+	transactionData.AddOutput(&tx.TransactionOutput{
+		Satoshis:      poolAmount,
+		LockingScript: outputMultisigScript,
+	})
+
+	clientChange := clientTotal - p.ClientAmount - clientFee
+	if clientChange > 0 {
+		transactionData.AddOutput(&tx.TransactionOutput{Satoshis: clientChange, LockingScript: clientScript})
+	}
+	serverChange := serverTotal - p.ServerAmount - serverFee
+	if serverChange > 0 {
+		transactionData.AddOutput(&tx.TransactionOutput{Satoshis: serverChange, LockingScript: serverScript})
+	}
+
+	return &DualFundedResponse{
+		Tx:           transactionData,
+		Amount:       poolAmount,
+		Index:        0,
+		Fee:          fee,
+		ClientChange: clientChange,
+		ServerChange: serverChange,
+	}, nil
+}
+
+// VerifyDualFundedBaseTx 按参数重建 A-Tx，并核对收到的交易除解锁脚本外与之完全一致，
+// 即双方的出资输入、多签输出金额和找零都符合约定。
+func VerifyDualFundedBaseTx(baseTx *tx.Transaction, p DualFundedParams) error {
+	if baseTx == nil {
+		return fmt.Errorf("%w: empty base tx", libs.ErrInvalidTransaction)
+	}
+	expected, err := BuildDualFundedBaseTx(p)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(libs.UnsignedBytes(baseTx), libs.UnsignedBytes(expected.Tx)) {
+		return fmt.Errorf("%w: dual funded base tx does not match the agreed contributions", libs.ErrTransitionMismatch)
+	}
+	return nil
+}
+
+// SignDualFundedBaseTx 核对 A-Tx 后只为签名方自己的输入签名（SIGHASH_ALL|FORKID）。
+// 签名方由私钥对应的公钥确定；若对方已签名，会先验证对方的输入签名。
+func SignDualFundedBaseTx(baseTx *tx.Transaction, p DualFundedParams, privateKey *ec.PrivateKey) (*tx.Transaction, error) {
+	if privateKey == nil {
+		return nil, invalidParams("private key is required")
+	}
+	if err := VerifyDualFundedBaseTx(baseTx, p); err != nil {
+		return nil, err
+	}
+
+	var (
+		party                  libs.Party
+		own, other             []libs.UTXO
+		ownOffset, otherOffset int
+		counterpartyKey        *ec.PublicKey
+		counterpartyParty      libs.Party
+	)
+	switch {
+	case privateKey.PubKey().IsEqual(p.ClientPublicKey):
+		party, own, other = libs.PartyClient, p.ClientUTXOs, p.ServerUTXOs
+		ownOffset, otherOffset = 0, len(p.ClientUTXOs)
+		counterpartyKey, counterpartyParty = p.ServerPublicKey, libs.PartyServer
+	case privateKey.PubKey().IsEqual(p.ServerPublicKey):
+		party, own, other = libs.PartyServer, p.ServerUTXOs, p.ClientUTXOs
+		ownOffset, otherOffset = len(p.ClientUTXOs), 0
+		counterpartyKey, counterpartyParty = p.ClientPublicKey, libs.PartyClient
+	default:
+		return nil, invalidParams("private key belongs to neither party")
+	}
+
+	if err := verifyDualFundedInputs(baseTx, p.Network, other, otherOffset, counterpartyKey, counterpartyParty); err != nil {
+		return nil, err
+	}
+
+	address, err := p.Network.Address(privateKey.PubKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address: %w", err)
+	}
+	lockingScript, err := p2pkh.Lock(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create locking script: %w", err)
+	}
+	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
+	unlocker, err := p2pkh.Unlock(privateKey, &sigHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unlocking script template: %w", err)
+	}
+	for i, u := range own {
+		index := ownOffset + i
+		baseTx.Inputs[index].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: u.Value, LockingScript: lockingScript})
+		unlockingScript, err := unlocker.Sign(baseTx, uint32(index))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s input %d: %w", libs.ErrSigningFailed, party, index, err)
+		}
+		baseTx.Inputs[index].UnlockingScript = unlockingScript
+	}
+
+	libs.Logger().Debug("dual_endpoint: dual funded base tx signed", "party", party, "inputs", len(own))
+	return baseTx, nil
+}
+
+// verifyDualFundedInputs 验证对方已签名的 P2PKH 输入；对方尚未签名（解锁脚本为空）时跳过。
+func verifyDualFundedInputs(baseTx *tx.Transaction, network libs.Network, utxos []libs.UTXO, offset int, pub *ec.PublicKey, party libs.Party) error {
+	address, err := network.Address(pub)
+	if err != nil {
+		return fmt.Errorf("failed to get %s address: %w", party, err)
+	}
+	lockingScript, err := p2pkh.Lock(address)
+	if err != nil {
+		return fmt.Errorf("failed to create %s locking script: %w", party, err)
+	}
+	for i, u := range utxos {
+		index := uint32(offset + i)
+		unlocking := baseTx.Inputs[index].UnlockingScript
+		if unlocking == nil || len(*unlocking) == 0 {
+			continue
+		}
+		chunks, err := unlocking.Chunks()
+		if err != nil || len(chunks) != 2 || !bytes.Equal(chunks[1].Data, pub.Compressed()) {
+			return &libs.SignatureError{Party: party, InputIndex: index, Err: libs.ErrInvalidSignatureFormat}
+		}
+		sig := chunks[0].Data
+		if _, err := verifySignatureWithContext(baseTx, index, lockingScript, u.Value, party, pub, &sig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildDualFundedRefundTX 客户端在 A-Tx 完整签名后构建退款 B-Tx：
+// 服务器输出为其出资金额，客户端输出为其出资金额扣除 B-Tx 手续费，两者都支付到声明的支付脚本。
+func BuildDualFundedRefundTX(baseTx *tx.Transaction, p DualFundedParams, endHeight uint32, clientPrivateKey *ec.PrivateKey) (*SpendResult, error) {
+	if err := requireFullySigned(baseTx); err != nil {
+		return nil, err
+	}
+	if clientPrivateKey == nil || !clientPrivateKey.PubKey().IsEqual(p.ClientPublicKey) {
+		return nil, invalidParams("client private key does not match client public key")
+	}
+	return BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:             baseTx,
+		ServerAmount:       p.ServerAmount,
+		EndHeight:          endHeight,
+		ClientPrivateKey:   clientPrivateKey,
+		ServerPublicKey:    p.ServerPublicKey,
+		Network:            p.Network,
+		FeeRate:            p.FeeRate,
+		ServerPayoutScript: p.ServerPayoutScript,
+		ClientPayoutScript: p.ClientPayoutScript,
+	})
+}
+
+// ServerVerifyDualFundedRefund 服务器在回签退款 B-Tx 前核对：A-Tx 完整且符合约定、
+// 退款交易花费 A-Tx 的多签输出、locktime 等于约定的 endHeight、只支付到声明的支付脚本且服务器输出等于其出资金额，以及客户端签名有效。
+func ServerVerifyDualFundedRefund(refundTx *tx.Transaction, baseTx *tx.Transaction, p DualFundedParams, endHeight uint32, clientSignBytes *[]byte) error {
+	if err := VerifyDualFundedBaseTx(baseTx, p); err != nil {
+		return err
+	}
+	if err := requireFullySigned(baseTx); err != nil {
+		return err
+	}
+	if err := verifyDualFundedInputs(baseTx, p.Network, p.ClientUTXOs, 0, p.ClientPublicKey, libs.PartyClient); err != nil {
+		return err
+	}
+	if err := libs.CheckRefundTimelock(refundTx, endHeight); err != nil {
+		return err
+	}
+	return verifyRefundTx(refundTx, baseTx, p.ServerAmount, p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript, clientSignBytes)
+}
+
+// verifyRefundTx 核对退款 B-Tx 花费 baseTx 的多签输出（outputs[0]），
+// 只支付到 [服务器, 客户端] 的支付脚本（为空时为签名公钥的 P2PKH），服务器金额为 serverAmount，且客户端签名有效。
+func verifyRefundTx(
+	refundTx *tx.Transaction,
+	baseTx *tx.Transaction,
+	serverAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	clientPublicKey *ec.PublicKey,
+	serverScript *script.Script,
+	clientScript *script.Script,
+	clientSignBytes *[]byte,
+) error {
+	if refundTx == nil || len(refundTx.Inputs) != 1 {
+		return fmt.Errorf("%w: refund tx must have exactly one input", libs.ErrInvalidTransaction)
+	}
+	input := refundTx.Inputs[0]
+	if input.SourceTXID.String() != baseTx.TxID().String() || input.SourceTxOutIndex != 0 {
+		return fmt.Errorf("%w: refund tx does not spend the pool output", libs.ErrTransitionMismatch)
+	}
+	scripts, err := payoutScripts(serverPublicKey, clientPublicKey, serverScript, clientScript)
+	if err != nil {
+		return err
+	}
+	poolAmount := baseTx.Outputs[0].Satoshis
+	if err := libs.CheckPayoutOutputs(refundTx, scripts, poolAmount); err != nil {
+		return err
+	}
+	amounts, _, err := libs.SplitPayouts(refundTx, scripts)
+	if err != nil {
+		return err
+	}
+	if amounts[0] != serverAmount {
+		return fmt.Errorf("%w: refund pays server %d, expected %d", libs.ErrTransitionMismatch, amounts[0], serverAmount)
+	}
+	if _, err := ServerVerifyClientSpendSig(refundTx, poolAmount, serverPublicKey, clientPublicKey, clientSignBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+func requireFullySigned(baseTx *tx.Transaction) error {
+	if baseTx == nil || len(baseTx.Inputs) == 0 {
+		return fmt.Errorf("%w: empty base tx", libs.ErrInvalidTransaction)
+	}
+	for i, input := range baseTx.Inputs {
+		if input.UnlockingScript == nil || len(*input.UnlockingScript) == 0 {
+			return fmt.Errorf("%w: base tx input %d is not signed yet", libs.ErrInvalidTransaction, i)
+		}
+	}
+	return nil
+}
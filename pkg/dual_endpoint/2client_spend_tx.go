@@ -3,7 +3,6 @@ package chain_utils
 import (
 	"encoding/hex"
 	"fmt"
-	"log"
 
 	script "github.com/bsv-blockchain/go-sdk/script"
 
@@ -27,13 +26,60 @@ func SubBuildDualFeePoolSpendTX(
 	isMain bool,
 	feeRate float64,
 ) (*tx.Transaction, uint64, error) {
+	return SubBuildDualFeePoolSpendTXAt(prevTxId, 0, totalAmount, serverAmount, endHeight, clientPrivateKey, serverPublicKey, isMain, feeRate)
+}
+
+// SubBuildDualFeePoolSpendTXAt 与 SubBuildDualFeePoolSpendTX 相同，但花费 prevTxId 的第 vout 个输出，
+// 用于多签输出不在 0 号位置的 A-Tx（例如批量开池）。
+func SubBuildDualFeePoolSpendTXAt(
+	prevTxId string,
+	vout uint32,
+	totalAmount uint64,
+	serverAmount uint64,
+	endHeight uint32,
+	clientPrivateKey *ec.PrivateKey,
+	serverPublicKey *ec.PublicKey,
+	isMain bool,
+	feeRate float64,
+) (*tx.Transaction, uint64, error) {
+	transactionTwo, _, clientAmount, err := subBuildDualFeePoolSpendTX(&SpendParams{
+		PrevTxID:         prevTxId,
+		PoolVout:         vout,
+		TotalAmount:      totalAmount,
+		ServerAmount:     serverAmount,
+		EndHeight:        endHeight,
+		ClientPrivateKey: clientPrivateKey,
+		ServerPublicKey:  serverPublicKey,
+		Network:          libs.NetworkFromIsMain(isMain),
+		Dust:             libs.DustPolicy{Action: libs.DustKeepZero},
+	}, feeRate, nil)
+	return transactionTwo, clientAmount, err
+}
+
+// poolSpend 描述 B-Tx 花费的非多签池输出：锁定脚本与估算手续费用的占位解锁脚本。
+type poolSpend struct {
+	lockingScript *script.Script
+	placeholder   *script.Script
+}
+
+// subBuildDualFeePoolSpendTX 按给定费率构建 B-Tx，不校验参数，p.FeeRate 不参与计算。p.ServerAmount 为扣费前服务器金额，
+// 手续费按 p.FeePolicy 在双方之间分摊，扣费后的支付输出按 p.Dust 布局。支付脚本为空时使用签名公钥的 P2PKH；
+// p.Commitment 不为空时在末尾附加承诺输出，其大小计入手续费。pool 为空时花费双方的 2-of-2 多签，
+// 否则花费 pool 描述的池输出（两方 ECDSA、契约模式）。返回交易、手续费与客户端输出金额。
+func subBuildDualFeePoolSpendTX(p *SpendParams, feeRate float64, pool *poolSpend) (*tx.Transaction, uint64, uint64, error) {
+	prevTxId, vout, totalAmount, serverAmount, endHeight := p.prevTxID(), p.PoolVout, p.TotalAmount, p.ServerAmount, p.EndHeight
+	clientPrivateKey, serverPublicKey, isMain := p.ClientPrivateKey, p.ServerPublicKey, p.Network.IsMain()
+	feePolicy, dust, commitment := p.FeePolicy, p.Dust, p.Commitment
+	if serverAmount > totalAmount {
+		return nil, 0, 0, fmt.Errorf("server amount: %w", &libs.InsufficientFundsError{Need: serverAmount, Have: totalAmount})
+	}
 	clientAddress, err := libs.GetAddressFromPublicKey(clientPrivateKey.PubKey(), isMain)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get client address: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to get client address: %w", err)
 	}
 	serverAddress, err := libs.GetAddressFromPublicKey(serverPublicKey, isMain)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get server address: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to get server address: %w", err)
 	}
 
 	// 生成公钥
@@ -43,28 +89,33 @@ func SubBuildDualFeePoolSpendTX(
 	transactionTwo.LockTime = endHeight
 
 	// 创建初始交易的锁定脚本
-	prevMultisigScript, err := libs.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create server locking script: %w", err)
+	var prevMultisigScript *script.Script
+	if pool != nil {
+		prevMultisigScript = pool.lockingScript
+	} else {
+		prevMultisigScript, err = libs.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to create server locking script: %w", err)
+		}
 	}
 	prevMultisigTxLockingAsm := hex.EncodeToString(prevMultisigScript.Bytes())
 
 	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
 	aMultisigUnlockingScriptTemplate, err := libs.Unlock([]*ec.PrivateKey{}, []*ec.PublicKey{serverPublicKey, clientPublicKey}, 2, &sigHash)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create unlocking script template: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create unlocking script template: %w", err)
 	}
 
 	// 添加所有UTXO作为输入
 	err = transactionTwo.AddInputFrom(
 		prevTxId,
-		0,
+		vout,
 		prevMultisigTxLockingAsm,
 		totalAmount,
 		aMultisigUnlockingScriptTemplate,
 	)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to add input: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to add input: %w", err)
 	}
 	transactionTwo.Inputs[0].SequenceNumber = 1
 
@@ -75,7 +126,10 @@ func SubBuildDualFeePoolSpendTX(
 	// }
 	serverChangeScript, err := p2pkh.Lock(serverAddress)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create change locking script: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create change locking script: %w", err)
+	}
+	if p.ServerPayoutScript != nil {
+		serverChangeScript = p.ServerPayoutScript
 	}
 
 	// 添加服务器输出
@@ -91,7 +145,10 @@ func SubBuildDualFeePoolSpendTX(
 	// }
 	clientChangeScript, err := p2pkh.Lock(clientAddress)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create change locking script: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create change locking script: %w", err)
+	}
+	if p.ClientPayoutScript != nil {
+		clientChangeScript = p.ClientPayoutScript
 	}
 
 	// 添加客户端输出
@@ -100,10 +157,20 @@ func SubBuildDualFeePoolSpendTX(
 		LockingScript: clientChangeScript,
 	})
 
+	// 承诺输出在估算手续费前加入
+	if commitment != nil {
+		transactionTwo.AddOutput(commitment.Output())
+	}
+
 	// 做一个假的签名script，方便计算 size
-	unlockingScript, err := libs.FakeSign(2)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to sign input %d: %w", 1, err)
+	var unlockingScript *script.Script
+	if pool != nil {
+		unlockingScript = pool.placeholder
+	} else {
+		unlockingScript, err = libs.FakeSign(2)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to build placeholder unlocking script: %w", err)
+		}
 	}
 	transactionTwo.Inputs[0].UnlockingScript = unlockingScript
 
@@ -112,25 +179,56 @@ func SubBuildDualFeePoolSpendTX(
 
 	// 基于大小计算费用（向上取整到最接近的KB）
 	fee := uint64(float64(txSize) / 1000.0 * feeRate)
-	if totalAmount < serverAmount+fee {
-		return nil, 0, fmt.Errorf("not enough balance, need %d (serverAmount %d + fee %d), have %d", serverAmount+fee, serverAmount, fee, totalAmount)
-	}
 	if fee == 0 {
 		fee = 1
 	}
+	serverOut, clientOut, err := feePolicy.ApplyDust(serverAmount, totalAmount-serverAmount, fee, dust)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("fee %d (%s): %w", fee, feePolicy, err)
+	}
 
-	// 更新找零输出的金额
-	transactionTwo.Outputs[1].Satoshis = totalAmount - serverAmount - fee
+	// 按策略扣费后按粉尘策略重新布局双方输出，默认布局保持 [服务器, 客户端] 两个输出
+	transactionTwo.Outputs, err = dust.Layout([]libs.Payout{
+		{Party: libs.PartyServer, Amount: serverOut, LockingScript: serverChangeScript},
+		{Party: libs.PartyClient, Amount: clientOut, LockingScript: clientChangeScript},
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	clientOut = libs.PayoutAmount(transactionTwo, clientChangeScript)
+	if commitment != nil {
+		transactionTwo.AddOutput(commitment.Output())
+	}
 
 	// 清空假解锁脚本，防止广播时出现非规范 DER 签名错误，后续由真实签名填充
 	transactionTwo.Inputs[0].UnlockingScript = script.NewFromBytes([]byte{})
 
 	// transactionTwo.Inputs[0].UnlockingScript = serverSignByte
 
-	return transactionTwo, totalAmount - serverAmount - fee, nil
+	libs.Logger().Debug("dual_endpoint: spend tx built",
+		"prev_txid", prevTxId,
+		"vout", vout,
+		"locktime", endHeight,
+		"sequence", transactionTwo.Inputs[0].SequenceNumber,
+		"server_amount", serverOut,
+		"client_amount", clientOut,
+		"fee", fee,
+		"fee_policy", feePolicy.String(),
+		"outputs", len(transactionTwo.Outputs),
+	)
+
+	return transactionTwo, fee, clientOut, nil
 }
 
 func SpendTXDualFeePoolClientSign(B_Tx *tx.Transaction, targetAmount uint64, clientPrivKey *ec.PrivateKey, serverPublicKey *ec.PublicKey) (*[]byte, error) {
+	return SpendTXDualFeePoolClientSignAt(B_Tx, 0, targetAmount, clientPrivKey, serverPublicKey)
+}
+
+// SpendTXDualFeePoolClientSignAt 与 SpendTXDualFeePoolClientSign 相同，但为第 inputIndex 个输入签名。
+func SpendTXDualFeePoolClientSignAt(B_Tx *tx.Transaction, inputIndex uint32, targetAmount uint64, clientPrivKey *ec.PrivateKey, serverPublicKey *ec.PublicKey) (*[]byte, error) {
+	if B_Tx == nil || int(inputIndex) >= len(B_Tx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", libs.ErrInvalidTransaction, inputIndex)
+	}
 	// transactionTwo, err := tx.NewTransactionFromHex(txHex)
 	// if err != nil {
 	// 	return nil, fmt.Errorf("无法从 hex 创建交易: %v", err)
@@ -139,11 +237,11 @@ func SpendTXDualFeePoolClientSign(B_Tx *tx.Transaction, targetAmount uint64, cli
 	// 创建优先级脚本
 	priorityScript, err := libs.Lock([]*ec.PublicKey{serverPublicKey, clientPrivKey.PubKey()}, 2)
 	if err != nil {
-		return nil, fmt.Errorf("创建优先级脚本失败: %v", err)
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
 	}
 
 	// 设置输入的锁定脚本
-	B_Tx.Inputs[0].SetSourceTxOutput(
+	B_Tx.Inputs[inputIndex].SetSourceTxOutput(
 		&tx.TransactionOutput{
 			Satoshis:      targetAmount,
 			LockingScript: priorityScript,
@@ -154,20 +252,23 @@ func SpendTXDualFeePoolClientSign(B_Tx *tx.Transaction, targetAmount uint64, cli
 	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
 	aMultisigUnlockingScriptTemplate, err := multisig.Unlock([]*ec.PrivateKey{clientPrivKey}, []*ec.PublicKey{serverPublicKey, clientPrivKey.PubKey()}, 2, &sigHash)
 	if err != nil {
-		return nil, fmt.Errorf("创建解锁脚本失败: %v", err)
+		return nil, fmt.Errorf("failed to create unlocking script template: %w", err)
 	}
 
 	// 重新签名所有输入
-	serverSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(B_Tx, 0, clientPrivKey)
+	serverSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(B_Tx, inputIndex, clientPrivKey)
 	if err != nil {
-		return nil, fmt.Errorf("a 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: client input %d: %w", libs.ErrSigningFailed, inputIndex, err)
 	}
+
+	libs.Logger().Debug("dual_endpoint: client signed spend tx", "txid", B_Tx.TxID().String(), "input", inputIndex)
 	return serverSignByte, nil
 }
 
 // 构建双端费用池花费交易
 // 发起者 utxos, 服务器提供金额， 发起者私钥， 服务器地址
-// fee 是 server 提供，我只负责精确的金额
+// 手续费从客户端输出中扣除；V2 可通过 SpendParams.FeePolicy 选择其他分摊方式
+// 位置参数版本，保留兼容：不做 V2 的参数校验，totalAmount 与 feeRate 原样使用。
 func BuildDualFeePoolSpendTX(
 	A_Tx *tx.Transaction,
 	totalAmount uint64, // UTXO 总金额
@@ -178,19 +279,42 @@ func BuildDualFeePoolSpendTX(
 	isMain bool,
 	feeRate float64,
 ) (*tx.Transaction, *[]byte, uint64, error) {
-
+	if A_Tx == nil || clientPrivateKey == nil || serverPublicKey == nil {
+		return nil, nil, 0, invalidParams("base tx, client private key and server public key are required")
+	}
 	txTwo, amount, err := SubBuildDualFeePoolSpendTX(A_Tx.TxID().String(), totalAmount, serverAmount, endHeight, clientPrivateKey, serverPublicKey, isMain, feeRate)
 	if err != nil {
-		log.Printf("BuildOneB error: %v", err)
+		libs.Logger().Debug("dual_endpoint: build spend tx failed", "error", err)
 		return nil, nil, 0, err
 	}
 
 	// 重新签名
 	clientSignByte, err := SpendTXDualFeePoolClientSign(txTwo, totalAmount, clientPrivateKey, serverPublicKey)
 	if err != nil {
-		log.Printf("BuildOneC error: %v", err)
+		libs.Logger().Debug("dual_endpoint: client sign spend tx failed", "error", err)
 		return nil, nil, 0, err
 	}
-
 	return txTwo, clientSignByte, amount, nil
 }
+
+// BuildDualFeePoolSpendTXV2 构建初始 B-Tx 并返回客户端签名。
+func BuildDualFeePoolSpendTXV2(p SpendParams) (*SpendResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	txTwo, fee, amount, err := subBuildDualFeePoolSpendTX(&p, feeRateOrDefault(p.FeeRate), nil)
+	if err != nil {
+		libs.Logger().Debug("dual_endpoint: build spend tx failed", "error", err)
+		return nil, err
+	}
+
+	// 重新签名
+	clientSignByte, err := SpendTXDualFeePoolClientSign(txTwo, p.TotalAmount, p.ClientPrivateKey, p.ServerPublicKey)
+	if err != nil {
+		libs.Logger().Debug("dual_endpoint: client sign spend tx failed", "error", err)
+		return nil, err
+	}
+
+	return &SpendResult{Tx: txTwo, ClientSignBytes: clientSignByte, Amount: amount, Fee: fee, ServerPayout: p.ServerPayout, ClientPayout: p.ClientPayout}, nil
+}
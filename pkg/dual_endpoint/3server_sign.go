@@ -18,16 +18,30 @@ func SpendTXServerSign(
 	serverPrivateKey *ec.PrivateKey,
 	clientPublicKey *ec.PublicKey,
 ) (*[]byte, error) {
+	return SpendTXServerSignAt(transactionObject, 0, targetAmount, serverPrivateKey, clientPublicKey)
+}
+
+// SpendTXServerSignAt 与 SpendTXServerSign 相同，但为第 inputIndex 个输入签名。
+func SpendTXServerSignAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	targetAmount uint64,
+	serverPrivateKey *ec.PrivateKey,
+	clientPublicKey *ec.PublicKey,
+) (*[]byte, error) {
+	if transactionObject == nil || int(inputIndex) >= len(transactionObject.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
 	serverPublicKey := serverPrivateKey.PubKey()
 
 	// 创建优先级脚本
 	priorityScript, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
 	if err != nil {
-		return nil, fmt.Errorf("创建优先级脚本失败: %v", err)
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
 	}
 
 	// 设置输入的锁定脚本
-	transactionObject.Inputs[0].SetSourceTxOutput(
+	transactionObject.Inputs[inputIndex].SetSourceTxOutput(
 		&tx.TransactionOutput{
 			Satoshis:      targetAmount,
 			LockingScript: priorityScript,
@@ -41,10 +55,12 @@ func SpendTXServerSign(
 	}
 
 	// 重新签名所有输入
-	serverSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(transactionObject, 0, serverPrivateKey)
+	serverSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(transactionObject, inputIndex, serverPrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("b 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: server input %d: %w", multisig.ErrSigningFailed, inputIndex, err)
 	}
 
+	multisig.Logger().Debug("dual_endpoint: server signed spend tx", "txid", transactionObject.TxID().String(), "input", inputIndex)
+
 	return serverSignByte, nil
 }
@@ -17,6 +17,7 @@ import (
 const FINAL_LOCKTIME uint32 = 0xffffffff
 
 // 合成两个签名
+// 位置参数版本，保留兼容：不做 V2 的参数校验，序列号原样写入，targetAmount 只用于签名的来源输出金额。
 func LoadTx(
 	txHex string,
 	locktime *uint32,
@@ -28,23 +29,65 @@ func LoadTx(
 	// serverSignByte *[]byte,
 	// clientSignByte *[]byte,
 ) (*transaction.Transaction, error) {
+	if serverPublicKey == nil || clientPublicKey == nil {
+		return nil, invalidParams("server and client public keys are required")
+	}
+	return loadTx(UpdateParams{
+		TxHex:           txHex,
+		Locktime:        locktime,
+		Sequence:        sequenceNumber,
+		ServerAmount:    serverAmount,
+		ServerPublicKey: serverPublicKey,
+		ClientPublicKey: clientPublicKey,
+		TotalAmount:     targetAmount,
+		Dust:            multisig.DustPolicy{Action: multisig.DustKeepZero},
+	})
+}
+
+// LoadTxV2 从 hex 恢复 B-Tx，设置新的序列号、locktime 与金额分配，返回待双方签名的交易。
+func LoadTxV2(p UpdateParams) (*transaction.Transaction, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return loadTx(p)
+}
+
+// loadTx 是 LoadTxV2 去掉参数校验的部分，供位置参数版本 LoadTx 复用。
+func loadTx(p UpdateParams) (*transaction.Transaction, error) {
+	txHex, locktime, sequenceNumber := p.TxHex, p.Locktime, p.Sequence
+	serverAmount, targetAmount := p.ServerAmount, p.TotalAmount
+	serverPublicKey, clientPublicKey := p.ServerPublicKey, p.ClientPublicKey
+
 	// 恢复 bTx
 	bTx, err := transaction.NewTransactionFromHex(txHex)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: decode tx hex: %w", multisig.ErrInvalidTransaction, err)
+	}
+	if len(multisig.ConditionalOutputs(bTx)) > 0 {
+		return nil, invalidParams("spend tx has a pending conditional payment; settle or cancel it first")
+	}
+	minOutputs := 2
+	if !p.Dust.FixedLayout() {
+		minOutputs = 1
+	}
+	if int(p.InputIndex) >= len(bTx.Inputs) || len(bTx.Outputs) < minOutputs {
+		return nil, fmt.Errorf("%w: expected input %d and %d outputs, got %d inputs and %d outputs", multisig.ErrInvalidTransaction, p.InputIndex, minOutputs, len(bTx.Inputs), len(bTx.Outputs))
 	}
 
 	if locktime != nil {
+		if err := multisig.CheckBlockHeightLocktime(*locktime); err != nil {
+			return nil, err
+		}
 		bTx.LockTime = *locktime
 	}
 
 	// 创建优先级脚本
 	priorityScript, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
 	if err != nil {
-		return nil, fmt.Errorf("创建优先级脚本失败: %v", err)
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
 	}
 
-	bTx.Inputs[0].SetSourceTxOutput(
+	bTx.Inputs[p.InputIndex].SetSourceTxOutput(
 		&tx.TransactionOutput{
 			Satoshis:      targetAmount,
 			LockingScript: priorityScript,
@@ -58,19 +101,111 @@ func LoadTx(
 	// }
 
 	// 更新输入
-	// bTx.Inputs[0].UnlockingScript = unScript
-	bTx.Inputs[0].SequenceNumber = sequenceNumber
+	// bTx.Inputs[p.InputIndex].UnlockingScript = unScript
+	bTx.Inputs[p.InputIndex].SequenceNumber = sequenceNumber
 
 	// 更新输出金额
-	allAmount := bTx.Outputs[0].Satoshis + bTx.Outputs[1].Satoshis
-	bTx.Outputs[0].Satoshis = serverAmount
-	bTx.Outputs[1].Satoshis = allAmount - serverAmount
+	// B-Tx 的手续费在开池时已确定，未显式给出时等于多签总额与输出之和的差，按策略重新分摊
+	fee := p.Fee
+	if fee == 0 {
+		var allAmount uint64
+		for _, out := range bTx.Outputs {
+			allAmount += out.Satoshis
+		}
+		if allAmount > targetAmount {
+			return nil, fmt.Errorf("%w: outputs %d exceed pool amount %d", multisig.ErrInvalidTransaction, allAmount, targetAmount)
+		}
+		fee = targetAmount - allAmount
+	}
+	if serverAmount > targetAmount {
+		return nil, fmt.Errorf("server amount: %w", &multisig.InsufficientFundsError{Need: serverAmount, Have: targetAmount})
+	}
+	serverOut, clientOut, err := p.FeePolicy.ApplyDust(serverAmount, targetAmount-serverAmount, fee, p.Dust)
+	if err != nil {
+		return nil, fmt.Errorf("server amount %d (%s): %w", serverAmount, p.FeePolicy, err)
+	}
+	scripts, err := p.payoutScripts()
+	if err != nil {
+		return nil, err
+	}
+	// 声明了支付脚本时，不接受支付到其他脚本的 B-Tx
+	if p.ServerPayoutScript != nil || p.ClientPayoutScript != nil {
+		if err := multisig.CheckPayoutOutputs(bTx, scripts, targetAmount); err != nil {
+			return nil, err
+		}
+	}
+	if p.Dust.FixedLayout() {
+		bTx.Outputs[0].Satoshis = serverOut
+		bTx.Outputs[1].Satoshis = clientOut
+	} else {
+		// 粉尘布局会重建支付输出：沿用 B-Tx 中已有的支付脚本，被省略的一方取 scripts 中的脚本，
+		// 原有的承诺输出重新附加在末尾
+		_, current, err := multisig.SplitPayouts(bTx, scripts)
+		if err != nil {
+			return nil, err
+		}
+		commitment, hasCommitment := multisig.CommitmentOf(bTx)
+		bTx.Outputs, err = p.Dust.Layout([]multisig.Payout{
+			{Party: multisig.PartyServer, Amount: serverOut, LockingScript: current[0]},
+			{Party: multisig.PartyClient, Amount: clientOut, LockingScript: current[1]},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if hasCommitment {
+			bTx.AddOutput(commitment.Output())
+		}
+	}
+	if p.Commitment != nil {
+		if err := multisig.SetCommitment(bTx, *p.Commitment); err != nil {
+			return nil, err
+		}
+	}
 
-	// fmt.Printf("bTx 2: %s\n", bTx.Hex())
+	multisig.Logger().Debug("dual_endpoint: spend tx loaded for update",
+		"txid", bTx.TxID().String(),
+		"locktime", bTx.LockTime,
+		"sequence", sequenceNumber,
+		"server_amount", serverOut,
+		"client_amount", clientOut,
+		"outputs", len(bTx.Outputs),
+	)
 
 	return bTx, nil
 }
 
+// ValidateUpdateTransition 在签名前校验对方提出的更新：只允许金额与序列号变化，
+// 序列号必须严格递增，输出总额不得增加。它要求输出数量不变，金额为 0 的支付可能出现或消失时
+// （默认粉尘策略）应使用 ValidatePayoutUpdate。
+func ValidateUpdateTransition(prev, next *tx.Transaction) error {
+	return multisig.ValidateSpendTransition(prev, next)
+}
+
+// ValidatePayoutUpdate 校验更新只支付到开池时声明的 [服务器, 客户端] 支付脚本（适用于任意粉尘策略），
+// 输出总额不得超过多签金额减 B-Tx 手续费。p 与构建 next 时传给 LoadTxV2 的参数相同，
+// p.Fee 为 0 时按 prev 推算手续费。
+func ValidatePayoutUpdate(prev, next *tx.Transaction, p UpdateParams) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	scripts, err := p.payoutScripts()
+	if err != nil {
+		return err
+	}
+	fee := p.Fee
+	if fee == 0 && prev != nil {
+		var prevTotal uint64
+		for _, out := range prev.Outputs {
+			prevTotal += out.Satoshis
+		}
+		if prevTotal > p.TotalAmount {
+			return fmt.Errorf("%w: outputs %d exceed pool amount %d", multisig.ErrInvalidTransaction, prevTotal, p.TotalAmount)
+		}
+		fee = p.TotalAmount - prevTotal
+	}
+	return multisig.ValidatePayoutTransition(prev, next, scripts, p.TotalAmount-fee)
+}
+
 // 双端费用池，分配资金, 客户端签名
 // client -> server 修改金额和版本号
 func ClientDualFeePoolSpendTXUpdateSign(
@@ -78,6 +213,19 @@ func ClientDualFeePoolSpendTXUpdateSign(
 	clientPrivateKey *ec.PrivateKey,
 	serverPublicKey *ec.PublicKey,
 ) (*[]byte, error) {
+	return ClientDualFeePoolSpendTXUpdateSignAt(tx, 0, clientPrivateKey, serverPublicKey)
+}
+
+// ClientDualFeePoolSpendTXUpdateSignAt 与 ClientDualFeePoolSpendTXUpdateSign 相同，但为第 inputIndex 个输入签名。
+func ClientDualFeePoolSpendTXUpdateSignAt(
+	tx *tx.Transaction,
+	inputIndex uint32,
+	clientPrivateKey *ec.PrivateKey,
+	serverPublicKey *ec.PublicKey,
+) (*[]byte, error) {
+	if tx == nil || int(inputIndex) >= len(tx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
 	// if locktime != nil {
 	// 	tx.LockTime = *locktime
 	// }
@@ -89,10 +237,12 @@ func ClientDualFeePoolSpendTXUpdateSign(
 	}
 
 	// 重新签名所有输入
-	clientSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, 0, clientPrivateKey)
+	clientSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, inputIndex, clientPrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("c 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: client input %d: %w", multisig.ErrSigningFailed, inputIndex, err)
 	}
 
+	multisig.Logger().Debug("dual_endpoint: client signed update", "txid", tx.TxID().String(), "sequence", tx.Inputs[inputIndex].SequenceNumber)
+
 	return clientSignByte, nil
 }
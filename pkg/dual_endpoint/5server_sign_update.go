@@ -18,6 +18,19 @@ func ServerDualFeePoolSpendTXUpdateSign(
 	serverPrivateKey *ec.PrivateKey,
 	clientPublicKey *ec.PublicKey,
 ) (*[]byte, error) {
+	return ServerDualFeePoolSpendTXUpdateSignAt(tx, 0, serverPrivateKey, clientPublicKey)
+}
+
+// ServerDualFeePoolSpendTXUpdateSignAt 与 ServerDualFeePoolSpendTXUpdateSign 相同，但为第 inputIndex 个输入签名。
+func ServerDualFeePoolSpendTXUpdateSignAt(
+	tx *tx.Transaction,
+	inputIndex uint32,
+	serverPrivateKey *ec.PrivateKey,
+	clientPublicKey *ec.PublicKey,
+) (*[]byte, error) {
+	if tx == nil || int(inputIndex) >= len(tx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
 	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
 	aMultisigUnlockingScriptTemplate, err := multisig.Unlock([]*ec.PrivateKey{}, []*ec.PublicKey{serverPrivateKey.PubKey(), clientPublicKey}, 2, &sigHash)
 	if err != nil {
@@ -25,10 +38,12 @@ func ServerDualFeePoolSpendTXUpdateSign(
 	}
 
 	// 重新签名所有输入
-	serverSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, 0, serverPrivateKey)
+	serverSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, inputIndex, serverPrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("d 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: server input %d: %w", multisig.ErrSigningFailed, inputIndex, err)
 	}
 
+	multisig.Logger().Debug("dual_endpoint: server signed update", "txid", tx.TxID().String(), "sequence", tx.Inputs[inputIndex].SequenceNumber)
+
 	return serverSignByte, nil
 }
@@ -14,26 +14,28 @@ import (
 
 // verifySignatureWithContext 用于在指定锁定脚本和金额的上下文中验证 DER+SigHash 签名。
 // 调用完成后会恢复输入的 SourceTxOutput，确保交易对象不会被持久修改。
+// 签名本身不合法时返回 *libs.SignatureError，交易上下文不完整时返回 libs.ErrInvalidTransaction。
 func verifySignatureWithContext(
 	transactionObject *tx.Transaction,
 	inputIndex uint32,
 	lockingScript *script.Script,
 	sourceSatoshis uint64,
+	party multisig.Party,
 	pub *ec.PublicKey,
 	signBytes *[]byte,
 ) (bool, error) {
-	if transactionObject == nil || len(transactionObject.Inputs) == 0 {
-		return false, fmt.Errorf("empty transaction or inputs")
+	if transactionObject == nil || int(inputIndex) >= len(transactionObject.Inputs) {
+		return false, fmt.Errorf("%w: empty transaction or inputs", multisig.ErrInvalidTransaction)
 	}
 
 	if signBytes == nil || len(*signBytes) < 10 {
-		return false, fmt.Errorf("invalid signature length")
+		return false, &multisig.SignatureError{Party: party, InputIndex: inputIndex, Err: multisig.ErrInvalidSignatureFormat}
 	}
 
 	// Expected flag
 	flag := sighash.Flag(sighash.ForkID | sighash.All)
 	if (*signBytes)[len(*signBytes)-1] != byte(flag) {
-		return false, fmt.Errorf("unexpected sighash flag")
+		return false, &multisig.SignatureError{Party: party, InputIndex: inputIndex, Err: multisig.ErrUnexpectedSighash}
 	}
 
 	// Backup existing context
@@ -48,14 +50,14 @@ func verifySignatureWithContext(
 	if err != nil {
 		// Restore
 		input.SetSourceTxOutput(prev)
-		return false, fmt.Errorf("calc sighash failed: %w", err)
+		return false, fmt.Errorf("%w: calc sighash: %w", multisig.ErrInvalidTransaction, err)
 	}
 
 	sigDER := (*signBytes)[:len(*signBytes)-1]
 	sig, err := ec.ParseDERSignature(sigDER)
 	if err != nil {
 		input.SetSourceTxOutput(prev)
-		return false, fmt.Errorf("parse der failed: %w", err)
+		return false, &multisig.SignatureError{Party: party, InputIndex: inputIndex, Err: fmt.Errorf("%w: %w", multisig.ErrInvalidSignatureFormat, err)}
 	}
 
 	ok := ecdsa.Verify(hash, sig, pub.ToECDSA())
@@ -63,8 +65,10 @@ func verifySignatureWithContext(
 	// Restore original source output
 	input.SetSourceTxOutput(prev)
 	if !ok {
-		return false, fmt.Errorf("signature verify failed")
+		multisig.Logger().Debug("dual_endpoint: signature rejected", "party", party, "input", inputIndex)
+		return false, &multisig.SignatureError{Party: party, InputIndex: inputIndex}
 	}
+	multisig.Logger().Debug("dual_endpoint: signature verified", "party", party, "input", inputIndex)
 	return true, nil
 }
 
@@ -75,12 +79,24 @@ func ServerVerifyClientSpendSig(
 	serverPublicKey *ec.PublicKey,
 	clientPublicKey *ec.PublicKey,
 	clientSignBytes *[]byte,
+) (bool, error) {
+	return ServerVerifyClientSpendSigAt(transactionObject, 0, totalAmount, serverPublicKey, clientPublicKey, clientSignBytes)
+}
+
+// ServerVerifyClientSpendSigAt 与 ServerVerifyClientSpendSig 相同，但验证第 inputIndex 个输入上的签名。
+func ServerVerifyClientSpendSigAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	totalAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	clientPublicKey *ec.PublicKey,
+	clientSignBytes *[]byte,
 ) (bool, error) {
 	redeem, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
 	if err != nil {
-		return false, fmt.Errorf("build redeem script: %w", err)
+		return false, fmt.Errorf("failed to create redeem script: %w", err)
 	}
-	return verifySignatureWithContext(transactionObject, 0, redeem, totalAmount, clientPublicKey, clientSignBytes)
+	return verifySignatureWithContext(transactionObject, inputIndex, redeem, totalAmount, multisig.PartyClient, clientPublicKey, clientSignBytes)
 }
 
 // ClientVerifyServerSpendSig 用于在 B-Tx 上验证服务器签名。
@@ -90,12 +106,24 @@ func ClientVerifyServerSpendSig(
 	serverPublicKey *ec.PublicKey,
 	clientPublicKey *ec.PublicKey,
 	serverSignBytes *[]byte,
+) (bool, error) {
+	return ClientVerifyServerSpendSigAt(transactionObject, 0, totalAmount, serverPublicKey, clientPublicKey, serverSignBytes)
+}
+
+// ClientVerifyServerSpendSigAt 与 ClientVerifyServerSpendSig 相同，但验证第 inputIndex 个输入上的签名。
+func ClientVerifyServerSpendSigAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	totalAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	clientPublicKey *ec.PublicKey,
+	serverSignBytes *[]byte,
 ) (bool, error) {
 	redeem, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
 	if err != nil {
-		return false, fmt.Errorf("build redeem script: %w", err)
+		return false, fmt.Errorf("failed to create redeem script: %w", err)
 	}
-	return verifySignatureWithContext(transactionObject, 0, redeem, totalAmount, serverPublicKey, serverSignBytes)
+	return verifySignatureWithContext(transactionObject, inputIndex, redeem, totalAmount, multisig.PartyServer, serverPublicKey, serverSignBytes)
 }
 
 // ServerVerifyClientUpdateSig 用于在更新后的 B-Tx 上验证客户端签名。
@@ -104,17 +132,31 @@ func ServerVerifyClientUpdateSig(
 	serverPublicKey *ec.PublicKey,
 	clientPublicKey *ec.PublicKey,
 	clientSignBytes *[]byte,
+) (bool, error) {
+	return ServerVerifyClientUpdateSigAt(transactionObject, 0, serverPublicKey, clientPublicKey, clientSignBytes)
+}
+
+// ServerVerifyClientUpdateSigAt 与 ServerVerifyClientUpdateSig 相同，但验证第 inputIndex 个输入上的签名。
+func ServerVerifyClientUpdateSigAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	serverPublicKey *ec.PublicKey,
+	clientPublicKey *ec.PublicKey,
+	clientSignBytes *[]byte,
 ) (bool, error) {
 	// source satoshis are expected set in input context for updates
-	src := transactionObject.Inputs[0].SourceTxOutput()
+	if transactionObject == nil || int(inputIndex) >= len(transactionObject.Inputs) {
+		return false, fmt.Errorf("%w: empty transaction or inputs", multisig.ErrInvalidTransaction)
+	}
+	src := transactionObject.Inputs[inputIndex].SourceTxOutput()
 	if src == nil {
-		return false, fmt.Errorf("missing source tx output")
+		return false, multisig.ErrMissingSourceOutput
 	}
 	redeem, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
 	if err != nil {
-		return false, fmt.Errorf("build redeem script: %w", err)
+		return false, fmt.Errorf("failed to create redeem script: %w", err)
 	}
-	return verifySignatureWithContext(transactionObject, 0, redeem, src.Satoshis, clientPublicKey, clientSignBytes)
+	return verifySignatureWithContext(transactionObject, inputIndex, redeem, src.Satoshis, multisig.PartyClient, clientPublicKey, clientSignBytes)
 }
 
 // ClientVerifyServerUpdateSig 用于在更新后的 B-Tx 上验证服务器签名。
@@ -124,13 +166,27 @@ func ClientVerifyServerUpdateSig(
 	clientPublicKey *ec.PublicKey,
 	serverSignBytes *[]byte,
 ) (bool, error) {
-	src := transactionObject.Inputs[0].SourceTxOutput()
+	return ClientVerifyServerUpdateSigAt(transactionObject, 0, serverPublicKey, clientPublicKey, serverSignBytes)
+}
+
+// ClientVerifyServerUpdateSigAt 与 ClientVerifyServerUpdateSig 相同，但验证第 inputIndex 个输入上的签名。
+func ClientVerifyServerUpdateSigAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	serverPublicKey *ec.PublicKey,
+	clientPublicKey *ec.PublicKey,
+	serverSignBytes *[]byte,
+) (bool, error) {
+	if transactionObject == nil || int(inputIndex) >= len(transactionObject.Inputs) {
+		return false, fmt.Errorf("%w: empty transaction or inputs", multisig.ErrInvalidTransaction)
+	}
+	src := transactionObject.Inputs[inputIndex].SourceTxOutput()
 	if src == nil {
-		return false, fmt.Errorf("missing source tx output")
+		return false, multisig.ErrMissingSourceOutput
 	}
 	redeem, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
 	if err != nil {
-		return false, fmt.Errorf("build redeem script: %w", err)
+		return false, fmt.Errorf("failed to create redeem script: %w", err)
 	}
-	return verifySignatureWithContext(transactionObject, 0, redeem, src.Satoshis, serverPublicKey, serverSignBytes)
+	return verifySignatureWithContext(transactionObject, inputIndex, redeem, src.Satoshis, multisig.PartyServer, serverPublicKey, serverSignBytes)
 }
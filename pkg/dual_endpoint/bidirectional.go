@@ -0,0 +1,261 @@
+package chain_utils
+
+import (
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 双向模式：B-Tx 的金额可以在两个方向上移动。
+//   - DirectionToServer：客户端付款给服务器，outputs[0] 增加。
+//   - DirectionToClient：服务器退款给客户端（例如任务失败），outputs[1] 增加。
+//
+// 发起规则：默认只有付款方可以发起（谁的余额减少谁提议），收款方只需回签；
+// 某方向设置了 AllowPayee 时收款方也可以发起，此时付款方回签即视为同意。
+// 无论哪个方向，序列号都必须严格递增，输出总额保持不变。
+
+// Direction 表示一次更新中资金移动的方向。
+type Direction uint8
+
+const (
+	DirectionNone Direction = iota
+	DirectionToServer
+	DirectionToClient
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionNone:
+		return "none"
+	case DirectionToServer:
+		return "to-server"
+	case DirectionToClient:
+		return "to-client"
+	}
+	return fmt.Sprintf("direction(%d)", uint8(d))
+}
+
+// Payer 返回该方向上余额减少的一方。
+func (d Direction) Payer() libs.Party {
+	if d == DirectionToClient {
+		return libs.PartyServer
+	}
+	return libs.PartyClient
+}
+
+// Check 校验 proposer 是否可以发起该方向、金额是否超出单次上限。
+func (p BidirectionalPolicy) Check(proposer libs.Party, direction Direction, amount uint64) error {
+	var limit DirectionLimit
+	switch direction {
+	case DirectionNone:
+		return nil
+	case DirectionToServer:
+		limit = p.ToServer
+	case DirectionToClient:
+		limit = p.ToClient
+	default:
+		return invalidParams("unknown direction %d", uint8(direction))
+	}
+	if proposer != direction.Payer() && !limit.AllowPayee {
+		return fmt.Errorf("%w: %s cannot propose %s updates", libs.ErrDirectionNotAllowed, proposer, direction)
+	}
+	if limit.MaxPerUpdate > 0 && amount > limit.MaxPerUpdate {
+		return fmt.Errorf("%w: %s amount %d, max %d", libs.ErrLimitExceeded, direction, amount, limit.MaxPerUpdate)
+	}
+	return nil
+}
+
+// ClassifyUpdate 校验 prev -> next 的状态迁移并返回资金移动方向与金额。
+// 除 ValidateSpendTransition 的规则外，双向模式要求输出总额不变。
+// 金额为 0 的支付被粉尘策略省略时，用另一笔状态中齐全的 [服务器, 客户端] 支付脚本识别剩下的输出。
+func ClassifyUpdate(prev, next *tx.Transaction) (Direction, uint64, error) {
+	return classifyUpdate(prev, next, nil)
+}
+
+// classifyUpdate 与 ClassifyUpdate 相同，scripts 为 [服务器, 客户端] 的支付脚本；
+// prev 的支付输出齐全时以 prev 为准，scripts 为 nil 时取 next 中齐全的支付脚本。
+func classifyUpdate(prev, next *tx.Transaction, scripts []*script.Script) (Direction, uint64, error) {
+	if prev == nil || next == nil {
+		return DirectionNone, 0, fmt.Errorf("%w: nil transaction", libs.ErrInvalidTransaction)
+	}
+	prevOutputs, nextOutputs := libs.PayoutOutputs(prev), libs.PayoutOutputs(next)
+	switch {
+	case len(prevOutputs) == 2:
+		scripts = []*script.Script{prevOutputs[0].LockingScript, prevOutputs[1].LockingScript}
+	case scripts == nil && len(nextOutputs) == 2:
+		scripts = []*script.Script{nextOutputs[0].LockingScript, nextOutputs[1].LockingScript}
+	}
+
+	var prevTotal, nextTotal uint64
+	for _, out := range prevOutputs {
+		prevTotal += out.Satoshis
+	}
+	for _, out := range nextOutputs {
+		nextTotal += out.Satoshis
+	}
+	if len(prevOutputs) == len(nextOutputs) {
+		if err := libs.ValidateSpendTransition(prev, next); err != nil {
+			return DirectionNone, 0, err
+		}
+	} else if scripts == nil {
+		return DirectionNone, 0, fmt.Errorf("%w: output count %d -> %d", libs.ErrTransitionMismatch, len(prev.Outputs), len(next.Outputs))
+	} else {
+		// 输出数量变化时两笔状态都必须只支付到 scripts
+		if err := libs.CheckPayoutOutputs(prev, scripts, prevTotal); err != nil {
+			return DirectionNone, 0, err
+		}
+		if err := libs.ValidatePayoutTransition(prev, next, scripts, prevTotal); err != nil {
+			return DirectionNone, 0, err
+		}
+	}
+	if prevTotal != nextTotal {
+		return DirectionNone, 0, fmt.Errorf("%w: output total %d -> %d", libs.ErrTransitionMismatch, prevTotal, nextTotal)
+	}
+	if scripts == nil {
+		// 前后都只有同一个支付输出且金额不变
+		return DirectionNone, 0, nil
+	}
+
+	prevAmounts, _, err := libs.SplitPayouts(prev, scripts)
+	if err != nil {
+		return DirectionNone, 0, err
+	}
+	nextAmounts, _, err := libs.SplitPayouts(next, scripts)
+	if err != nil {
+		return DirectionNone, 0, err
+	}
+	prevServer, nextServer := prevAmounts[0], nextAmounts[0]
+	switch {
+	case nextServer > prevServer:
+		return DirectionToServer, nextServer - prevServer, nil
+	case nextServer < prevServer:
+		return DirectionToClient, prevServer - nextServer, nil
+	}
+	return DirectionNone, 0, nil
+}
+
+// ProposeBidirectionalUpdate 发起方基于最近一次双方签名的 B-Tx 构建新状态并签名。
+func ProposeBidirectionalUpdate(p BidirectionalUpdateParams) (*tx.Transaction, *[]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := p.Policy.Check(p.Proposer, p.Direction, p.Amount); err != nil {
+		return nil, nil, err
+	}
+
+	serverPublicKey, clientPublicKey := p.CounterpartyPublicKey, p.ProposerPrivateKey.PubKey()
+	if p.Proposer == libs.PartyServer {
+		serverPublicKey, clientPublicKey = clientPublicKey, serverPublicKey
+	}
+	scripts, err := payoutScripts(serverPublicKey, clientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	amounts, _, err := libs.SplitPayouts(p.Prev, scripts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverAmount, clientAmount := amounts[0], amounts[1]
+	if p.Direction == DirectionToServer {
+		if p.Amount > clientAmount {
+			return nil, nil, fmt.Errorf("client balance: %w", &libs.InsufficientFundsError{Need: p.Amount, Have: clientAmount})
+		}
+		serverAmount += p.Amount
+	} else {
+		if p.Amount > serverAmount {
+			return nil, nil, fmt.Errorf("server balance: %w", &libs.InsufficientFundsError{Need: p.Amount, Have: serverAmount})
+		}
+		serverAmount -= p.Amount
+	}
+
+	next, err := LoadTxV2(UpdateParams{
+		TxHex:              p.Prev.Hex(),
+		Locktime:           p.Locktime,
+		Sequence:           p.Sequence,
+		ServerAmount:       serverAmount,
+		ServerPublicKey:    serverPublicKey,
+		ClientPublicKey:    clientPublicKey,
+		TotalAmount:        p.TotalAmount,
+		ServerPayoutScript: p.ServerPayoutScript,
+		ClientPayoutScript: p.ClientPayoutScript,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, _, err := classifyUpdate(p.Prev, next, scripts); err != nil {
+		return nil, nil, err
+	}
+
+	var signBytes *[]byte
+	if p.Proposer == libs.PartyClient {
+		signBytes, err = ClientDualFeePoolSpendTXUpdateSign(next, p.ProposerPrivateKey, serverPublicKey)
+	} else {
+		signBytes, err = ServerDualFeePoolSpendTXUpdateSign(next, p.ProposerPrivateKey, clientPublicKey)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	libs.Logger().Debug("dual_endpoint: bidirectional update proposed",
+		"proposer", p.Proposer,
+		"direction", p.Direction.String(),
+		"amount", p.Amount,
+		"sequence", p.Sequence,
+	)
+	return next, signBytes, nil
+}
+
+// AcceptBidirectionalUpdate 接收方核对状态迁移、发起规则与限额，验证发起方签名后回签。
+// 返回资金移动方向、金额与接收方签名。
+func AcceptBidirectionalUpdate(p BidirectionalAcceptParams) (Direction, uint64, *[]byte, error) {
+	if err := p.Validate(); err != nil {
+		return DirectionNone, 0, nil, err
+	}
+	serverPublicKey, clientPublicKey := p.AcceptorPrivateKey.PubKey(), p.ProposerPublicKey
+	if p.Proposer == libs.PartyServer {
+		serverPublicKey, clientPublicKey = clientPublicKey, serverPublicKey
+	}
+	// 被省略的支付重新出现时，只接受支付到声明的脚本或签名公钥的 P2PKH
+	scripts, err := payoutScripts(serverPublicKey, clientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+	if err != nil {
+		return DirectionNone, 0, nil, err
+	}
+	direction, amount, err := classifyUpdate(p.Prev, p.Next, scripts)
+	if err != nil {
+		return DirectionNone, 0, nil, err
+	}
+	if err := p.Policy.Check(p.Proposer, direction, amount); err != nil {
+		return DirectionNone, 0, nil, err
+	}
+	redeem, err := libs.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
+	if err != nil {
+		return DirectionNone, 0, nil, fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	p.Next.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: p.TotalAmount, LockingScript: redeem})
+	if _, err := verifySignatureWithContext(p.Next, 0, redeem, p.TotalAmount, p.Proposer, p.ProposerPublicKey, p.ProposerSignBytes); err != nil {
+		return DirectionNone, 0, nil, err
+	}
+
+	var signBytes *[]byte
+	if p.Proposer == libs.PartyClient {
+		signBytes, err = ServerDualFeePoolSpendTXUpdateSign(p.Next, p.AcceptorPrivateKey, clientPublicKey)
+	} else {
+		signBytes, err = ClientDualFeePoolSpendTXUpdateSign(p.Next, p.AcceptorPrivateKey, serverPublicKey)
+	}
+	if err != nil {
+		return DirectionNone, 0, nil, err
+	}
+
+	libs.Logger().Debug("dual_endpoint: bidirectional update accepted",
+		"proposer", p.Proposer,
+		"direction", direction.String(),
+		"amount", amount,
+		"sequence", p.Next.Inputs[0].SequenceNumber,
+	)
+	return direction, amount, signBytes, nil
+}
@@ -0,0 +1,224 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 双向更新：付款方发起，序列号在两个方向上都严格递增，并执行单次限额。
+func TestDualBidirectionalUpdates(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	prevTxID := "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	const total = uint64(50000)
+
+	bTx, _, err := SubBuildDualFeePoolSpendTX(prevTxID, total, 0, 800000, clientPriv, serverPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	policy := BidirectionalPolicy{ToClient: DirectionLimit{MaxPerUpdate: 500}}
+
+	// 客户端付款给服务器
+	next, clientSig, err := ProposeBidirectionalUpdate(BidirectionalUpdateParams{
+		Prev: bTx, TotalAmount: total, Proposer: libs.PartyClient, Direction: DirectionToServer, Amount: 3000,
+		ProposerPrivateKey: clientPriv, CounterpartyPublicKey: serverPriv.PubKey(), Policy: policy,
+	})
+	if err != nil {
+		t.Fatalf("propose to server: %v", err)
+	}
+	wire, _ := tx.NewTransactionFromHex(next.Hex())
+	dir, amount, _, err := AcceptBidirectionalUpdate(BidirectionalAcceptParams{
+		Prev: bTx, Next: wire, TotalAmount: total, Proposer: libs.PartyClient, ProposerSignBytes: clientSig,
+		ProposerPublicKey: clientPriv.PubKey(), AcceptorPrivateKey: serverPriv, Policy: policy,
+	})
+	if err != nil || dir != DirectionToServer || amount != 3000 {
+		t.Fatalf("accept to server: %v %v %d", err, dir, amount)
+	}
+
+	// 服务器退款给客户端，序列号继续递增
+	refund, serverSig, err := ProposeBidirectionalUpdate(BidirectionalUpdateParams{
+		Prev: wire, TotalAmount: total, Proposer: libs.PartyServer, Direction: DirectionToClient, Amount: 400,
+		ProposerPrivateKey: serverPriv, CounterpartyPublicKey: clientPriv.PubKey(), Policy: policy,
+	})
+	if err != nil {
+		t.Fatalf("propose refund: %v", err)
+	}
+	if refund.Inputs[0].SequenceNumber != 3 || refund.Outputs[0].Satoshis != 2600 {
+		t.Fatalf("unexpected refund state seq=%d server=%d", refund.Inputs[0].SequenceNumber, refund.Outputs[0].Satoshis)
+	}
+	if _, _, _, err := AcceptBidirectionalUpdate(BidirectionalAcceptParams{
+		Prev: wire, Next: refund, TotalAmount: total, Proposer: libs.PartyServer, ProposerSignBytes: serverSig,
+		ProposerPublicKey: serverPriv.PubKey(), AcceptorPrivateKey: clientPriv, Policy: policy,
+	}); err != nil {
+		t.Fatalf("accept refund: %v", err)
+	}
+
+	// 超过退款单次上限
+	_, _, err = ProposeBidirectionalUpdate(BidirectionalUpdateParams{
+		Prev: wire, TotalAmount: total, Proposer: libs.PartyServer, Direction: DirectionToClient, Amount: 600,
+		ProposerPrivateKey: serverPriv, CounterpartyPublicKey: clientPriv.PubKey(), Policy: policy,
+	})
+	if !errors.Is(err, libs.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	// 服务器不能替客户端发起付款
+	_, _, err = ProposeBidirectionalUpdate(BidirectionalUpdateParams{
+		Prev: wire, TotalAmount: total, Proposer: libs.PartyServer, Direction: DirectionToServer, Amount: 100,
+		ProposerPrivateKey: serverPriv, CounterpartyPublicKey: clientPriv.PubKey(), Policy: policy,
+	})
+	if !errors.Is(err, libs.ErrDirectionNotAllowed) {
+		t.Fatalf("expected ErrDirectionNotAllowed, got %v", err)
+	}
+
+	// 重放旧序列号会被拒绝
+	if _, _, err := ClassifyUpdate(refund, wire); !errors.Is(err, libs.ErrSequenceRegression) {
+		t.Fatalf("expected ErrSequenceRegression, got %v", err)
+	}
+
+	// 序列号耗尽：默认的 prev+1 不能达到 final，否则该状态可立即广播
+	last := wire.ShallowClone()
+	last.Inputs[0].SequenceNumber = libs.FinalSequence - 1
+	_, _, err = ProposeBidirectionalUpdate(BidirectionalUpdateParams{
+		Prev: last, TotalAmount: total, Proposer: libs.PartyClient, Direction: DirectionToServer, Amount: 100,
+		ProposerPrivateKey: clientPriv, CounterpartyPublicKey: serverPriv.PubKey(), Policy: policy,
+	})
+	if !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a final sequence, got %v", err)
+	}
+	final := wire.ShallowClone()
+	final.Inputs[0].SequenceNumber = libs.FinalSequence
+	if _, _, err := ClassifyUpdate(last, final); !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for a final sequence, got %v", err)
+	}
+}
+
+// 双向更新从省略服务器输出的开池状态开始：服务器输出出现与再次省略都能被接受，重新出现的输出支付到他人脚本时被拒绝。
+func TestDualBidirectionalOmittedPayout(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	otherPriv, _ := ec.PrivateKeyFromHex("1c4f0a2a6b5d3e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f7")
+	const total = uint64(50000)
+
+	open, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		PrevTxID:         "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		TotalAmount:      total,
+		EndHeight:        800000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		FeeRate:          0.5,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if len(open.Tx.Outputs) != 1 {
+		t.Fatalf("expected the 0-sat server output to be omitted, got %d outputs", len(open.Tx.Outputs))
+	}
+
+	// 客户端付款后服务器输出出现
+	next, clientSig, err := ProposeBidirectionalUpdate(BidirectionalUpdateParams{
+		Prev: open.Tx, TotalAmount: total, Proposer: libs.PartyClient, Direction: DirectionToServer, Amount: 3000,
+		ProposerPrivateKey: clientPriv, CounterpartyPublicKey: serverPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("propose to server: %v", err)
+	}
+	if len(next.Outputs) != 2 || next.Outputs[0].Satoshis != 3000 {
+		t.Fatalf("expected the server output to appear with 3000, got %d outputs", len(next.Outputs))
+	}
+	wire, _ := tx.NewTransactionFromHex(next.Hex())
+	dir, amount, _, err := AcceptBidirectionalUpdate(BidirectionalAcceptParams{
+		Prev: open.Tx, Next: wire, TotalAmount: total, Proposer: libs.PartyClient, ProposerSignBytes: clientSig,
+		ProposerPublicKey: clientPriv.PubKey(), AcceptorPrivateKey: serverPriv,
+	})
+	if err != nil || dir != DirectionToServer || amount != 3000 {
+		t.Fatalf("accept to server: %v %v %d", err, dir, amount)
+	}
+
+	// 服务器全额退款后服务器输出再次省略
+	refund, serverSig, err := ProposeBidirectionalUpdate(BidirectionalUpdateParams{
+		Prev: wire, TotalAmount: total, Proposer: libs.PartyServer, Direction: DirectionToClient, Amount: 3000,
+		ProposerPrivateKey: serverPriv, CounterpartyPublicKey: clientPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("propose refund: %v", err)
+	}
+	if len(refund.Outputs) != 1 || refund.Outputs[0].Satoshis != open.Amount {
+		t.Fatalf("expected a single client output after a full refund, got %d outputs", len(refund.Outputs))
+	}
+	if dir, amount, _, err := AcceptBidirectionalUpdate(BidirectionalAcceptParams{
+		Prev: wire, Next: refund, TotalAmount: total, Proposer: libs.PartyServer, ProposerSignBytes: serverSig,
+		ProposerPublicKey: serverPriv.PubKey(), AcceptorPrivateKey: clientPriv,
+	}); err != nil || dir != DirectionToClient || amount != 3000 {
+		t.Fatalf("accept refund: %v %v %d", err, dir, amount)
+	}
+
+	// 重新出现的服务器输出支付到他人脚本
+	otherScripts, _ := PayoutScripts(otherPriv.PubKey(), clientPriv.PubKey())
+	forged, _ := tx.NewTransactionFromHex(next.Hex())
+	forged.Outputs[0].LockingScript = otherScripts[0]
+	if _, _, _, err := AcceptBidirectionalUpdate(BidirectionalAcceptParams{
+		Prev: open.Tx, Next: forged, TotalAmount: total, Proposer: libs.PartyClient, ProposerSignBytes: clientSig,
+		ProposerPublicKey: clientPriv.PubKey(), AcceptorPrivateKey: serverPriv,
+	}); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for a foreign payout script, got %v", err)
+	}
+}
+
+// 非最终序列号的更新不能改变 locktime：设为 0xffffffff 的状态要到 2106 年才能上链，对方可在到期时广播旧状态。
+// 关闭交易同时把 locktime 与序列号设为最终值，可以通过校验。
+func TestDualUpdateLocktime(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	const total = uint64(50000)
+
+	bTx, _, err := SubBuildDualFeePoolSpendTX("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", total, 0, 800000, clientPriv, serverPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	final := libs.FinalLocktime
+	stalled, err := LoadTx(bTx.Hex(), &final, 2, 3000, serverPriv.PubKey(), clientPriv.PubKey(), total)
+	if err != nil {
+		t.Fatalf("load stalled update: %v", err)
+	}
+	clientSig, err := ClientDualFeePoolSpendTXUpdateSign(stalled, clientPriv, serverPriv.PubKey())
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+	_, _, _, err = AcceptBidirectionalUpdate(BidirectionalAcceptParams{
+		Prev: bTx, Next: stalled, TotalAmount: total, Proposer: libs.PartyClient, ProposerSignBytes: clientSig,
+		ProposerPublicKey: clientPriv.PubKey(), AcceptorPrivateKey: serverPriv,
+	})
+	if !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange for a non-final update with locktime 0xffffffff, got %v", err)
+	}
+	if err := ValidateUpdateTransition(bTx, stalled); !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange from ValidateUpdateTransition, got %v", err)
+	}
+
+	// 关闭：locktime 与序列号都取最终值
+	closeTx, err := LoadTx(bTx.Hex(), &final, libs.FinalSequence, 3000, serverPriv.PubKey(), clientPriv.PubKey(), total)
+	if err != nil {
+		t.Fatalf("load close: %v", err)
+	}
+	if err := ValidateUpdateTransition(bTx, closeTx); err != nil {
+		t.Fatalf("close must be accepted: %v", err)
+	}
+	clientSig, _ = ClientDualFeePoolSpendTXUpdateSign(closeTx, clientPriv, serverPriv.PubKey())
+	if _, _, _, err := AcceptBidirectionalUpdate(BidirectionalAcceptParams{
+		Prev: bTx, Next: closeTx, TotalAmount: total, Proposer: libs.PartyClient, ProposerSignBytes: clientSig,
+		ProposerPublicKey: clientPriv.PubKey(), AcceptorPrivateKey: serverPriv,
+	}); err != nil {
+		t.Fatalf("accept close: %v", err)
+	}
+	// 已关闭的状态不能再更新
+	after, _ := LoadTx(closeTx.Hex(), nil, 2, 3000, serverPriv.PubKey(), clientPriv.PubKey(), total)
+	if err := ValidateUpdateTransition(closeTx, after); err == nil {
+		t.Fatalf("expected an error for an update after close")
+	}
+}
@@ -0,0 +1,161 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// OP_RETURN 承诺：开池时预留并计入手续费，更新时可以更换承诺，签名覆盖承诺，校验只允许承诺与金额、序列号变化。
+func TestDualCommitment(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	const total = uint64(100000)
+
+	open := func(commitment *libs.Commitment, dust libs.DustPolicy, serverAmount uint64) *SpendResult {
+		t.Helper()
+		res, err := BuildDualFeePoolSpendTXV2(SpendParams{
+			PrevTxID:         "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+			TotalAmount:      total,
+			ServerAmount:     serverAmount,
+			EndHeight:        800000,
+			ClientPrivateKey: clientPriv,
+			ServerPublicKey:  serverPriv.PubKey(),
+			FeeRate:          500,
+			Dust:             dust,
+			Commitment:       commitment,
+		})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		return res
+	}
+	receipt := libs.HashCommitment([]byte("invoice-0001"))
+	plain := open(nil, libs.DustPolicy{}, 10000)
+	res := open(&receipt, libs.DustPolicy{}, 10000)
+	if got, ok := libs.CommitmentOf(res.Tx); !ok || got != receipt || len(res.Tx.Outputs) != 3 || res.Tx.Outputs[2].Satoshis != 0 {
+		t.Fatalf("opening B-Tx must end with the commitment output")
+	}
+	if res.Fee <= plain.Fee {
+		t.Fatalf("commitment output must be accounted for in the fee: %d <= %d", res.Fee, plain.Fee)
+	}
+
+	update := UpdateParams{
+		TxHex:           res.Tx.Hex(),
+		Sequence:        2,
+		ServerAmount:    20000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+	}
+	kept, err := LoadTxV2(update)
+	if err != nil {
+		t.Fatalf("update without new commitment: %v", err)
+	}
+	if got, _ := libs.CommitmentOf(kept); got != receipt {
+		t.Fatalf("update without a new commitment must keep the previous one")
+	}
+
+	next := libs.HashCommitment([]byte("invoice-0002"), []byte{2})
+	update.Commitment = &next
+	updated, err := LoadTxV2(update)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got, _ := libs.CommitmentOf(updated); got != next || updated.Outputs[0].Satoshis != 20000 {
+		t.Fatalf("unexpected updated state")
+	}
+	if err := ValidateUpdateTransition(res.Tx, updated); err != nil {
+		t.Fatalf("transition with new commitment: %v", err)
+	}
+
+	// 签名覆盖承诺：签名后更换承诺会使签名失效
+	clientSig, err := ClientDualFeePoolSpendTXUpdateSign(updated, clientPriv, serverPriv.PubKey())
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+	serverSig, err := ServerDualFeePoolSpendTXUpdateSign(updated, serverPriv, clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	merged, err := MergeDualPoolSigForSpendTx(updated.Hex(), serverSig, clientSig)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	assertDualInputValid(t, merged, 0, updated.Inputs[0].SourceTxOutput())
+	tampered, _ := tx.NewTransactionFromHex(updated.Hex())
+	tampered.Inputs[0].SetSourceTxOutput(updated.Inputs[0].SourceTxOutput())
+	if err := libs.SetCommitment(tampered, receipt); err != nil {
+		t.Fatalf("set commitment: %v", err)
+	}
+	if ok, _ := ServerVerifyClientUpdateSig(tampered, serverPriv.PubKey(), clientPriv.PubKey(), clientSig); ok {
+		t.Fatalf("client signature must not verify after the commitment changed")
+	}
+
+	// 只有承诺可以变化：去掉承诺、承诺带金额、把承诺挪到支付输出位置都被拒绝
+	removed, _ := tx.NewTransactionFromHex(updated.Hex())
+	removed.Outputs = removed.Outputs[:2]
+	if err := ValidateUpdateTransition(res.Tx, removed); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for removed commitment, got %v", err)
+	}
+	funded, _ := tx.NewTransactionFromHex(updated.Hex())
+	funded.Outputs[1].Satoshis -= 10
+	funded.Outputs[2].Satoshis = 10
+	if err := ValidateUpdateTransition(res.Tx, funded); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for funded commitment, got %v", err)
+	}
+	swapped, _ := tx.NewTransactionFromHex(updated.Hex())
+	swapped.Outputs[0] = next.Output()
+	if err := ValidateUpdateTransition(res.Tx, swapped); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for commitment in a payout slot, got %v", err)
+	}
+
+	// 开池时没有承诺输出的池不能在更新中加入承诺（手续费未预留）
+	update.TxHex = plain.Tx.Hex()
+	if _, err := LoadTxV2(update); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams when adding a commitment, got %v", err)
+	}
+
+	// 粉尘布局重建支付输出时承诺仍在末尾
+	drop := libs.DustPolicy{Action: libs.DustDrop}
+	dropped := open(&receipt, drop, 0)
+	if len(dropped.Tx.Outputs) != 2 {
+		t.Fatalf("expected [client, commitment], got %d outputs", len(dropped.Tx.Outputs))
+	}
+	dropUpdate := UpdateParams{
+		TxHex:           dropped.Tx.Hex(),
+		Sequence:        2,
+		ServerAmount:    20000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+		Fee:             dropped.Fee,
+		Dust:            drop,
+		Commitment:      &next,
+	}
+	grown, err := LoadTxV2(dropUpdate)
+	if err != nil {
+		t.Fatalf("dust update: %v", err)
+	}
+	if got, ok := libs.CommitmentOf(grown); !ok || got != next || len(grown.Outputs) != 3 {
+		t.Fatalf("expected [server, client, commitment] after dust update")
+	}
+	if err := ValidatePayoutUpdate(dropped.Tx, grown, dropUpdate); err != nil {
+		t.Fatalf("payout update with commitment: %v", err)
+	}
+
+	// 换池与结算只看支付输出，带承诺的 B-Tx 同样可以换池
+	if _, err := BuildDualRolloverTx(RolloverParams{
+		Latest:          updated,
+		PoolAmount:      total,
+		ClientPublicKey: clientPriv.PubKey(),
+		ServerPublicKey: serverPriv.PubKey(),
+		FeeRate:         50,
+	}); err != nil {
+		t.Fatalf("rollover with commitment: %v", err)
+	}
+}
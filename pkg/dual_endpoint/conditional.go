@@ -0,0 +1,227 @@
+package chain_utils
+
+import (
+	"bytes"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 条件支付：付款方把一笔金额锁进 B-Tx 的条件输出（见 libs.ConditionalLockingScript），
+// 收款方交付原像后才能得到这笔金额，例如按内容原像结算的原子购买。全部状态都走现有的序列号更新流程：
+//  1. 双方用相同参数调用 AddConditionalPayment（或由收款方 VerifyConditionalPayment 核对），得到
+//     加入条件输出的新状态 Add（序列号 n），双方签名后 Add 成为最近状态。
+//  2. 付款方用 libs.BuildConditionalRefundTx 预先签好回退（退款）交易：nLockTime 为 Timeout，
+//     只需付款方自己的签名，Add 的 txid 变化时可以重建。
+//  3. 收款方出示原像，双方签名 SettleConditionalPayment 构建的结清状态（序列号至少 n+1，金额归收款方）；
+//     原像不出现时双方签名 CancelConditionalPayment 构建的取消状态（金额退回付款方）。
+//
+// 链上保障：Timeout 必须晚于池到期高度（B-Tx 的 locktime）。对方不配合结清或取消时，Add 在池到期后上链：
+// 收款方在 Timeout 之前用 libs.BuildConditionalClaimTx 出示原像领取，原像随之公开；
+// 原像没有出现时付款方在 Timeout 之后广播回退交易取回金额。哈希锁与超时都由脚本和共识规则强制，
+// 收款方应确认 Timeout 与池到期高度之间留有足够的区块完成领取。
+// 同一时间只能有一笔未结清的条件支付；期间 LoadTxV2、换池、延期与结算都会拒绝带条件输出的 B-Tx。
+
+// AddConditionalPayment 基于最近一次双方签名的 B-Tx 构建加入条件输出的新状态。
+// 条件输出位于 [服务器, 客户端] 之后、承诺输出之前；付款方余额减少条件金额与条件输出增加的手续费，
+// 减为 0 的支付输出被省略，剩余金额不得低于粉尘限额。
+func AddConditionalPayment(p ConditionalParams) (*ConditionalProposal, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	payerIndex, terms := 1, libs.ConditionalTerms{Hash: p.Hash, Payee: p.ServerPublicKey, Payer: p.ClientPublicKey, Timeout: p.Timeout}
+	if p.Payer == libs.PartyServer {
+		payerIndex, terms.Payee, terms.Payer = 0, p.ClientPublicKey, p.ServerPublicKey
+	}
+	size, err := libs.ConditionalOutputSize(terms)
+	if err != nil {
+		return nil, err
+	}
+	fee := uint64(float64(size) / 1000.0 * feeRateOrDefault(p.FeeRate))
+	if fee == 0 {
+		fee = 1
+	}
+	amounts, scripts, err := statePayouts(p.Prev, p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+	if err != nil {
+		return nil, err
+	}
+	if balance := amounts[payerIndex]; balance < p.Amount+fee {
+		return nil, fmt.Errorf("%s balance: %w", p.Payer, &libs.InsufficientFundsError{Need: p.Amount + fee, Have: balance})
+	}
+	amounts[payerIndex] -= p.Amount + fee
+	if rest := amounts[payerIndex]; rest > 0 && rest < libs.DustLimit {
+		return nil, fmt.Errorf("%s balance: %w", p.Payer, &libs.DustError{Party: p.Payer, Amount: rest, Limit: libs.DustLimit})
+	}
+	lockingScript, err := libs.ConditionalLockingScript(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	add, err := restoreSpendState(p.Prev, p.TotalAmount, p.ServerPublicKey, p.ClientPublicKey, p.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	vout := layoutConditionalState(add, amounts, scripts, &tx.TransactionOutput{Satoshis: p.Amount, LockingScript: lockingScript})
+	if _, _, err := libs.ValidateConditionalTransition(p.Prev, add); err != nil {
+		return nil, err
+	}
+
+	libs.Logger().Debug("dual_endpoint: conditional payment added",
+		"payer", p.Payer,
+		"amount", p.Amount,
+		"fee", fee,
+		"sequence", p.Sequence,
+		"timeout", p.Timeout,
+	)
+	return &ConditionalProposal{Add: add, Vout: vout, Fee: fee}, nil
+}
+
+// VerifyConditionalPayment 收款方签名前核对对方发来的 Add：按相同参数重建后必须完全一致。
+// 返回重建的提案，其中的交易已设置多签输入的来源输出，可直接签名。
+func VerifyConditionalPayment(add *tx.Transaction, p ConditionalParams) (*ConditionalProposal, error) {
+	if add == nil {
+		return nil, invalidParams("add transaction is required")
+	}
+	proposal, err := AddConditionalPayment(p)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(libs.UnsignedBytes(add), libs.UnsignedBytes(proposal.Add)) {
+		return nil, fmt.Errorf("%w: conditional state does not match the parameters", libs.ErrTransitionMismatch)
+	}
+	return proposal, nil
+}
+
+// SettleConditionalPayment 用收款方出示的原像构建结清状态：去掉条件输出，金额归收款方，
+// 条件输出增加的手续费退回付款方。
+func SettleConditionalPayment(p ConditionalResolveParams) (*tx.Transaction, error) {
+	if len(p.Preimage) == 0 {
+		return nil, invalidParams("preimage is required to settle")
+	}
+	return resolveConditionalPayment(p, true)
+}
+
+// CancelConditionalPayment 构建取消状态：去掉条件输出，金额与手续费都退回付款方。
+func CancelConditionalPayment(p ConditionalResolveParams) (*tx.Transaction, error) {
+	return resolveConditionalPayment(p, false)
+}
+
+// VerifyConditionalResolution 核对对方发来的结清或取消状态：p.Preimage 不为空时按结清重建，否则按取消重建，
+// 结果必须与 next 完全一致。
+func VerifyConditionalResolution(next *tx.Transaction, p ConditionalResolveParams) error {
+	if next == nil {
+		return invalidParams("next transaction is required")
+	}
+	expected, err := resolveConditionalPayment(p, len(p.Preimage) > 0)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(libs.UnsignedBytes(next), libs.UnsignedBytes(expected)) {
+		return fmt.Errorf("%w: resolution does not match the parameters", libs.ErrTransitionMismatch)
+	}
+	next.Inputs[0].SetSourceTxOutput(expected.Inputs[0].SourceTxOutput())
+	return nil
+}
+
+func resolveConditionalPayment(p ConditionalResolveParams, settle bool) (*tx.Transaction, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if int(p.Vout) >= len(p.Latest.Outputs) {
+		return nil, fmt.Errorf("%w: no output %d", libs.ErrInvalidTransaction, p.Vout)
+	}
+	conditional := p.Latest.Outputs[p.Vout]
+	terms, ok := libs.ParseConditionalScript(conditional.LockingScript)
+	if !ok {
+		return nil, invalidParams("output %d is not a conditional output", p.Vout)
+	}
+	var payeeIndex, payerIndex int
+	switch {
+	case terms.Payee.IsEqual(p.ServerPublicKey) && terms.Payer.IsEqual(p.ClientPublicKey):
+		payeeIndex, payerIndex = 0, 1
+	case terms.Payee.IsEqual(p.ClientPublicKey) && terms.Payer.IsEqual(p.ServerPublicKey):
+		payeeIndex, payerIndex = 1, 0
+	default:
+		return nil, invalidParams("conditional payee and payer are not the server and the client")
+	}
+	if settle {
+		if err := libs.CheckPreimage(terms.Hash, p.Preimage); err != nil {
+			return nil, err
+		}
+	}
+
+	next, err := restoreSpendState(p.Latest, p.TotalAmount, p.ServerPublicKey, p.ClientPublicKey, p.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	next.Outputs = append(next.Outputs[:p.Vout], next.Outputs[p.Vout+1:]...)
+	amounts, scripts, err := statePayouts(next, p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+	if err != nil {
+		return nil, err
+	}
+	amounts[payerIndex] += p.Fee
+	if settle {
+		amounts[payeeIndex] += conditional.Satoshis
+	} else {
+		amounts[payerIndex] += conditional.Satoshis
+	}
+	layoutConditionalState(next, amounts, scripts, nil)
+	if _, _, err := libs.ValidateConditionalTransition(p.Latest, next); err != nil {
+		return nil, err
+	}
+	var total uint64
+	for _, out := range next.Outputs {
+		total += out.Satoshis
+	}
+	if total > p.TotalAmount {
+		return nil, fmt.Errorf("output total: %w", &libs.InsufficientFundsError{Need: total, Have: p.TotalAmount})
+	}
+
+	libs.Logger().Debug("dual_endpoint: conditional payment resolved",
+		"settled", settle,
+		"amount", conditional.Satoshis,
+		"sequence", p.Sequence,
+	)
+	return next, nil
+}
+
+// layoutConditionalState 按 [服务器, 客户端] 重新排列 t 的支付输出（金额为 0 的一方省略），
+// conditional 不为空时放在支付之后、承诺输出之前，返回它的序号。
+func layoutConditionalState(t *tx.Transaction, amounts []uint64, scripts []*script.Script, conditional *tx.TransactionOutput) uint32 {
+	commitment, hasCommitment := libs.CommitmentOf(t)
+	outputs := make([]*tx.TransactionOutput, 0, len(amounts)+2)
+	for i, amount := range amounts {
+		if amount > 0 {
+			outputs = append(outputs, &tx.TransactionOutput{Satoshis: amount, LockingScript: scripts[i]})
+		}
+	}
+	vout := uint32(len(outputs))
+	if conditional != nil {
+		outputs = append(outputs, conditional)
+	}
+	if hasCommitment {
+		outputs = append(outputs, commitment.Output())
+	}
+	t.Outputs = outputs
+	return vout
+}
+
+// restoreSpendState 从 prev 复制出序列号为 sequence 的新状态，清除解锁脚本并设置多签输入的来源输出以便签名。
+func restoreSpendState(prev *tx.Transaction, totalAmount uint64, serverPublicKey, clientPublicKey *ec.PublicKey, sequence uint32) (*tx.Transaction, error) {
+	next, err := tx.NewTransactionFromHex(prev.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode tx hex: %w", libs.ErrInvalidTransaction, err)
+	}
+	redeem, err := libs.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	next.Inputs[0].UnlockingScript = nil
+	next.Inputs[0].SequenceNumber = sequence
+	next.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: totalAmount, LockingScript: redeem})
+	return next, nil
+}
@@ -0,0 +1,218 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 条件支付：加入哈希锁输出，出示原像结清、取消，以及链上的领取与超时退款。
+func TestDualConditionalPayment(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	const total = uint64(100000)
+
+	sign := func(next *tx.Transaction) *tx.Transaction {
+		t.Helper()
+		clientSig, err := ClientDualFeePoolSpendTXUpdateSign(next, clientPriv, serverPriv.PubKey())
+		if err != nil {
+			t.Fatalf("client sign: %v", err)
+		}
+		serverSig, err := ServerDualFeePoolSpendTXUpdateSign(next, serverPriv, clientPriv.PubKey())
+		if err != nil {
+			t.Fatalf("server sign: %v", err)
+		}
+		merged, err := MergeDualPoolSigForSpendTx(next.Hex(), serverSig, clientSig)
+		if err != nil {
+			t.Fatalf("merge: %v", err)
+		}
+		assertDualInputValid(t, merged, 0, next.Inputs[0].SourceTxOutput())
+		return merged
+	}
+
+	res, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		PrevTxID:         "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		TotalAmount:      total,
+		EndHeight:        800000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		FeeRate:          50,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	updated, err := LoadTxV2(UpdateParams{
+		TxHex:           res.Tx.Hex(),
+		Sequence:        2,
+		ServerAmount:    20000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	prev := sign(updated)
+
+	preimage := []byte("content key for order 42")
+	p := ConditionalParams{
+		Prev:            prev,
+		TotalAmount:     total,
+		Payer:           libs.PartyClient,
+		Amount:          10000,
+		Hash:            libs.HashLock(preimage),
+		Timeout:         prev.LockTime + 144,
+		FeeRate:         50,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+	}
+	proposal, err := AddConditionalPayment(p)
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	add := proposal.Add
+	conditionals := libs.ConditionalOutputs(add)
+	if len(conditionals) != 1 || conditionals[0].Vout != 2 || conditionals[0].Satoshis != 10000 ||
+		!conditionals[0].Payee.IsEqual(serverPriv.PubKey()) || !conditionals[0].Payer.IsEqual(clientPriv.PubKey()) || conditionals[0].Timeout != p.Timeout {
+		t.Fatalf("unexpected conditional outputs: %+v", conditionals)
+	}
+	if add.Inputs[0].SequenceNumber != 3 || add.LockTime != prev.LockTime {
+		t.Fatalf("add must keep the pool locktime with the next sequence")
+	}
+	if add.Outputs[0].Satoshis != prev.Outputs[0].Satoshis || add.Outputs[1].Satoshis != prev.Outputs[1].Satoshis-10000-proposal.Fee {
+		t.Fatalf("payer must fund the conditional output and its fee")
+	}
+	if _, added, err := libs.ValidateConditionalTransition(prev, add); err != nil || !added {
+		t.Fatalf("conditional transition: %v", err)
+	}
+
+	// 收款方按相同参数核对后签名；参数不一致时拒绝
+	wireAdd, _ := tx.NewTransactionFromHex(add.Hex())
+	if _, err := VerifyConditionalPayment(wireAdd, p); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	greedy := p
+	greedy.Amount = 20000
+	if _, err := VerifyConditionalPayment(wireAdd, greedy); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for different amount, got %v", err)
+	}
+	early := p
+	early.Timeout = p.Timeout - 1
+	if _, err := VerifyConditionalPayment(wireAdd, early); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for a different timeout, got %v", err)
+	}
+	addTx := sign(add)
+
+	// 未结清期间普通更新被拒绝
+	if _, err := LoadTxV2(UpdateParams{
+		TxHex:           addTx.Hex(),
+		Sequence:        4,
+		ServerAmount:    30000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+	}); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams while a conditional payment is pending, got %v", err)
+	}
+
+	resolve := ConditionalResolveParams{
+		Latest:          addTx,
+		TotalAmount:     total,
+		Vout:            proposal.Vout,
+		Fee:             proposal.Fee,
+		Preimage:        []byte("wrong"),
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+	}
+	if _, err := SettleConditionalPayment(resolve); !errors.Is(err, libs.ErrPreimageMismatch) {
+		t.Fatalf("expected ErrPreimageMismatch, got %v", err)
+	}
+	resolve.Preimage = preimage
+	resolve.Sequence = 3
+	if _, err := SettleConditionalPayment(resolve); !errors.Is(err, libs.ErrSequenceRegression) {
+		t.Fatalf("settlement must be sequenced above add, got %v", err)
+	}
+	resolve.Sequence = 0
+	settled, err := SettleConditionalPayment(resolve)
+	if err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if len(settled.Outputs) != 2 || settled.Inputs[0].SequenceNumber != 4 ||
+		settled.Outputs[0].Satoshis != prev.Outputs[0].Satoshis+10000 || settled.Outputs[1].Satoshis != prev.Outputs[1].Satoshis-10000 {
+		t.Fatalf("unexpected settlement outputs %d/%d", settled.Outputs[0].Satoshis, settled.Outputs[1].Satoshis)
+	}
+	wireSettled, _ := tx.NewTransactionFromHex(settled.Hex())
+	if err := VerifyConditionalResolution(wireSettled, resolve); err != nil {
+		t.Fatalf("verify settlement: %v", err)
+	}
+	settledTx := sign(wireSettled)
+	if _, err := LoadTxV2(UpdateParams{
+		TxHex:           settledTx.Hex(),
+		Sequence:        5,
+		ServerAmount:    40000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+	}); err != nil {
+		t.Fatalf("update after settlement: %v", err)
+	}
+
+	// 取消：金额与手续费都退回付款方，与加入前相同
+	resolve.Preimage = nil
+	cancelled, err := CancelConditionalPayment(resolve)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if cancelled.Outputs[0].Satoshis != prev.Outputs[0].Satoshis || cancelled.Outputs[1].Satoshis != prev.Outputs[1].Satoshis {
+		t.Fatalf("cancellation must restore the previous balances")
+	}
+	if err := VerifyConditionalResolution(wireSettled, resolve); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("settlement must not verify as a cancellation, got %v", err)
+	}
+
+	// 链上领取：Add 在池到期后上链，收款方出示原像并签名
+	claim, err := libs.BuildConditionalClaimTx(addTx, proposal.Vout, preimage, serverPriv, nil, 50)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	assertDualInputValid(t, claim, 0, addTx.Outputs[proposal.Vout])
+	if extracted, err := libs.ExtractPreimage(claim, p.Hash); err != nil || string(extracted) != string(preimage) {
+		t.Fatalf("claim must reveal the preimage: %v", err)
+	}
+
+	// 链上退款：付款方自己签名，nLockTime 为 Timeout，序列号不是 final
+	refund, err := libs.BuildConditionalRefundTx(addTx, proposal.Vout, clientPriv, nil, 50)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if refund.LockTime != p.Timeout || refund.Inputs[0].SequenceNumber == libs.FinalSequence || refund.LockTime <= addTx.LockTime {
+		t.Fatalf("refund must be locked until the timeout, after the pool expiry")
+	}
+	assertDualInputValid(t, refund, 0, addTx.Outputs[proposal.Vout])
+	if _, err := libs.BuildConditionalRefundTx(addTx, proposal.Vout, serverPriv, nil, 50); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for non-payer refund key, got %v", err)
+	}
+	if _, err := libs.BuildConditionalClaimTx(addTx, proposal.Vout, []byte("wrong"), serverPriv, nil, 50); !errors.Is(err, libs.ErrPreimageMismatch) {
+		t.Fatalf("expected ErrPreimageMismatch for claim, got %v", err)
+	}
+	if _, err := libs.BuildConditionalClaimTx(addTx, proposal.Vout, preimage, clientPriv, nil, 50); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for non-payee key, got %v", err)
+	}
+
+	// 同一时间只能有一笔未结清的条件支付
+	second := p
+	second.Prev = addTx
+	second.Timeout = addTx.LockTime + 144
+	if _, err := AddConditionalPayment(second); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a second conditional payment, got %v", err)
+	}
+	// 退款高度必须晚于池到期高度，否则 Add 上链时退款已经生效
+	early.Timeout = prev.LockTime
+	if _, err := AddConditionalPayment(early); !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange, got %v", err)
+	}
+}
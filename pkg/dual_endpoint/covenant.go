@@ -0,0 +1,242 @@
+package chain_utils
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	script "github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 契约模式：池输出锁定到 libs.CovenantLockingScript，链上强制 B-Tx 恰好有 [服务器, 客户端] 两个支付输出、
+// 手续费不超过开池时约定的 MaxFee，之后才检查 2-of-2 签名。B-Tx 由 BuildCovenantSpendTx 构建、LoadCovenantTx 更新，
+// 两者都强制使用 libs.DustKeepZero：默认的 libs.DustKeep 会省略 0 聪输出，一方余额耗尽后交易只剩一个输出，违反契约。
+// 不支持粉尘省略、承诺输出与条件支付；双方用 CovenantSign 签名，MergeCovenantSigs 写入带签名原像的解锁脚本。
+// 签名前各方用 libs.CheckCovenantOutputs（CovenantSign 会自动调用）确认交易符合契约。
+
+// NewCovenantTerms 返回契约条款，支付脚本为空时使用签名公钥的 P2PKH。
+// maxFee 一般取 EstimateCovenantFee 的结果，需要提高费率时应留出余量。
+func NewCovenantTerms(serverPublicKey, clientPublicKey *ec.PublicKey, serverPayoutScript, clientPayoutScript *script.Script, maxFee uint64) (libs.CovenantTerms, error) {
+	if serverPublicKey == nil || clientPublicKey == nil {
+		return libs.CovenantTerms{}, invalidParams("server and client public keys are required")
+	}
+	scripts, err := payoutScripts(serverPublicKey, clientPublicKey, serverPayoutScript, clientPayoutScript)
+	if err != nil {
+		return libs.CovenantTerms{}, err
+	}
+	terms := libs.CovenantTerms{
+		ServerPublicKey:    serverPublicKey,
+		ClientPublicKey:    clientPublicKey,
+		ServerPayoutScript: scripts[0],
+		ClientPayoutScript: scripts[1],
+		MaxFee:             maxFee,
+	}
+	return terms, terms.Validate()
+}
+
+// EstimateCovenantFee 按 feeRate 估算花费契约池的 B-Tx 手续费，terms.MaxFee 不参与估算。
+func EstimateCovenantFee(terms libs.CovenantTerms, feeRate float64) (uint64, error) {
+	// 按最长的 MaxFee 编码估算锁定脚本长度
+	terms.MaxFee = math.MaxInt64
+	lockingScript, err := libs.CovenantLockingScript(terms)
+	if err != nil {
+		return 0, err
+	}
+	spend := tx.NewTransaction()
+	spend.AddInput(&tx.TransactionInput{
+		SourceTXID:      &chainhash.Hash{},
+		UnlockingScript: libs.CovenantPlaceholder(lockingScript),
+	})
+	spend.AddOutput(&tx.TransactionOutput{LockingScript: terms.ServerPayoutScript})
+	spend.AddOutput(&tx.TransactionOutput{LockingScript: terms.ClientPayoutScript})
+	fee := uint64(float64(spend.Size()) / 1000.0 * feeRateOrDefault(feeRate))
+	if fee == 0 {
+		fee = 1
+	}
+	return fee, nil
+}
+
+// BuildCovenantBaseTx 构建契约模式的 A-Tx：客户端 UTXO -> 契约池输出 + 客户端找零。
+func BuildCovenantBaseTx(p PoolParams, terms libs.CovenantTerms) (*BuildStep1Response, error) {
+	if p.ClientPrivateKey != nil && p.ServerPublicKey != nil {
+		if err := checkCovenantKeys(terms, p.ServerPublicKey, p.ClientPrivateKey.PubKey()); err != nil {
+			return nil, err
+		}
+	}
+	poolScript, err := libs.CovenantLockingScript(terms)
+	if err != nil {
+		return nil, err
+	}
+	return buildDualFeePoolBaseTx(p, poolScript)
+}
+
+// BuildCovenantSpendTx 构建契约模式的初始 B-Tx 并由客户端签名，支付脚本固定为 terms 中的脚本。
+// 手续费按契约解锁脚本估算，超过 terms.MaxFee 时返回 libs.ErrCovenantViolation。
+func BuildCovenantSpendTx(p SpendParams, terms libs.CovenantTerms) (*SpendResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkCovenantKeys(terms, p.ServerPublicKey, p.ClientPrivateKey.PubKey()); err != nil {
+		return nil, err
+	}
+	if (p.Dust.Action != libs.DustKeep && !p.Dust.FixedLayout()) || p.Commitment != nil {
+		return nil, invalidParams("covenant pools keep both payout outputs and carry no commitment output")
+	}
+	for i, declared := range []*script.Script{p.ServerPayoutScript, p.ClientPayoutScript} {
+		agreed := []*script.Script{terms.ServerPayoutScript, terms.ClientPayoutScript}[i]
+		if declared != nil && !bytes.Equal(declared.Bytes(), agreed.Bytes()) {
+			return nil, invalidParams("payout script %d differs from the covenant", i)
+		}
+	}
+	poolScript, err := libs.CovenantLockingScript(terms)
+	if err != nil {
+		return nil, err
+	}
+	if p.BaseTx != nil && !bytes.Equal(p.BaseTx.Outputs[p.PoolVout].LockingScript.Bytes(), poolScript.Bytes()) {
+		return nil, invalidParams("base tx output %d is not locked to the covenant", p.PoolVout)
+	}
+	pool := &poolSpend{lockingScript: poolScript, placeholder: libs.CovenantPlaceholder(poolScript)}
+	// 契约要求恰好两个支付输出，支付到约定的脚本
+	p.Dust = libs.DustPolicy{Action: libs.DustKeepZero}
+	p.ServerPayoutScript, p.ClientPayoutScript = terms.ServerPayoutScript, terms.ClientPayoutScript
+	spend, fee, amount, err := subBuildDualFeePoolSpendTX(&p, feeRateOrDefault(p.FeeRate), pool)
+	if err != nil {
+		libs.Logger().Debug("dual_endpoint: build covenant spend tx failed", "error", err)
+		return nil, err
+	}
+	clientSig, err := CovenantSign(spend, p.TotalAmount, terms, p.ClientPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &SpendResult{Tx: spend, ClientSignBytes: clientSig, Amount: amount, Fee: fee, ServerPayout: p.ServerPayout, ClientPayout: p.ClientPayout}, nil
+}
+
+// LoadCovenantTx 构建契约池 B-Tx 的更新，参数同 LoadTxV2。粉尘策略固定为 libs.DustKeepZero、支付脚本取自 terms，
+// 一方余额耗尽时保留其 0 聪输出，更新后的交易仍是契约要求的两个支付输出。
+func LoadCovenantTx(p UpdateParams, terms libs.CovenantTerms) (*tx.Transaction, error) {
+	if err := checkCovenantKeys(terms, p.ServerPublicKey, p.ClientPublicKey); err != nil {
+		return nil, err
+	}
+	if (p.Dust.Action != libs.DustKeep && !p.Dust.FixedLayout()) || p.Commitment != nil {
+		return nil, invalidParams("covenant pools keep both payout outputs and carry no commitment output")
+	}
+	for i, declared := range []*script.Script{p.ServerPayoutScript, p.ClientPayoutScript} {
+		agreed := []*script.Script{terms.ServerPayoutScript, terms.ClientPayoutScript}[i]
+		if declared != nil && !bytes.Equal(declared.Bytes(), agreed.Bytes()) {
+			return nil, invalidParams("payout script %d differs from the covenant", i)
+		}
+	}
+	p.Dust = libs.DustPolicy{Action: libs.DustKeepZero}
+	p.ServerPayoutScript, p.ClientPayoutScript = terms.ServerPayoutScript, terms.ClientPayoutScript
+	next, err := LoadTxV2(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := libs.CheckCovenantOutputs(next, p.TotalAmount, terms); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// CovenantSign 由服务器或客户端对契约池 B-Tx 的 0 号输入签名。签名前按契约规则检查输出，
+// 不符合时返回 libs.ErrCovenantViolation，避免签出无法上链的状态。
+func CovenantSign(t *tx.Transaction, totalAmount uint64, terms libs.CovenantTerms, priv *ec.PrivateKey) (*[]byte, error) {
+	if priv == nil {
+		return nil, invalidParams("signer private key is required")
+	}
+	party, err := covenantParty(terms, priv.PubKey())
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || len(t.Inputs) == 0 {
+		return nil, fmt.Errorf("%w: no input 0", libs.ErrInvalidTransaction)
+	}
+	if err := libs.CheckCovenantOutputs(t, totalAmount, terms); err != nil {
+		return nil, err
+	}
+	poolScript, err := libs.CovenantLockingScript(terms)
+	if err != nil {
+		return nil, err
+	}
+	flag := sighash.Flag(sighash.ForkID | sighash.All)
+	t.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: totalAmount, LockingScript: poolScript})
+	digest, err := t.CalcInputSignatureHash(0, flag)
+	if err != nil {
+		return nil, fmt.Errorf("%w: calc sighash: %w", libs.ErrInvalidTransaction, err)
+	}
+	sig, err := priv.Sign(digest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s input 0: %w", libs.ErrSigningFailed, party, err)
+	}
+	sigBytes := append(sig.Serialize(), byte(flag))
+	libs.Logger().Debug("dual_endpoint: covenant spend signed", "txid", t.TxID().String(), "party", party, "sequence", t.Inputs[0].SequenceNumber)
+	return &sigBytes, nil
+}
+
+// VerifyCovenantSig 核对 signer 对契约池 B-Tx 的签名，并检查交易符合契约。
+func VerifyCovenantSig(t *tx.Transaction, totalAmount uint64, terms libs.CovenantTerms, signer *ec.PublicKey, sig *[]byte) error {
+	party, err := covenantParty(terms, signer)
+	if err != nil {
+		return err
+	}
+	if err := libs.CheckCovenantOutputs(t, totalAmount, terms); err != nil {
+		return err
+	}
+	poolScript, err := libs.CovenantLockingScript(terms)
+	if err != nil {
+		return err
+	}
+	_, err = verifySignatureWithContext(t, 0, poolScript, totalAmount, party, signer, sig)
+	return err
+}
+
+// MergeCovenantSigs 核对双方签名后写入契约解锁脚本，返回可广播的 B-Tx（来源输出已设置）。
+func MergeCovenantSigs(t *tx.Transaction, totalAmount uint64, terms libs.CovenantTerms, serverSig, clientSig *[]byte) (*tx.Transaction, error) {
+	if err := VerifyCovenantSig(t, totalAmount, terms, terms.ServerPublicKey, serverSig); err != nil {
+		return nil, err
+	}
+	if err := VerifyCovenantSig(t, totalAmount, terms, terms.ClientPublicKey, clientSig); err != nil {
+		return nil, err
+	}
+	poolScript, err := libs.CovenantLockingScript(terms)
+	if err != nil {
+		return nil, err
+	}
+	t.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: totalAmount, LockingScript: poolScript})
+	unlocking, err := libs.CovenantUnlockingScript(t, 0, *serverSig, *clientSig)
+	if err != nil {
+		return nil, err
+	}
+	t.Inputs[0].UnlockingScript = unlocking
+	libs.Logger().Debug("dual_endpoint: covenant spend merged", "txid", t.TxID().String(), "sequence", t.Inputs[0].SequenceNumber)
+	return t, nil
+}
+
+// checkCovenantKeys 检查条款中的公钥与参数中的双方公钥一致。
+func checkCovenantKeys(terms libs.CovenantTerms, serverPublicKey, clientPublicKey *ec.PublicKey) error {
+	if terms.ServerPublicKey == nil || terms.ClientPublicKey == nil ||
+		!terms.ServerPublicKey.IsEqual(serverPublicKey) || !terms.ClientPublicKey.IsEqual(clientPublicKey) {
+		return invalidParams("covenant keys do not match the pool keys")
+	}
+	return nil
+}
+
+// covenantParty 返回 pub 在契约池中的角色。
+func covenantParty(terms libs.CovenantTerms, pub *ec.PublicKey) (libs.Party, error) {
+	switch {
+	case pub == nil:
+		return "", invalidParams("signer public key is required")
+	case terms.ServerPublicKey != nil && pub.IsEqual(terms.ServerPublicKey):
+		return libs.PartyServer, nil
+	case terms.ClientPublicKey != nil && pub.IsEqual(terms.ClientPublicKey):
+		return libs.PartyClient, nil
+	default:
+		return "", invalidParams("signer is neither the server nor the client of the covenant")
+	}
+}
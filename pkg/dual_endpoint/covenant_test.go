@@ -0,0 +1,206 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter/scriptflag"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 契约池：开池、初始 B-Tx 与更新在解释器中通过；双方都签了名但违反契约布局或手续费上限的交易被脚本拒绝。
+func TestDualCovenantPool(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	attacker, _ := ec.PrivateKeyFromHex("4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d")
+
+	terms, err := NewCovenantTerms(serverPriv.PubKey(), clientPriv.PubKey(), nil, nil, 0)
+	if err != nil {
+		t.Fatalf("terms: %v", err)
+	}
+	if terms.MaxFee, err = EstimateCovenantFee(terms, 50); err != nil {
+		t.Fatalf("estimate fee: %v", err)
+	}
+
+	base, err := BuildCovenantBaseTx(PoolParams{
+		ClientUTXOs:      []libs.UTXO{{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 1, Value: 100000}},
+		PoolAmount:       50000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		Network:          libs.Testnet,
+		FeeRate:          50,
+	}, terms)
+	if err != nil {
+		t.Fatalf("base tx: %v", err)
+	}
+	poolScript, _ := libs.CovenantLockingScript(terms)
+	if base.Tx.Outputs[0].LockingScript.String() != poolScript.String() {
+		t.Fatalf("pool output must be locked to the covenant")
+	}
+
+	spend, err := BuildCovenantSpendTx(SpendParams{
+		BaseTx:           base.Tx,
+		EndHeight:        800000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		Network:          libs.Testnet,
+		FeeRate:          50,
+	}, terms)
+	if err != nil {
+		t.Fatalf("spend tx: %v", err)
+	}
+	if spend.Fee > terms.MaxFee {
+		t.Fatalf("fee %d exceeds covenant maximum %d", spend.Fee, terms.MaxFee)
+	}
+
+	// sign 由服务器签名并合并，交易经 hex 传输
+	sign := func(next *tx.Transaction, clientSig *[]byte) *tx.Transaction {
+		t.Helper()
+		received, _ := tx.NewTransactionFromHex(next.Hex())
+		if err := VerifyCovenantSig(received, base.Amount, terms, clientPriv.PubKey(), clientSig); err != nil {
+			t.Fatalf("verify client sig: %v", err)
+		}
+		serverSig, err := CovenantSign(received, base.Amount, terms, serverPriv)
+		if err != nil {
+			t.Fatalf("server sign: %v", err)
+		}
+		final, err := MergeCovenantSigs(received, base.Amount, terms, serverSig, clientSig)
+		if err != nil {
+			t.Fatalf("merge: %v", err)
+		}
+		assertCovenantInput(t, final, base.Tx.Outputs[0], true)
+		return final
+	}
+	signed := sign(spend.Tx, spend.ClientSignBytes)
+
+	next, err := LoadCovenantTx(UpdateParams{
+		TxHex:           signed.Hex(),
+		Sequence:        2,
+		ServerAmount:    10000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     base.Amount,
+	}, terms)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	clientSig, err := CovenantSign(next, base.Amount, terms, clientPriv)
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+	updated := sign(next, clientSig)
+	if updated.Outputs[0].Satoshis != 10000 {
+		t.Fatalf("unexpected server amount %d", updated.Outputs[0].Satoshis)
+	}
+
+	// 一方余额耗尽：保留 0 聪输出，交易仍是两个支付输出并通过脚本检查
+	for _, serverAmount := range []uint64{0, base.Amount - spend.Fee} {
+		drained, err := LoadCovenantTx(UpdateParams{
+			TxHex:           updated.Hex(),
+			Sequence:        3,
+			ServerAmount:    serverAmount,
+			ServerPublicKey: serverPriv.PubKey(),
+			ClientPublicKey: clientPriv.PubKey(),
+			TotalAmount:     base.Amount,
+		}, terms)
+		if err != nil {
+			t.Fatalf("drain to server %d: %v", serverAmount, err)
+		}
+		if len(drained.Outputs) != 2 || drained.Outputs[0].Satoshis != serverAmount ||
+			drained.Outputs[0].Satoshis+drained.Outputs[1].Satoshis != base.Amount-spend.Fee {
+			t.Fatalf("drain to server %d: unexpected outputs %d/%d", serverAmount, len(drained.Outputs), drained.Outputs[0].Satoshis)
+		}
+		clientSig, err := CovenantSign(drained, base.Amount, terms, clientPriv)
+		if err != nil {
+			t.Fatalf("drain to server %d: client sign: %v", serverAmount, err)
+		}
+		sign(drained, clientSig)
+	}
+	// 默认 DustKeep 的 LoadTxV2 省略 0 聪输出，CovenantSign 拒绝签名
+	dropped, err := LoadTxV2(UpdateParams{
+		TxHex:           updated.Hex(),
+		Sequence:        3,
+		ServerAmount:    0,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     base.Amount,
+	})
+	if err != nil {
+		t.Fatalf("update with default dust policy: %v", err)
+	}
+	if _, err := CovenantSign(dropped, base.Amount, terms, clientPriv); !errors.Is(err, libs.ErrCovenantViolation) {
+		t.Fatalf("expected ErrCovenantViolation for a dropped payout, got %v", err)
+	}
+	if _, err := LoadCovenantTx(UpdateParams{
+		TxHex:           updated.Hex(),
+		Sequence:        3,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     base.Amount,
+		Dust:            libs.DustPolicy{Action: libs.DustDrop},
+	}, terms); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for DustDrop, got %v", err)
+	}
+
+	// 解锁脚本中的原像必须属于当前交易
+	replayed, _ := tx.NewTransactionFromHex(updated.Hex())
+	replayed.Inputs[0].UnlockingScript = signed.Inputs[0].UnlockingScript
+	assertCovenantInput(t, replayed, base.Tx.Outputs[0], false)
+
+	// 违反契约的交易：库拒绝签名，即使双方都签了名，脚本也拒绝
+	violations := map[string]func(*tx.Transaction){
+		"third output": func(v *tx.Transaction) {
+			v.Outputs[1].Satoshis -= 5000
+			v.AddOutput(&tx.TransactionOutput{Satoshis: 5000, LockingScript: v.Outputs[0].LockingScript})
+		},
+		"foreign payout script": func(v *tx.Transaction) {
+			scripts, _ := PayoutScripts(attacker.PubKey(), clientPriv.PubKey())
+			v.Outputs[0].LockingScript = scripts[0]
+		},
+		"fee above maximum": func(v *tx.Transaction) {
+			v.Outputs[1].Satoshis -= terms.MaxFee
+		},
+	}
+	for name, mutate := range violations {
+		violating, _ := tx.NewTransactionFromHex(updated.Hex())
+		mutate(violating)
+		if _, err := CovenantSign(violating, base.Amount, terms, clientPriv); !errors.Is(err, libs.ErrCovenantViolation) {
+			t.Fatalf("%s: expected ErrCovenantViolation, got %v", name, err)
+		}
+		violating.Inputs[0].SetSourceTxOutput(base.Tx.Outputs[0])
+		var sigs [][]byte
+		for _, priv := range []*ec.PrivateKey{serverPriv, clientPriv} {
+			digest, _ := violating.CalcInputSignatureHash(0, sighash.Flag(sighash.ForkID|sighash.All))
+			sig, _ := priv.Sign(digest)
+			sigs = append(sigs, append(sig.Serialize(), byte(sighash.ForkID|sighash.All)))
+		}
+		violating.Inputs[0].UnlockingScript, err = libs.CovenantUnlockingScript(violating, 0, sigs[0], sigs[1])
+		if err != nil {
+			t.Fatalf("%s: unlocking script: %v", name, err)
+		}
+		assertCovenantInput(t, violating, base.Tx.Outputs[0], false)
+	}
+}
+
+// assertCovenantInput 以节点的标准脚本规则（含 low-S、严格 DER 与最小编码）执行契约池输入。
+func assertCovenantInput(t *testing.T, transaction *tx.Transaction, prevOut *tx.TransactionOutput, valid bool) {
+	t.Helper()
+	err := interpreter.NewEngine().Execute(
+		interpreter.WithTx(transaction, 0, prevOut),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+		interpreter.WithFlags(scriptflag.VerifyStrictEncoding|scriptflag.VerifyDERSignatures|scriptflag.VerifyLowS|
+			scriptflag.VerifyMinimalData|scriptflag.VerifyNullFail|scriptflag.VerifySigPushOnly),
+	)
+	if valid && err != nil {
+		t.Fatalf("covenant input failed script check: %v", err)
+	}
+	if !valid && err == nil {
+		t.Fatalf("covenant input must fail script check")
+	}
+}
@@ -0,0 +1,113 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 双方出资：各自只签自己的输入，退款 B-Tx 按出资金额返还。
+func TestDualFundedOpening(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	p := DualFundedParams{
+		ClientUTXOs:     []libs.UTXO{{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 0, Value: 30000}},
+		ClientAmount:    20000,
+		ClientPublicKey: clientPriv.PubKey(),
+		ServerUTXOs:     []libs.UTXO{{TxID: "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", Vout: 3, Value: 15000}},
+		ServerAmount:    15000 - 1,
+		ServerPublicKey: serverPriv.PubKey(),
+		Network:         libs.Testnet,
+		FeeRate:         5,
+	}
+	res, err := BuildDualFundedBaseTx(p)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if res.Amount != 34999 || res.Tx.Outputs[0].Satoshis != 34999 {
+		t.Fatalf("unexpected pool amount %d", res.Amount)
+	}
+	if res.ServerChange != 0 || len(res.Tx.Outputs) != 2 {
+		t.Fatalf("server change should be absent, got %d", res.ServerChange)
+	}
+	if res.ClientChange != 10000-(res.Fee-res.Fee/2) {
+		t.Fatalf("unexpected client change %d for fee %d", res.ClientChange, res.Fee)
+	}
+
+	// 服务器先签自己的输入，经过序列化传给客户端
+	serverSigned, err := SignDualFundedBaseTx(res.Tx, p, serverPriv)
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	if serverSigned.Inputs[0].UnlockingScript != nil {
+		t.Fatalf("server must not sign client input")
+	}
+	received, _ := tx.NewTransactionFromHex(serverSigned.Hex())
+
+	// 篡改服务器签名会被客户端拒绝
+	tampered, _ := tx.NewTransactionFromHex(serverSigned.Hex())
+	(*tampered.Inputs[1].UnlockingScript)[5] ^= 0x01
+	if _, err := SignDualFundedBaseTx(tampered, p, clientPriv); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+
+	baseTx, err := SignDualFundedBaseTx(received, p, clientPriv)
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+
+	refund, err := BuildDualFundedRefundTX(baseTx, p, 800000, clientPriv)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if refund.Tx.Outputs[0].Satoshis != p.ServerAmount || refund.Amount >= p.ClientAmount {
+		t.Fatalf("unexpected refund outputs %d/%d", refund.Tx.Outputs[0].Satoshis, refund.Amount)
+	}
+	if err := ServerVerifyDualFundedRefund(refund.Tx, baseTx, p, 800000, refund.ClientSignBytes); err != nil {
+		t.Fatalf("server verify refund: %v", err)
+	}
+
+	// locktime 为 0 或序列号为 final 的退款可以立即广播，服务器不能回签
+	early, err := BuildDualFundedRefundTX(baseTx, p, 0, clientPriv)
+	if err != nil {
+		t.Fatalf("locktime 0 refund: %v", err)
+	}
+	if err := ServerVerifyDualFundedRefund(early.Tx, baseTx, p, 800000, early.ClientSignBytes); !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange for a locktime 0 refund, got %v", err)
+	}
+	final := refund.Tx.ShallowClone()
+	final.Inputs[0].SequenceNumber = libs.FinalSequence
+	if err := ServerVerifyDualFundedRefund(final, baseTx, p, 800000, refund.ClientSignBytes); !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for a final refund sequence, got %v", err)
+	}
+
+	// 声明了服务器冷钱包脚本时，退款只能支付到该脚本；按 P2PKH 构建的退款会被拒绝
+	coldPriv, _ := ec.PrivateKeyFromHex("1c4f0a2a6b5d3e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f7")
+	coldScripts, _ := PayoutScripts(coldPriv.PubKey(), clientPriv.PubKey())
+	cold := p
+	cold.ServerPayoutScript = coldScripts[0]
+	coldRefund, err := BuildDualFundedRefundTX(baseTx, cold, 800000, clientPriv)
+	if err != nil {
+		t.Fatalf("cold refund: %v", err)
+	}
+	if !coldRefund.Tx.Outputs[0].LockingScript.Equals(coldScripts[0]) {
+		t.Fatalf("refund must pay the server to its declared script")
+	}
+	if err := ServerVerifyDualFundedRefund(coldRefund.Tx, baseTx, cold, 800000, coldRefund.ClientSignBytes); err != nil {
+		t.Fatalf("server verify cold refund: %v", err)
+	}
+	if err := ServerVerifyDualFundedRefund(refund.Tx, baseTx, cold, 800000, refund.ClientSignBytes); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for a refund ignoring the declared script, got %v", err)
+	}
+
+	// 出资金额与约定不符的 A-Tx 会被拒绝
+	other := p
+	other.ServerAmount = 14000
+	if err := VerifyDualFundedBaseTx(baseTx, other); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch, got %v", err)
+	}
+}
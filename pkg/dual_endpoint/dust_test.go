@@ -0,0 +1,265 @@
+package chain_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 粉尘策略：默认省略 0 聪输出，DustKeepZero 保持原有布局；DustDrop 省略低于限额的输出，更新后输出可以重新出现；DustMerge 把粉尘并入最大输出。
+func TestDualDustLayout(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	const total = uint64(100000)
+
+	open := func(server uint64, dust libs.DustPolicy) (*SpendResult, error) {
+		return BuildDualFeePoolSpendTXV2(SpendParams{
+			PrevTxID:         "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+			TotalAmount:      total,
+			ServerAmount:     server,
+			EndHeight:        800000,
+			ClientPrivateKey: clientPriv,
+			ServerPublicKey:  serverPriv.PubKey(),
+			FeeRate:          50,
+			Dust:             dust,
+		})
+	}
+
+	// 默认策略省略金额为 0 的服务器输出；DustKeepZero 与位置参数版本的原有两输出布局逐字节一致
+	keep, err := open(0, libs.DustPolicy{})
+	if err != nil {
+		t.Fatalf("keep open: %v", err)
+	}
+	if len(keep.Tx.Outputs) != 1 || keep.Tx.Outputs[0].Satoshis == 0 {
+		t.Fatalf("default dust policy must omit the 0-sat server output, got %d outputs", len(keep.Tx.Outputs))
+	}
+	if small, err := open(100, libs.DustPolicy{}); err != nil || len(small.Tx.Outputs) != 2 || small.Tx.Outputs[0].Satoshis != 100 {
+		t.Fatalf("default dust policy must keep non-zero payouts below the limit (%v)", err)
+	}
+	keepZero, err := open(0, libs.DustPolicy{Action: libs.DustKeepZero})
+	if err != nil {
+		t.Fatalf("keep-zero open: %v", err)
+	}
+	legacy, _, err := SubBuildDualFeePoolSpendTX("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", total, 0, 800000, clientPriv, serverPriv.PubKey(), true, 50)
+	if err != nil {
+		t.Fatalf("legacy open: %v", err)
+	}
+	legacy.Inputs[0].UnlockingScript = keepZero.Tx.Inputs[0].UnlockingScript
+	if keepZero.Tx.Hex() != legacy.Hex() || len(keepZero.Tx.Outputs) != 2 {
+		t.Fatalf("keep-zero dust policy must keep the legacy layout")
+	}
+
+	// DustDrop：开池时服务器金额为 0，只保留客户端输出
+	drop := libs.DustPolicy{Action: libs.DustDrop}
+	res, err := open(0, drop)
+	if err != nil {
+		t.Fatalf("drop open: %v", err)
+	}
+	scripts, err := PayoutScripts(serverPriv.PubKey(), clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("payout scripts: %v", err)
+	}
+	if len(res.Tx.Outputs) != 1 || !res.Tx.Outputs[0].LockingScript.Equals(scripts[1]) {
+		t.Fatalf("expected a single client output, got %d outputs", len(res.Tx.Outputs))
+	}
+	if res.Fee != keep.Fee || res.Amount+res.Fee != total {
+		t.Fatalf("unexpected drop amounts: client %d fee %d", res.Amount, res.Fee)
+	}
+
+	// 更新后服务器输出重新出现，双方从同一参数得到相同交易，并能完成签名
+	update := UpdateParams{
+		TxHex:           res.Tx.Hex(),
+		Sequence:        2,
+		ServerAmount:    30000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+		Fee:             res.Fee,
+		Dust:            drop,
+	}
+	clientSide, err := LoadTxV2(update)
+	if err != nil {
+		t.Fatalf("drop update: %v", err)
+	}
+	serverSide, err := LoadTxV2(update)
+	if err != nil {
+		t.Fatalf("drop update (server): %v", err)
+	}
+	if clientSide.Hex() != serverSide.Hex() || len(clientSide.Outputs) != 2 {
+		t.Fatalf("both sides must derive the same two-output transaction")
+	}
+	if clientSide.Outputs[0].Satoshis != 30000 || clientSide.Outputs[1].Satoshis != total-30000-res.Fee {
+		t.Fatalf("unexpected update amounts %d/%d", clientSide.Outputs[0].Satoshis, clientSide.Outputs[1].Satoshis)
+	}
+	if err := ValidatePayoutUpdate(res.Tx, clientSide, update); err != nil {
+		t.Fatalf("payout transition: %v", err)
+	}
+	clientSig, err := ClientDualFeePoolSpendTXUpdateSign(clientSide, clientPriv, serverPriv.PubKey())
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+	serverSig, err := ServerDualFeePoolSpendTXUpdateSign(serverSide, serverPriv, clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	merged, err := MergeDualPoolSigForSpendTx(clientSide.Hex(), serverSig, clientSig)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	assertDualInputValid(t, merged, 0, clientSide.Inputs[0].SourceTxOutput())
+
+	// 不属于双方的输出与超出多签金额减手续费的输出都会被拒绝
+	forged := tx.NewTransaction()
+	forged.AddInput(&tx.TransactionInput{SourceTXID: clientSide.Inputs[0].SourceTXID, SourceTxOutIndex: 0, SequenceNumber: 3})
+	forged.AddOutput(&tx.TransactionOutput{Satoshis: 1000, LockingScript: scripts[0]})
+	forged.AddOutput(&tx.TransactionOutput{Satoshis: 1000, LockingScript: scripts[0]})
+	forged.LockTime = clientSide.LockTime
+	if err := ValidatePayoutUpdate(clientSide, forged, update); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for repeated payout, got %v", err)
+	}
+	forged.Outputs = forged.Outputs[:1]
+	forged.Outputs[0].Satoshis = total
+	if err := ValidatePayoutUpdate(clientSide, forged, update); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds for overpaying update, got %v", err)
+	}
+
+	// DustMerge：低于限额的服务器金额并入客户端输出
+	merge, err := open(500, libs.DustPolicy{Action: libs.DustMerge, Limit: 1000})
+	if err != nil {
+		t.Fatalf("merge open: %v", err)
+	}
+	if len(merge.Tx.Outputs) != 1 || merge.Amount != total-merge.Fee {
+		t.Fatalf("expected merged client output of %d, got %d outputs / %d", total-merge.Fee, len(merge.Tx.Outputs), merge.Amount)
+	}
+
+	if _, err := open(0, libs.DustPolicy{Action: libs.DustDrop, Limit: total}); !errors.Is(err, libs.ErrBelowDust) {
+		t.Fatalf("expected ErrBelowDust when every payout is dust, got %v", err)
+	}
+	if _, err := open(0, libs.DustPolicy{Action: libs.DustAction(7)}); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for unknown dust action, got %v", err)
+	}
+}
+
+// 位置参数版本使用 DustKeepZero：扣费后余额低于粉尘限额（包括 0）的支付照常保留，只要承担手续费的一方付得起手续费。
+func TestDualDustPositionalBoundary(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	const prev = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	const total = uint64(50000)
+
+	open, clientAmount, err := SubBuildDualFeePoolSpendTX(prev, total, 49800, 800000, clientPriv, serverPriv.PubKey(), true, 50)
+	if err != nil {
+		t.Fatalf("open near the boundary: %v", err)
+	}
+	fee := total - 49800 - clientAmount
+	if len(open.Outputs) != 2 || open.Outputs[0].Satoshis != 49800 || open.Outputs[1].Satoshis != clientAmount || clientAmount >= libs.DustLimit {
+		t.Fatalf("unexpected open layout: client %d fee %d", clientAmount, fee)
+	}
+	small, clientAmount, err := SubBuildDualFeePoolSpendTX(prev, 500, 0, 800000, clientPriv, serverPriv.PubKey(), true, 50)
+	if err != nil {
+		t.Fatalf("open a pool below the dust limit: %v", err)
+	}
+	if len(small.Outputs) != 2 || small.Outputs[0].Satoshis != 0 || clientAmount+fee != 500 {
+		t.Fatalf("unexpected small pool layout: client %d", clientAmount)
+	}
+
+	for server := uint64(49500); server < total; server++ {
+		next, err := LoadTx(open.Hex(), nil, 2, server, serverPriv.PubKey(), clientPriv.PubKey(), total)
+		if total-server < fee {
+			if !errors.Is(err, libs.ErrInsufficientFunds) {
+				t.Fatalf("server %d: expected ErrInsufficientFunds, got %v", server, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("server %d: %v", server, err)
+		}
+		if len(next.Outputs) != 2 || next.Outputs[0].Satoshis != server || next.Outputs[1].Satoshis != total-server-fee {
+			t.Fatalf("server %d: unexpected outputs %d/%d", server, next.Outputs[0].Satoshis, next.Outputs[1].Satoshis)
+		}
+	}
+}
+
+// dustVector 是 tests/vectors/dust_layout.json 中的一项，TS 端的 tests/dual_endpoint/dust_layout.test.ts 使用同一文件。
+type dustVector struct {
+	Name         string `json:"name"`
+	Prev         string `json:"prev"`
+	Sequence     uint32 `json:"sequence"`
+	ServerAmount uint64 `json:"serverAmount"`
+	Dust         struct {
+		Action libs.DustAction `json:"action"`
+		Limit  uint64          `json:"limit"`
+	} `json:"dust"`
+	Hex string `json:"hex"`
+}
+
+// 跨语言向量：Go 与 TS 按相同的粉尘策略开池与更新，得到逐字节相同的未签名 B-Tx。
+func TestDualDustVectors(t *testing.T) {
+	data, err := os.ReadFile("../../tests/vectors/dust_layout.json")
+	if err != nil {
+		t.Fatalf("read vectors: %v", err)
+	}
+	var file struct {
+		Dual struct {
+			ClientPrivHex string       `json:"clientPrivHex"`
+			ServerPrivHex string       `json:"serverPrivHex"`
+			PrevTxID      string       `json:"prevTxId"`
+			TotalAmount   uint64       `json:"totalAmount"`
+			EndHeight     uint32       `json:"endHeight"`
+			FeeRate       float64      `json:"feeRate"`
+			Open          []dustVector `json:"open"`
+			Update        []dustVector `json:"update"`
+		} `json:"dual"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("decode vectors: %v", err)
+	}
+	v := file.Dual
+	clientPriv, _ := ec.PrivateKeyFromHex(v.ClientPrivHex)
+	serverPriv, _ := ec.PrivateKeyFromHex(v.ServerPrivHex)
+
+	built := map[string]string{}
+	for _, vec := range v.Open {
+		res, err := BuildDualFeePoolSpendTXV2(SpendParams{
+			PrevTxID:         v.PrevTxID,
+			TotalAmount:      v.TotalAmount,
+			ServerAmount:     vec.ServerAmount,
+			EndHeight:        v.EndHeight,
+			ClientPrivateKey: clientPriv,
+			ServerPublicKey:  serverPriv.PubKey(),
+			FeeRate:          v.FeeRate,
+			Dust:             libs.DustPolicy{Action: vec.Dust.Action, Limit: vec.Dust.Limit},
+		})
+		if err != nil {
+			t.Fatalf("%s: open: %v", vec.Name, err)
+		}
+		if got := res.Tx.Hex(); got != vec.Hex {
+			t.Errorf("%s: open mismatch, got %s", vec.Name, got)
+		}
+		built[vec.Name] = res.Tx.Hex()
+	}
+	for _, vec := range v.Update {
+		next, err := LoadTxV2(UpdateParams{
+			TxHex:           built[vec.Prev],
+			Sequence:        vec.Sequence,
+			ServerAmount:    vec.ServerAmount,
+			ServerPublicKey: serverPriv.PubKey(),
+			ClientPublicKey: clientPriv.PubKey(),
+			TotalAmount:     v.TotalAmount,
+			Dust:            libs.DustPolicy{Action: vec.Dust.Action, Limit: vec.Dust.Limit},
+		})
+		if err != nil {
+			t.Fatalf("%s: update: %v", vec.Name, err)
+		}
+		if got := next.Hex(); got != vec.Hex {
+			t.Errorf("%s: update mismatch, got %s", vec.Name, got)
+		}
+		built[vec.Name] = next.Hex()
+	}
+}
@@ -0,0 +1,94 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 验证各步骤返回的错误可以通过 errors.Is / errors.As 映射，而不需要匹配字符串。
+func TestDualTypedErrors(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	prevTxID := "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	total := uint64(50000)
+
+	// 余额不足：serverAmount 超过多签总额。
+	_, _, err := SubBuildDualFeePoolSpendTX(prevTxID, total, total, 800000, clientPriv, serverPriv.PubKey(), true, 0.5)
+	if !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+	var fundsErr *libs.InsufficientFundsError
+	if !errors.As(err, &fundsErr) || fundsErr.Have != total || fundsErr.Need <= total {
+		t.Fatalf("unexpected InsufficientFundsError: %+v", fundsErr)
+	}
+
+	btx, _, err := SubBuildDualFeePoolSpendTX(prevTxID, total, 100, 800000, clientPriv, serverPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	clientSig, err := SpendTXDualFeePoolClientSign(btx, total, clientPriv, serverPriv.PubKey())
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+
+	// 坏签名：用客户端签名冒充服务器签名。
+	_, err = ClientVerifyServerSpendSig(btx, total, serverPriv.PubKey(), clientPriv.PubKey(), clientSig)
+	if !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+	var sigErr *libs.SignatureError
+	if !errors.As(err, &sigErr) || sigErr.Party != libs.PartyServer {
+		t.Fatalf("expected SignatureError from server, got %v", err)
+	}
+
+	// 篡改 sighash 标志位同时匹配 ErrBadSignature 和 ErrUnexpectedSighash。
+	bad := append([]byte{}, *clientSig...)
+	bad[len(bad)-1] = 0x01
+	_, err = ServerVerifyClientSpendSig(btx, total, serverPriv.PubKey(), clientPriv.PubKey(), &bad)
+	if !errors.Is(err, libs.ErrBadSignature) || !errors.Is(err, libs.ErrUnexpectedSighash) {
+		t.Fatalf("expected ErrUnexpectedSighash, got %v", err)
+	}
+
+	// 非法 locktime。
+	badLocktime := uint32(600000000)
+	_, err = LoadTx(btx.Hex(), &badLocktime, 2, 200, serverPriv.PubKey(), clientPriv.PubKey(), total)
+	var ltErr *libs.LocktimeError
+	if !errors.Is(err, libs.ErrLocktimeOutOfRange) || !errors.As(err, &ltErr) || ltErr.Locktime != badLocktime {
+		t.Fatalf("expected LocktimeError, got %v", err)
+	}
+
+	// 非法交易 hex。
+	_, err = LoadTx("zz", nil, 2, 200, serverPriv.PubKey(), clientPriv.PubKey(), total)
+	if !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction, got %v", err)
+	}
+
+	// 序列号回退。
+	next, err := LoadTx(btx.Hex(), nil, 2, 200, serverPriv.PubKey(), clientPriv.PubKey(), total)
+	if err != nil {
+		t.Fatalf("load tx: %v", err)
+	}
+	if err := ValidateUpdateTransition(btx, next); err != nil {
+		t.Fatalf("valid transition rejected: %v", err)
+	}
+	stale, err := LoadTx(next.Hex(), nil, 2, 300, serverPriv.PubKey(), clientPriv.PubKey(), total)
+	if err != nil {
+		t.Fatalf("load tx: %v", err)
+	}
+	err = ValidateUpdateTransition(next, stale)
+	var seqErr *libs.SequenceError
+	if !errors.Is(err, libs.ErrSequenceRegression) || !errors.As(err, &seqErr) || seqErr.Current != 2 || seqErr.Proposed != 2 {
+		t.Fatalf("expected SequenceError, got %v", err)
+	}
+
+	// 锁定脚本被替换。
+	redirected, _ := LoadTx(btx.Hex(), nil, 3, 200, serverPriv.PubKey(), clientPriv.PubKey(), total)
+	redirected.Outputs[1].LockingScript = redirected.Outputs[0].LockingScript
+	if err := ValidateUpdateTransition(btx, redirected); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package chain_utils
+
+import (
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 延期：双方约定新的到期高度，在最近一次双方签名的 B-Tx 上后移 locktime、递增序列号并重新签名。
+//  1. 发起方调用 ProposeExpiryExtension 构建新 B-Tx 并签名。
+//  2. 接收方调用 AcceptExpiryExtension 核对（金额不变、序列号递增、延期幅度符合 ExpiryPolicy）后回签。
+//  3. 双方用 FinalizeExpiryExtension 验证两份签名并合成完整的新 B-Tx，持久化后才能丢弃旧状态。
+
+// ProposeExpiryExtension 发起方基于最近一次双方签名的 B-Tx 构建延期后的新状态并签名。
+func ProposeExpiryExtension(p ExtendExpiryParams) (*tx.Transaction, *[]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := p.Policy.Check(p.Prev.LockTime, p.EndHeight); err != nil {
+		return nil, nil, err
+	}
+
+	serverPublicKey, clientPublicKey := p.CounterpartyPublicKey, p.ProposerPrivateKey.PubKey()
+	if p.Proposer == libs.PartyServer {
+		serverPublicKey, clientPublicKey = clientPublicKey, serverPublicKey
+	}
+
+	amounts, _, err := statePayouts(p.Prev, serverPublicKey, clientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 延期不改变金额：支付输出齐全时按位置改写（沿用位置参数版本开出的 0 聪输出），否则按默认策略重建
+	var dust libs.DustPolicy
+	if len(libs.PayoutOutputs(p.Prev)) == 2 {
+		dust.Action = libs.DustKeepZero
+	}
+	endHeight := p.EndHeight
+	next, err := LoadTxV2(UpdateParams{
+		TxHex:              p.Prev.Hex(),
+		Locktime:           &endHeight,
+		Sequence:           p.Sequence,
+		ServerAmount:       amounts[0],
+		ServerPublicKey:    serverPublicKey,
+		ClientPublicKey:    clientPublicKey,
+		TotalAmount:        p.TotalAmount,
+		Dust:               dust,
+		ServerPayoutScript: p.ServerPayoutScript,
+		ClientPayoutScript: p.ClientPayoutScript,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := libs.ValidateExpiryExtension(p.Prev, next, p.Policy); err != nil {
+		return nil, nil, err
+	}
+
+	var signBytes *[]byte
+	if p.Proposer == libs.PartyClient {
+		signBytes, err = ClientDualFeePoolSpendTXUpdateSign(next, p.ProposerPrivateKey, serverPublicKey)
+	} else {
+		signBytes, err = ServerDualFeePoolSpendTXUpdateSign(next, p.ProposerPrivateKey, clientPublicKey)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	libs.Logger().Debug("dual_endpoint: expiry extension proposed",
+		"proposer", p.Proposer,
+		"end_height", p.Prev.LockTime,
+		"new_end_height", endHeight,
+		"sequence", p.Sequence,
+	)
+	return next, signBytes, nil
+}
+
+// AcceptExpiryExtension 接收方核对延期提案与策略上限，验证发起方签名后回签。
+func AcceptExpiryExtension(p ExtendExpiryAcceptParams) (*[]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := libs.ValidateExpiryExtension(p.Prev, p.Next, p.Policy); err != nil {
+		return nil, err
+	}
+
+	serverPublicKey, clientPublicKey := p.AcceptorPrivateKey.PubKey(), p.ProposerPublicKey
+	if p.Proposer == libs.PartyServer {
+		serverPublicKey, clientPublicKey = clientPublicKey, serverPublicKey
+	}
+	redeem, err := libs.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	p.Next.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: p.TotalAmount, LockingScript: redeem})
+	if _, err := verifySignatureWithContext(p.Next, 0, redeem, p.TotalAmount, p.Proposer, p.ProposerPublicKey, p.ProposerSignBytes); err != nil {
+		return nil, err
+	}
+
+	var signBytes *[]byte
+	if p.Proposer == libs.PartyClient {
+		signBytes, err = ServerDualFeePoolSpendTXUpdateSign(p.Next, p.AcceptorPrivateKey, clientPublicKey)
+	} else {
+		signBytes, err = ClientDualFeePoolSpendTXUpdateSign(p.Next, p.AcceptorPrivateKey, serverPublicKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	libs.Logger().Debug("dual_endpoint: expiry extension accepted",
+		"proposer", p.Proposer,
+		"new_end_height", p.Next.LockTime,
+		"sequence", p.Next.Inputs[0].SequenceNumber,
+	)
+	return signBytes, nil
+}
+
+// FinalizeExpiryExtension 验证双方对延期后 B-Tx 的签名并合成解锁脚本，返回可持久化的完整交易。
+func FinalizeExpiryExtension(
+	next *tx.Transaction,
+	totalAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	clientPublicKey *ec.PublicKey,
+	serverSignBytes *[]byte,
+	clientSignBytes *[]byte,
+) (*tx.Transaction, error) {
+	if next == nil || len(next.Inputs) != 1 {
+		return nil, fmt.Errorf("%w: extended tx must have exactly one input", libs.ErrInvalidTransaction)
+	}
+	return finalizeSpendState(next, totalAmount, serverPublicKey, clientPublicKey, serverSignBytes, clientSignBytes)
+}
+
+// finalizeSpendState 验证双方对单输入 B-Tx 状态的签名并写入解锁脚本。
+func finalizeSpendState(
+	next *tx.Transaction,
+	totalAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	clientPublicKey *ec.PublicKey,
+	serverSignBytes *[]byte,
+	clientSignBytes *[]byte,
+) (*tx.Transaction, error) {
+	redeem, err := libs.Lock([]*ec.PublicKey{serverPublicKey, clientPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	if _, err := verifySignatureWithContext(next, 0, redeem, totalAmount, libs.PartyServer, serverPublicKey, serverSignBytes); err != nil {
+		return nil, err
+	}
+	if _, err := verifySignatureWithContext(next, 0, redeem, totalAmount, libs.PartyClient, clientPublicKey, clientSignBytes); err != nil {
+		return nil, err
+	}
+	unlockingScript, err := libs.BuildSignScript(&[][]byte{*serverSignBytes, *clientSignBytes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build unlocking script: %w", err)
+	}
+	next.Inputs[0].UnlockingScript = unlockingScript
+	next.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: totalAmount, LockingScript: redeem})
+	return next, nil
+}
@@ -0,0 +1,100 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 延期：locktime 后移、序列号递增、金额不变，并受策略上限约束。
+func TestDualExtendExpiry(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	prevTxID := "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	const total = uint64(50000)
+
+	prev, _, err := SubBuildDualFeePoolSpendTX(prevTxID, total, 2000, 800000, clientPriv, serverPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	policy := libs.ExpiryPolicy{MaxExtension: 1000, MaxEndHeight: 802000}
+
+	next, serverSig, err := ProposeExpiryExtension(ExtendExpiryParams{
+		Prev: prev, TotalAmount: total, Proposer: libs.PartyServer, EndHeight: 801000,
+		ProposerPrivateKey: serverPriv, CounterpartyPublicKey: clientPriv.PubKey(), Policy: policy,
+	})
+	if err != nil {
+		t.Fatalf("propose: %v", err)
+	}
+	if next.LockTime != 801000 || next.Inputs[0].SequenceNumber != 2 || next.Outputs[0].Satoshis != prev.Outputs[0].Satoshis {
+		t.Fatalf("unexpected extended tx: locktime %d sequence %d", next.LockTime, next.Inputs[0].SequenceNumber)
+	}
+
+	wire, _ := tx.NewTransactionFromHex(next.Hex())
+	clientSig, err := AcceptExpiryExtension(ExtendExpiryAcceptParams{
+		Prev: prev, Next: wire, TotalAmount: total, Proposer: libs.PartyServer, ProposerSignBytes: serverSig,
+		ProposerPublicKey: serverPriv.PubKey(), AcceptorPrivateKey: clientPriv, Policy: policy,
+	})
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	final, err := FinalizeExpiryExtension(wire, total, serverPriv.PubKey(), clientPriv.PubKey(), serverSig, clientSig)
+	if err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	err = interpreter.NewEngine().Execute(
+		interpreter.WithTx(final, 0, final.Inputs[0].SourceTxOutput()),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("extended tx failed script check: %v", err)
+	}
+
+	// 超过单次上限、超过绝对上限、或把到期高度前移都会被拒绝
+	for _, endHeight := range []uint32{801001, 799999} {
+		_, _, err := ProposeExpiryExtension(ExtendExpiryParams{
+			Prev: prev, TotalAmount: total, Proposer: libs.PartyServer, EndHeight: endHeight,
+			ProposerPrivateKey: serverPriv, CounterpartyPublicKey: clientPriv.PubKey(), Policy: policy,
+		})
+		if err == nil {
+			t.Fatalf("end height %d should be rejected", endHeight)
+		}
+	}
+	if err := policy.Check(801500, 802001); !errors.Is(err, libs.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+	if err := policy.Check(800000, 799999); !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange, got %v", err)
+	}
+
+	// 零值策略也有单次上限 DefaultMaxExtension
+	var zero libs.ExpiryPolicy
+	if err := zero.Check(800000, 800000+libs.DefaultMaxExtension); err != nil {
+		t.Fatalf("zero policy must allow the default extension: %v", err)
+	}
+	_, _, err = ProposeExpiryExtension(ExtendExpiryParams{
+		Prev: prev, TotalAmount: total, Proposer: libs.PartyClient, EndHeight: 800000 + libs.DefaultMaxExtension + 1,
+		ProposerPrivateKey: clientPriv, CounterpartyPublicKey: serverPriv.PubKey(),
+	})
+	if !errors.Is(err, libs.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded for an uncapped extension under the zero policy, got %v", err)
+	}
+
+	// 接收方拒绝在延期时夹带金额变化
+	cheat, _ := tx.NewTransactionFromHex(next.Hex())
+	cheat.Outputs[0].Satoshis++
+	cheat.Outputs[1].Satoshis--
+	_, err = AcceptExpiryExtension(ExtendExpiryAcceptParams{
+		Prev: prev, Next: cheat, TotalAmount: total, Proposer: libs.PartyServer, ProposerSignBytes: serverSig,
+		ProposerPublicKey: serverPriv.PubKey(), AcceptorPrivateKey: clientPriv, Policy: policy,
+	})
+	if !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 各手续费策略在开池、更新与换池中一致生效，扣费后不足时返回 DustError。
+func TestDualFeePolicies(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	const total, serverAmount = uint64(100000), uint64(25000)
+
+	open := func(policy libs.FeePolicy, server uint64) (*SpendResult, error) {
+		return BuildDualFeePoolSpendTXV2(SpendParams{
+			PrevTxID:         "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+			TotalAmount:      total,
+			ServerAmount:     server,
+			EndHeight:        800000,
+			ClientPrivateKey: clientPriv,
+			ServerPublicKey:  serverPriv.PubKey(),
+			FeeRate:          50,
+			FeePolicy:        policy,
+		})
+	}
+
+	for _, policy := range []libs.FeePolicy{libs.FeeClientPays, libs.FeeServerPays, libs.FeeProportional, libs.FeeSplitEven} {
+		res, err := open(policy, serverAmount)
+		if err != nil {
+			t.Fatalf("%s: open: %v", policy, err)
+		}
+		server, client := res.Tx.Outputs[0].Satoshis, res.Tx.Outputs[1].Satoshis
+		fee := total - server - client
+		wantServer, wantClient := policy.Shares(serverAmount, total-serverAmount, fee)
+		if server != serverAmount-wantServer || client != total-serverAmount-wantClient || res.Amount != client {
+			t.Fatalf("%s: unexpected open amounts %d/%d fee %d", policy, server, client, fee)
+		}
+
+		// 更新时沿用同一策略：ServerAmount 为扣费前金额，B-Tx 的手续费保持不变
+		updated, err := LoadTxV2(UpdateParams{
+			TxHex:           res.Tx.Hex(),
+			Sequence:        2,
+			ServerAmount:    60000,
+			ServerPublicKey: serverPriv.PubKey(),
+			ClientPublicKey: clientPriv.PubKey(),
+			TotalAmount:     total,
+			FeePolicy:       policy,
+		})
+		if err != nil {
+			t.Fatalf("%s: update: %v", policy, err)
+		}
+		wantServer, wantClient = policy.Shares(60000, total-60000, fee)
+		if updated.Outputs[0].Satoshis != 60000-wantServer || updated.Outputs[1].Satoshis != total-60000-wantClient {
+			t.Fatalf("%s: unexpected update amounts %d/%d", policy, updated.Outputs[0].Satoshis, updated.Outputs[1].Satoshis)
+		}
+		if err := ValidateUpdateTransition(res.Tx, updated); err != nil {
+			t.Fatalf("%s: update transition: %v", policy, err)
+		}
+
+		// 换池：释放的 B-Tx 手续费与换池手续费之差同样按策略分摊
+		rollover, err := BuildDualRolloverTx(RolloverParams{
+			Latest:          updated,
+			PoolAmount:      total,
+			ClientPublicKey: clientPriv.PubKey(),
+			ServerPublicKey: serverPriv.PubKey(),
+			FeeRate:         50,
+			FeePolicy:       policy,
+		})
+		if err != nil {
+			t.Fatalf("%s: rollover: %v", policy, err)
+		}
+		if got := rollover.Amount + rollover.ServerPayout + rollover.Fee; got != total {
+			t.Fatalf("%s: rollover amounts %d + %d + fee %d do not add up", policy, rollover.Amount, rollover.ServerPayout, rollover.Fee)
+		}
+	}
+
+	// 服务器没有余额时无法承担手续费
+	_, err := open(libs.FeeServerPays, 0)
+	var dustErr *libs.DustError
+	if !errors.Is(err, libs.ErrBelowDust) || !errors.As(err, &dustErr) || dustErr.Party != libs.PartyServer {
+		t.Fatalf("expected server DustError, got %v", err)
+	}
+	if !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("dust error from a shortfall should also match ErrInsufficientFunds")
+	}
+	if _, err := open(libs.FeePolicy(9), serverAmount); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for unknown policy, got %v", err)
+	}
+}
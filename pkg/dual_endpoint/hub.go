@@ -0,0 +1,832 @@
+package chain_utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 中转转账：服务器与客户端 X、Y 各有一个双端池，X 经服务器付款给 Y，不需要链上交易。
+// 两条腿用同一个哈希锁的条件支付耦合在一起：
+//   - 入方向（X 的池）：X 付给服务器，条件输出的收款方为服务器，退款高度 T_in；
+//   - 出方向（Y 的池）：服务器付给 Y，条件输出的收款方为 Y，退款高度 T_out。
+//
+// Y 生成原像并把哈希交给 X。服务器只有在入方向锁定（双方签名）之后才锁定出方向，且
+// T_out + MinTimeoutDelta ≤ T_in、X 的池到期高度 + MinTimeoutDelta ≤ T_in。条件输出的领取与退款都由脚本强制（见 conditional.go），
+// 因此两条腿在链上也是原子的：
+//   - Y 只有出示原像才能拿到出方向的金额：链下结清，或在 T_out 之前链上领取（原像随领取交易公开，用 RecordOnChain 记录）。
+//     服务器最晚在 T_out 附近得知原像，此时 X 的池已经到期，服务器在 T_in 之前结清入方向，
+//     X 不配合时广播入方向的 Add 并用 BuildIncomingClaim 链上领取。
+//   - 原像不出现时，Y 不同意取消的出方向在 T_out 之后由服务器用 BuildOutgoingRefund 取回，入方向随后取消，
+//     或由 X 在 T_in 之后链上退款。
+//
+// Hub 在 HubStore 中为每个池保存服务器最近一次双方签名的状态（HubPool）：条件支付的 Prev 必须与它完全一致，
+// 客户端不能用旧状态或伪造的余额提出中转腿。开池及中转之外的更新完成后调用 RecordPoolState 登记；
+// 腿锁定后池的最近状态为 Add，结清或取消后为结果状态，期间池被该转账占用。
+// 每次状态变化都先写入 HubStore，再把服务器签名交给对方；崩溃后用 Recover 找出未完成的转账及下一步操作。
+// 出方向锁定后服务器还应监视 Y 的池：条件输出在链上被花费时调用 RecordOnChain。
+
+// HubTransferState 是中转转账的状态。
+type HubTransferState uint8
+
+const (
+	HubTransferPending HubTransferState = iota // 已创建，入方向尚未锁定
+	HubIncomingLocked                          // 入方向的条件支付已双方签名
+	HubOutgoingLocked                          // 出方向的条件支付也已双方签名
+	HubPreimageKnown                           // 已得到原像，两条腿都按结清处理
+	HubSettled                                 // 两条腿都已结清
+	HubCancelled                               // 两条腿都已取消，或入方向从未锁定
+)
+
+func (s HubTransferState) String() string {
+	switch s {
+	case HubTransferPending:
+		return "pending"
+	case HubIncomingLocked:
+		return "incoming-locked"
+	case HubOutgoingLocked:
+		return "outgoing-locked"
+	case HubPreimageKnown:
+		return "preimage-known"
+	case HubSettled:
+		return "settled"
+	case HubCancelled:
+		return "cancelled"
+	}
+	return fmt.Sprintf("hub-state(%d)", uint8(s))
+}
+
+// HubLegKind 区分转账的两条腿。
+type HubLegKind uint8
+
+const (
+	HubIncoming HubLegKind = iota // 付款客户端的池：客户端付给服务器
+	HubOutgoing                   // 收款客户端的池：服务器付给客户端
+)
+
+func (k HubLegKind) String() string {
+	if k == HubOutgoing {
+		return "outgoing"
+	}
+	return "incoming"
+}
+
+// HubLeg 是一条腿在某个池中的条件支付记录。
+type HubLeg struct {
+	Pool            string `json:"pool"`              // 调用方的池标识
+	ClientPublicKey string `json:"client_public_key"` // 压缩公钥 hex
+	TotalAmount     uint64 `json:"total_amount"`
+	Amount          uint64 `json:"amount"`
+	Timeout         uint32 `json:"timeout"` // 条件输出的退款高度
+	Vout            uint32 `json:"vout"`
+	Fee             uint64 `json:"fee"`
+	Add             string `json:"add,omitempty"`      // Add 状态 hex，锁定后为双方签名的完整交易
+	Resolved        string `json:"resolved,omitempty"` // 双方签名的结清或取消状态 hex，或链上花费条件输出的交易 hex
+	OnChain         bool   `json:"on_chain,omitempty"` // Resolved 是链上的领取或退款交易
+	Locked          bool   `json:"locked"`
+}
+
+// HubPool 是 Hub 保存的池记录：服务器在该池中最近一次双方签名的 B-Tx。
+type HubPool struct {
+	Pool            string `json:"pool"`
+	ClientPublicKey string `json:"client_public_key"` // 压缩公钥 hex
+	TotalAmount     uint64 `json:"total_amount"`
+	Latest          string `json:"latest"`             // 最近一次双方签名的 B-Tx hex
+	Transfer        string `json:"transfer,omitempty"` // 占用该池的转账 id，腿结清、取消或转账放弃后清空
+}
+
+// HubTransfer 是持久化的中转转账路由状态。
+type HubTransfer struct {
+	ID       string           `json:"id"`
+	Hash     string           `json:"hash"`               // 原像 SHA-256 的 hex
+	Preimage string           `json:"preimage,omitempty"` // 原像 hex
+	State    HubTransferState `json:"state"`
+	Incoming HubLeg           `json:"incoming"`
+	Outgoing HubLeg           `json:"outgoing"`
+}
+
+// Leg 返回指定的一条腿。
+func (t *HubTransfer) Leg(kind HubLegKind) *HubLeg {
+	if kind == HubOutgoing {
+		return &t.Outgoing
+	}
+	return &t.Incoming
+}
+
+// RoutingFee 返回服务器的中转收入（入方向金额减出方向金额）。
+func (t *HubTransfer) RoutingFee() uint64 {
+	return t.Incoming.Amount - t.Outgoing.Amount
+}
+
+func (t *HubTransfer) hash() ([32]byte, error) {
+	var hash [32]byte
+	b, err := hex.DecodeString(t.Hash)
+	if err != nil || len(b) != len(hash) {
+		return hash, fmt.Errorf("%w: transfer %q has an invalid hash", libs.ErrInvalidParams, t.ID)
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+// HubPolicy 配置中转转账的安全边界。
+type HubPolicy struct {
+	// 出方向退款高度至少比入方向早的区块数，也是入方向退款高度与 X 的池到期高度的最小间隔；
+	// 为 0 时使用 DefaultHubTimeoutDelta
+	MinTimeoutDelta uint32
+}
+
+// DefaultHubTimeoutDelta 是退款高度的默认最小间隔，留给服务器得知原像后在链上领取入方向。
+const DefaultHubTimeoutDelta uint32 = 72
+
+func (p HubPolicy) minTimeoutDelta() uint32 {
+	if p.MinTimeoutDelta == 0 {
+		return DefaultHubTimeoutDelta
+	}
+	return p.MinTimeoutDelta
+}
+
+// HubLegSignatures 是服务器对一条腿的 Add 的签名。
+type HubLegSignatures struct {
+	Add *[]byte
+}
+
+// Hub 是服务器侧的中转转账协调器，方法可并发调用。
+type Hub struct {
+	mu               sync.Mutex
+	store            HubStore
+	serverPrivateKey *ec.PrivateKey
+	policy           HubPolicy
+}
+
+// NewHub 用持久化存储与服务器私钥创建协调器；崩溃后用同一个存储重新创建即可恢复。
+func NewHub(store HubStore, serverPrivateKey *ec.PrivateKey, policy HubPolicy) (*Hub, error) {
+	if store == nil || serverPrivateKey == nil {
+		return nil, invalidParams("hub store and server private key are required")
+	}
+	return &Hub{store: store, serverPrivateKey: serverPrivateKey, policy: policy}, nil
+}
+
+// Begin 创建一笔转账：X 付 incomingAmount，Y 收 outgoingAmount，差额为服务器的中转收入。
+func (h *Hub) Begin(id string, hash [32]byte, incomingAmount, outgoingAmount uint64) (*HubTransfer, error) {
+	if id == "" {
+		return nil, invalidParams("transfer id is required")
+	}
+	if outgoingAmount == 0 || outgoingAmount > incomingAmount {
+		return nil, invalidParams("outgoing amount %d must be positive and not exceed incoming amount %d", outgoingAmount, incomingAmount)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	existing, err := h.store.LoadTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, invalidParams("transfer %q already exists", id)
+	}
+	t := &HubTransfer{
+		ID:       id,
+		Hash:     hex.EncodeToString(hash[:]),
+		State:    HubTransferPending,
+		Incoming: HubLeg{Amount: incomingAmount},
+		Outgoing: HubLeg{Amount: outgoingAmount},
+	}
+	if err := h.store.SaveTransfer(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RecordPoolState 登记池最近一次双方签名的 B-Tx，在开池以及中转之外的每次更新之后调用。
+// latest 必须带有服务器与客户端对 totalAmount 多签输出的有效签名；同一 outpoint 上序列号必须递增，
+// 池被未完成的转账占用时返回 ErrInvalidState。
+func (h *Hub) RecordPoolState(pool string, latest *tx.Transaction, totalAmount uint64, clientPublicKey *ec.PublicKey) error {
+	if pool == "" || latest == nil || clientPublicKey == nil || totalAmount == 0 {
+		return invalidParams("pool id, latest state, total amount and client public key are required")
+	}
+	if err := VerifyDualSignedState(latest, 0, totalAmount, h.serverPrivateKey.PubKey(), clientPublicKey); err != nil {
+		return fmt.Errorf("latest: %w", err)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	existing, err := h.store.LoadPool(pool)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if existing.Transfer != "" {
+			return fmt.Errorf("%w: pool %q is in use by transfer %q", libs.ErrInvalidState, pool, existing.Transfer)
+		}
+		prev, err := tx.NewTransactionFromHex(existing.Latest)
+		if err != nil {
+			return fmt.Errorf("%w: decode tx hex: %w", libs.ErrInvalidTransaction, err)
+		}
+		current, proposed := prev.Inputs[0], latest.Inputs[0]
+		if current.SourceTXID.IsEqual(proposed.SourceTXID) && current.SourceTxOutIndex == proposed.SourceTxOutIndex &&
+			proposed.SequenceNumber <= current.SequenceNumber {
+			return &libs.SequenceError{Current: current.SequenceNumber, Proposed: proposed.SequenceNumber}
+		}
+	}
+	return h.savePool(&HubPool{
+		Pool:            pool,
+		ClientPublicKey: hex.EncodeToString(clientPublicKey.Compressed()),
+		TotalAmount:     totalAmount,
+		Latest:          latest.Hex(),
+	})
+}
+
+// Pool 返回保存的池记录。
+func (h *Hub) Pool(pool string) (*HubPool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.loadPool(pool)
+}
+
+// Transfer 返回保存的转账。
+func (h *Hub) Transfer(id string) (*HubTransfer, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.load(id)
+}
+
+// AcceptIncoming 核对 X 提出的入方向条件支付并返回服务器对 Add 的签名。
+// 服务器是收款方，可以先签名；X 交出自己的签名后由 LockIncoming 完成锁定。
+func (h *Hub) AcceptIncoming(id string, leg HubLegParams) (*HubLegSignatures, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.State != HubTransferPending {
+		return nil, h.stateError(t, "accept incoming leg")
+	}
+	proposal, pool, err := h.verifyLeg(t, HubIncoming, leg)
+	if err != nil {
+		return nil, err
+	}
+	// X 的池到期后入方向的 Add 才能上链，服务器需要在 T_in 之前留出领取的时间
+	if delta, end := h.policy.minTimeoutDelta(), leg.Conditional.Prev.LockTime; leg.Conditional.Timeout < end+delta {
+		return nil, &libs.LocktimeError{Locktime: leg.Conditional.Timeout, Min: end + delta, Max: libs.MaxBlockHeightLocktime - 1}
+	}
+	sigs, err := h.signLeg(proposal, leg.Conditional.ClientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	t.Incoming = newHubLeg(t.Incoming.Amount, leg, proposal)
+	if err := h.save(t); err != nil {
+		return nil, err
+	}
+	// 服务器签名交出后池即被占用，直到入方向结清、取消或转账被放弃
+	pool.Transfer = t.ID
+	if err := h.savePool(pool); err != nil {
+		return nil, err
+	}
+	return sigs, nil
+}
+
+// LockIncoming 用 X 对 Add 的签名完成入方向的锁定。
+func (h *Hub) LockIncoming(id string, clientAddSig *[]byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return err
+	}
+	if t.State != HubTransferPending || t.Incoming.Add == "" {
+		return h.stateError(t, "lock incoming leg")
+	}
+	if err := h.finalizeLeg(&t.Incoming, clientAddSig); err != nil {
+		return err
+	}
+	t.State = HubIncomingLocked
+	if err := h.save(t); err != nil {
+		return err
+	}
+	pool, err := h.loadPool(t.Incoming.Pool)
+	if err != nil {
+		return err
+	}
+	pool.Latest = t.Incoming.Add
+	return h.savePool(pool)
+}
+
+// LockOutgoing 在入方向锁定后核对 Y 的出方向条件支付。服务器是付款方，Y 必须先签名 Add；
+// 服务器验证、签名并持久化后返回自己的签名，出方向随即锁定。
+func (h *Hub) LockOutgoing(id string, leg HubLegParams) (*HubLegSignatures, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.State != HubIncomingLocked {
+		return nil, h.stateError(t, "lock outgoing leg")
+	}
+	if leg.ClientAddSig == nil {
+		return nil, invalidParams("payee signature on the outgoing add state is required")
+	}
+	proposal, pool, err := h.verifyLeg(t, HubOutgoing, leg)
+	if err != nil {
+		return nil, err
+	}
+	// 出方向先到期，服务器得知原像后在入方向的退款高度之前仍有时间结清或领取入方向
+	if delta := h.policy.minTimeoutDelta(); leg.Conditional.Timeout+delta > t.Incoming.Timeout {
+		return nil, &libs.LocktimeError{Locktime: leg.Conditional.Timeout, Min: 1, Max: t.Incoming.Timeout - min(delta, t.Incoming.Timeout)}
+	}
+	sigs, err := h.signLeg(proposal, leg.Conditional.ClientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	outgoing := newHubLeg(t.Outgoing.Amount, leg, proposal)
+	if err := h.finalizeLeg(&outgoing, leg.ClientAddSig); err != nil {
+		return nil, err
+	}
+	t.Outgoing = outgoing
+	t.State = HubOutgoingLocked
+	if err := h.save(t); err != nil {
+		return nil, err
+	}
+	pool.Latest, pool.Transfer = outgoing.Add, t.ID
+	if err := h.savePool(pool); err != nil {
+		return nil, err
+	}
+	return sigs, nil
+}
+
+// ReceivePreimage 记录原像（来自 Y 的结清请求，或用 libs.ExtractPreimage 从 Y 的链上领取交易取得）。
+// 原像写入存储后两条腿都只能结清。
+func (h *Hub) ReceivePreimage(id string, preimage []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return err
+	}
+	if t.State == HubPreimageKnown || t.State == HubSettled {
+		return nil
+	}
+	if t.State != HubOutgoingLocked || t.Outgoing.Resolved != "" {
+		return h.stateError(t, "receive preimage")
+	}
+	hash, err := t.hash()
+	if err != nil {
+		return err
+	}
+	if err := libs.CheckPreimage(hash, preimage); err != nil {
+		return err
+	}
+	t.Preimage = hex.EncodeToString(preimage)
+	t.State = HubPreimageKnown
+	return h.save(t)
+}
+
+// Abort 放弃入方向尚未锁定的转账。X 此后在自己的池中的更新须使用高于 Add 的序列号。
+func (h *Hub) Abort(id string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return err
+	}
+	if t.State != HubTransferPending {
+		return h.stateError(t, "abort")
+	}
+	t.State = HubCancelled
+	if err := h.save(t); err != nil {
+		return err
+	}
+	if t.Incoming.Pool == "" {
+		return nil
+	}
+	pool, err := h.loadPool(t.Incoming.Pool)
+	if err != nil {
+		return err
+	}
+	if pool.Transfer != t.ID {
+		return nil
+	}
+	pool.Transfer = ""
+	return h.savePool(pool)
+}
+
+// ProposeResolution 构建一条腿的结清（已知原像）或取消状态，并返回服务器签名。
+// 未知原像时只能先取消出方向（需要 Y 同意），出方向未锁定或已取消后才能取消入方向。
+func (h *Hub) ProposeResolution(id string, kind HubLegKind) (*tx.Transaction, *[]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	next, clientPublicKey, err := h.resolution(t, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverSig, err := ServerDualFeePoolSpendTXUpdateSign(next, h.serverPrivateKey, clientPublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return next, serverSig, nil
+}
+
+// CompleteResolution 用客户端签名完成一条腿的结清或取消并持久化，返回双方签名的新状态。
+func (h *Hub) CompleteResolution(id string, kind HubLegKind, clientSig *[]byte) (*tx.Transaction, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return nil, err
+	}
+	next, clientPublicKey, err := h.resolution(t, kind)
+	if err != nil {
+		return nil, err
+	}
+	leg := t.Leg(kind)
+	serverSig, err := ServerDualFeePoolSpendTXUpdateSign(next, h.serverPrivateKey, clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := finalizeSpendState(next, leg.TotalAmount, h.serverPrivateKey.PubKey(), clientPublicKey, serverSig, clientSig)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.resolveLeg(t, kind, resolved.Hex(), resolved.Hex(), false); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// BuildIncomingClaim 在已知原像、X 不配合结清时构建入方向的链上领取：返回双方签名的 Add 与服务器的领取交易。
+// Add 在 X 的池到期后才能上链，领取交易必须在 T_in 之前确认；payoutScript 为空时使用服务器公钥的 P2PKH。
+// 两笔交易确认后调用 RecordOnChain 记录。
+func (h *Hub) BuildIncomingClaim(id string, payoutScript *script.Script, feeRate float64) (*tx.Transaction, *tx.Transaction, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.State != HubPreimageKnown || t.Incoming.Resolved != "" {
+		return nil, nil, h.stateError(t, "claim incoming leg")
+	}
+	preimage, err := hex.DecodeString(t.Preimage)
+	if err != nil {
+		return nil, nil, invalidParams("invalid stored preimage: %v", err)
+	}
+	add, err := tx.NewTransactionFromHex(t.Incoming.Add)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: decode tx hex: %w", libs.ErrInvalidTransaction, err)
+	}
+	claim, err := libs.BuildConditionalClaimTx(add, t.Incoming.Vout, preimage, h.serverPrivateKey, payoutScript, feeRateOrDefault(feeRate))
+	if err != nil {
+		return nil, nil, err
+	}
+	return add, claim, nil
+}
+
+// BuildOutgoingRefund 在原像未出现、Y 不同意取消时构建出方向的链上退款：返回双方签名的 Add 与服务器的退款交易。
+// 退款交易在 T_out 之后才能上链；payoutScript 为空时使用服务器公钥的 P2PKH。两笔交易确认后调用 RecordOnChain 记录。
+func (h *Hub) BuildOutgoingRefund(id string, payoutScript *script.Script, feeRate float64) (*tx.Transaction, *tx.Transaction, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.State != HubOutgoingLocked || t.Outgoing.Resolved != "" {
+		return nil, nil, h.stateError(t, "refund outgoing leg")
+	}
+	add, err := tx.NewTransactionFromHex(t.Outgoing.Add)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: decode tx hex: %w", libs.ErrInvalidTransaction, err)
+	}
+	refund, err := libs.BuildConditionalRefundTx(add, t.Outgoing.Vout, h.serverPrivateKey, payoutScript, feeRateOrDefault(feeRate))
+	if err != nil {
+		return nil, nil, err
+	}
+	return add, refund, nil
+}
+
+// RecordOnChain 记录链上花费一条腿条件输出的交易：add 是上链的 Add（可能由对方重新签名，未签名部分必须与记录一致），
+// spend 花费其中的条件输出。spend 出示了原像时按领取处理并记录原像（Y 在链上领取出方向时两条腿随即都按结清处理），
+// 否则按退款处理。该腿的池随之关闭并释放。
+func (h *Hub) RecordOnChain(id string, kind HubLegKind, add, spend *tx.Transaction) error {
+	if add == nil || spend == nil {
+		return invalidParams("add and spend transactions are required")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, err := h.load(id)
+	if err != nil {
+		return err
+	}
+	leg := t.Leg(kind)
+	if !leg.Locked || leg.Resolved != "" {
+		return h.stateError(t, "record on-chain "+kind.String()+" leg")
+	}
+	recorded, err := tx.NewTransactionFromHex(leg.Add)
+	if err != nil {
+		return fmt.Errorf("%w: decode tx hex: %w", libs.ErrInvalidTransaction, err)
+	}
+	if !bytes.Equal(libs.UnsignedBytes(add), libs.UnsignedBytes(recorded)) {
+		return fmt.Errorf("%w: %s add does not match the locked state", libs.ErrTransitionMismatch, kind)
+	}
+	spends := false
+	for _, input := range spend.Inputs {
+		if input.SourceTXID != nil && input.SourceTXID.IsEqual(add.TxID()) && input.SourceTxOutIndex == leg.Vout {
+			spends = true
+		}
+	}
+	if !spends {
+		return fmt.Errorf("%w: spend does not use the %s conditional output", libs.ErrInvalidTransaction, kind)
+	}
+	hash, err := t.hash()
+	if err != nil {
+		return err
+	}
+	if preimage, err := libs.ExtractPreimage(spend, hash); err == nil && t.Preimage == "" {
+		t.Preimage = hex.EncodeToString(preimage)
+		t.State = HubPreimageKnown
+	}
+	return h.resolveLeg(t, kind, spend.Hex(), add.Hex(), true)
+}
+
+// HubAction 是恢复时对未完成转账建议的下一步操作。
+type HubAction uint8
+
+const (
+	HubActionWait           HubAction = iota // 等待原像或 Y 同意取消出方向，T_out 之后可用 BuildOutgoingRefund 退款（同时监视 Y 的链上领取）
+	HubActionAbort                           // 入方向未锁定：调用 Abort
+	HubActionCancelIncoming                  // 出方向未锁定或已取消：取消入方向
+	HubActionSettleIncoming                  // 已知原像：结清入方向，X 不配合时用 BuildIncomingClaim 链上领取
+	HubActionSettleOutgoing                  // 已知原像：结清出方向
+)
+
+func (a HubAction) String() string {
+	switch a {
+	case HubActionWait:
+		return "wait"
+	case HubActionAbort:
+		return "abort"
+	case HubActionCancelIncoming:
+		return "cancel-incoming"
+	case HubActionSettleIncoming:
+		return "settle-incoming"
+	case HubActionSettleOutgoing:
+		return "settle-outgoing"
+	}
+	return fmt.Sprintf("hub-action(%d)", uint8(a))
+}
+
+// HubRecovery 是一笔未完成转账及其下一步操作。
+type HubRecovery struct {
+	Transfer *HubTransfer
+	Action   HubAction
+}
+
+// NextAction 返回转账的下一步操作；已结清或已取消的转账返回 HubActionWait。
+func NextAction(t *HubTransfer) HubAction {
+	switch t.State {
+	case HubTransferPending:
+		return HubActionAbort
+	case HubIncomingLocked:
+		return HubActionCancelIncoming
+	case HubOutgoingLocked:
+		if t.Outgoing.Resolved != "" {
+			return HubActionCancelIncoming
+		}
+	case HubPreimageKnown:
+		if t.Incoming.Resolved == "" {
+			return HubActionSettleIncoming
+		}
+		return HubActionSettleOutgoing
+	}
+	return HubActionWait
+}
+
+// Recover 从存储中找出所有未结清也未取消的转账及其下一步操作，用于崩溃后继续。
+func (h *Hub) Recover() ([]HubRecovery, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	transfers, err := h.store.ListTransfers()
+	if err != nil {
+		return nil, err
+	}
+	var pending []HubRecovery
+	for _, t := range transfers {
+		if t.State == HubSettled || t.State == HubCancelled {
+			continue
+		}
+		pending = append(pending, HubRecovery{Transfer: t, Action: NextAction(t)})
+	}
+	return pending, nil
+}
+
+func (h *Hub) load(id string) (*HubTransfer, error) {
+	t, err := h.store.LoadTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, invalidParams("transfer %q not found", id)
+	}
+	return t, nil
+}
+
+func (h *Hub) save(t *HubTransfer) error {
+	if err := h.store.SaveTransfer(t); err != nil {
+		return err
+	}
+	libs.Logger().Debug("dual_endpoint: hub transfer updated", "id", t.ID, "state", t.State.String())
+	return nil
+}
+
+func (h *Hub) loadPool(id string) (*HubPool, error) {
+	pool, err := h.store.LoadPool(id)
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		return nil, invalidParams("pool %q has no recorded state", id)
+	}
+	return pool, nil
+}
+
+func (h *Hub) savePool(pool *HubPool) error {
+	if err := h.store.SavePool(pool); err != nil {
+		return err
+	}
+	libs.Logger().Debug("dual_endpoint: hub pool updated", "pool", pool.Pool, "transfer", pool.Transfer)
+	return nil
+}
+
+// resolveLeg 记录一条腿的结果并更新转账状态，把池的最近状态设为 latest 并释放池。
+func (h *Hub) resolveLeg(t *HubTransfer, kind HubLegKind, resolved, latest string, onChain bool) error {
+	leg := t.Leg(kind)
+	leg.Resolved, leg.OnChain = resolved, onChain
+	switch {
+	case t.State == HubPreimageKnown && t.Incoming.Resolved != "" && t.Outgoing.Resolved != "":
+		t.State = HubSettled
+	case t.State != HubPreimageKnown && t.Incoming.Resolved != "" && (!t.Outgoing.Locked || t.Outgoing.Resolved != ""):
+		t.State = HubCancelled
+	}
+	if err := h.save(t); err != nil {
+		return err
+	}
+	pool, err := h.loadPool(leg.Pool)
+	if err != nil {
+		return err
+	}
+	pool.Latest, pool.Transfer = latest, ""
+	return h.savePool(pool)
+}
+
+func (h *Hub) stateError(t *HubTransfer, action string) error {
+	return fmt.Errorf("%w: cannot %s for transfer %q in state %s", libs.ErrInvalidState, action, t.ID, t.State)
+}
+
+// verifyLeg 核对一条腿的条件支付参数与转账及池记录一致：Prev 必须是池中最近一次双方签名的状态，
+// 再按参数重建核对 Add。返回重建的提案与池记录。
+func (h *Hub) verifyLeg(t *HubTransfer, kind HubLegKind, leg HubLegParams) (*ConditionalProposal, *HubPool, error) {
+	if err := leg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	c := leg.Conditional
+	pool, err := h.loadPool(leg.Pool)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pool.Transfer != "" && pool.Transfer != t.ID {
+		return nil, nil, fmt.Errorf("%w: pool %q is in use by transfer %q", libs.ErrInvalidState, pool.Pool, pool.Transfer)
+	}
+	if pool.ClientPublicKey != hex.EncodeToString(c.ClientPublicKey.Compressed()) || pool.TotalAmount != c.TotalAmount {
+		return nil, nil, invalidParams("%s leg client key or total amount does not match pool %q", kind, pool.Pool)
+	}
+	if c.Prev.Hex() != pool.Latest {
+		return nil, nil, fmt.Errorf("%w: %s leg prev is not the latest co-signed state of pool %q", libs.ErrTransitionMismatch, kind, pool.Pool)
+	}
+	payer := libs.PartyClient
+	if kind == HubOutgoing {
+		payer = libs.PartyServer
+	}
+	if c.Payer != payer {
+		return nil, nil, invalidParams("%s leg must be paid by the %s", kind, payer)
+	}
+	if !c.ServerPublicKey.IsEqual(h.serverPrivateKey.PubKey()) {
+		return nil, nil, invalidParams("%s leg is not for this hub's server key", kind)
+	}
+	hash, err := t.hash()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Hash != hash {
+		return nil, nil, invalidParams("%s leg hash does not match transfer %q", kind, t.ID)
+	}
+	if want := t.Leg(kind).Amount; c.Amount != want {
+		return nil, nil, invalidParams("%s leg amount %d, transfer expects %d", kind, c.Amount, want)
+	}
+	proposal, err := VerifyConditionalPayment(leg.Add, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proposal, pool, nil
+}
+
+// signLeg 返回服务器对 Add 的签名。
+func (h *Hub) signLeg(proposal *ConditionalProposal, clientPublicKey *ec.PublicKey) (*HubLegSignatures, error) {
+	addSig, err := ServerDualFeePoolSpendTXUpdateSign(proposal.Add, h.serverPrivateKey, clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &HubLegSignatures{Add: addSig}, nil
+}
+
+// finalizeLeg 验证客户端签名、补上服务器签名，把 Add 替换为双方签名的完整交易。
+func (h *Hub) finalizeLeg(leg *HubLeg, clientAddSig *[]byte) error {
+	clientPublicKey, err := ec.PublicKeyFromString(leg.ClientPublicKey)
+	if err != nil {
+		return invalidParams("invalid client public key: %v", err)
+	}
+	serverPublicKey := h.serverPrivateKey.PubKey()
+	unsigned, err := tx.NewTransactionFromHex(leg.Add)
+	if err != nil {
+		return fmt.Errorf("%w: decode tx hex: %w", libs.ErrInvalidTransaction, err)
+	}
+	unsigned, err = restoreSpendState(unsigned, leg.TotalAmount, serverPublicKey, clientPublicKey, unsigned.Inputs[0].SequenceNumber)
+	if err != nil {
+		return err
+	}
+	serverSig, err := ServerDualFeePoolSpendTXUpdateSign(unsigned, h.serverPrivateKey, clientPublicKey)
+	if err != nil {
+		return err
+	}
+	signed, err := finalizeSpendState(unsigned, leg.TotalAmount, serverPublicKey, clientPublicKey, serverSig, clientAddSig)
+	if err != nil {
+		return err
+	}
+	leg.Add = signed.Hex()
+	leg.Locked = true
+	return nil
+}
+
+// resolution 按转账状态构建一条腿的结清或取消状态。
+func (h *Hub) resolution(t *HubTransfer, kind HubLegKind) (*tx.Transaction, *ec.PublicKey, error) {
+	leg := t.Leg(kind)
+	if !leg.Locked || leg.Resolved != "" {
+		return nil, nil, h.stateError(t, "resolve "+kind.String()+" leg")
+	}
+	settle := t.State == HubPreimageKnown
+	if !settle {
+		cancellable := kind == HubOutgoing && t.State == HubOutgoingLocked ||
+			kind == HubIncoming && (t.State == HubIncomingLocked || t.State == HubOutgoingLocked && t.Outgoing.Resolved != "")
+		if !cancellable {
+			return nil, nil, h.stateError(t, "cancel "+kind.String()+" leg")
+		}
+	}
+	clientPublicKey, err := ec.PublicKeyFromString(leg.ClientPublicKey)
+	if err != nil {
+		return nil, nil, invalidParams("invalid client public key: %v", err)
+	}
+	latest, err := tx.NewTransactionFromHex(leg.Add)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: decode tx hex: %w", libs.ErrInvalidTransaction, err)
+	}
+	p := ConditionalResolveParams{
+		Latest:          latest,
+		TotalAmount:     leg.TotalAmount,
+		Vout:            leg.Vout,
+		Fee:             leg.Fee,
+		ServerPublicKey: h.serverPrivateKey.PubKey(),
+		ClientPublicKey: clientPublicKey,
+	}
+	if !settle {
+		next, err := CancelConditionalPayment(p)
+		return next, clientPublicKey, err
+	}
+	if p.Preimage, err = hex.DecodeString(t.Preimage); err != nil {
+		return nil, nil, invalidParams("invalid stored preimage: %v", err)
+	}
+	next, err := SettleConditionalPayment(p)
+	return next, clientPublicKey, err
+}
+
+// newHubLeg 根据核对过的参数与提案生成未锁定的腿记录。
+func newHubLeg(amount uint64, leg HubLegParams, proposal *ConditionalProposal) HubLeg {
+	return HubLeg{
+		Pool:            leg.Pool,
+		ClientPublicKey: hex.EncodeToString(leg.Conditional.ClientPublicKey.Compressed()),
+		TotalAmount:     leg.Conditional.TotalAmount,
+		Amount:          amount,
+		Timeout:         leg.Conditional.Timeout,
+		Vout:            proposal.Vout,
+		Fee:             proposal.Fee,
+		Add:             proposal.Add.Hex(),
+	}
+}
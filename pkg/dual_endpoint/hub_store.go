@@ -0,0 +1,115 @@
+package chain_utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// HubStore 持久化中转转账的路由状态。Hub 在每次状态变化后、把签名交给对方之前调用 SaveTransfer，
+// 进程崩溃后用同一个 HubStore 重新创建 Hub 即可通过 Recover 继续未完成的转账。
+type HubStore interface {
+	SaveTransfer(t *HubTransfer) error
+	// LoadTransfer 返回 id 对应的转账，不存在时返回 nil, nil。
+	LoadTransfer(id string) (*HubTransfer, error)
+	// ListTransfers 返回所有转账。
+	ListTransfers() ([]*HubTransfer, error)
+	SavePool(p *HubPool) error
+	// LoadPool 返回池标识对应的池记录，不存在时返回 nil, nil。
+	LoadPool(pool string) (*HubPool, error)
+}
+
+// MemoryHubStore 是保存在内存中的 HubStore，按 JSON 序列化保存副本，行为与持久化存储一致；用于测试与单进程部署。
+type MemoryHubStore struct {
+	mu      sync.Mutex
+	records map[string][]byte
+	pools   map[string][]byte
+}
+
+// NewMemoryHubStore 创建空的内存存储。
+func NewMemoryHubStore() *MemoryHubStore {
+	return &MemoryHubStore{records: make(map[string][]byte), pools: make(map[string][]byte)}
+}
+
+// SaveTransfer 保存转账的副本。
+func (s *MemoryHubStore) SaveTransfer(t *HubTransfer) error {
+	if t == nil || t.ID == "" {
+		return invalidParams("transfer id is required")
+	}
+	record, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encode transfer %q: %w", t.ID, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[t.ID] = record
+	return nil
+}
+
+// LoadTransfer 返回保存的转账副本。
+func (s *MemoryHubStore) LoadTransfer(id string) (*HubTransfer, error) {
+	s.mu.Lock()
+	record, ok := s.records[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	var t HubTransfer
+	if err := json.Unmarshal(record, &t); err != nil {
+		return nil, fmt.Errorf("decode transfer %q: %w", id, err)
+	}
+	return &t, nil
+}
+
+// ListTransfers 按 id 顺序返回所有转账的副本。
+func (s *MemoryHubStore) ListTransfers() ([]*HubTransfer, error) {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.records))
+	for id := range s.records {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	sort.Strings(ids)
+	transfers := make([]*HubTransfer, 0, len(ids))
+	for _, id := range ids {
+		t, err := s.LoadTransfer(id)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
+
+// SavePool 保存池记录的副本。
+func (s *MemoryHubStore) SavePool(p *HubPool) error {
+	if p == nil || p.Pool == "" {
+		return invalidParams("pool id is required")
+	}
+	record, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encode pool %q: %w", p.Pool, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pools[p.Pool] = record
+	return nil
+}
+
+// LoadPool 返回保存的池记录副本。
+func (s *MemoryHubStore) LoadPool(pool string) (*HubPool, error) {
+	s.mu.Lock()
+	record, ok := s.pools[pool]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	var p HubPool
+	if err := json.Unmarshal(record, &p); err != nil {
+		return nil, fmt.Errorf("decode pool %q: %w", pool, err)
+	}
+	return &p, nil
+}
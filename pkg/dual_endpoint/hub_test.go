@@ -0,0 +1,380 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 中转转账：X 经服务器付款给 Y，两条腿用同一哈希锁耦合，服务器崩溃后从存储恢复并继续结清。
+func TestHubTransfer(t *testing.T) {
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	xPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	yPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	const total = uint64(100000)
+
+	// openPool 返回客户端与服务器都已签名、服务器金额为 serverAmount 的 B-Tx
+	openPool := func(clientPriv *ec.PrivateKey, prevTxID string, serverAmount uint64) *tx.Transaction {
+		t.Helper()
+		res, err := BuildDualFeePoolSpendTXV2(SpendParams{
+			PrevTxID:         prevTxID,
+			TotalAmount:      total,
+			EndHeight:        800000,
+			ClientPrivateKey: clientPriv,
+			ServerPublicKey:  serverPriv.PubKey(),
+			FeeRate:          50,
+		})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		next, err := LoadTxV2(UpdateParams{
+			TxHex:           res.Tx.Hex(),
+			Sequence:        2,
+			ServerAmount:    serverAmount,
+			ServerPublicKey: serverPriv.PubKey(),
+			ClientPublicKey: clientPriv.PubKey(),
+			TotalAmount:     total,
+		})
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		clientSig, _ := ClientDualFeePoolSpendTXUpdateSign(next, clientPriv, serverPriv.PubKey())
+		serverSig, _ := ServerDualFeePoolSpendTXUpdateSign(next, serverPriv, clientPriv.PubKey())
+		merged, err := MergeDualPoolSigForSpendTx(next.Hex(), serverSig, clientSig)
+		if err != nil {
+			t.Fatalf("merge: %v", err)
+		}
+		return merged
+	}
+	clientSig := func(clientPriv *ec.PrivateKey, p *ConditionalProposal) *[]byte {
+		t.Helper()
+		addSig, err := ClientDualFeePoolSpendTXUpdateSign(p.Add, clientPriv, serverPriv.PubKey())
+		if err != nil {
+			t.Fatalf("client sign add: %v", err)
+		}
+		return addSig
+	}
+	xPrev := openPool(xPriv, "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", 20000)
+	yPrev := openPool(yPriv, "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", 50000)
+
+	store := NewMemoryHubStore()
+	hub, err := NewHub(store, serverPriv, HubPolicy{MinTimeoutDelta: 100})
+	if err != nil {
+		t.Fatalf("hub: %v", err)
+	}
+	preimage := []byte("invoice 7 from Y")
+	hash := libs.HashLock(preimage)
+	if _, err := hub.Begin("t1", hash, 10100, 10000); err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := hub.Begin("t1", hash, 10100, 10000); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for duplicate transfer, got %v", err)
+	}
+
+	// 入方向：X 付给服务器，服务器先签名，X 验证后交出自己的签名
+	incoming := ConditionalParams{
+		Prev:            xPrev,
+		TotalAmount:     total,
+		Payer:           libs.PartyClient,
+		Amount:          10100,
+		Hash:            hash,
+		Timeout:         xPrev.LockTime + 300,
+		FeeRate:         50,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: xPriv.PubKey(),
+	}
+	xProposal, err := AddConditionalPayment(incoming)
+	if err != nil {
+		t.Fatalf("incoming add: %v", err)
+	}
+	outgoing := ConditionalParams{
+		Prev:            yPrev,
+		TotalAmount:     total,
+		Payer:           libs.PartyServer,
+		Amount:          10000,
+		Hash:            hash,
+		Timeout:         incoming.Timeout - 100,
+		FeeRate:         50,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: yPriv.PubKey(),
+	}
+	yProposal, err := AddConditionalPayment(outgoing)
+	if err != nil {
+		t.Fatalf("outgoing add: %v", err)
+	}
+	yAddSig := clientSig(yPriv, yProposal)
+	outgoingLeg := HubLegParams{Pool: "pool-y", Conditional: outgoing, Add: yProposal.Add, ClientAddSig: yAddSig}
+	if _, err := hub.LockOutgoing("t1", outgoingLeg); !errors.Is(err, libs.ErrInvalidState) {
+		t.Fatalf("outgoing leg must not lock before the incoming leg, got %v", err)
+	}
+
+	incomingLeg := HubLegParams{Pool: "pool-x", Conditional: incoming, Add: xProposal.Add}
+	if _, err := hub.AcceptIncoming("t1", incomingLeg); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a pool without a recorded state, got %v", err)
+	}
+	// 服务器只登记双方签名的状态，腿的 Prev 必须与登记的状态一致
+	unsigned, _ := tx.NewTransactionFromHex(xPrev.Hex())
+	unsigned.Inputs[0].UnlockingScript = nil
+	if err := hub.RecordPoolState("pool-x", unsigned, total, xPriv.PubKey()); !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for an unsigned pool state, got %v", err)
+	}
+	if err := hub.RecordPoolState("pool-x", xPrev, total, xPriv.PubKey()); err != nil {
+		t.Fatalf("record pool x: %v", err)
+	}
+	if err := hub.RecordPoolState("pool-y", yPrev, total, yPriv.PubKey()); err != nil {
+		t.Fatalf("record pool y: %v", err)
+	}
+	// X 虚报 Prev 中的余额：按伪造的 Prev 构建的提案与登记的状态不一致
+	forged := incoming
+	forged.Prev, _ = tx.NewTransactionFromHex(xPrev.Hex())
+	forged.Prev.Outputs[0].Satoshis += 5000
+	forged.Prev.Outputs[1].Satoshis -= 5000
+	forgedProposal, err := AddConditionalPayment(forged)
+	if err != nil {
+		t.Fatalf("forged add: %v", err)
+	}
+	if _, err := hub.AcceptIncoming("t1", HubLegParams{Pool: "pool-x", Conditional: forged, Add: forgedProposal.Add}); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for a forged prev, got %v", err)
+	}
+	if _, err := hub.AcceptIncoming("t1", HubLegParams{Pool: "pool-y", Conditional: incoming, Add: xProposal.Add}); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for another client's pool, got %v", err)
+	}
+
+	serverSigs, err := hub.AcceptIncoming("t1", incomingLeg)
+	if err != nil {
+		t.Fatalf("accept incoming: %v", err)
+	}
+	// 服务器签名交出后池被 t1 占用，其他转账与池外更新都不能使用同一个 Prev
+	if _, err := hub.Begin("t3", libs.HashLock([]byte("concurrent")), 10100, 10000); err != nil {
+		t.Fatalf("begin t3: %v", err)
+	}
+	if _, err := hub.AcceptIncoming("t3", incomingLeg); !errors.Is(err, libs.ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState for a pool in use, got %v", err)
+	}
+	if err := hub.RecordPoolState("pool-x", xPrev, total, xPriv.PubKey()); !errors.Is(err, libs.ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState when recording a pool in use, got %v", err)
+	}
+	if err := hub.Abort("t3"); err != nil {
+		t.Fatalf("abort t3: %v", err)
+	}
+	if ok, err := ClientVerifyServerUpdateSig(xProposal.Add, serverPriv.PubKey(), xPriv.PubKey(), serverSigs.Add); !ok || err != nil {
+		t.Fatalf("X must be able to verify the add signature: %v", err)
+	}
+	if err := hub.LockIncoming("t1", clientSig(yPriv, xProposal)); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for another client's signature, got %v", err)
+	}
+	if err := hub.LockIncoming("t1", clientSig(xPriv, xProposal)); err != nil {
+		t.Fatalf("lock incoming: %v", err)
+	}
+
+	// 出方向必须先于入方向超时
+	late := outgoingLeg
+	late.Conditional.Timeout = incoming.Timeout - 50
+	lateProposal, _ := AddConditionalPayment(late.Conditional)
+	late.Add, late.ClientAddSig = lateProposal.Add, clientSig(yPriv, lateProposal)
+	if _, err := hub.LockOutgoing("t1", late); !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange for late outgoing timeout, got %v", err)
+	}
+	outgoingSigs, err := hub.LockOutgoing("t1", outgoingLeg)
+	if err != nil {
+		t.Fatalf("lock outgoing: %v", err)
+	}
+	yAdd, err := MergeDualPoolSigForSpendTx(yProposal.Add.Hex(), outgoingSigs.Add, yAddSig)
+	if err != nil {
+		t.Fatalf("merge outgoing add: %v", err)
+	}
+	assertDualInputValid(t, yAdd, 0, yProposal.Add.Inputs[0].SourceTxOutput())
+
+	// 崩溃后从同一存储恢复：出方向已锁定，等待原像
+	hub, _ = NewHub(store, serverPriv, HubPolicy{MinTimeoutDelta: 100})
+	recovered, err := hub.Recover()
+	if err != nil || len(recovered) != 1 || recovered[0].Action != HubActionWait || recovered[0].Transfer.State != HubOutgoingLocked {
+		t.Fatalf("unexpected recovery: %+v %v", recovered, err)
+	}
+	if _, _, err := hub.ProposeResolution("t1", HubIncoming); !errors.Is(err, libs.ErrInvalidState) {
+		t.Fatalf("incoming leg must not be cancelled while the outgoing leg is locked, got %v", err)
+	}
+
+	// Y 在链上领取出方向，服务器从领取交易中得知原像
+	claim, err := libs.BuildConditionalClaimTx(yAdd, yProposal.Vout, preimage, yPriv, nil, 50)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if err := hub.ReceivePreimage("t1", []byte("guess")); !errors.Is(err, libs.ErrPreimageMismatch) {
+		t.Fatalf("expected ErrPreimageMismatch, got %v", err)
+	}
+	revealed, err := libs.ExtractPreimage(claim, hash)
+	if err != nil {
+		t.Fatalf("extract preimage: %v", err)
+	}
+	if err := hub.ReceivePreimage("t1", revealed); err != nil {
+		t.Fatalf("receive preimage: %v", err)
+	}
+
+	hub, _ = NewHub(store, serverPriv, HubPolicy{MinTimeoutDelta: 100})
+	recovered, _ = hub.Recover()
+	if len(recovered) != 1 || recovered[0].Action != HubActionSettleIncoming {
+		t.Fatalf("expected settle-incoming after restart, got %+v", recovered)
+	}
+	settle := func(id string, kind HubLegKind, clientPriv *ec.PrivateKey) *tx.Transaction {
+		t.Helper()
+		next, serverSig, err := hub.ProposeResolution(id, kind)
+		if err != nil {
+			t.Fatalf("propose %s resolution: %v", kind, err)
+		}
+		if ok, err := ClientVerifyServerUpdateSig(next, serverPriv.PubKey(), clientPriv.PubKey(), serverSig); !ok || err != nil {
+			t.Fatalf("verify server resolution signature: %v", err)
+		}
+		clientSig, err := ClientDualFeePoolSpendTXUpdateSign(next, clientPriv, serverPriv.PubKey())
+		if err != nil {
+			t.Fatalf("client sign resolution: %v", err)
+		}
+		resolved, err := hub.CompleteResolution(id, kind, clientSig)
+		if err != nil {
+			t.Fatalf("complete %s resolution: %v", kind, err)
+		}
+		assertDualInputValid(t, resolved, 0, next.Inputs[0].SourceTxOutput())
+		return resolved
+	}
+	xSettled := settle("t1", HubIncoming, xPriv)
+	if pool, err := hub.Pool("pool-x"); err != nil || pool.Latest != xSettled.Hex() || pool.Transfer != "" {
+		t.Fatalf("pool x must record the settled state and be released: %+v %v", pool, err)
+	}
+	if err := hub.RecordPoolState("pool-x", xPrev, total, xPriv.PubKey()); !errors.Is(err, libs.ErrSequenceRegression) {
+		t.Fatalf("expected ErrSequenceRegression for an older pool state, got %v", err)
+	}
+	if xSettled.Outputs[0].Satoshis != xPrev.Outputs[0].Satoshis+10100 || xSettled.Outputs[1].Satoshis != xPrev.Outputs[1].Satoshis-10100 {
+		t.Fatalf("unexpected incoming settlement %d/%d", xSettled.Outputs[0].Satoshis, xSettled.Outputs[1].Satoshis)
+	}
+	recovered, _ = hub.Recover()
+	if len(recovered) != 1 || recovered[0].Action != HubActionSettleOutgoing {
+		t.Fatalf("expected settle-outgoing, got %+v", recovered)
+	}
+	ySettled := settle("t1", HubOutgoing, yPriv)
+	if ySettled.Outputs[1].Satoshis != yPrev.Outputs[1].Satoshis+10000 || ySettled.Outputs[0].Satoshis != yPrev.Outputs[0].Satoshis-10000 {
+		t.Fatalf("unexpected outgoing settlement %d/%d", ySettled.Outputs[0].Satoshis, ySettled.Outputs[1].Satoshis)
+	}
+	done, _ := hub.Transfer("t1")
+	if done.State != HubSettled || done.RoutingFee() != 100 {
+		t.Fatalf("unexpected final transfer %s fee %d", done.State, done.RoutingFee())
+	}
+	if recovered, _ = hub.Recover(); len(recovered) != 0 {
+		t.Fatalf("settled transfers must not need recovery: %+v", recovered)
+	}
+
+	// 出方向没有锁定时，入方向可以取消；未锁定出方向不能收原像
+	if _, err := hub.Begin("t2", libs.HashLock([]byte("never revealed")), 5000, 5000); err != nil {
+		t.Fatalf("begin t2: %v", err)
+	}
+	second := incoming
+	second.Prev, second.Amount, second.Hash, second.Sequence = xSettled, 5000, libs.HashLock([]byte("never revealed")), 0
+	second.Timeout = xSettled.LockTime + 300
+	secondProposal, err := AddConditionalPayment(second)
+	if err != nil {
+		t.Fatalf("second add: %v", err)
+	}
+	if _, err := hub.AcceptIncoming("t2", HubLegParams{Pool: "pool-x", Conditional: second, Add: secondProposal.Add}); err != nil {
+		t.Fatalf("accept second: %v", err)
+	}
+	if err := hub.LockIncoming("t2", clientSig(xPriv, secondProposal)); err != nil {
+		t.Fatalf("lock second: %v", err)
+	}
+	if err := hub.ReceivePreimage("t2", []byte("never revealed")); !errors.Is(err, libs.ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState before the outgoing leg is locked, got %v", err)
+	}
+	recovered, _ = hub.Recover()
+	if len(recovered) != 1 || recovered[0].Action != HubActionCancelIncoming {
+		t.Fatalf("expected cancel-incoming, got %+v", recovered)
+	}
+	cancelled := settle("t2", HubIncoming, xPriv)
+	if cancelled.Outputs[1].Satoshis != xSettled.Outputs[1].Satoshis {
+		t.Fatalf("cancellation must return the amount to X")
+	}
+	if done, _ := hub.Transfer("t2"); done.State != HubCancelled {
+		t.Fatalf("expected cancelled transfer, got %s", done.State)
+	}
+
+	// 链上路径：Y 在链上领取出方向，X 不配合结清，服务器在 T_in 之前链上领取入方向
+	onChainHash := libs.HashLock([]byte("claimed on chain"))
+	if _, err := hub.Begin("t4", onChainHash, 5000, 4900); err != nil {
+		t.Fatalf("begin t4: %v", err)
+	}
+	third := incoming
+	third.Prev, third.Amount, third.Hash, third.Sequence = cancelled, 5000, onChainHash, 0
+	third.Timeout = cancelled.LockTime + 50
+	thirdProposal, _ := AddConditionalPayment(third)
+	if _, err := hub.AcceptIncoming("t4", HubLegParams{Pool: "pool-x", Conditional: third, Add: thirdProposal.Add}); !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("incoming refund height must leave MinTimeoutDelta after the pool expiry, got %v", err)
+	}
+	third.Timeout = cancelled.LockTime + 300
+	thirdProposal, _ = AddConditionalPayment(third)
+	if _, err := hub.AcceptIncoming("t4", HubLegParams{Pool: "pool-x", Conditional: third, Add: thirdProposal.Add}); err != nil {
+		t.Fatalf("accept t4: %v", err)
+	}
+	if err := hub.LockIncoming("t4", clientSig(xPriv, thirdProposal)); err != nil {
+		t.Fatalf("lock t4 incoming: %v", err)
+	}
+	fourth := outgoing
+	fourth.Prev, fourth.Amount, fourth.Hash, fourth.Sequence = ySettled, 4900, onChainHash, 0
+	fourth.Timeout = third.Timeout - 100
+	fourthProposal, _ := AddConditionalPayment(fourth)
+	fourthSig := clientSig(yPriv, fourthProposal)
+	fourthSigs, err := hub.LockOutgoing("t4", HubLegParams{Pool: "pool-y", Conditional: fourth, Add: fourthProposal.Add, ClientAddSig: fourthSig})
+	if err != nil {
+		t.Fatalf("lock t4 outgoing: %v", err)
+	}
+	if _, _, err := hub.BuildIncomingClaim("t4", nil, 50); !errors.Is(err, libs.ErrInvalidState) {
+		t.Fatalf("incoming leg cannot be claimed before the preimage is known, got %v", err)
+	}
+	// 原像不出现时服务器在 T_out 之后取回出方向
+	add, refund, err := hub.BuildOutgoingRefund("t4", nil, 50)
+	if err != nil {
+		t.Fatalf("outgoing refund: %v", err)
+	}
+	if refund.LockTime != fourth.Timeout || refund.LockTime <= add.LockTime {
+		t.Fatalf("outgoing refund must wait for T_out after Y's pool expiry")
+	}
+	assertDualInputValid(t, refund, 0, add.Outputs[fourthProposal.Vout])
+
+	// Y 自己合成 Add 后上链并领取：未签名部分与锁定的状态一致即可记录，原像随之得知
+	yOnChain, err := MergeDualPoolSigForSpendTx(fourthProposal.Add.Hex(), fourthSigs.Add, clientSig(yPriv, fourthProposal))
+	if err != nil {
+		t.Fatalf("merge t4 outgoing add: %v", err)
+	}
+	yClaim, err := libs.BuildConditionalClaimTx(yOnChain, fourthProposal.Vout, []byte("claimed on chain"), yPriv, nil, 50)
+	if err != nil {
+		t.Fatalf("t4 claim: %v", err)
+	}
+	if err := hub.RecordOnChain("t4", HubOutgoing, yOnChain, claim); !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for a spend of another Add, got %v", err)
+	}
+	if err := hub.RecordOnChain("t4", HubOutgoing, thirdProposal.Add, yClaim); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for another pool's add, got %v", err)
+	}
+	if err := hub.RecordOnChain("t4", HubOutgoing, yOnChain, yClaim); err != nil {
+		t.Fatalf("record outgoing claim: %v", err)
+	}
+	recovered, _ = hub.Recover()
+	if len(recovered) != 1 || recovered[0].Action != HubActionSettleIncoming || recovered[0].Transfer.State != HubPreimageKnown {
+		t.Fatalf("expected settle-incoming after Y's on-chain claim, got %+v", recovered)
+	}
+	xAdd, xClaim, err := hub.BuildIncomingClaim("t4", nil, 50)
+	if err != nil {
+		t.Fatalf("incoming claim: %v", err)
+	}
+	assertDualInputValid(t, xAdd, 0, thirdProposal.Add.Inputs[0].SourceTxOutput())
+	assertDualInputValid(t, xClaim, 0, xAdd.Outputs[thirdProposal.Vout])
+	if err := hub.RecordOnChain("t4", HubIncoming, xAdd, xClaim); err != nil {
+		t.Fatalf("record incoming claim: %v", err)
+	}
+	if done, _ := hub.Transfer("t4"); done.State != HubSettled || !done.Incoming.OnChain || !done.Outgoing.OnChain {
+		t.Fatalf("expected on-chain settled transfer, got %s", done.State)
+	}
+	if pool, _ := hub.Pool("pool-x"); pool.Transfer != "" {
+		t.Fatalf("pool x must be released after the on-chain claim")
+	}
+}
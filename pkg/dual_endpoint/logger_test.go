@@ -0,0 +1,59 @@
+package chain_utils
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 注入日志器后应输出结构化事件，且不包含交易 hex。
+func TestDualLoggerHook(t *testing.T) {
+	var buf bytes.Buffer
+	libs.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer libs.SetLogger(nil)
+
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	total := uint64(50000)
+
+	btx, _, err := SubBuildDualFeePoolSpendTX("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", total, 100, 800000, clientPriv, serverPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	clientSig, err := SpendTXDualFeePoolClientSign(btx, total, clientPriv, serverPriv.PubKey())
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+	serverSig, err := SpendTXServerSign(btx, total, serverPriv, clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	if _, err := MergeDualPoolSigForSpendTx(btx.Hex(), serverSig, clientSig); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+
+	out := buf.String()
+	for _, msg := range []string{"spend tx built", "client signed spend tx", "server signed spend tx", "signatures merged"} {
+		if !strings.Contains(out, msg) {
+			t.Fatalf("missing event %q in %s", msg, out)
+		}
+	}
+	if strings.Contains(out, btx.Hex()) {
+		t.Fatalf("log output leaks transaction hex")
+	}
+
+	// 恢复默认后不再输出。
+	libs.SetLogger(nil)
+	buf.Reset()
+	if _, _, err := SubBuildDualFeePoolSpendTX("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", total, 100, 800000, clientPriv, serverPriv.PubKey(), true, 0.5); err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected silent default logger, got %s", buf.String())
+	}
+}
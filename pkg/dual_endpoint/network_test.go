@@ -0,0 +1,51 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 双端池开池时 UTXO 地址必须属于池所在的网络：主网地址不能用于测试网池，反之亦然。
+func TestDualNetwork(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+
+	mainAddr, err := libs.Mainnet.Address(clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("derive mainnet address: %v", err)
+	}
+	testAddr, err := libs.Testnet.Address(clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("derive testnet address: %v", err)
+	}
+	utxo := libs.UTXO{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 0, Value: 20000}
+	open := func(network libs.Network, address string) error {
+		u := utxo
+		u.Address = address
+		_, err := BuildDualFeePoolBaseTxV2(PoolParams{
+			ClientUTXOs:      []libs.UTXO{u},
+			ClientPrivateKey: clientPriv,
+			ServerPublicKey:  serverPriv.PubKey(),
+			Network:          network,
+			PoolAmount:       10000,
+		})
+		return err
+	}
+
+	if err := open(libs.Mainnet, mainAddr.AddressString); err != nil {
+		t.Fatalf("mainnet utxo on mainnet: %v", err)
+	}
+	if err := open(libs.Testnet, testAddr.AddressString); err != nil {
+		t.Fatalf("testnet utxo on testnet: %v", err)
+	}
+	if err := open(libs.Testnet, mainAddr.AddressString); !errors.Is(err, libs.ErrNetworkMismatch) {
+		t.Fatalf("expected ErrNetworkMismatch for mainnet utxo on testnet, got %v", err)
+	}
+	if err := open(libs.Mainnet, testAddr.AddressString); !errors.Is(err, libs.ErrNetworkMismatch) {
+		t.Fatalf("expected ErrNetworkMismatch for testnet utxo on mainnet, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 多签输出位于 A-Tx 的 vout 1，且 B-Tx 中多签输入位于 1 号位置：构建、签名、验证、更新、合成全程使用显式位置。
+func TestDualPoolAtNonZeroOutpoint(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	const total = uint64(100000)
+	poolTxID := "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+
+	built, _, err := SubBuildDualFeePoolSpendTXAt(poolTxID, 1, total, 0, 800000, clientPriv, serverPriv.PubKey(), false, 1)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if built.Inputs[0].SourceTxOutIndex != 1 {
+		t.Fatalf("expected pool outpoint vout 1, got %d", built.Inputs[0].SourceTxOutIndex)
+	}
+
+	// 在多签输入前插入一个无关输入，使多签输入位于 1 号位置
+	bTx := tx.NewTransaction()
+	if err := bTx.AddInputFrom("ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", 0, built.Inputs[0].SourceTxOutput().LockingScript.String(), 1000, nil); err != nil {
+		t.Fatalf("add leading input: %v", err)
+	}
+	bTx.Inputs = append(bTx.Inputs, built.Inputs[0])
+	bTx.Outputs = built.Outputs
+	bTx.LockTime = built.LockTime
+	redeem := bTx.Inputs[1].SourceTxOutput()
+
+	clientSig, err := SpendTXDualFeePoolClientSignAt(bTx, 1, total, clientPriv, serverPriv.PubKey())
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+	serverSig, err := SpendTXServerSignAt(bTx, 1, total, serverPriv, clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	if ok, err := ServerVerifyClientSpendSigAt(bTx, 1, total, serverPriv.PubKey(), clientPriv.PubKey(), clientSig); !ok || err != nil {
+		t.Fatalf("verify client sig at input 1: %v", err)
+	}
+	if ok, err := ClientVerifyServerSpendSigAt(bTx, 1, total, serverPriv.PubKey(), clientPriv.PubKey(), serverSig); !ok || err != nil {
+		t.Fatalf("verify server sig at input 1: %v", err)
+	}
+	if ok, _ := ServerVerifyClientSpendSig(bTx, total, serverPriv.PubKey(), clientPriv.PubKey(), clientSig); ok {
+		t.Fatalf("signature for input 1 must not verify against input 0")
+	}
+
+	merged, err := MergeDualPoolSigForSpendTxAt(bTx.Hex(), 1, serverSig, clientSig)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	assertDualInputValid(t, merged, 1, redeem)
+
+	// 更新：加载时指定输入位置，后续签名与验证沿用同一位置
+	updated, err := LoadTxV2(UpdateParams{
+		TxHex:           bTx.Hex(),
+		Sequence:        2,
+		ServerAmount:    20000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+		InputIndex:      1,
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if updated.Inputs[1].SequenceNumber != 2 || updated.Inputs[0].SequenceNumber == 2 {
+		t.Fatalf("sequence must be applied to input 1 only")
+	}
+	clientSig, err = ClientDualFeePoolSpendTXUpdateSignAt(updated, 1, clientPriv, serverPriv.PubKey())
+	if err != nil {
+		t.Fatalf("client update sign: %v", err)
+	}
+	serverSig, err = ServerDualFeePoolSpendTXUpdateSignAt(updated, 1, serverPriv, clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("server update sign: %v", err)
+	}
+	if ok, err := ServerVerifyClientUpdateSigAt(updated, 1, serverPriv.PubKey(), clientPriv.PubKey(), clientSig); !ok || err != nil {
+		t.Fatalf("verify client update sig: %v", err)
+	}
+	if ok, err := ClientVerifyServerUpdateSigAt(updated, 1, serverPriv.PubKey(), clientPriv.PubKey(), serverSig); !ok || err != nil {
+		t.Fatalf("verify server update sig: %v", err)
+	}
+	merged, err = MergeDualPoolSigForSpendTxAt(updated.Hex(), 1, serverSig, clientSig)
+	if err != nil {
+		t.Fatalf("merge update: %v", err)
+	}
+	assertDualInputValid(t, merged, 1, redeem)
+
+	if _, err := LoadTxV2(UpdateParams{
+		TxHex:           bTx.Hex(),
+		Sequence:        3,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+		InputIndex:      2,
+	}); !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for missing input, got %v", err)
+	}
+	if _, err := SpendTXServerSignAt(bTx, 2, total, serverPriv, clientPriv.PubKey()); !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for missing input, got %v", err)
+	}
+}
+
+func assertDualInputValid(t *testing.T, transaction *tx.Transaction, inputIndex int, prevOut *tx.TransactionOutput) {
+	t.Helper()
+	err := interpreter.NewEngine().Execute(
+		interpreter.WithTx(transaction, inputIndex, prevOut),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("input %d failed script check: %v", inputIndex, err)
+	}
+}
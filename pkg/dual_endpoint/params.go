@@ -0,0 +1,820 @@
+package chain_utils
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// v2 API：用具名字段的参数结构体代替容易颠倒的位置参数。
+// 各结构体的 Validate 会在构建交易前检查必填字段和金额关系，零值字段按下列默认值处理：
+//   - FeeRate 为 0 时使用 libs.DefaultFeeRate
+//   - Network 为零值时使用主网（libs.Mainnet）
+
+// PoolParams 描述开池（步骤1，A-Tx）所需的参数。
+type PoolParams struct {
+	ClientUTXOs      []libs.UTXO // 客户端提供的 UTXO，全部作为输入
+	PoolAmount       uint64      // 多签输出金额
+	ClientPrivateKey *ec.PrivateKey
+	ServerPublicKey  *ec.PublicKey
+	Network          libs.Network
+	FeeRate          float64
+}
+
+// SpendParams 描述构建初始 B-Tx（步骤2）所需的参数。
+type SpendParams struct {
+	BaseTx           *tx.Transaction // 步骤1产生的 A-Tx；为空时使用 PrevTxID
+	PrevTxID         string
+	PoolVout         uint32 // 多签输出在 A-Tx 中的序号，默认 0
+	TotalAmount      uint64 // 多签输出金额；为 0 时取 BaseTx.Outputs[PoolVout]
+	ServerAmount     uint64 // 初始分配给服务器的金额（扣费前）
+	EndHeight        uint32 // B-Tx 的 locktime
+	ClientPrivateKey *ec.PrivateKey
+	ServerPublicKey  *ec.PublicKey
+	Network          libs.Network
+	FeeRate          float64
+	FeePolicy        libs.FeePolicy  // 手续费分摊方式，默认由客户端承担
+	Dust             libs.DustPolicy // 扣费后支付输出的粉尘处理方式，默认省略金额为 0 的支付
+	// 双方在开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；之后的更新只能支付到这两个脚本
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+	// 支付地址轮换记录，不为空时支付脚本取自记录（与上面的脚本同时给出时两者必须一致），并随 SpendResult 返回与池状态一起保存
+	ServerPayout *libs.PayoutState
+	ClientPayout *libs.PayoutState
+	Commitment   *libs.Commitment // 不为空时 B-Tx 末尾带 OP_RETURN 承诺输出，之后的更新才能更换承诺
+}
+
+// SpendResult 是 BuildDualFeePoolSpendTXV2 的返回值。
+type SpendResult struct {
+	Tx              *tx.Transaction
+	ClientSignBytes *[]byte
+	Amount          uint64 // 客户端输出金额
+	Fee             uint64 // B-Tx 手续费，不含被粉尘策略省略的金额
+	// 池使用的支付轮换记录，取自 SpendParams，换池时作为 RolloverParams 的当前记录
+	ServerPayout *libs.PayoutState
+	ClientPayout *libs.PayoutState
+}
+
+// UpdateParams 描述加载并更新 B-Tx（步骤4/5）所需的参数。
+type UpdateParams struct {
+	TxHex           string
+	Locktime        *uint32 // 为空时保持原 locktime
+	Sequence        uint32
+	ServerAmount    uint64
+	ServerPublicKey *ec.PublicKey
+	ClientPublicKey *ec.PublicKey
+	TotalAmount     uint64          // 多签输出金额
+	InputIndex      uint32          // 多签输入在 B-Tx 中的位置，默认 0
+	FeePolicy       libs.FeePolicy  // ServerAmount 为扣费前金额，B-Tx 手续费按该策略分摊，默认由客户端承担
+	Fee             uint64          // B-Tx 手续费；为 0 时取多签金额与输出之和的差。DustDrop 省略过输出时应传入开池时的手续费
+	Dust            libs.DustPolicy // 扣费后支付输出的粉尘处理方式，必须与开池时一致
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+	Commitment         *libs.Commitment // 新的承诺，为空时保留 B-Tx 中原有的承诺；开池时没有承诺输出的池不能设置
+}
+
+// OpenAcceptParams 描述服务器签名初始 B-Tx 前对 A-Tx 的接受检查所需的参数。
+type OpenAcceptParams struct {
+	BaseTx          *tx.Transaction // 客户端构建的 A-Tx
+	SpendTx         *tx.Transaction // 客户端构建并签名的初始 B-Tx
+	PoolVout        uint32          // 多签输出在 A-Tx 中的序号，默认 0
+	ServerPublicKey *ec.PublicKey
+	ClientPublicKey *ec.PublicKey
+	// 双方声明的支付锁定脚本，必须与开池时 SpendParams 中的一致
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+func invalidParams(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", libs.ErrInvalidParams, fmt.Sprintf(format, args...))
+}
+
+func feeRateOrDefault(feeRate float64) float64 {
+	if feeRate == 0 {
+		return libs.DefaultFeeRate
+	}
+	return feeRate
+}
+
+// Validate 检查开池参数。
+func (p *PoolParams) Validate() error {
+	if p.ClientPrivateKey == nil {
+		return invalidParams("client private key is required")
+	}
+	if p.ServerPublicKey == nil {
+		return invalidParams("server public key is required")
+	}
+	if len(p.ClientUTXOs) == 0 {
+		return invalidParams("at least one client utxo is required")
+	}
+	if err := p.Network.ValidateUTXOs(p.ClientUTXOs, p.ClientPrivateKey.PubKey()); err != nil {
+		return err
+	}
+	if p.PoolAmount == 0 {
+		return invalidParams("pool amount must be positive")
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	var total uint64
+	for _, u := range p.ClientUTXOs {
+		total += u.Value
+	}
+	if total < p.PoolAmount {
+		return fmt.Errorf("pool amount: %w", &libs.InsufficientFundsError{Need: p.PoolAmount, Have: total})
+	}
+	return nil
+}
+
+// Validate 检查 B-Tx 构建参数，并在 TotalAmount 为 0 时从 BaseTx 补全。
+func (p *SpendParams) Validate() error {
+	if p.ClientPrivateKey == nil {
+		return invalidParams("client private key is required")
+	}
+	if p.ServerPublicKey == nil {
+		return invalidParams("server public key is required")
+	}
+	if p.BaseTx == nil && p.PrevTxID == "" {
+		return invalidParams("base tx or prev txid is required")
+	}
+	if err := p.Network.Validate(); err != nil {
+		return err
+	}
+	if p.BaseTx != nil {
+		if int(p.PoolVout) >= len(p.BaseTx.Outputs) {
+			return fmt.Errorf("%w: base tx has no output %d", libs.ErrInvalidTransaction, p.PoolVout)
+		}
+		poolOutput := p.BaseTx.Outputs[p.PoolVout].Satoshis
+		if p.TotalAmount == 0 {
+			p.TotalAmount = poolOutput
+		} else if p.TotalAmount != poolOutput {
+			return invalidParams("total amount %d does not match base tx output %d", p.TotalAmount, poolOutput)
+		}
+	}
+	if p.TotalAmount == 0 {
+		return invalidParams("total amount must be positive")
+	}
+	if p.ServerAmount > p.TotalAmount {
+		return fmt.Errorf("server amount: %w", &libs.InsufficientFundsError{Need: p.ServerAmount, Have: p.TotalAmount})
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	if err := p.FeePolicy.Validate(); err != nil {
+		return err
+	}
+	if err := p.Dust.Validate(); err != nil {
+		return err
+	}
+	var err error
+	if p.ServerPayoutScript, err = libs.ResolvePayoutScript(p.ServerPayout, p.ServerPayoutScript); err != nil {
+		return fmt.Errorf("server payout: %w", err)
+	}
+	if p.ClientPayoutScript, err = libs.ResolvePayoutScript(p.ClientPayout, p.ClientPayoutScript); err != nil {
+		return fmt.Errorf("client payout: %w", err)
+	}
+	if _, err := payoutScripts(p.ServerPublicKey, p.ClientPrivateKey.PubKey(), p.ServerPayoutScript, p.ClientPayoutScript); err != nil {
+		return err
+	}
+	return libs.CheckBlockHeightLocktime(p.EndHeight)
+}
+
+func (p *SpendParams) prevTxID() string {
+	if p.BaseTx != nil {
+		return p.BaseTx.TxID().String()
+	}
+	return p.PrevTxID
+}
+
+// Validate 检查更新参数。
+func (p *UpdateParams) Validate() error {
+	if p.TxHex == "" {
+		return invalidParams("tx hex is required")
+	}
+	if p.ServerPublicKey == nil || p.ClientPublicKey == nil {
+		return invalidParams("server and client public keys are required")
+	}
+	if p.TotalAmount == 0 {
+		return invalidParams("total amount must be positive")
+	}
+	if p.ServerAmount > p.TotalAmount {
+		return fmt.Errorf("server amount: %w", &libs.InsufficientFundsError{Need: p.ServerAmount, Have: p.TotalAmount})
+	}
+	if p.Sequence == 0 {
+		return invalidParams("sequence must be positive")
+	}
+	if p.Fee > p.TotalAmount {
+		return fmt.Errorf("fee: %w", &libs.InsufficientFundsError{Need: p.Fee, Have: p.TotalAmount})
+	}
+	if err := p.FeePolicy.Validate(); err != nil {
+		return err
+	}
+	if err := p.Dust.Validate(); err != nil {
+		return err
+	}
+	_, err := p.payoutScripts()
+	return err
+}
+
+// spendState 报告 t 是否为只有一个输入、一到两个支付输出的 B-Tx（金额为 0 的支付可能被粉尘策略省略）。
+func spendState(t *tx.Transaction) bool {
+	if t == nil || len(t.Inputs) != 1 {
+		return false
+	}
+	n := len(libs.PayoutOutputs(t))
+	return n >= 1 && n <= 2
+}
+
+// statePayouts 返回状态 t 中 [服务器, 客户端] 的支付金额与锁定脚本，被省略的一方金额为 0，
+// 脚本取声明的支付脚本或签名公钥的 P2PKH。
+func statePayouts(t *tx.Transaction, serverPublicKey, clientPublicKey *ec.PublicKey, serverScript, clientScript *script.Script) ([]uint64, []*script.Script, error) {
+	scripts, err := payoutScripts(serverPublicKey, clientPublicKey, serverScript, clientScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	return libs.SplitPayouts(t, scripts)
+}
+
+// payoutScripts 返回 [服务器, 客户端] 的支付锁定脚本，未声明的一方使用签名公钥的 P2PKH。
+func payoutScripts(serverPublicKey, clientPublicKey *ec.PublicKey, serverScript, clientScript *script.Script) ([]*script.Script, error) {
+	scripts, err := PayoutScripts(serverPublicKey, clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	for i, declared := range []*script.Script{serverScript, clientScript} {
+		if declared != nil {
+			if len(*declared) == 0 {
+				return nil, invalidParams("payout script %d is empty", i)
+			}
+			scripts[i] = declared
+		}
+	}
+	return scripts, nil
+}
+
+// payoutScripts 返回更新时允许的 [服务器, 客户端] 支付锁定脚本。
+func (p *UpdateParams) payoutScripts() ([]*script.Script, error) {
+	return payoutScripts(p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+}
+
+// Validate 检查开池接受参数。
+func (p *OpenAcceptParams) Validate() error {
+	if p.BaseTx == nil || p.SpendTx == nil {
+		return invalidParams("base tx and spend tx are required")
+	}
+	if p.ServerPublicKey == nil || p.ClientPublicKey == nil {
+		return invalidParams("server and client public keys are required")
+	}
+	return nil
+}
+
+// DualFundedParams 描述双方共同出资的开池参数。
+// 双方都只提供公钥即可构建同一笔 A-Tx，各自再用私钥签自己的输入。
+type DualFundedParams struct {
+	ClientUTXOs     []libs.UTXO
+	ClientAmount    uint64 // 客户端出资金额
+	ClientPublicKey *ec.PublicKey
+	ServerUTXOs     []libs.UTXO
+	ServerAmount    uint64 // 服务器出资金额
+	ServerPublicKey *ec.PublicKey
+	Network         libs.Network
+	FeeRate         float64
+	// 双方在开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；退款 B-Tx 只能支付到这两个脚本
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+// Validate 检查双方出资参数。
+func (p *DualFundedParams) Validate() error {
+	if p.ClientPublicKey == nil || p.ServerPublicKey == nil {
+		return invalidParams("client and server public keys are required")
+	}
+	if len(p.ClientUTXOs) == 0 || len(p.ServerUTXOs) == 0 {
+		return invalidParams("both parties must provide utxos")
+	}
+	if p.ClientAmount == 0 || p.ServerAmount == 0 {
+		return invalidParams("both contributions must be positive")
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	if err := p.Network.ValidateUTXOs(p.ClientUTXOs, p.ClientPublicKey); err != nil {
+		return fmt.Errorf("client utxos: %w", err)
+	}
+	if err := p.Network.ValidateUTXOs(p.ServerUTXOs, p.ServerPublicKey); err != nil {
+		return fmt.Errorf("server utxos: %w", err)
+	}
+	if _, err := payoutScripts(p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript); err != nil {
+		return err
+	}
+	if have := libs.SumUTXOs(p.ClientUTXOs); have < p.ClientAmount {
+		return fmt.Errorf("client contribution: %w", &libs.InsufficientFundsError{Need: p.ClientAmount, Have: have})
+	}
+	if have := libs.SumUTXOs(p.ServerUTXOs); have < p.ServerAmount {
+		return fmt.Errorf("server contribution: %w", &libs.InsufficientFundsError{Need: p.ServerAmount, Have: have})
+	}
+	// 同一 UTXO 不能由双方重复提供
+	return p.Network.ValidateUTXOs(append(append([]libs.UTXO(nil), p.ClientUTXOs...), p.ServerUTXOs...), nil)
+}
+
+// DirectionLimit 是某一方向的规则：默认只有付款方可以发起，AllowPayee 允许收款方发起（付款方签名即视为同意）。
+type DirectionLimit struct {
+	MaxPerUpdate uint64 // 单次更新可转移的金额上限，0 表示不限
+	AllowPayee   bool
+}
+
+// BidirectionalPolicy 为两个方向分别设置限制。
+type BidirectionalPolicy struct {
+	ToServer DirectionLimit // 客户端付款给服务器
+	ToClient DirectionLimit // 服务器退款给客户端
+}
+
+// BidirectionalUpdateParams 描述由一方发起的双向更新提案。
+type BidirectionalUpdateParams struct {
+	Prev                  *tx.Transaction // 最近一次双方都已签名的 B-Tx
+	TotalAmount           uint64          // 多签输出金额
+	Proposer              libs.Party      // libs.PartyClient 或 libs.PartyServer
+	Direction             Direction
+	Amount                uint64  // 本次转移金额
+	Sequence              uint32  // 为 0 时取 Prev 的序列号 + 1
+	Locktime              *uint32 // 为空时保持原 locktime
+	ProposerPrivateKey    *ec.PrivateKey
+	CounterpartyPublicKey *ec.PublicKey
+	Policy                BidirectionalPolicy
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；用于识别并补回金额为 0 而被省略的支付输出
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+// Validate 检查双向更新提案参数。
+func (p *BidirectionalUpdateParams) Validate() error {
+	if !spendState(p.Prev) {
+		return invalidParams("prev must be a spend tx with one input and one or two payout outputs")
+	}
+	if p.ProposerPrivateKey == nil || p.CounterpartyPublicKey == nil {
+		return invalidParams("proposer private key and counterparty public key are required")
+	}
+	if p.TotalAmount == 0 {
+		return invalidParams("total amount must be positive")
+	}
+	if p.Proposer != libs.PartyClient && p.Proposer != libs.PartyServer {
+		return invalidParams("proposer must be client or server, got %q", p.Proposer)
+	}
+	if p.Direction != DirectionToServer && p.Direction != DirectionToClient {
+		return invalidParams("direction must be to-server or to-client")
+	}
+	if p.Amount == 0 {
+		return invalidParams("amount must be positive")
+	}
+	if p.Sequence == 0 {
+		p.Sequence = p.Prev.Inputs[0].SequenceNumber + 1
+	}
+	if p.Sequence >= libs.FinalSequence {
+		return invalidParams("sequence %d is final, locktime would not apply", p.Sequence)
+	}
+	return nil
+}
+
+// BidirectionalAcceptParams 描述接收方核对并回签双向更新所需的参数。
+type BidirectionalAcceptParams struct {
+	Prev               *tx.Transaction // 最近一次双方都已签名的 B-Tx
+	Next               *tx.Transaction // 对方提出的新 B-Tx
+	TotalAmount        uint64
+	Proposer           libs.Party
+	ProposerSignBytes  *[]byte
+	ProposerPublicKey  *ec.PublicKey
+	AcceptorPrivateKey *ec.PrivateKey
+	Policy             BidirectionalPolicy
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；被省略的支付重新出现时只能支付到这些脚本
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+// Validate 检查回签参数。
+func (p *BidirectionalAcceptParams) Validate() error {
+	if p.Prev == nil || p.Next == nil {
+		return invalidParams("prev and next transactions are required")
+	}
+	if p.ProposerPublicKey == nil || p.AcceptorPrivateKey == nil {
+		return invalidParams("proposer public key and acceptor private key are required")
+	}
+	if p.Proposer != libs.PartyClient && p.Proposer != libs.PartyServer {
+		return invalidParams("proposer must be client or server, got %q", p.Proposer)
+	}
+	if p.TotalAmount == 0 {
+		return invalidParams("total amount must be positive")
+	}
+	return nil
+}
+
+// ExtendExpiryParams 描述由一方发起的延期提案：把最近一次双方签名的 B-Tx 的 locktime 后移到 EndHeight。
+type ExtendExpiryParams struct {
+	Prev                  *tx.Transaction // 最近一次双方都已签名的 B-Tx
+	TotalAmount           uint64          // 多签输出金额
+	Proposer              libs.Party      // libs.PartyClient 或 libs.PartyServer
+	EndHeight             uint32          // 新的到期高度
+	Sequence              uint32          // 为 0 时取 Prev 的序列号 + 1
+	ProposerPrivateKey    *ec.PrivateKey
+	CounterpartyPublicKey *ec.PublicKey
+	Policy                libs.ExpiryPolicy
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；用于识别 Prev 中的支付输出
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+// Validate 检查延期提案参数。
+func (p *ExtendExpiryParams) Validate() error {
+	if !spendState(p.Prev) {
+		return invalidParams("prev must be a spend tx with one input and one or two payout outputs")
+	}
+	if p.ProposerPrivateKey == nil || p.CounterpartyPublicKey == nil {
+		return invalidParams("proposer private key and counterparty public key are required")
+	}
+	if p.TotalAmount == 0 {
+		return invalidParams("total amount must be positive")
+	}
+	if p.Proposer != libs.PartyClient && p.Proposer != libs.PartyServer {
+		return invalidParams("proposer must be client or server, got %q", p.Proposer)
+	}
+	if p.Sequence == 0 {
+		p.Sequence = p.Prev.Inputs[0].SequenceNumber + 1
+	}
+	if p.Sequence >= libs.FinalSequence {
+		return invalidParams("sequence %d is final, locktime would not apply", p.Sequence)
+	}
+	return nil
+}
+
+// ExtendExpiryAcceptParams 描述接收方核对并回签延期提案所需的参数。
+type ExtendExpiryAcceptParams struct {
+	Prev               *tx.Transaction // 最近一次双方都已签名的 B-Tx
+	Next               *tx.Transaction // 对方提出的新 B-Tx
+	TotalAmount        uint64
+	Proposer           libs.Party
+	ProposerSignBytes  *[]byte
+	ProposerPublicKey  *ec.PublicKey
+	AcceptorPrivateKey *ec.PrivateKey
+	Policy             libs.ExpiryPolicy
+}
+
+// Validate 检查延期回签参数。
+func (p *ExtendExpiryAcceptParams) Validate() error {
+	if p.Prev == nil || p.Next == nil {
+		return invalidParams("prev and next transactions are required")
+	}
+	// 延期会推迟 Add 上链，收款方可能来不及在退款高度之前领取
+	if len(libs.ConditionalOutputs(p.Prev)) > 0 {
+		return invalidParams("prev has a pending conditional payment; settle or cancel it first")
+	}
+	if p.ProposerPublicKey == nil || p.AcceptorPrivateKey == nil {
+		return invalidParams("proposer public key and acceptor private key are required")
+	}
+	if p.Proposer != libs.PartyClient && p.Proposer != libs.PartyServer {
+		return invalidParams("proposer must be client or server, got %q", p.Proposer)
+	}
+	if p.TotalAmount == 0 {
+		return invalidParams("total amount must be positive")
+	}
+	return nil
+}
+
+// SpliceInParams 描述向现有池追加客户端资金（splice-in）所需的参数。
+// 新多签输出 = PoolAmount + AddAmount，手续费由客户端新增的 UTXO 承担。
+type SpliceInParams struct {
+	PoolTxID        string // 当前多签输出所在交易
+	PoolVout        uint32 // 当前多签输出在 PoolTxID 中的位置
+	PoolAmount      uint64 // 当前多签输出金额
+	ServerBalance   uint64 // 最近一次双方签名的 B-Tx 中服务器的金额，splice 后沿用
+	ClientUTXOs     []libs.UTXO
+	AddAmount       uint64
+	ClientPublicKey *ec.PublicKey
+	ServerPublicKey *ec.PublicKey
+	Network         libs.Network
+	FeeRate         float64
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；新 outpoint 上的退款 B-Tx 沿用这两个脚本
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+// Validate 检查 splice-in 参数。
+func (p *SpliceInParams) Validate() error {
+	if raw, err := hex.DecodeString(p.PoolTxID); err != nil || len(raw) != 32 {
+		return invalidParams("malformed pool txid %q", p.PoolTxID)
+	}
+	if p.ClientPublicKey == nil || p.ServerPublicKey == nil {
+		return invalidParams("client and server public keys are required")
+	}
+	if p.PoolAmount == 0 || p.AddAmount == 0 {
+		return invalidParams("pool amount and add amount must be positive")
+	}
+	if p.ServerBalance > p.PoolAmount {
+		return fmt.Errorf("server balance: %w", &libs.InsufficientFundsError{Need: p.ServerBalance, Have: p.PoolAmount})
+	}
+	if len(p.ClientUTXOs) == 0 {
+		return invalidParams("at least one client utxo is required")
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	if err := p.Network.ValidateUTXOs(p.ClientUTXOs, p.ClientPublicKey); err != nil {
+		return err
+	}
+	if _, err := payoutScripts(p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript); err != nil {
+		return err
+	}
+	if have := libs.SumUTXOs(p.ClientUTXOs); have < p.AddAmount {
+		return fmt.Errorf("add amount: %w", &libs.InsufficientFundsError{Need: p.AddAmount, Have: have})
+	}
+	return nil
+}
+
+// SpliceOutParams 描述服务器从现有池提取已赚取金额（splice-out）所需的参数。
+type SpliceOutParams struct {
+	Latest          *tx.Transaction // 最近一次双方签名的 B-Tx（已合并签名），服务器的支付为已赚取的金额
+	PoolAmount      uint64          // 当前多签输出金额
+	Withdraw        uint64          // 提现金额，手续费另从已赚取金额中扣除
+	PayoutAddress   string          // 提现地址；为空时支付到服务器地址
+	ClientPublicKey *ec.PublicKey
+	ServerPublicKey *ec.PublicKey
+	Network         libs.Network
+	FeeRate         float64
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；用于读取 Latest 的余额，新 outpoint 上的退款 B-Tx 沿用这两个脚本
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+// Validate 检查 splice-out 参数。
+func (p *SpliceOutParams) Validate() error {
+	if !spendState(p.Latest) {
+		return invalidParams("latest must be a spend tx with one input and one or two payout outputs")
+	}
+	if p.ClientPublicKey == nil || p.ServerPublicKey == nil {
+		return invalidParams("client and server public keys are required")
+	}
+	if p.PoolAmount == 0 || p.Withdraw == 0 {
+		return invalidParams("pool amount and withdraw must be positive")
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	// 已赚取金额取自 Latest，必须先确认它是双方在当前多签输出上签过的状态
+	if err := VerifyDualSignedState(p.Latest, 0, p.PoolAmount, p.ServerPublicKey, p.ClientPublicKey); err != nil {
+		return fmt.Errorf("latest: %w", err)
+	}
+	amounts, _, err := statePayouts(p.Latest, p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+	if err != nil {
+		return fmt.Errorf("latest: %w", err)
+	}
+	if earned := amounts[0]; p.Withdraw > earned {
+		return fmt.Errorf("withdraw exceeds earned: %w", &libs.InsufficientFundsError{Need: p.Withdraw, Have: earned})
+	}
+	if _, err := p.payoutAddress(); err != nil {
+		return err
+	}
+	return p.Network.Validate()
+}
+
+func (p *SpliceOutParams) poolTxID() string {
+	return p.Latest.Inputs[0].SourceTXID.String()
+}
+
+func (p *SpliceOutParams) poolVout() uint32 {
+	return p.Latest.Inputs[0].SourceTxOutIndex
+}
+
+func (p *SpliceOutParams) payoutAddress() (*script.Address, error) {
+	if p.PayoutAddress == "" {
+		return p.Network.Address(p.ServerPublicKey)
+	}
+	addr, err := p.Network.ParseAddress(p.PayoutAddress)
+	if err != nil {
+		return nil, fmt.Errorf("payout address: %w", err)
+	}
+	return addr, nil
+}
+
+// RolloverParams 描述把当前池结算并滚动到后继池所需的参数。
+type RolloverParams struct {
+	Latest          *tx.Transaction // 最近一次双方签名的 B-Tx
+	PoolAmount      uint64          // 当前多签输出金额
+	ClientPublicKey *ec.PublicKey
+	ServerPublicKey *ec.PublicKey
+	Network         libs.Network
+	FeeRate         float64
+	FeePolicy       libs.FeePolicy // 释放的 B-Tx 手续费与换池手续费之差按该策略分摊，默认由客户端承担
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；服务器结算输出与后继池的退款 B-Tx 沿用它们
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+	// 后继池的支付锁定脚本，为空时沿用上面的脚本
+	NextServerPayoutScript *script.Script
+	NextClientPayoutScript *script.Script
+	// 当前池的支付轮换记录（开池 SpendResult 中的记录），不为空时支付脚本取自记录
+	ServerPayout *libs.PayoutState
+	ClientPayout *libs.PayoutState
+	// 后继池的支付轮换记录，由 PayoutKeyChain.Next 按 Path.Next() 派生；当前池有记录时必须给出，
+	// 不为空时后继池的支付脚本取自记录，并作为后继池退款 SpendResult 的记录返回
+	NextServerPayout *libs.PayoutState
+	NextClientPayout *libs.PayoutState
+}
+
+// payoutScripts 返回当前池的 [服务器, 客户端] 支付脚本。
+func (p *RolloverParams) payoutScripts() (*script.Script, *script.Script, error) {
+	server, err := libs.ResolvePayoutScript(p.ServerPayout, p.ServerPayoutScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server payout: %w", err)
+	}
+	client, err := libs.ResolvePayoutScript(p.ClientPayout, p.ClientPayoutScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client payout: %w", err)
+	}
+	return server, client, nil
+}
+
+// nextPayoutScripts 返回后继池的 [服务器, 客户端] 支付脚本。
+func (p *RolloverParams) nextPayoutScripts() (*script.Script, *script.Script, error) {
+	server, client, err := p.payoutScripts()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.NextServerPayoutScript != nil || p.NextServerPayout != nil {
+		if server, err = libs.ResolvePayoutScript(p.NextServerPayout, p.NextServerPayoutScript); err != nil {
+			return nil, nil, fmt.Errorf("next server payout: %w", err)
+		}
+	}
+	if p.NextClientPayoutScript != nil || p.NextClientPayout != nil {
+		if client, err = libs.ResolvePayoutScript(p.NextClientPayout, p.NextClientPayoutScript); err != nil {
+			return nil, nil, fmt.Errorf("next client payout: %w", err)
+		}
+	}
+	return server, client, nil
+}
+
+// Validate 检查换池参数。
+func (p *RolloverParams) Validate() error {
+	if !spendState(p.Latest) {
+		return invalidParams("latest must be a spend tx with one input and one or two payout outputs")
+	}
+	if p.ClientPublicKey == nil || p.ServerPublicKey == nil {
+		return invalidParams("client and server public keys are required")
+	}
+	if p.PoolAmount == 0 {
+		return invalidParams("pool amount must be positive")
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	if err := libs.CheckPayoutRotation(p.ServerPayout, p.NextServerPayout); err != nil {
+		return fmt.Errorf("server payout: %w", err)
+	}
+	if err := libs.CheckPayoutRotation(p.ClientPayout, p.NextClientPayout); err != nil {
+		return fmt.Errorf("client payout: %w", err)
+	}
+	if _, _, err := p.nextPayoutScripts(); err != nil {
+		return err
+	}
+	serverScript, clientScript, err := p.payoutScripts()
+	if err != nil {
+		return err
+	}
+	amounts, _, err := statePayouts(p.Latest, p.ServerPublicKey, p.ClientPublicKey, serverScript, clientScript)
+	if err != nil {
+		return fmt.Errorf("latest: %w", err)
+	}
+	if serverAmount := amounts[0]; serverAmount >= p.PoolAmount {
+		return fmt.Errorf("nothing left to carry forward: %w", &libs.InsufficientFundsError{Need: serverAmount + 1, Have: p.PoolAmount})
+	}
+	if outputs := amounts[0] + amounts[1]; outputs > p.PoolAmount {
+		return fmt.Errorf("%w: latest outputs %d exceed pool amount %d", libs.ErrInvalidTransaction, outputs, p.PoolAmount)
+	}
+	if err := p.FeePolicy.Validate(); err != nil {
+		return err
+	}
+	return p.Network.Validate()
+}
+
+func (p *RolloverParams) poolTxID() string {
+	return p.Latest.Inputs[0].SourceTXID.String()
+}
+
+func (p *RolloverParams) poolVout() uint32 {
+	return p.Latest.Inputs[0].SourceTxOutIndex
+}
+
+// ConditionalParams 描述在池内加入一笔条件支付（哈希锁）所需的参数。
+type ConditionalParams struct {
+	Prev            *tx.Transaction // 最近一次双方都已签名的 B-Tx，须没有未结清的条件支付
+	TotalAmount     uint64          // 多签输出金额
+	Payer           libs.Party      // 付款方，libs.PartyClient 或 libs.PartyServer；收款方为另一方
+	Amount          uint64          // 条件输出金额
+	Hash            [32]byte        // 原像的 SHA-256
+	Timeout         uint32          // 付款方可以链上退款的最早高度，必须晚于 Prev 的 locktime（池到期高度）
+	Sequence        uint32          // 为 0 时取 Prev 的序列号 + 1
+	FeeRate         float64         // 条件输出增加的手续费按该费率计算，由付款方承担
+	ServerPublicKey *ec.PublicKey
+	ClientPublicKey *ec.PublicKey
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；Prev 中被省略的一方按该脚本重新出现
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+// Validate 检查条件支付参数。
+func (p *ConditionalParams) Validate() error {
+	if !spendState(p.Prev) {
+		return invalidParams("prev must be a spend tx with one input and one or two payout outputs")
+	}
+	if len(libs.ConditionalOutputs(p.Prev)) != 0 {
+		return invalidParams("prev already has a pending conditional payment")
+	}
+	if p.ServerPublicKey == nil || p.ClientPublicKey == nil {
+		return invalidParams("server and client public keys are required")
+	}
+	if p.TotalAmount == 0 {
+		return invalidParams("total amount must be positive")
+	}
+	if p.Payer != libs.PartyClient && p.Payer != libs.PartyServer {
+		return invalidParams("payer must be client or server, got %q", p.Payer)
+	}
+	if p.Amount < libs.DustLimit {
+		return fmt.Errorf("conditional amount: %w", &libs.DustError{Party: p.Payer, Amount: p.Amount, Limit: libs.DustLimit})
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	// Add 最早在池到期时上链，收款方要在 Timeout 之前领取，退款不能早于池到期
+	if p.Timeout <= p.Prev.LockTime || p.Timeout >= libs.MaxBlockHeightLocktime {
+		return &libs.LocktimeError{Locktime: p.Timeout, Min: p.Prev.LockTime + 1, Max: libs.MaxBlockHeightLocktime - 1}
+	}
+	if p.Sequence == 0 {
+		p.Sequence = p.Prev.Inputs[0].SequenceNumber + 1
+	}
+	if p.Sequence >= libs.FinalSequence {
+		return invalidParams("sequence %d is final, locktime would not apply", p.Sequence)
+	}
+	return nil
+}
+
+// ConditionalProposal 是 AddConditionalPayment 的返回值。
+type ConditionalProposal struct {
+	Add  *tx.Transaction // 带条件输出的新状态
+	Vout uint32          // 条件输出在 Add 中的序号
+	Fee  uint64          // 条件输出增加的手续费，结清时退回付款方
+}
+
+// ConditionalResolveParams 描述结清（出示原像）或取消一笔条件支付所需的参数。
+type ConditionalResolveParams struct {
+	Latest          *tx.Transaction // 带条件输出、双方都已签名的 B-Tx
+	TotalAmount     uint64
+	Vout            uint32 // 条件输出的序号，即 ConditionalProposal.Vout
+	Fee             uint64 // ConditionalProposal.Fee
+	Preimage        []byte // 结清时必填
+	Sequence        uint32 // 为 0 时取 Latest 的序列号 + 1
+	ServerPublicKey *ec.PublicKey
+	ClientPublicKey *ec.PublicKey
+	// 与 ConditionalParams 中的支付脚本相同
+	ServerPayoutScript *script.Script
+	ClientPayoutScript *script.Script
+}
+
+// Validate 检查结清参数。
+func (p *ConditionalResolveParams) Validate() error {
+	if p.Latest == nil || len(p.Latest.Inputs) != 1 {
+		return invalidParams("latest must be a spend tx with one input")
+	}
+	if p.ServerPublicKey == nil || p.ClientPublicKey == nil {
+		return invalidParams("server and client public keys are required")
+	}
+	if p.TotalAmount == 0 {
+		return invalidParams("total amount must be positive")
+	}
+	current := p.Latest.Inputs[0].SequenceNumber
+	if p.Sequence == 0 {
+		p.Sequence = current + 1
+	}
+	if p.Sequence <= current || p.Sequence >= libs.FinalSequence {
+		return &libs.SequenceError{Current: current, Proposed: p.Sequence}
+	}
+	return nil
+}
+
+// HubLegParams 描述中转转账中一条腿的条件支付提案。
+type HubLegParams struct {
+	Pool        string            // 调用方的池标识，Hub 按它查找 RecordPoolState 登记的最近状态
+	Conditional ConditionalParams // 与客户端构建 Add 时使用的参数相同
+	Add         *tx.Transaction
+	// 客户端对 Add 的签名；出方向（服务器付款）必填，客户端作为收款方须先签名
+	ClientAddSig *[]byte
+}
+
+// Validate 检查中转腿参数。
+func (p *HubLegParams) Validate() error {
+	if p.Add == nil {
+		return invalidParams("add transaction is required")
+	}
+	return p.Conditional.Validate()
+}
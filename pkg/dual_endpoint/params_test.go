@@ -0,0 +1,98 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// v2 API 与位置参数版本产生相同的交易，并拒绝颠倒的金额参数。
+func TestDualParamsAPI(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	utxos := []libs.UTXO{{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 1, Value: 100000}}
+
+	legacy, err := BuildDualFeePoolBaseTx(&utxos, 50000, clientPriv, serverPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("legacy base tx: %v", err)
+	}
+	v2, err := BuildDualFeePoolBaseTxV2(PoolParams{
+		ClientUTXOs:      utxos,
+		PoolAmount:       50000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("v2 base tx: %v", err)
+	}
+	if legacy.Tx.Hex() != v2.Tx.Hex() {
+		t.Fatalf("v2 base tx differs from legacy")
+	}
+
+	legacyB, _, _, err := BuildDualFeePoolSpendTX(legacy.Tx, 50000, 100, 800000, clientPriv, serverPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("legacy spend tx: %v", err)
+	}
+	res, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:           v2.Tx,
+		ServerAmount:     100,
+		EndHeight:        800000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("v2 spend tx: %v", err)
+	}
+	if legacyB.Hex() != res.Tx.Hex() {
+		t.Fatalf("v2 spend tx differs from legacy")
+	}
+	ok, err := ServerVerifyClientSpendSig(res.Tx, 50000, serverPriv.PubKey(), clientPriv.PubKey(), res.ClientSignBytes)
+	if err != nil || !ok {
+		t.Fatalf("verify v2 client sig: %v", err)
+	}
+
+	// 颠倒 totalAmount 与 serverAmount 会被参数校验拦截。
+	_, err = BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:           v2.Tx,
+		TotalAmount:      100,
+		ServerAmount:     50000,
+		EndHeight:        800000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+	})
+	if !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for mismatched total, got %v", err)
+	}
+	_, err = LoadTxV2(UpdateParams{
+		TxHex:           res.Tx.Hex(),
+		Sequence:        2,
+		ServerAmount:    50000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     100,
+	})
+	if !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds for swapped amounts, got %v", err)
+	}
+
+	_, err = BuildDualFeePoolBaseTxV2(PoolParams{ClientUTXOs: utxos, PoolAmount: 50000, ClientPrivateKey: clientPriv})
+	if !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for missing key, got %v", err)
+	}
+
+	// 位置参数版本保持原有行为：费率 0 不替换为默认值，序列号 0 照常写入。
+	zeroRate, err := BuildDualFeePoolBaseTx(&utxos, 50000, clientPriv, serverPriv.PubKey(), true, 0)
+	if err != nil || zeroRate.Fee != 1 {
+		t.Fatalf("legacy base tx with fee rate 0 must pay 1 sat, got %v (%v)", zeroRate, err)
+	}
+	reset, err := LoadTx(res.Tx.Hex(), nil, 0, 200, serverPriv.PubKey(), clientPriv.PubKey(), 50000)
+	if err != nil || reset.Inputs[0].SequenceNumber != 0 {
+		t.Fatalf("legacy load tx must accept sequence 0: %v", err)
+	}
+	if _, err := LoadTxV2(UpdateParams{TxHex: res.Tx.Hex(), ServerAmount: 200, ServerPublicKey: serverPriv.PubKey(), ClientPublicKey: clientPriv.PubKey(), TotalAmount: 50000}); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for sequence 0 in v2, got %v", err)
+	}
+}
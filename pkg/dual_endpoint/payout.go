@@ -0,0 +1,36 @@
+package chain_utils
+
+import (
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// VerifyDualOpening 是服务器签名初始 B-Tx 前的接受检查：A-Tx 的多签输出必须锁定到双方公钥，
+// B-Tx 只花费该输出，且只按 [服务器, 客户端] 顺序支付到开池时声明的支付脚本。
+// 通过后这两个脚本即被双方确认，之后的更新由 LoadTxV2 与 ValidatePayoutUpdate 强制使用。
+// 返回多签输出金额。
+func VerifyDualOpening(p OpenAcceptParams) (uint64, error) {
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+	poolScript, err := libs.Lock([]*ec.PublicKey{p.ServerPublicKey, p.ClientPublicKey}, 2)
+	if err != nil {
+		return 0, err
+	}
+	scripts, err := payoutScripts(p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+	if err != nil {
+		return 0, err
+	}
+	amount, err := libs.VerifyOpeningSpend(p.BaseTx, p.SpendTx, p.PoolVout, poolScript, scripts)
+	if err != nil {
+		return 0, err
+	}
+	libs.Logger().Debug("dual_endpoint: opening accepted",
+		"base_txid", p.BaseTx.TxID().String(),
+		"pool_vout", p.PoolVout,
+		"pool_amount", amount,
+		"outputs", len(p.SpendTx.Outputs),
+	)
+	return amount, nil
+}
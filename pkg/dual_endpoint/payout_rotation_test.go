@@ -0,0 +1,177 @@
+package chain_utils
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	bip32 "github.com/bsv-blockchain/go-sdk/compat/bip32"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	chaincfg "github.com/bsv-blockchain/go-sdk/transaction/chaincfg"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 支付地址轮换：开池与换池各用一个派生地址，钱包只凭扩展公钥就能扫描到所有结算。
+func TestDualPayoutRotation(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	const total = uint64(100000)
+
+	newChain := func(seed byte) (*libs.PayoutKeyChain, *libs.PayoutKeyChain) {
+		master, err := bip32.NewMaster(bytes.Repeat([]byte{seed}, 32), &chaincfg.MainNet)
+		if err != nil {
+			t.Fatalf("master: %v", err)
+		}
+		xpub, err := master.Neuter()
+		if err != nil {
+			t.Fatalf("neuter: %v", err)
+		}
+		private, _ := libs.NewPayoutKeyChain(master.String())
+		public, _ := libs.NewPayoutKeyChain(xpub.String())
+		return private, public
+	}
+	serverChain, serverWatch := newChain(1)
+	clientChain, clientWatch := newChain(2)
+
+	path := libs.PayoutPath{Pool: 3}
+	state, err := serverChain.State(path)
+	if err != nil {
+		t.Fatalf("state: %v", err)
+	}
+	if parsed, err := libs.ParsePayoutPath(state.Path.String()); err != nil || parsed != path {
+		t.Fatalf("path round trip: %v %v", parsed, err)
+	}
+	serverScript, _ := state.Script()
+	clientState, _ := clientChain.State(path)
+	clientScript, _ := clientState.Script()
+	if other, _ := serverChain.LockingScript(libs.PayoutPath{Pool: 4}); other.Equals(serverScript) {
+		t.Fatalf("each pool must get a fresh payout script")
+	}
+
+	poolScript, _ := libs.Lock([]*ec.PublicKey{serverPriv.PubKey(), clientPriv.PubKey()}, 2)
+	baseTx := tx.NewTransaction()
+	baseTx.AddOutput(&tx.TransactionOutput{Satoshis: total, LockingScript: poolScript})
+	res, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:           baseTx,
+		EndHeight:        800000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		FeeRate:          50,
+		ServerPayout:     state,
+		ClientPayout:     clientState,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if res.ServerPayout == nil || *res.ServerPayout != *state || res.ClientPayout == nil || *res.ClientPayout != *clientState {
+		t.Fatalf("open must return the payout states to persist with the pool")
+	}
+	if _, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:             baseTx,
+		EndHeight:          800000,
+		ClientPrivateKey:   clientPriv,
+		ServerPublicKey:    serverPriv.PubKey(),
+		ServerPayout:       state,
+		ServerPayoutScript: clientScript,
+	}); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a script that differs from the payout state, got %v", err)
+	}
+	latest, err := LoadTxV2(UpdateParams{
+		TxHex:              res.Tx.Hex(),
+		Sequence:           2,
+		ServerAmount:       30000,
+		ServerPublicKey:    serverPriv.PubKey(),
+		ClientPublicKey:    clientPriv.PubKey(),
+		TotalAmount:        total,
+		ServerPayoutScript: serverScript,
+		ClientPayoutScript: clientScript,
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	// 换池：服务器结算到本代地址，后继池的退款 B-Tx 使用按 Path.Next() 派生的下一代地址
+	nextServer, err := serverWatch.Next(*res.ServerPayout)
+	if err != nil {
+		t.Fatalf("next server state: %v", err)
+	}
+	nextClient, _ := clientWatch.Next(*res.ClientPayout)
+	if nextServer.Path != path.Next() {
+		t.Fatalf("next state must use path %s, got %s", path.Next(), nextServer.Path)
+	}
+	if _, err := serverChain.Next(*res.ClientPayout); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a state from another key chain, got %v", err)
+	}
+	rp := RolloverParams{
+		Latest:          latest,
+		PoolAmount:      total,
+		ClientPublicKey: clientPriv.PubKey(),
+		ServerPublicKey: serverPriv.PubKey(),
+		FeeRate:         50,
+		ServerPayout:    res.ServerPayout,
+		ClientPayout:    res.ClientPayout,
+	}
+	// 当前池有记录时必须给出后继记录，且路径只能前进一代
+	if _, err := BuildDualRolloverTx(rp); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams without next payout states, got %v", err)
+	}
+	skipped, _ := serverChain.State(libs.PayoutPath{Pool: 3, Generation: 2})
+	rp.NextServerPayout, rp.NextClientPayout = skipped, nextClient
+	if _, err := BuildDualRolloverTx(rp); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a skipped generation, got %v", err)
+	}
+	rp.NextServerPayout = nextServer
+	rollover, err := BuildDualRolloverTx(rp)
+	if err != nil {
+		t.Fatalf("rollover: %v", err)
+	}
+	serverSig, err := ServerSignRollover(rollover.Tx, rp, serverPriv)
+	if err != nil {
+		t.Fatalf("server sign rollover: %v", err)
+	}
+	rolloverTx, err := ClientSignRollover(rollover.Tx, rp, clientPriv, serverSig)
+	if err != nil {
+		t.Fatalf("client sign rollover: %v", err)
+	}
+	refund, err := BuildRolloverRefundTX(rolloverTx, rp, 810000, clientPriv)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if err := ServerVerifyRolloverRefund(refund.Tx, rolloverTx, rp, 810000, refund.ClientSignBytes); err != nil {
+		t.Fatalf("verify refund: %v", err)
+	}
+	if refund.ServerPayout != nextServer || refund.ClientPayout != nextClient {
+		t.Fatalf("the successor pool must record the next payout states")
+	}
+
+	serverScanner, err := libs.NewPayoutScanner(serverWatch, 5, 3)
+	if err != nil {
+		t.Fatalf("server scanner: %v", err)
+	}
+	matches := serverScanner.Scan(res.Tx, latest, rolloverTx, refund.Tx)
+	// 开池 B-Tx 与退款 B-Tx 的服务器金额为 0，输出被省略；最新 B-Tx 与换池交易都结算到 3/0
+	if len(matches) != 2 || matches[0].Path != path || matches[1].Path != path || matches[1].Satoshis != rollover.ServerPayout {
+		t.Fatalf("unexpected server matches: %+v", matches)
+	}
+	clientScanner, _ := libs.NewPayoutScanner(clientWatch, 5, 3)
+	if matches := clientScanner.Scan(refund.Tx); len(matches) != 1 || matches[0].Path != path.Next() || matches[0].Vout != 0 {
+		t.Fatalf("unexpected client matches: %+v", matches)
+	}
+
+	// 扩展私钥派生的支付私钥与扫描到的地址对应，扩展公钥不能派生私钥
+	key, err := serverChain.PrivateKey(path)
+	if err != nil {
+		t.Fatalf("private key: %v", err)
+	}
+	if pub, _ := serverWatch.PublicKey(path); !pub.IsEqual(key.PubKey()) {
+		t.Fatalf("xpub and xprv must derive the same payout key")
+	}
+	if _, err := serverWatch.PrivateKey(path); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for watch-only chain, got %v", err)
+	}
+	if _, err := libs.ParsePayoutPath("3/2147483648"); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for hardened path, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 开池时声明的支付脚本：服务器结算到冷钱包、客户端使用自定义脚本，接受检查与更新校验都拒绝改向。
+func TestDualDeclaredPayoutScripts(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	coldPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const total = uint64(100000)
+
+	coldAddress, _ := script.NewAddressFromPublicKey(coldPriv.PubKey(), true)
+	coldScript, _ := p2pkh.Lock(coldAddress)
+	clientScript, err := libs.Lock([]*ec.PublicKey{clientPriv.PubKey()}, 1)
+	if err != nil {
+		t.Fatalf("client script: %v", err)
+	}
+
+	poolScript, _ := libs.Lock([]*ec.PublicKey{serverPriv.PubKey(), clientPriv.PubKey()}, 2)
+	baseTx := tx.NewTransaction()
+	baseTx.AddOutput(&tx.TransactionOutput{Satoshis: total, LockingScript: poolScript})
+
+	res, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:             baseTx,
+		ServerAmount:       0,
+		EndHeight:          800000,
+		ClientPrivateKey:   clientPriv,
+		ServerPublicKey:    serverPriv.PubKey(),
+		FeeRate:            50,
+		ServerPayoutScript: coldScript,
+		ClientPayoutScript: clientScript,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// 开池时服务器金额为 0，服务器输出被省略
+	if len(res.Tx.Outputs) != 1 || !res.Tx.Outputs[0].LockingScript.Equals(clientScript) {
+		t.Fatalf("B-Tx must pay to the declared client script")
+	}
+
+	accept := OpenAcceptParams{
+		BaseTx:             baseTx,
+		SpendTx:            res.Tx,
+		ServerPublicKey:    serverPriv.PubKey(),
+		ClientPublicKey:    clientPriv.PubKey(),
+		ServerPayoutScript: coldScript,
+		ClientPayoutScript: clientScript,
+	}
+	if amount, err := VerifyDualOpening(accept); err != nil || amount != total {
+		t.Fatalf("accept opening: amount %d, %v", amount, err)
+	}
+	// 客户端声明了 1-of-1 脚本，接受方却按客户端签名公钥的地址核对
+	accept.ClientPayoutScript = nil
+	if _, err := VerifyDualOpening(accept); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for undeclared client payout, got %v", err)
+	}
+
+	update := UpdateParams{
+		TxHex:              res.Tx.Hex(),
+		Sequence:           2,
+		ServerAmount:       30000,
+		ServerPublicKey:    serverPriv.PubKey(),
+		ClientPublicKey:    clientPriv.PubKey(),
+		TotalAmount:        total,
+		ServerPayoutScript: coldScript,
+		ClientPayoutScript: clientScript,
+	}
+	next, err := LoadTxV2(update)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := ValidatePayoutUpdate(res.Tx, next, update); err != nil {
+		t.Fatalf("payout update: %v", err)
+	}
+	// 服务器输出重新出现时使用声明的冷钱包脚本
+	if len(next.Outputs) != 2 || !next.Outputs[0].LockingScript.Equals(coldScript) || next.Outputs[0].Satoshis != 30000 {
+		t.Fatalf("update must restore the server payout to its declared script")
+	}
+
+	// 更新时把客户端输出改向其他脚本：校验与加载都拒绝
+	redirected, _ := tx.NewTransactionFromHex(next.Hex())
+	redirected.Outputs[1].LockingScript = coldScript
+	if err := ValidatePayoutUpdate(res.Tx, redirected, update); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for redirected payout, got %v", err)
+	}
+	update.TxHex, update.Sequence = redirected.Hex(), 3
+	if _, err := LoadTxV2(update); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch when loading a redirected B-Tx, got %v", err)
+	}
+
+	// 换池时服务器结算输出沿用冷钱包脚本
+	rollover, err := BuildDualRolloverTx(RolloverParams{
+		Latest:             next,
+		PoolAmount:         total,
+		ClientPublicKey:    clientPriv.PubKey(),
+		ServerPublicKey:    serverPriv.PubKey(),
+		FeeRate:            50,
+		ServerPayoutScript: coldScript,
+		ClientPayoutScript: clientScript,
+	})
+	if err != nil {
+		t.Fatalf("rollover: %v", err)
+	}
+	if len(rollover.Tx.Outputs) != 2 || !rollover.Tx.Outputs[1].LockingScript.Equals(coldScript) {
+		t.Fatalf("rollover must settle the server to its declared payout script")
+	}
+
+	if _, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:             baseTx,
+		EndHeight:          800000,
+		ClientPrivateKey:   clientPriv,
+		ServerPublicKey:    serverPriv.PubKey(),
+		ClientPayoutScript: &script.Script{},
+	}); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for empty payout script, got %v", err)
+	}
+}
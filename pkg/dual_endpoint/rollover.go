@@ -0,0 +1,225 @@
+package chain_utils
+
+import (
+	"bytes"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// Rollover：序列号或到期高度即将用尽时，用一笔交易同时结算当前池并开启后继池。
+// 交易只花费当前多签输出：输出 [后继多签 (客户端余额 - fee), 服务器结算 P2PKH (服务器金额)?]，
+// 服务器金额为 0 时省略结算输出。最近一次 B-Tx 的手续费随换池释放，与换池手续费的差额按 FeePolicy 分摊；
+// 默认由客户端承担，即客户端余额按 PoolAmount - 服务器金额 - 手续费结转。
+// 签名顺序与 splice 相同：服务器先签，客户端核对后完成签名并在新 outpoint 上构建退款 B-Tx
+// （序列号从 1 开始、服务器金额为 0、使用新的到期高度），服务器回签后客户端才广播。
+// 是否需要换池由 libs.RolloverPolicy.Due 按剩余序列号与剩余区块数判断，调用方在每次更新后检查即可。
+
+// RolloverResponse 是 BuildDualRolloverTx 的返回值。
+type RolloverResponse struct {
+	Tx            *tx.Transaction
+	Amount        uint64 // 后继多签输出金额
+	Index         int
+	Fee           uint64
+	ServerPayout  uint64 // 服务器结算金额，为 0 时交易没有结算输出
+	CarriedAmount uint64 // 结转前的客户端余额 = PoolAmount - ServerPayout
+}
+
+// BuildDualRolloverTx 构建未签名的换池交易。
+func BuildDualRolloverTx(p RolloverParams) (*RolloverResponse, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	serverScript, clientScript, err := p.payoutScripts()
+	if err != nil {
+		return nil, err
+	}
+	latest, _, err := statePayouts(p.Latest, p.ServerPublicKey, p.ClientPublicKey, serverScript, clientScript)
+	if err != nil {
+		return nil, err
+	}
+	serverPayout := latest[0]
+	carried := p.PoolAmount - serverPayout
+
+	multisigScript, err := libs.Lock([]*ec.PublicKey{p.ServerPublicKey, p.ClientPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multisig locking script: %w", err)
+	}
+
+	transactionData := tx.NewTransaction()
+	if err := transactionData.AddInputFrom(p.poolTxID(), p.poolVout(), multisigScript.String(), p.PoolAmount, nil); err != nil {
+		return nil, fmt.Errorf("failed to add pool input: %w", err)
+	}
+	transactionData.AddOutput(&tx.TransactionOutput{Satoshis: carried, LockingScript: multisigScript})
+	if serverPayout > 0 {
+		if serverScript == nil {
+			serverAddress, err := p.Network.Address(p.ServerPublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get server address: %w", err)
+			}
+			serverScript, err = p2pkh.Lock(serverAddress)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create server locking script: %w", err)
+			}
+		}
+		transactionData.AddOutput(&tx.TransactionOutput{Satoshis: serverPayout, LockingScript: serverScript})
+	}
+
+	fakeMultisig, err := libs.FakeSign(2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build placeholder unlocking script: %w", err)
+	}
+	transactionData.Inputs[0].UnlockingScript = fakeMultisig
+	fee := uint64(float64(transactionData.Size()) / 1000.0 * feeRateOrDefault(p.FeeRate))
+	if fee == 0 {
+		fee = 1
+	}
+	transactionData.Inputs[0].UnlockingScript = nil
+
+	// 最近一次 B-Tx 的手续费随换池释放，与换池手续费的差额按策略分摊
+	oldFee := p.PoolAmount - latest[0] - latest[1]
+	serverOut, amount, err := p.FeePolicy.Resettle(serverPayout, latest[1], oldFee, fee)
+	if err != nil {
+		return nil, fmt.Errorf("rollover fee %d (%s): %w", fee, p.FeePolicy, err)
+	}
+	if amount == 0 {
+		return nil, fmt.Errorf("rollover fee: %w", &libs.InsufficientFundsError{Need: fee + 1, Have: carried})
+	}
+	transactionData.Outputs[0].Satoshis = amount
+	if serverPayout > 0 {
+		transactionData.Outputs[1].Satoshis = serverOut
+	}
+	serverPayout, carried = serverOut, p.PoolAmount-serverOut
+
+	libs.Logger().Debug("dual_endpoint: rollover tx built",
+		"prev_pool_txid", p.poolTxID(),
+		"pool_amount", transactionData.Outputs[0].Satoshis,
+		"server_payout", serverPayout,
+		"fee", fee,
+	)
+	return &RolloverResponse{
+		Tx:            transactionData,
+		Amount:        amount,
+		Index:         0,
+		Fee:           fee,
+		ServerPayout:  serverPayout,
+		CarriedAmount: carried,
+	}, nil
+}
+
+// PlanDualRollover 按阈值检查最近状态，需要换池时构建换池交易；未到阈值时返回 nil 与 libs.RolloverNotDue。
+func PlanDualRollover(p RolloverParams, policy libs.RolloverPolicy, currentHeight uint32) (*RolloverResponse, libs.RolloverReason, error) {
+	reason := policy.Due(p.Latest, currentHeight)
+	if reason == libs.RolloverNotDue {
+		return nil, reason, nil
+	}
+	res, err := BuildDualRolloverTx(p)
+	if err != nil {
+		return nil, reason, err
+	}
+	libs.Logger().Debug("dual_endpoint: rollover due", "reason", reason.String(), "height", currentHeight)
+	return res, reason, nil
+}
+
+// VerifyDualRolloverTx 按参数重建换池交易并核对除解锁脚本外完全一致，并补全多签输入的前序输出。
+func VerifyDualRolloverTx(rolloverTx *tx.Transaction, p RolloverParams) (*RolloverResponse, error) {
+	if rolloverTx == nil || len(rolloverTx.Inputs) != 1 {
+		return nil, fmt.Errorf("%w: rollover tx must have exactly one input", libs.ErrInvalidTransaction)
+	}
+	expected, err := BuildDualRolloverTx(p)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(libs.UnsignedBytes(rolloverTx), libs.UnsignedBytes(expected.Tx)) {
+		return nil, fmt.Errorf("%w: rollover tx does not match the agreed parameters", libs.ErrTransitionMismatch)
+	}
+	rolloverTx.Inputs[0].SetSourceTxOutput(expected.Tx.Inputs[0].SourceTxOutput())
+	return expected, nil
+}
+
+// ServerSignRollover 服务器核对换池交易后为多签输入签名。
+func ServerSignRollover(rolloverTx *tx.Transaction, p RolloverParams, serverPrivateKey *ec.PrivateKey) (*[]byte, error) {
+	if serverPrivateKey == nil || !serverPrivateKey.PubKey().IsEqual(p.ServerPublicKey) {
+		return nil, invalidParams("server private key does not match server public key")
+	}
+	if _, err := VerifyDualRolloverTx(rolloverTx, p); err != nil {
+		return nil, err
+	}
+	serverSignBytes, err := signPoolInput(rolloverTx, p.ServerPublicKey, p.ClientPublicKey, serverPrivateKey, libs.PartyServer)
+	if err != nil {
+		return nil, err
+	}
+	libs.Logger().Debug("dual_endpoint: server signed rollover", "prev_pool_txid", p.poolTxID())
+	return serverSignBytes, nil
+}
+
+// ClientSignRollover 客户端按自己保存的最近状态核对结算金额与服务器签名后完成签名，返回完整交易。
+func ClientSignRollover(rolloverTx *tx.Transaction, p RolloverParams, clientPrivateKey *ec.PrivateKey, serverSignBytes *[]byte) (*tx.Transaction, error) {
+	if clientPrivateKey == nil || !clientPrivateKey.PubKey().IsEqual(p.ClientPublicKey) {
+		return nil, invalidParams("client private key does not match client public key")
+	}
+	if _, err := VerifyDualRolloverTx(rolloverTx, p); err != nil {
+		return nil, err
+	}
+	if _, err := completePoolInput(rolloverTx, p.PoolAmount, p.ServerPublicKey, clientPrivateKey, serverSignBytes); err != nil {
+		return nil, err
+	}
+	libs.Logger().Debug("dual_endpoint: client signed rollover", "txid", rolloverTx.TxID().String())
+	return rolloverTx, nil
+}
+
+// BuildRolloverRefundTX 客户端在换池交易完整签名后，为后继池构建退款 B-Tx：
+// 序列号从 1 开始，服务器金额为 0，locktime 为新的到期高度，支付脚本为后继池的脚本。
+func BuildRolloverRefundTX(rolloverTx *tx.Transaction, p RolloverParams, endHeight uint32, clientPrivateKey *ec.PrivateKey) (*SpendResult, error) {
+	if err := requireFullySigned(rolloverTx); err != nil {
+		return nil, err
+	}
+	if clientPrivateKey == nil || !clientPrivateKey.PubKey().IsEqual(p.ClientPublicKey) {
+		return nil, invalidParams("client private key does not match client public key")
+	}
+	if _, err := VerifyDualRolloverTx(rolloverTx, p); err != nil {
+		return nil, err
+	}
+	serverScript, clientScript, err := p.nextPayoutScripts()
+	if err != nil {
+		return nil, err
+	}
+	return BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:             rolloverTx,
+		ServerAmount:       0,
+		EndHeight:          endHeight,
+		ClientPrivateKey:   clientPrivateKey,
+		ServerPublicKey:    p.ServerPublicKey,
+		Network:            p.Network,
+		FeeRate:            p.FeeRate,
+		ServerPayoutScript: serverScript,
+		ClientPayoutScript: clientScript,
+		ServerPayout:       p.NextServerPayout,
+		ClientPayout:       p.NextClientPayout,
+	})
+}
+
+// ServerVerifyRolloverRefund 服务器回签后继池退款 B-Tx 前核对换池交易与退款交易，退款 locktime 必须等于 endHeight。
+func ServerVerifyRolloverRefund(refundTx *tx.Transaction, rolloverTx *tx.Transaction, p RolloverParams, endHeight uint32, clientSignBytes *[]byte) error {
+	if _, err := VerifyDualRolloverTx(rolloverTx, p); err != nil {
+		return err
+	}
+	if err := requireFullySigned(rolloverTx); err != nil {
+		return err
+	}
+	if refundTx != nil && len(refundTx.Inputs) == 1 && refundTx.Inputs[0].SequenceNumber != 1 {
+		return fmt.Errorf("%w: refund sequence must restart at 1, got %d", libs.ErrTransitionMismatch, refundTx.Inputs[0].SequenceNumber)
+	}
+	serverScript, clientScript, err := p.nextPayoutScripts()
+	if err != nil {
+		return err
+	}
+	if err := libs.CheckRefundTimelock(refundTx, endHeight); err != nil {
+		return err
+	}
+	return verifyRefundTx(refundTx, rolloverTx, 0, p.ServerPublicKey, p.ClientPublicKey, serverScript, clientScript, clientSignBytes)
+}
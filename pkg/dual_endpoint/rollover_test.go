@@ -0,0 +1,84 @@
+package chain_utils
+
+import (
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 换池：阈值触发，服务器金额结算，客户端余额结转到后继池，新退款交易从序列号 1 开始。
+func TestDualRollover(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	latest, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		PrevTxID:         "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		TotalAmount:      100000,
+		ServerAmount:     30000,
+		EndHeight:        800100,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	p := RolloverParams{
+		Latest:          latest.Tx,
+		PoolAmount:      100000,
+		ClientPublicKey: clientPriv.PubKey(),
+		ServerPublicKey: serverPriv.PubKey(),
+		FeeRate:         5,
+	}
+	policy := libs.RolloverPolicy{MinSequenceRemaining: 1000, MinBlocksRemaining: 144}
+
+	if res, reason, err := PlanDualRollover(p, policy, 799000); err != nil || res != nil || reason != libs.RolloverNotDue {
+		t.Fatalf("rollover should not be due yet: %v %v", reason, err)
+	}
+	latest.Tx.Inputs[0].SequenceNumber = libs.MaxNonFinalSequence - 10
+	if reason := policy.Due(latest.Tx, 799000); reason != libs.RolloverSequence {
+		t.Fatalf("expected sequence trigger, got %s", reason)
+	}
+	latest.Tx.Inputs[0].SequenceNumber = 1
+
+	res, reason, err := PlanDualRollover(p, policy, 800000)
+	if err != nil || reason != libs.RolloverExpiry {
+		t.Fatalf("plan rollover: %v %v", reason, err)
+	}
+	if res.ServerPayout != 30000 || res.Amount != 70000-res.Fee || len(res.Tx.Outputs) != 2 {
+		t.Fatalf("unexpected rollover amounts %d/%d fee %d", res.ServerPayout, res.Amount, res.Fee)
+	}
+
+	wire, _ := tx.NewTransactionFromHex(res.Tx.Hex())
+	serverSig, err := ServerSignRollover(wire, p, serverPriv)
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	wire, _ = tx.NewTransactionFromHex(res.Tx.Hex())
+	rolloverTx, err := ClientSignRollover(wire, p, clientPriv, serverSig)
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+	err = interpreter.NewEngine().Execute(
+		interpreter.WithTx(rolloverTx, 0, rolloverTx.Inputs[0].SourceTxOutput()),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("rollover failed script check: %v", err)
+	}
+
+	refund, err := BuildRolloverRefundTX(rolloverTx, p, 810000, clientPriv)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if refund.Tx.Inputs[0].SequenceNumber != 1 || refund.Tx.LockTime != 810000 || len(refund.Tx.Outputs) != 1 || refund.Amount != res.Amount-refund.Fee {
+		t.Fatalf("successor refund must restart sequence and omit the zero server balance")
+	}
+	received, _ := tx.NewTransactionFromHex(rolloverTx.Hex())
+	if err := ServerVerifyRolloverRefund(refund.Tx, received, p, 810000, refund.ClientSignBytes); err != nil {
+		t.Fatalf("server verify refund: %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
 	script "github.com/bsv-blockchain/go-sdk/script"
 	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	p2pkh "github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
 )
 
 // 构建双端费用池的花费脚本
@@ -28,22 +29,83 @@ func MergeDualPoolSigForSpendTx(
 	txHex string,
 	serverSignByte *[]byte,
 	clientSignByte *[]byte,
+) (*tx.Transaction, error) {
+	return MergeDualPoolSigForSpendTxAt(txHex, 0, serverSignByte, clientSignByte)
+}
+
+// MergeDualPoolSigForSpendTxAt 与 MergeDualPoolSigForSpendTx 相同，但把解锁脚本写入第 inputIndex 个输入。
+func MergeDualPoolSigForSpendTxAt(
+	txHex string,
+	inputIndex uint32,
+	serverSignByte *[]byte,
+	clientSignByte *[]byte,
 ) (*tx.Transaction, error) {
 	// 恢复 bTx
 	bTx, err := tx.NewTransactionFromHex(txHex)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: decode tx hex: %w", multisig.ErrInvalidTransaction, err)
+	}
+	if int(inputIndex) >= len(bTx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
+	if serverSignByte == nil {
+		return nil, &multisig.SignatureError{Party: multisig.PartyServer, Err: multisig.ErrInvalidSignatureFormat}
+	}
+	if clientSignByte == nil {
+		return nil, &multisig.SignatureError{Party: multisig.PartyClient, Err: multisig.ErrInvalidSignatureFormat}
 	}
 
 	signs := [][]byte{*serverSignByte, *clientSignByte}
 	unScript, err := multisig.BuildSignScript(&signs)
 	if err != nil {
-		return nil, fmt.Errorf("BuildSignScript error: %v", err)
+		return nil, fmt.Errorf("failed to build unlocking script: %w", err)
 	}
 
-	bTx.Inputs[0].UnlockingScript = unScript
-	// fmt.Printf("aTx: %s\n", aTx.Hex())
-	fmt.Printf("bTx 2: %s\n", bTx.Hex())
+	bTx.Inputs[inputIndex].UnlockingScript = unScript
+	multisig.Logger().Debug("dual_endpoint: signatures merged", "txid", bTx.TxID().String())
 
 	return bTx, nil
 }
+
+// VerifyDualSignedState 核对已合并签名的 B-Tx：第 inputIndex 个输入的解锁脚本按 [服务器, 客户端] 顺序带有
+// 双方对 poolAmount 多签输出的有效签名。签名覆盖输入 outpoint 与金额，通过后该状态即是双方认可的最新分配。
+func VerifyDualSignedState(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	poolAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	clientPublicKey *ec.PublicKey,
+) error {
+	if transactionObject == nil || int(inputIndex) >= len(transactionObject.Inputs) || transactionObject.Inputs[inputIndex].UnlockingScript == nil {
+		return fmt.Errorf("%w: input %d is not signed", multisig.ErrInvalidTransaction, inputIndex)
+	}
+	chunks, err := transactionObject.Inputs[inputIndex].UnlockingScript.Chunks()
+	if err != nil || len(chunks) != 3 || chunks[0].Op != script.Op0 {
+		return fmt.Errorf("%w: input %d is not a 2-of-2 multisig spend", multisig.ErrInvalidTransaction, inputIndex)
+	}
+	serverSig, clientSig := chunks[1].Data, chunks[2].Data
+	if _, err := ClientVerifyServerSpendSigAt(transactionObject, inputIndex, poolAmount, serverPublicKey, clientPublicKey, &serverSig); err != nil {
+		return err
+	}
+	if _, err := ServerVerifyClientSpendSigAt(transactionObject, inputIndex, poolAmount, serverPublicKey, clientPublicKey, &clientSig); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PayoutScripts 返回双端池按固定顺序 [服务器, 客户端] 排列的支付锁定脚本（P2PKH，与网络无关）。
+func PayoutScripts(serverPublicKey, clientPublicKey *ec.PublicKey) ([]*script.Script, error) {
+	scripts := make([]*script.Script, 0, 2)
+	for _, pub := range []*ec.PublicKey{serverPublicKey, clientPublicKey} {
+		address, err := script.NewAddressFromPublicKey(pub, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get payout address: %w", err)
+		}
+		lockingScript, err := p2pkh.Lock(address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create payout locking script: %w", err)
+		}
+		scripts = append(scripts, lockingScript)
+	}
+	return scripts, nil
+}
@@ -0,0 +1,426 @@
+package chain_utils
+
+import (
+	"bytes"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// Splice-in：不关闭池，把现有多签输出与客户端新 UTXO 合并为更大的多签输出。
+//  1. 双方按 SpliceInParams 构建同一笔 splice 交易（BuildDualSpliceInTx）。
+//  2. 服务器核对后只签多签输入（ServerSignSpliceIn），签名交给客户端。
+//  3. 客户端核对服务器签名后完成多签输入并签自己的 P2PKH 输入（ClientSignSpliceIn），此时 txid 确定。
+//  4. 客户端在新 outpoint 上构建退款 B-Tx（BuildSpliceInRefundTX）：序列号重新从 1 开始，
+//     服务器金额沿用 ServerBalance（已付款金额），支付脚本沿用开池时声明的脚本。服务器核对（ServerVerifySpliceInRefund）后回签。
+//  5. 客户端拿到完整退款交易后才广播 splice 交易。
+
+// BuildDualSpliceInTx 构建未签名的 splice-in 交易：
+// 输入 [现有多签输出, 客户端 UTXO...]，输出 [新多签 (PoolAmount + AddAmount), 客户端找零?]。
+func BuildDualSpliceInTx(p SpliceInParams) (*BuildStep1Response, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	feeRate := feeRateOrDefault(p.FeeRate)
+
+	var res *BuildStep1Response
+	_, err := libs.ConvergeFee(feeRate, func(fee uint64) (*tx.Transaction, error) {
+		var err error
+		res, err = assembleSpliceInTx(&p, fee)
+		if err != nil {
+			return nil, err
+		}
+		return res.Tx, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, input := range res.Tx.Inputs {
+		input.UnlockingScript = nil
+	}
+
+	libs.Logger().Debug("dual_endpoint: splice-in tx built",
+		"prev_pool_txid", p.PoolTxID,
+		"pool_amount", res.Amount,
+		"added", p.AddAmount,
+		"change", res.Change,
+		"fee", res.Fee,
+	)
+	return res, nil
+}
+
+func assembleSpliceInTx(p *SpliceInParams, fee uint64) (*BuildStep1Response, error) {
+	clientTotal := libs.SumUTXOs(p.ClientUTXOs)
+	if clientTotal < p.AddAmount+fee {
+		return nil, fmt.Errorf("add amount plus fee %d: %w", fee, &libs.InsufficientFundsError{Need: p.AddAmount + fee, Have: clientTotal})
+	}
+
+	multisigScript, err := libs.Lock([]*ec.PublicKey{p.ServerPublicKey, p.ClientPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multisig locking script: %w", err)
+	}
+	clientAddress, err := p.Network.Address(p.ClientPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client address: %w", err)
+	}
+	clientScript, err := p2pkh.Lock(clientAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client locking script: %w", err)
+	}
+
+	transactionData := tx.NewTransaction()
+	if err := transactionData.AddInputFrom(p.PoolTxID, p.PoolVout, multisigScript.String(), p.PoolAmount, nil); err != nil {
+		return nil, fmt.Errorf("failed to add pool input: %w", err)
+	}
+	for _, u := range p.ClientUTXOs {
+		if err := transactionData.AddInputFrom(u.TxID, u.Vout, clientScript.String(), u.Value, nil); err != nil {
+			return nil, fmt.Errorf("failed to add client input: %w", err)
+		}
+	}
+	fakeMultisig, err := libs.FakeSign(2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build placeholder unlocking script: %w", err)
+	}
+	transactionData.Inputs[0].UnlockingScript = fakeMultisig
+	for _, input := range transactionData.Inputs[1:] {
+		input.UnlockingScript = libs.FakeP2PKHSign()
+	}
+
+	poolAmount := p.PoolAmount + p.AddAmount
+	transactionData.AddOutput(&tx.TransactionOutput{
+		Satoshis:      poolAmount,
+		LockingScript: multisigScript,
+	})
+	change := clientTotal - p.AddAmount - fee
+	if change > 0 {
+		transactionData.AddOutput(&tx.TransactionOutput{Satoshis: change, LockingScript: clientScript})
+	}
+
+	return &BuildStep1Response{
+		Tx:     transactionData,
+		Amount: poolAmount,
+		Index:  0,
+		Fee:    fee,
+		Change: change,
+	}, nil
+}
+
+// VerifyDualSpliceInTx 按参数重建 splice 交易并核对除解锁脚本外完全一致，
+// 同时为收到的交易补全各输入的前序输出，便于之后签名与验签。
+func VerifyDualSpliceInTx(spliceTx *tx.Transaction, p SpliceInParams) error {
+	if spliceTx == nil {
+		return fmt.Errorf("%w: empty splice tx", libs.ErrInvalidTransaction)
+	}
+	expected, err := BuildDualSpliceInTx(p)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(libs.UnsignedBytes(spliceTx), libs.UnsignedBytes(expected.Tx)) {
+		return fmt.Errorf("%w: splice tx does not match the agreed parameters", libs.ErrTransitionMismatch)
+	}
+	for i, input := range expected.Tx.Inputs {
+		spliceTx.Inputs[i].SetSourceTxOutput(input.SourceTxOutput())
+	}
+	return nil
+}
+
+// ServerSignSpliceIn 服务器核对 splice 交易后只为多签输入签名。
+func ServerSignSpliceIn(spliceTx *tx.Transaction, p SpliceInParams, serverPrivateKey *ec.PrivateKey) (*[]byte, error) {
+	if serverPrivateKey == nil || !serverPrivateKey.PubKey().IsEqual(p.ServerPublicKey) {
+		return nil, invalidParams("server private key does not match server public key")
+	}
+	if err := VerifyDualSpliceInTx(spliceTx, p); err != nil {
+		return nil, err
+	}
+	serverSignBytes, err := signPoolInput(spliceTx, p.ServerPublicKey, p.ClientPublicKey, serverPrivateKey, libs.PartyServer)
+	if err != nil {
+		return nil, err
+	}
+	libs.Logger().Debug("dual_endpoint: server signed splice-in", "prev_pool_txid", p.PoolTxID)
+	return serverSignBytes, nil
+}
+
+// ClientSignSpliceIn 客户端核对 splice 交易与服务器签名后，完成多签输入并签名自己的输入，返回完整交易。
+func ClientSignSpliceIn(spliceTx *tx.Transaction, p SpliceInParams, clientPrivateKey *ec.PrivateKey, serverSignBytes *[]byte) (*tx.Transaction, error) {
+	if clientPrivateKey == nil || !clientPrivateKey.PubKey().IsEqual(p.ClientPublicKey) {
+		return nil, invalidParams("client private key does not match client public key")
+	}
+	if err := VerifyDualSpliceInTx(spliceTx, p); err != nil {
+		return nil, err
+	}
+	if _, err := completePoolInput(spliceTx, p.PoolAmount, p.ServerPublicKey, clientPrivateKey, serverSignBytes); err != nil {
+		return nil, err
+	}
+
+	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
+	p2pkhUnlocker, err := p2pkh.Unlock(clientPrivateKey, &sigHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unlocking script template: %w", err)
+	}
+	for i := 1; i < len(spliceTx.Inputs); i++ {
+		unlockingScript, err := p2pkhUnlocker.Sign(spliceTx, uint32(i))
+		if err != nil {
+			return nil, fmt.Errorf("%w: client input %d: %w", libs.ErrSigningFailed, i, err)
+		}
+		spliceTx.Inputs[i].UnlockingScript = unlockingScript
+	}
+
+	libs.Logger().Debug("dual_endpoint: client signed splice-in", "txid", spliceTx.TxID().String())
+	return spliceTx, nil
+}
+
+// BuildSpliceInRefundTX 客户端在 splice 交易完整签名后，在新 outpoint 上构建退款 B-Tx（序列号从 1 开始），
+// 服务器金额沿用 splice 前的已付款金额。
+func BuildSpliceInRefundTX(spliceTx *tx.Transaction, p SpliceInParams, endHeight uint32, clientPrivateKey *ec.PrivateKey) (*SpendResult, error) {
+	if err := requireFullySigned(spliceTx); err != nil {
+		return nil, err
+	}
+	if clientPrivateKey == nil || !clientPrivateKey.PubKey().IsEqual(p.ClientPublicKey) {
+		return nil, invalidParams("client private key does not match client public key")
+	}
+	return BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:             spliceTx,
+		ServerAmount:       p.ServerBalance,
+		EndHeight:          endHeight,
+		ClientPrivateKey:   clientPrivateKey,
+		ServerPublicKey:    p.ServerPublicKey,
+		Network:            p.Network,
+		FeeRate:            p.FeeRate,
+		ServerPayoutScript: p.ServerPayoutScript,
+		ClientPayoutScript: p.ClientPayoutScript,
+	})
+}
+
+// ServerVerifySpliceInRefund 服务器回签退款 B-Tx 前核对：splice 交易完整且符合约定、
+// 客户端输入签名有效、退款交易花费新多签输出、locktime 等于 endHeight 且服务器金额等于 ServerBalance。
+func ServerVerifySpliceInRefund(refundTx *tx.Transaction, spliceTx *tx.Transaction, p SpliceInParams, endHeight uint32, clientSignBytes *[]byte) error {
+	if err := VerifyDualSpliceInTx(spliceTx, p); err != nil {
+		return err
+	}
+	if err := requireFullySigned(spliceTx); err != nil {
+		return err
+	}
+	if err := verifyDualFundedInputs(spliceTx, p.Network, p.ClientUTXOs, 1, p.ClientPublicKey, libs.PartyClient); err != nil {
+		return err
+	}
+	if refundTx != nil && len(refundTx.Inputs) == 1 && refundTx.Inputs[0].SequenceNumber != 1 {
+		return fmt.Errorf("%w: refund sequence must restart at 1, got %d", libs.ErrTransitionMismatch, refundTx.Inputs[0].SequenceNumber)
+	}
+	if err := libs.CheckRefundTimelock(refundTx, endHeight); err != nil {
+		return err
+	}
+	return verifyRefundTx(refundTx, spliceTx, p.ServerBalance, p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript, clientSignBytes)
+}
+
+// signPoolInput 为 splice 交易的多签输入（inputs[0]）签名，返回 DER+SigHash 签名。
+func signPoolInput(spliceTx *tx.Transaction, serverPublicKey, clientPublicKey *ec.PublicKey, privateKey *ec.PrivateKey, party libs.Party) (*[]byte, error) {
+	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
+	unlocker, err := libs.Unlock([]*ec.PrivateKey{}, []*ec.PublicKey{serverPublicKey, clientPublicKey}, 2, &sigHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unlocking script template: %w", err)
+	}
+	signBytes, err := unlocker.SignOne(spliceTx, 0, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s input %d: %w", libs.ErrSigningFailed, party, 0, err)
+	}
+	return signBytes, nil
+}
+
+// completePoolInput 客户端验证服务器对多签输入的签名，补上自己的签名并写入解锁脚本。
+func completePoolInput(spliceTx *tx.Transaction, poolAmount uint64, serverPublicKey *ec.PublicKey, clientPrivateKey *ec.PrivateKey, serverSignBytes *[]byte) (*[]byte, error) {
+	multisigScript, err := libs.Lock([]*ec.PublicKey{serverPublicKey, clientPrivateKey.PubKey()}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	if _, err := verifySignatureWithContext(spliceTx, 0, multisigScript, poolAmount, libs.PartyServer, serverPublicKey, serverSignBytes); err != nil {
+		return nil, err
+	}
+	clientSignBytes, err := signPoolInput(spliceTx, serverPublicKey, clientPrivateKey.PubKey(), clientPrivateKey, libs.PartyClient)
+	if err != nil {
+		return nil, err
+	}
+	signs := [][]byte{*serverSignBytes, *clientSignBytes}
+	unlockingScript, err := libs.BuildSignScript(&signs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build unlocking script: %w", err)
+	}
+	spliceTx.Inputs[0].UnlockingScript = unlockingScript
+	return clientSignBytes, nil
+}
+
+// Splice-out：服务器提取已赚取的金额而不结束会话。
+// 交易只花费现有多签输出：输出 [新多签 (PoolAmount - Withdraw - fee), 提现 P2PKH (Withdraw)]，
+// 手续费同样从服务器已赚取的金额中扣除，因此 Withdraw + fee 不得超过最近一次双方签名状态中的服务器金额。
+// 签名顺序与 splice-in 相同：服务器先签，客户端核对后完成签名并构建新 outpoint 上的退款 B-Tx，
+// 服务器回签退款交易后客户端才广播 splice 交易。
+
+// SpliceOutResponse 是 BuildDualSpliceOutTx 的返回值。
+type SpliceOutResponse struct {
+	Tx            *tx.Transaction
+	Amount        uint64 // 新多签输出金额
+	Index         int
+	Fee           uint64
+	Withdrawn     uint64 // 提现输出金额（outputs[1]）
+	ServerBalance uint64 // 新池中服务器的剩余金额 = 已赚取 - Withdraw - fee
+}
+
+// BuildDualSpliceOutTx 构建未签名的 splice-out 交易。
+func BuildDualSpliceOutTx(p SpliceOutParams) (*SpliceOutResponse, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	latest, _, err := statePayouts(p.Latest, p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript)
+	if err != nil {
+		return nil, err
+	}
+	earned := latest[0]
+
+	multisigScript, err := libs.Lock([]*ec.PublicKey{p.ServerPublicKey, p.ClientPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multisig locking script: %w", err)
+	}
+	payoutAddress, err := p.payoutAddress()
+	if err != nil {
+		return nil, err
+	}
+	payoutScript, err := p2pkh.Lock(payoutAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payout locking script: %w", err)
+	}
+
+	transactionData := tx.NewTransaction()
+	if err := transactionData.AddInputFrom(p.poolTxID(), p.poolVout(), multisigScript.String(), p.PoolAmount, nil); err != nil {
+		return nil, fmt.Errorf("failed to add pool input: %w", err)
+	}
+	transactionData.AddOutput(&tx.TransactionOutput{Satoshis: p.PoolAmount - p.Withdraw, LockingScript: multisigScript})
+	transactionData.AddOutput(&tx.TransactionOutput{Satoshis: p.Withdraw, LockingScript: payoutScript})
+
+	fakeMultisig, err := libs.FakeSign(2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build placeholder unlocking script: %w", err)
+	}
+	transactionData.Inputs[0].UnlockingScript = fakeMultisig
+	fee := uint64(float64(transactionData.Size()) / 1000.0 * feeRateOrDefault(p.FeeRate))
+	if fee == 0 {
+		fee = 1
+	}
+	transactionData.Inputs[0].UnlockingScript = nil
+
+	// 只能提取已赚取的金额
+	if p.Withdraw+fee > earned {
+		return nil, fmt.Errorf("withdraw plus fee %d exceeds earned: %w", fee, &libs.InsufficientFundsError{Need: p.Withdraw + fee, Have: earned})
+	}
+	transactionData.Outputs[0].Satoshis = p.PoolAmount - p.Withdraw - fee
+
+	libs.Logger().Debug("dual_endpoint: splice-out tx built",
+		"prev_pool_txid", p.poolTxID(),
+		"pool_amount", transactionData.Outputs[0].Satoshis,
+		"withdrawn", p.Withdraw,
+		"fee", fee,
+	)
+	return &SpliceOutResponse{
+		Tx:            transactionData,
+		Amount:        transactionData.Outputs[0].Satoshis,
+		Index:         0,
+		Fee:           fee,
+		Withdrawn:     p.Withdraw,
+		ServerBalance: earned - p.Withdraw - fee,
+	}, nil
+}
+
+// VerifyDualSpliceOutTx 按参数重建 splice-out 交易并核对除解锁脚本外完全一致，并补全多签输入的前序输出。
+func VerifyDualSpliceOutTx(spliceTx *tx.Transaction, p SpliceOutParams) (*SpliceOutResponse, error) {
+	if spliceTx == nil || len(spliceTx.Inputs) != 1 {
+		return nil, fmt.Errorf("%w: splice-out tx must have exactly one input", libs.ErrInvalidTransaction)
+	}
+	expected, err := BuildDualSpliceOutTx(p)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(libs.UnsignedBytes(spliceTx), libs.UnsignedBytes(expected.Tx)) {
+		return nil, fmt.Errorf("%w: splice-out tx does not match the agreed parameters", libs.ErrTransitionMismatch)
+	}
+	spliceTx.Inputs[0].SetSourceTxOutput(expected.Tx.Inputs[0].SourceTxOutput())
+	return expected, nil
+}
+
+// ServerSignSpliceOut 服务器核对 splice-out 交易后为多签输入签名。
+func ServerSignSpliceOut(spliceTx *tx.Transaction, p SpliceOutParams, serverPrivateKey *ec.PrivateKey) (*[]byte, error) {
+	if serverPrivateKey == nil || !serverPrivateKey.PubKey().IsEqual(p.ServerPublicKey) {
+		return nil, invalidParams("server private key does not match server public key")
+	}
+	if _, err := VerifyDualSpliceOutTx(spliceTx, p); err != nil {
+		return nil, err
+	}
+	serverSignBytes, err := signPoolInput(spliceTx, p.ServerPublicKey, p.ClientPublicKey, serverPrivateKey, libs.PartyServer)
+	if err != nil {
+		return nil, err
+	}
+	libs.Logger().Debug("dual_endpoint: server signed splice-out", "prev_pool_txid", p.poolTxID())
+	return serverSignBytes, nil
+}
+
+// ClientSignSpliceOut 客户端按自己保存的最近状态核对提现金额与服务器签名后完成签名，返回完整交易。
+func ClientSignSpliceOut(spliceTx *tx.Transaction, p SpliceOutParams, clientPrivateKey *ec.PrivateKey, serverSignBytes *[]byte) (*tx.Transaction, error) {
+	if clientPrivateKey == nil || !clientPrivateKey.PubKey().IsEqual(p.ClientPublicKey) {
+		return nil, invalidParams("client private key does not match client public key")
+	}
+	if _, err := VerifyDualSpliceOutTx(spliceTx, p); err != nil {
+		return nil, err
+	}
+	if _, err := completePoolInput(spliceTx, p.PoolAmount, p.ServerPublicKey, clientPrivateKey, serverSignBytes); err != nil {
+		return nil, err
+	}
+	libs.Logger().Debug("dual_endpoint: client signed splice-out", "txid", spliceTx.TxID().String())
+	return spliceTx, nil
+}
+
+// BuildSpliceOutRefundTX 客户端在 splice-out 交易完整签名后，在新 outpoint 上构建退款 B-Tx（序列号从 1 开始），
+// 服务器金额为提现后的剩余金额。
+func BuildSpliceOutRefundTX(spliceTx *tx.Transaction, p SpliceOutParams, endHeight uint32, clientPrivateKey *ec.PrivateKey) (*SpendResult, error) {
+	if err := requireFullySigned(spliceTx); err != nil {
+		return nil, err
+	}
+	if clientPrivateKey == nil || !clientPrivateKey.PubKey().IsEqual(p.ClientPublicKey) {
+		return nil, invalidParams("client private key does not match client public key")
+	}
+	expected, err := VerifyDualSpliceOutTx(spliceTx, p)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDualFeePoolSpendTXV2(SpendParams{
+		BaseTx:             spliceTx,
+		ServerAmount:       expected.ServerBalance,
+		EndHeight:          endHeight,
+		ClientPrivateKey:   clientPrivateKey,
+		ServerPublicKey:    p.ServerPublicKey,
+		Network:            p.Network,
+		FeeRate:            p.FeeRate,
+		ServerPayoutScript: p.ServerPayoutScript,
+		ClientPayoutScript: p.ClientPayoutScript,
+	})
+}
+
+// ServerVerifySpliceOutRefund 服务器回签退款 B-Tx 前核对 splice-out 交易与退款交易，退款 locktime 必须等于 endHeight。
+func ServerVerifySpliceOutRefund(refundTx *tx.Transaction, spliceTx *tx.Transaction, p SpliceOutParams, endHeight uint32, clientSignBytes *[]byte) error {
+	expected, err := VerifyDualSpliceOutTx(spliceTx, p)
+	if err != nil {
+		return err
+	}
+	if err := requireFullySigned(spliceTx); err != nil {
+		return err
+	}
+	if refundTx != nil && len(refundTx.Inputs) == 1 && refundTx.Inputs[0].SequenceNumber != 1 {
+		return fmt.Errorf("%w: refund sequence must restart at 1, got %d", libs.ErrTransitionMismatch, refundTx.Inputs[0].SequenceNumber)
+	}
+	if err := libs.CheckRefundTimelock(refundTx, endHeight); err != nil {
+		return err
+	}
+	return verifyRefundTx(refundTx, spliceTx, expected.ServerBalance, p.ServerPublicKey, p.ClientPublicKey, p.ServerPayoutScript, p.ClientPayoutScript, clientSignBytes)
+}
@@ -0,0 +1,195 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// splice-in：新多签输出变大，已付款金额沿用，新退款交易序列号从 1 开始。
+func TestDualSpliceIn(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	p := SpliceInParams{
+		PoolTxID:        "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		PoolAmount:      50000,
+		ServerBalance:   42000,
+		ClientUTXOs:     []libs.UTXO{{TxID: "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", Vout: 2, Value: 40000}},
+		AddAmount:       30000,
+		ClientPublicKey: clientPriv.PubKey(),
+		ServerPublicKey: serverPriv.PubKey(),
+		FeeRate:         5,
+	}
+	res, err := BuildDualSpliceInTx(p)
+	if err != nil {
+		t.Fatalf("build splice: %v", err)
+	}
+	if res.Amount != 80000 || res.Change != 10000-res.Fee {
+		t.Fatalf("unexpected splice amounts %d/%d fee %d", res.Amount, res.Change, res.Fee)
+	}
+
+	wire, _ := tx.NewTransactionFromHex(res.Tx.Hex())
+	serverSig, err := ServerSignSpliceIn(wire, p, serverPriv)
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	wire, _ = tx.NewTransactionFromHex(res.Tx.Hex())
+	spliceTx, err := ClientSignSpliceIn(wire, p, clientPriv, serverSig)
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+
+	// 所有输入的解锁脚本都能通过脚本解释器
+	for i, input := range spliceTx.Inputs {
+		err := interpreter.NewEngine().Execute(
+			interpreter.WithTx(spliceTx, i, input.SourceTxOutput()),
+			interpreter.WithForkID(),
+			interpreter.WithAfterGenesis(),
+		)
+		if err != nil {
+			t.Fatalf("input %d failed script check: %v", i, err)
+		}
+	}
+
+	refund, err := BuildSpliceInRefundTX(spliceTx, p, 900000, clientPriv)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if refund.Tx.Inputs[0].SequenceNumber != 1 || refund.Tx.Outputs[0].Satoshis != 42000 {
+		t.Fatalf("refund must restart sequence and carry server balance")
+	}
+	received, _ := tx.NewTransactionFromHex(spliceTx.Hex())
+	if err := ServerVerifySpliceInRefund(refund.Tx, received, p, 900000, refund.ClientSignBytes); err != nil {
+		t.Fatalf("server verify refund: %v", err)
+	}
+
+	// 客户端不能在 splice 时压低已付款金额
+	cheat := p
+	cheat.ServerBalance = 1000
+	cheatRefund, err := BuildSpliceInRefundTX(spliceTx, cheat, 900000, clientPriv)
+	if err != nil {
+		t.Fatalf("cheat refund: %v", err)
+	}
+	if err := ServerVerifySpliceInRefund(cheatRefund.Tx, received, p, 900000, cheatRefund.ClientSignBytes); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch, got %v", err)
+	}
+
+	// 开池时声明的服务器脚本沿用到新 outpoint 上的退款，客户端不能改回 P2PKH
+	coldPriv, _ := ec.PrivateKeyFromHex("1c4f0a2a6b5d3e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f7")
+	coldScripts, _ := PayoutScripts(coldPriv.PubKey(), clientPriv.PubKey())
+	cold := p
+	cold.ServerPayoutScript = coldScripts[0]
+	coldRefund, err := BuildSpliceInRefundTX(spliceTx, cold, 900000, clientPriv)
+	if err != nil {
+		t.Fatalf("cold refund: %v", err)
+	}
+	if !coldRefund.Tx.Outputs[0].LockingScript.Equals(coldScripts[0]) {
+		t.Fatalf("refund must pay the server to its declared script")
+	}
+	if err := ServerVerifySpliceInRefund(coldRefund.Tx, received, cold, 900000, coldRefund.ClientSignBytes); err != nil {
+		t.Fatalf("server verify cold refund: %v", err)
+	}
+	if err := ServerVerifySpliceInRefund(refund.Tx, received, cold, 900000, refund.ClientSignBytes); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for a refund ignoring the declared script, got %v", err)
+	}
+}
+
+// splice-out：只能提取已赚取金额，新池与新退款交易中服务器余额相应减少。
+func TestDualSpliceOut(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	latest, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		PrevTxID:         "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		TotalAmount:      100000,
+		ServerAmount:     30000,
+		EndHeight:        900000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	latestServerSig, err := SpendTXServerSign(latest.Tx, 100000, serverPriv, clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("server sign latest: %v", err)
+	}
+	signedLatest, err := MergeDualPoolSigForSpendTx(latest.Tx.Hex(), latestServerSig, latest.ClientSignBytes)
+	if err != nil {
+		t.Fatalf("merge latest: %v", err)
+	}
+	p := SpliceOutParams{
+		Latest:          signedLatest,
+		PoolAmount:      100000,
+		Withdraw:        20000,
+		ClientPublicKey: clientPriv.PubKey(),
+		ServerPublicKey: serverPriv.PubKey(),
+		FeeRate:         5,
+	}
+	res, err := BuildDualSpliceOutTx(p)
+	if err != nil {
+		t.Fatalf("build splice-out: %v", err)
+	}
+	if res.Amount != 80000-res.Fee || res.Withdrawn != 20000 || res.ServerBalance != 10000-res.Fee {
+		t.Fatalf("unexpected splice-out amounts %d/%d/%d fee %d", res.Amount, res.Withdrawn, res.ServerBalance, res.Fee)
+	}
+
+	wire, _ := tx.NewTransactionFromHex(res.Tx.Hex())
+	serverSig, err := ServerSignSpliceOut(wire, p, serverPriv)
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	wire, _ = tx.NewTransactionFromHex(res.Tx.Hex())
+	spliceTx, err := ClientSignSpliceOut(wire, p, clientPriv, serverSig)
+	if err != nil {
+		t.Fatalf("client sign: %v", err)
+	}
+	err = interpreter.NewEngine().Execute(
+		interpreter.WithTx(spliceTx, 0, spliceTx.Inputs[0].SourceTxOutput()),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("splice-out failed script check: %v", err)
+	}
+
+	refund, err := BuildSpliceOutRefundTX(spliceTx, p, 900000, clientPriv)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if refund.Tx.Inputs[0].SequenceNumber != 1 || refund.Tx.Outputs[0].Satoshis != res.ServerBalance {
+		t.Fatalf("refund must restart sequence and carry the remaining server balance")
+	}
+	received, _ := tx.NewTransactionFromHex(spliceTx.Hex())
+	if err := ServerVerifySpliceOutRefund(refund.Tx, received, p, 900000, refund.ClientSignBytes); err != nil {
+		t.Fatalf("server verify refund: %v", err)
+	}
+
+	// 已赚取金额必须来自双方签过的状态：未签名或被改过金额的 Latest 都会被拒绝
+	unsigned := p
+	unsigned.Latest = latest.Tx
+	if _, err := BuildDualSpliceOutTx(unsigned); !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for an unsigned latest, got %v", err)
+	}
+	forged := p
+	forged.Latest = signedLatest.ShallowClone()
+	forged.Latest.Outputs[0].Satoshis, forged.Latest.Outputs[1].Satoshis = 60000, signedLatest.Outputs[1].Satoshis-30000
+	if _, err := BuildDualSpliceOutTx(forged); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for a forged latest, got %v", err)
+	}
+
+	// 提取超过已赚取金额（含手续费）会被拒绝
+	over := p
+	over.Withdraw = 30000
+	if _, err := BuildDualSpliceOutTx(over); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+	over.Withdraw = 30001
+	if _, err := BuildDualSpliceOutTx(over); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package chain_utils
+
+import (
+	"bytes"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 跨池原子互换：两个双端池各做一次更新，要么都完成，要么都不生效。秘密 y 由腿 1 的收款方 H 选定，Y = y·G 告诉各方：
+//   - 腿 1：池 1 的付款方 P1 付给 H；
+//   - 腿 2：池 2 的付款方 P2 付给收款方 C2。
+//
+// P1 与 C2 是同一方时就是两方互换；也可以是按合作协议互相结算的两台服务器，
+// 例如 S1 在池 1 中付给 Alice、Bob 在池 2 中付给 S2，四方各用自己的密钥。流程：
+//  1. P2 用 SwapPreSign 以 Y 预签名腿 2，C2 用 VerifySwapPreSignature 核对，
+//     并用 ValidateSwapLocktimes 确认腿 2 的 locktime 比腿 1 晚足够多。
+//  2. P1 以 Y 预签名腿 1，发给 H。
+//  3. H 核对后用 CompleteSwapLeg 把 P1 的预签名适配成签名，得到完整的腿 1，交给 P1 作为池 1 的最新状态。
+//  4. 拿到腿 1 预签名与完整腿 1 的任何一方（C2 不必是池 1 的参与方）都能用 ExtractSwapSecret 算出 y，
+//     C2 再用 CompleteSwapLeg 完成腿 2。
+//
+// H 不完成腿 1 时两次更新都不生效；H 只在链上广播腿 1 时，C2 从链上交易提取 y，
+// 因此腿 2 的 locktime 必须比腿 1 至少晚 minDelta 个区块。更新沿用池的到期高度，两个池的到期高度必须相差足够多。
+// P1 与 C2 不是同一方时，P1 付款后依赖 C2 完成腿 2 并按协议结算，这部分信任不由本协议保证。
+
+// SwapLeg 描述原子互换中的一条腿：某个双端池里待签名的一次更新。
+type SwapLeg struct {
+	Next            *tx.Transaction // LoadTxV2 等构建的更新，尚未签名
+	TotalAmount     uint64          // 多签输出金额
+	ServerPublicKey *ec.PublicKey
+	ClientPublicKey *ec.PublicKey
+}
+
+// SwapPreSign 以适配点 adaptor 对互换腿的多签输入做预签名，priv 必须是该池服务器或客户端的私钥。
+func SwapPreSign(leg SwapLeg, priv *ec.PrivateKey, adaptor *ec.PublicKey) (*libs.AdaptorSignature, error) {
+	if priv == nil {
+		return nil, invalidParams("signer private key is required")
+	}
+	if _, err := leg.party(priv.PubKey()); err != nil {
+		return nil, err
+	}
+	digest, err := leg.sighash()
+	if err != nil {
+		return nil, err
+	}
+	pre, err := libs.AdaptorPreSign(priv, digest, adaptor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: swap pre-signature: %w", libs.ErrSigningFailed, err)
+	}
+	libs.Logger().Debug("dual_endpoint: swap leg pre-signed", "txid", leg.Next.TxID().String(), "sequence", leg.Next.Inputs[0].SequenceNumber)
+	return pre, nil
+}
+
+// VerifySwapPreSignature 核对对方 signer 对互换腿的预签名。
+func VerifySwapPreSignature(leg SwapLeg, pre *libs.AdaptorSignature, signer, adaptor *ec.PublicKey) error {
+	party, err := leg.party(signer)
+	if err != nil {
+		return err
+	}
+	digest, err := leg.sighash()
+	if err != nil {
+		return err
+	}
+	if err := libs.VerifyAdaptorSignature(pre, signer, digest, adaptor); err != nil {
+		return &libs.SignatureError{Party: party, InputIndex: 0, Err: err}
+	}
+	return nil
+}
+
+// CompleteSwapLeg 由知道秘密的一方调用：把对方的预签名适配成签名，与自己（priv）的签名合并成完整的 B-Tx。
+func CompleteSwapLeg(leg SwapLeg, pre *libs.AdaptorSignature, secret, priv *ec.PrivateKey) (*tx.Transaction, error) {
+	if priv == nil {
+		return nil, invalidParams("signer private key is required")
+	}
+	party, err := leg.party(priv.PubKey())
+	if err != nil {
+		return nil, err
+	}
+	if err := leg.prepare(); err != nil {
+		return nil, err
+	}
+	adapted, err := libs.AdaptSignature(pre, secret)
+	if err != nil {
+		return nil, err
+	}
+	counterSig := append(adapted.Serialize(), byte(sighash.ForkID|sighash.All))
+	redeem := leg.Next.Inputs[0].SourceTxOutput().LockingScript
+
+	var serverSig, clientSig *[]byte
+	if party == libs.PartyServer {
+		if _, err := verifySignatureWithContext(leg.Next, 0, redeem, leg.TotalAmount, libs.PartyClient, leg.ClientPublicKey, &counterSig); err != nil {
+			return nil, err
+		}
+		if serverSig, err = ServerDualFeePoolSpendTXUpdateSign(leg.Next, priv, leg.ClientPublicKey); err != nil {
+			return nil, err
+		}
+		clientSig = &counterSig
+	} else {
+		if _, err := verifySignatureWithContext(leg.Next, 0, redeem, leg.TotalAmount, libs.PartyServer, leg.ServerPublicKey, &counterSig); err != nil {
+			return nil, err
+		}
+		if clientSig, err = ClientDualFeePoolSpendTXUpdateSign(leg.Next, priv, leg.ServerPublicKey); err != nil {
+			return nil, err
+		}
+		serverSig = &counterSig
+	}
+	completed, err := MergeDualPoolSigForSpendTx(leg.Next.Hex(), serverSig, clientSig)
+	if err != nil {
+		return nil, err
+	}
+	completed.Inputs[0].SetSourceTxOutput(leg.Next.Inputs[0].SourceTxOutput())
+	libs.Logger().Debug("dual_endpoint: swap leg completed", "txid", completed.TxID().String(), "party", party)
+	return completed, nil
+}
+
+// ExtractSwapSecret 从完整的 B-Tx 中取出预签名方 signer 那份被适配的签名，算出秘密。
+// 调用者不必是该池的参与方，只需拿到预签名与完整交易；completed 必须与 leg.Next 是同一笔交易。
+func ExtractSwapSecret(leg SwapLeg, pre *libs.AdaptorSignature, completed *tx.Transaction, signer, adaptor *ec.PublicKey) (*ec.PrivateKey, error) {
+	party, err := leg.party(signer)
+	if err != nil {
+		return nil, err
+	}
+	if completed == nil || len(completed.Inputs) == 0 || completed.Inputs[0].UnlockingScript == nil {
+		return nil, fmt.Errorf("%w: completed swap leg has no unlocking script", libs.ErrInvalidTransaction)
+	}
+	if !bytes.Equal(libs.UnsignedBytes(completed), libs.UnsignedBytes(leg.Next)) {
+		return nil, fmt.Errorf("%w: completed swap leg differs from the agreed update", libs.ErrTransitionMismatch)
+	}
+	chunks, err := completed.Inputs[0].UnlockingScript.Chunks()
+	if err != nil || len(chunks) != 3 {
+		return nil, fmt.Errorf("%w: completed swap leg is not a 2-of-2 multisig spend", libs.ErrInvalidTransaction)
+	}
+	sigBytes := chunks[1].Data
+	if party == libs.PartyClient {
+		sigBytes = chunks[2].Data
+	}
+	if len(sigBytes) < 2 {
+		return nil, &libs.SignatureError{Party: party, InputIndex: 0, Err: libs.ErrInvalidSignatureFormat}
+	}
+	sig, err := ec.ParseDERSignature(sigBytes[:len(sigBytes)-1])
+	if err != nil {
+		return nil, &libs.SignatureError{Party: party, InputIndex: 0, Err: fmt.Errorf("%w: %w", libs.ErrInvalidSignatureFormat, err)}
+	}
+	secret, err := libs.ExtractAdaptorSecret(pre, sig, adaptor)
+	if err != nil {
+		return nil, err
+	}
+	libs.Logger().Debug("dual_endpoint: swap secret extracted", "txid", completed.TxID().String(), "party", party)
+	return secret, nil
+}
+
+// ValidateSwapLocktimes 检查先完成的腿 first 与后完成的腿 second 的 locktime：
+// second 至少比 first 晚 minDelta 个区块，给后完成的一方留出从链上提取秘密的时间。
+// 更新不能改变 locktime，两条腿的 locktime 就是两个池的到期高度；到期相同的池需先换池再互换。
+func ValidateSwapLocktimes(first, second *tx.Transaction, minDelta uint32) error {
+	if first == nil || second == nil {
+		return invalidParams("both swap legs are required")
+	}
+	for _, leg := range []*tx.Transaction{first, second} {
+		if err := libs.CheckBlockHeightLocktime(leg.LockTime); err != nil {
+			return err
+		}
+	}
+	if need := uint64(first.LockTime) + uint64(minDelta); uint64(second.LockTime) < need {
+		return &libs.LocktimeError{Locktime: second.LockTime, Min: uint32(min(need, uint64(^uint32(0)))), Max: libs.MaxBlockHeightLocktime - 1}
+	}
+	return nil
+}
+
+// party 返回 pub 在该池中的角色。
+func (l *SwapLeg) party(pub *ec.PublicKey) (libs.Party, error) {
+	if l.Next == nil || len(l.Next.Inputs) == 0 || l.ServerPublicKey == nil || l.ClientPublicKey == nil || l.TotalAmount == 0 {
+		return "", invalidParams("swap leg needs the update, pool amount and both public keys")
+	}
+	switch {
+	case pub == nil:
+		return "", invalidParams("signer public key is required")
+	case pub.IsEqual(l.ServerPublicKey):
+		return libs.PartyServer, nil
+	case pub.IsEqual(l.ClientPublicKey):
+		return libs.PartyClient, nil
+	default:
+		return "", invalidParams("signer is neither the server nor the client of the pool")
+	}
+}
+
+// prepare 设置多签输入的来源输出，以便计算签名摘要。
+func (l *SwapLeg) prepare() error {
+	redeem, err := libs.Lock([]*ec.PublicKey{l.ServerPublicKey, l.ClientPublicKey}, 2)
+	if err != nil {
+		return fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	l.Next.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: l.TotalAmount, LockingScript: redeem})
+	return nil
+}
+
+func (l *SwapLeg) sighash() ([]byte, error) {
+	if err := l.prepare(); err != nil {
+		return nil, err
+	}
+	digest, err := l.Next.CalcInputSignatureHash(0, sighash.Flag(sighash.ForkID|sighash.All))
+	if err != nil {
+		return nil, fmt.Errorf("%w: calc sighash: %w", libs.ErrInvalidTransaction, err)
+	}
+	return digest, nil
+}
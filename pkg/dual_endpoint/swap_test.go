@@ -0,0 +1,205 @@
+package chain_utils
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 跨池原子互换：池 1 中服务器 Bob 付给客户端 Alice，池 2 中服务器 Alice 付给客户端 Bob；
+// Alice 完成池 1 的更新后，Bob 从签名中提取秘密完成池 2 的更新。
+func TestDualAdaptorSwap(t *testing.T) {
+	alice1, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	bob1, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	alice2, _ := ec.PrivateKeyFromHex("4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d")
+	bob2, _ := ec.PrivateKeyFromHex("6c7c2b1a4bd1e3f0b7d0c29e9fa3b6e4b5a8c0f1d2e3f4a5b6c7d8e9f0a1b2c3")
+	prev1, leg1 := openSwapPool(t, bob1, alice1, "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", 800000, 40000)
+	prev2, leg2 := openSwapPool(t, alice2, bob2, "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", 800144, 40000)
+	if dir, amount, err := ClassifyUpdate(prev1, leg1.Next); err != nil || dir != DirectionToClient || amount != 10000 {
+		t.Fatalf("leg 1 must pay alice: %v %d %v", dir, amount, err)
+	}
+	if dir, amount, err := ClassifyUpdate(prev2, leg2.Next); err != nil || dir != DirectionToClient || amount != 10000 {
+		t.Fatalf("leg 2 must pay bob: %v %d %v", dir, amount, err)
+	}
+
+	secret, _ := ec.NewPrivateKey()
+	adaptor := secret.PubKey()
+
+	// 1. Alice 预签名腿 2
+	pre2, err := SwapPreSign(leg2, alice2, adaptor)
+	if err != nil {
+		t.Fatalf("pre-sign leg 2: %v", err)
+	}
+	// 2. Bob 核对后预签名腿 1
+	if err := VerifySwapPreSignature(leg2, pre2, alice2.PubKey(), adaptor); err != nil {
+		t.Fatalf("verify leg 2: %v", err)
+	}
+	other, _ := ec.NewPrivateKey()
+	if err := VerifySwapPreSignature(leg2, pre2, alice2.PubKey(), other.PubKey()); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for a different adaptor point, got %v", err)
+	}
+	if err := ValidateSwapLocktimes(leg1.Next, leg2.Next, 144); err != nil {
+		t.Fatalf("locktimes: %v", err)
+	}
+	if err := ValidateSwapLocktimes(leg1.Next, leg2.Next, 145); !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange, got %v", err)
+	}
+	pre1, err := SwapPreSign(leg1, bob1, adaptor)
+	if err != nil {
+		t.Fatalf("pre-sign leg 1: %v", err)
+	}
+
+	// 预签名本身不能当作签名使用，没有秘密也无法完成
+	if _, err := CompleteSwapLeg(leg2, pre2, other, bob2); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature without the secret, got %v", err)
+	}
+
+	// 3. Alice 用秘密完成腿 1
+	if err := VerifySwapPreSignature(leg1, pre1, bob1.PubKey(), adaptor); err != nil {
+		t.Fatalf("verify leg 1: %v", err)
+	}
+	completed1, err := CompleteSwapLeg(leg1, pre1, secret, alice1)
+	if err != nil {
+		t.Fatalf("complete leg 1: %v", err)
+	}
+	assertDualInputValid(t, completed1, 0, completed1.Inputs[0].SourceTxOutput())
+
+	// 4. Bob 从腿 1 中提取秘密并完成腿 2
+	wire1, _ := tx.NewTransactionFromHex(completed1.Hex())
+	extracted, err := ExtractSwapSecret(leg1, pre1, wire1, bob1.PubKey(), adaptor)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if !extracted.PubKey().IsEqual(adaptor) {
+		t.Fatalf("extracted secret does not match the adaptor point")
+	}
+	if _, err := ExtractSwapSecret(leg1, pre1, prev1, bob1.PubKey(), adaptor); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for another state, got %v", err)
+	}
+	completed2, err := CompleteSwapLeg(leg2, pre2, extracted, bob2)
+	if err != nil {
+		t.Fatalf("complete leg 2: %v", err)
+	}
+	assertDualInputValid(t, completed2, 0, completed2.Inputs[0].SourceTxOutput())
+	if completed2.Outputs[1].Satoshis != prev2.Outputs[1].Satoshis+10000 {
+		t.Fatalf("bob must receive the swapped amount in pool 2")
+	}
+
+	// 适配后的签名就是普通 ECDSA 签名，可以用库的验证函数核对
+	chunks, _ := completed1.Inputs[0].UnlockingScript.Chunks()
+	serverSig := chunks[1].Data
+	if ok, err := ClientVerifyServerUpdateSig(leg1.Next, bob1.PubKey(), alice1.PubKey(), &serverSig); err != nil || !ok {
+		t.Fatalf("adapted signature must verify as a regular server signature: %v", err)
+	}
+}
+
+// 合作方互换：四个不同的密钥。池 1 中服务器 S1 付给客户端 Alice，池 2 中客户端 Bob 付给服务器 S2；
+// S1 与 S2 另行结算。Alice 持有秘密，Bob 只在 Alice 收款后才付款，S2 从 S1 转来的腿 1 中提取秘密。
+func TestDualAdaptorSwapAcrossServers(t *testing.T) {
+	s1, _ := ec.PrivateKeyFromHex("1f2e3d4c5b6a79881726354453627180f1e2d3c4b5a69788a9b8c7d6e5f40312")
+	alice, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	s2, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+	bob, _ := ec.PrivateKeyFromHex("6c7c2b1a4bd1e3f0b7d0c29e9fa3b6e4b5a8c0f1d2e3f4a5b6c7d8e9f0a1b2c3")
+
+	_, leg1 := openSwapPool(t, s1, alice, "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", 800000, 40000)
+	prev2, leg2 := openSwapPool(t, s2, bob, "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", 800144, 60000)
+	if dir, amount, err := ClassifyUpdate(prev2, leg2.Next); err != nil || dir != DirectionToServer || amount != 10000 {
+		t.Fatalf("leg 2 must pay s2: %v %d %v", dir, amount, err)
+	}
+	// 更新沿用池的到期高度，到期相同的池之间不能互换
+	_, sameHeight := openSwapPool(t, s2, bob, "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", 800000, 60000)
+	if err := ValidateSwapLocktimes(leg1.Next, sameHeight.Next, 144); !errors.Is(err, libs.ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange for pools with the same end height, got %v", err)
+	}
+
+	secret, _ := ec.NewPrivateKey()
+	adaptor := secret.PubKey()
+
+	// 1. Bob 预签名腿 2，S2 核对
+	pre2, err := SwapPreSign(leg2, bob, adaptor)
+	if err != nil {
+		t.Fatalf("pre-sign leg 2: %v", err)
+	}
+	if err := VerifySwapPreSignature(leg2, pre2, bob.PubKey(), adaptor); err != nil {
+		t.Fatalf("verify leg 2: %v", err)
+	}
+	if err := ValidateSwapLocktimes(leg1.Next, leg2.Next, 144); err != nil {
+		t.Fatalf("locktimes: %v", err)
+	}
+	// 不是池 2 参与方的密钥不能预签名
+	if _, err := SwapPreSign(leg2, alice, adaptor); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a key outside pool 2, got %v", err)
+	}
+
+	// 2. S1 预签名腿 1，Alice 核对后完成
+	pre1, err := SwapPreSign(leg1, s1, adaptor)
+	if err != nil {
+		t.Fatalf("pre-sign leg 1: %v", err)
+	}
+	if err := VerifySwapPreSignature(leg1, pre1, s1.PubKey(), adaptor); err != nil {
+		t.Fatalf("verify leg 1: %v", err)
+	}
+	completed1, err := CompleteSwapLeg(leg1, pre1, secret, alice)
+	if err != nil {
+		t.Fatalf("complete leg 1: %v", err)
+	}
+	assertDualInputValid(t, completed1, 0, completed1.Inputs[0].SourceTxOutput())
+
+	// 3. S2 不是池 1 的参与方，用 S1 转来的预签名与完整腿 1 提取秘密，完成腿 2
+	wire1, _ := tx.NewTransactionFromHex(completed1.Hex())
+	extracted, err := ExtractSwapSecret(leg1, pre1, wire1, s1.PubKey(), adaptor)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	completed2, err := CompleteSwapLeg(leg2, pre2, extracted, s2)
+	if err != nil {
+		t.Fatalf("complete leg 2: %v", err)
+	}
+	assertDualInputValid(t, completed2, 0, completed2.Inputs[0].SourceTxOutput())
+	if completed2.Outputs[0].Satoshis != prev2.Outputs[0].Satoshis+10000 {
+		t.Fatalf("s2 must receive the swapped amount in pool 2")
+	}
+}
+
+// openSwapPool 开池并返回双方签名的初始状态与一次待签名的更新。
+func openSwapPool(t *testing.T, serverPriv, clientPriv *ec.PrivateKey, prevTxID string, endHeight uint32, serverAmount uint64) (*tx.Transaction, SwapLeg) {
+	t.Helper()
+	const total = uint64(100000)
+	res, err := BuildDualFeePoolSpendTXV2(SpendParams{
+		PrevTxID:         prevTxID,
+		TotalAmount:      total,
+		ServerAmount:     50000,
+		EndHeight:        endHeight,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		FeeRate:          50,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	serverSig, err := SpendTXServerSign(res.Tx, total, serverPriv, clientPriv.PubKey())
+	if err != nil {
+		t.Fatalf("server sign: %v", err)
+	}
+	prev, err := MergeDualPoolSigForSpendTx(res.Tx.Hex(), serverSig, res.ClientSignBytes)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	next, err := LoadTxV2(UpdateParams{
+		TxHex:           prev.Hex(),
+		Sequence:        2,
+		ServerAmount:    serverAmount,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     total,
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	wire, _ := tx.NewTransactionFromHex(next.Hex())
+	return prev, SwapLeg{Next: wire, TotalAmount: total, ServerPublicKey: serverPriv.PubKey(), ClientPublicKey: clientPriv.PubKey()}
+}
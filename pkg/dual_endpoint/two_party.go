@@ -0,0 +1,209 @@
+package chain_utils
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	script "github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 两方 ECDSA 模式：池输出锁定到 libs 两方密钥生成得到的联合公钥的 P2PKH，B-Tx 用单个签名花费，
+// 链上与普通 P2PKH 支付无法区分，解锁脚本也比 2-of-2 多签短。金额、序列号、locktime、支付脚本与
+// 承诺等规则不变，B-Tx 的构建与更新仍使用 BuildTwoPartySpendTx / LoadTxV2，只有签名换成两轮协议：
+//  1. 服务器的 TwoPartySigner 先给出 nonce（开池时随密钥生成一起发出，之后附在每次签名的回复里）。
+//  2. 客户端构建或更新 B-Tx，用 ClientTwoPartySign 算出部分签名，与交易一起作为 TwoPartyUpdateRequest 发出，
+//     取代多签模式下的客户端签名。
+//  3. 服务器照常核对更新后调用 TwoPartySigner.Sign，得到带完整解锁脚本的 B-Tx，与下一次的 nonce
+//     一起作为 TwoPartyUpdateResponse 返回；客户端用 VerifyTwoPartySpend 核对后保存。
+//
+// 服务器的 nonce 只保存在内存中，服务器重启后用 NewTwoPartySigner 重新给出 nonce 即可。
+
+// TwoPartyUpdateRequest 是两方 ECDSA 模式下客户端发出的签名请求。
+type TwoPartyUpdateRequest struct {
+	TxHex   string                         `json:"tx_hex"`
+	Partial *libs.TwoPartyPartialSignature `json:"partial"`
+}
+
+// TwoPartyUpdateResponse 是服务器的回复：签好的 B-Tx 与下一次签名使用的 nonce。
+type TwoPartyUpdateResponse struct {
+	TxHex string              `json:"tx_hex"`
+	Nonce *libs.TwoPartyNonce `json:"nonce"`
+}
+
+// TwoPartyPoolScript 返回联合公钥的 P2PKH 锁定脚本，即两方 ECDSA 模式下的池输出脚本（与网络无关）。
+func TwoPartyPoolScript(jointPublicKey *ec.PublicKey) (*script.Script, error) {
+	if jointPublicKey == nil {
+		return nil, invalidParams("joint public key is required")
+	}
+	address, err := libs.GetAddressFromPublicKey(jointPublicKey, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get joint address: %w", err)
+	}
+	return p2pkh.Lock(address)
+}
+
+// BuildTwoPartyBaseTx 构建两方 ECDSA 模式的 A-Tx：客户端 UTXO -> 联合公钥 P2PKH + 客户端找零。
+func BuildTwoPartyBaseTx(p PoolParams, jointPublicKey *ec.PublicKey) (*BuildStep1Response, error) {
+	poolScript, err := TwoPartyPoolScript(jointPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return buildDualFeePoolBaseTx(p, poolScript)
+}
+
+// BuildTwoPartySpendTx 构建两方 ECDSA 模式的初始 B-Tx，手续费按 P2PKH 解锁脚本估算。
+// 返回的交易尚未签名，SpendResult.ClientSignBytes 为空；客户端接着调用 ClientTwoPartySign。
+func BuildTwoPartySpendTx(p SpendParams, jointPublicKey *ec.PublicKey) (*SpendResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	poolScript, err := TwoPartyPoolScript(jointPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if p.BaseTx != nil && !bytes.Equal(p.BaseTx.Outputs[p.PoolVout].LockingScript.Bytes(), poolScript.Bytes()) {
+		return nil, invalidParams("base tx output %d is not locked to the joint public key", p.PoolVout)
+	}
+	spend, fee, amount, err := subBuildDualFeePoolSpendTX(&p, feeRateOrDefault(p.FeeRate), &poolSpend{lockingScript: poolScript, placeholder: libs.FakeP2PKHSign()})
+	if err != nil {
+		libs.Logger().Debug("dual_endpoint: build two-party spend tx failed", "error", err)
+		return nil, err
+	}
+	return &SpendResult{Tx: spend, Amount: amount, Fee: fee, ServerPayout: p.ServerPayout, ClientPayout: p.ClientPayout}, nil
+}
+
+// TwoPartySighash 设置第 inputIndex 个输入的来源输出为联合公钥 P2PKH，返回其 SIGHASH_ALL|FORKID 签名摘要。
+func TwoPartySighash(t *tx.Transaction, inputIndex uint32, totalAmount uint64, jointPublicKey *ec.PublicKey) ([]byte, error) {
+	if t == nil || int(inputIndex) >= len(t.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", libs.ErrInvalidTransaction, inputIndex)
+	}
+	poolScript, err := TwoPartyPoolScript(jointPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	t.Inputs[inputIndex].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: totalAmount, LockingScript: poolScript})
+	digest, err := t.CalcInputSignatureHash(inputIndex, sighash.Flag(sighash.ForkID|sighash.All))
+	if err != nil {
+		return nil, fmt.Errorf("%w: calc sighash: %w", libs.ErrInvalidTransaction, err)
+	}
+	return digest, nil
+}
+
+// ClientTwoPartySign 由客户端对 B-Tx 的 0 号输入计算部分签名，nonce 为服务器最近一次给出的 nonce。
+func ClientTwoPartySign(t *tx.Transaction, totalAmount uint64, share *libs.TwoPartyClientShare, nonce *libs.TwoPartyNonce) (*libs.TwoPartyPartialSignature, error) {
+	if err := share.Validate(); err != nil {
+		return nil, err
+	}
+	digest, err := TwoPartySighash(t, 0, totalAmount, share.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	partial, err := share.SignPartial(digest, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: client input 0: %w", libs.ErrSigningFailed, err)
+	}
+	libs.Logger().Debug("dual_endpoint: client two-party partial signature", "txid", t.TxID().String(), "sequence", t.Inputs[0].SequenceNumber)
+	return partial, nil
+}
+
+// TwoPartySigner 是服务器一侧的两方签名器，每次只有一个未使用的 nonce。
+type TwoPartySigner struct {
+	mu      sync.Mutex
+	share   *libs.TwoPartyServerShare
+	session *libs.TwoPartySigningSession
+	nonce   *libs.TwoPartyNonce
+}
+
+// NewTwoPartySigner 用服务器份额创建签名器，并返回发给客户端的第一个 nonce。
+func NewTwoPartySigner(share *libs.TwoPartyServerShare) (*TwoPartySigner, *libs.TwoPartyNonce, error) {
+	s := &TwoPartySigner{share: share}
+	if err := s.rotate(); err != nil {
+		return nil, nil, err
+	}
+	return s, s.nonce, nil
+}
+
+// Nonce 返回当前未使用的 nonce。
+func (s *TwoPartySigner) Nonce() *libs.TwoPartyNonce {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nonce
+}
+
+// Sign 用客户端的部分签名完成 B-Tx 0 号输入的签名并写入解锁脚本 <签名> <联合公钥>。
+// 调用方应先像多签模式一样核对 t 的状态转换。无论成功与否当前 nonce 都会作废，
+// 返回值中的 nonce 是下一次签名使用的新 nonce。
+func (s *TwoPartySigner) Sign(t *tx.Transaction, totalAmount uint64, partial *libs.TwoPartyPartialSignature) (*tx.Transaction, *libs.TwoPartyNonce, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := s.session
+	if err := s.rotate(); err != nil {
+		return nil, nil, err
+	}
+	digest, err := TwoPartySighash(t, 0, totalAmount, s.share.PublicKey)
+	if err != nil {
+		return nil, s.nonce, err
+	}
+	sig, err := session.Complete(digest, partial)
+	if err != nil {
+		return nil, s.nonce, &libs.SignatureError{Party: libs.PartyClient, InputIndex: 0, Err: err}
+	}
+	unlocking, err := twoPartyUnlockingScript(sig, s.share.PublicKey)
+	if err != nil {
+		return nil, s.nonce, err
+	}
+	t.Inputs[0].UnlockingScript = unlocking
+	libs.Logger().Debug("dual_endpoint: two-party spend signed", "txid", t.TxID().String(), "sequence", t.Inputs[0].SequenceNumber)
+	return t, s.nonce, nil
+}
+
+func (s *TwoPartySigner) rotate() error {
+	session, nonce, err := s.share.NewSigningSession()
+	if err != nil {
+		return err
+	}
+	s.session, s.nonce = session, nonce
+	return nil
+}
+
+// VerifyTwoPartySpend 核对服务器返回的 B-Tx：0 号输入的解锁脚本必须是联合公钥对该交易的有效签名。
+func VerifyTwoPartySpend(t *tx.Transaction, totalAmount uint64, jointPublicKey *ec.PublicKey) error {
+	if t == nil || len(t.Inputs) == 0 || t.Inputs[0].UnlockingScript == nil {
+		return fmt.Errorf("%w: spend tx has no unlocking script", libs.ErrInvalidTransaction)
+	}
+	chunks, err := t.Inputs[0].UnlockingScript.Chunks()
+	if err != nil || len(chunks) != 2 {
+		return &libs.SignatureError{Party: libs.PartyServer, InputIndex: 0, Err: libs.ErrInvalidSignatureFormat}
+	}
+	if !bytes.Equal(chunks[1].Data, jointPublicKey.Compressed()) {
+		return &libs.SignatureError{Party: libs.PartyServer, InputIndex: 0, Err: fmt.Errorf("unlocking script does not use the joint public key")}
+	}
+	poolScript, err := TwoPartyPoolScript(jointPublicKey)
+	if err != nil {
+		return err
+	}
+	sig := chunks[0].Data
+	if _, err := verifySignatureWithContext(t, 0, poolScript, totalAmount, libs.PartyServer, jointPublicKey, &sig); err != nil {
+		return err
+	}
+	t.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: totalAmount, LockingScript: poolScript})
+	return nil
+}
+
+func twoPartyUnlockingScript(sig *ec.Signature, jointPublicKey *ec.PublicKey) (*script.Script, error) {
+	s := script.NewFromBytes([]byte{})
+	if err := s.AppendPushData(append(sig.Serialize(), byte(sighash.ForkID|sighash.All))); err != nil {
+		return nil, err
+	}
+	if err := s.AppendPushData(jointPublicKey.Compressed()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,202 @@
+package chain_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 两方 ECDSA：密钥生成、P2PKH 池输出、初始 B-Tx 与更新的两轮签名，以及被篡改消息的拒绝。
+func TestDualTwoPartyECDSA(t *testing.T) {
+	clientPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	serverPriv, _ := ec.PrivateKeyFromHex("a2d2ca4c19e3c560792ca751842c29b9da94be09f712a7f9ba7c66e64a354829")
+
+	keyGen, err := libs.NewTwoPartyKeyGen()
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	// 消息经 JSON 传输
+	var offer libs.TwoPartyKeyGenOffer
+	roundTrip(t, keyGen.Offer(), &offer)
+
+	tampered := offer
+	tampered.EncryptedShare = new(big.Int).Add(offer.EncryptedShare, big.NewInt(1))
+	if _, _, err := libs.AcceptTwoPartyKeyGen(&tampered); !errors.Is(err, libs.ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a tampered encrypted share, got %v", err)
+	}
+	clientShare, reply, err := libs.AcceptTwoPartyKeyGen(&offer)
+	if err != nil {
+		t.Fatalf("accept keygen: %v", err)
+	}
+	var wireReply libs.TwoPartyKeyGenReply
+	roundTrip(t, reply, &wireReply)
+	serverShare, err := keyGen.Complete(&wireReply)
+	if err != nil {
+		t.Fatalf("complete keygen: %v", err)
+	}
+	if !serverShare.PublicKey.IsEqual(clientShare.PublicKey) {
+		t.Fatalf("both parties must derive the same joint public key")
+	}
+	joint := clientShare.PublicKey
+
+	// 份额可以持久化后恢复
+	var restoredServer libs.TwoPartyServerShare
+	roundTrip(t, serverShare, &restoredServer)
+	var restoredClient libs.TwoPartyClientShare
+	roundTrip(t, clientShare, &restoredClient)
+	signer, nonce, err := NewTwoPartySigner(&restoredServer)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+
+	base, err := BuildTwoPartyBaseTx(PoolParams{
+		ClientUTXOs:      []libs.UTXO{{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 1, Value: 100000}},
+		PoolAmount:       50000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		Network:          libs.Testnet,
+		FeeRate:          50,
+	}, joint)
+	if err != nil {
+		t.Fatalf("base tx: %v", err)
+	}
+	poolScript, _ := TwoPartyPoolScript(joint)
+	if !base.Tx.Outputs[0].LockingScript.IsP2PKH() || base.Tx.Outputs[0].LockingScript.String() != poolScript.String() {
+		t.Fatalf("pool output must be a plain P2PKH to the joint key")
+	}
+	multisigBase, _ := BuildDualFeePoolBaseTxV2(PoolParams{
+		ClientUTXOs:      []libs.UTXO{{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 1, Value: 100000}},
+		PoolAmount:       50000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		Network:          libs.Testnet,
+		FeeRate:          50,
+	})
+	if base.Tx.Size() >= multisigBase.Tx.Size() {
+		t.Fatalf("two-party base tx (%d bytes) must be smaller than multisig (%d bytes)", base.Tx.Size(), multisigBase.Tx.Size())
+	}
+
+	spend, err := BuildTwoPartySpendTx(SpendParams{
+		BaseTx:           base.Tx,
+		EndHeight:        800000,
+		ClientPrivateKey: clientPriv,
+		ServerPublicKey:  serverPriv.PubKey(),
+		Network:          libs.Testnet,
+		FeeRate:          50,
+	}, joint)
+	if err != nil {
+		t.Fatalf("spend tx: %v", err)
+	}
+
+	// 客户端部分签名随请求发出，服务器完成签名并给出下一个 nonce
+	sign := func(next *tx.Transaction, nonce *libs.TwoPartyNonce) (*tx.Transaction, *libs.TwoPartyNonce) {
+		t.Helper()
+		partial, err := ClientTwoPartySign(next, base.Amount, &restoredClient, nonce)
+		if err != nil {
+			t.Fatalf("client partial: %v", err)
+		}
+		var req TwoPartyUpdateRequest
+		roundTrip(t, TwoPartyUpdateRequest{TxHex: next.Hex(), Partial: partial}, &req)
+		received, _ := tx.NewTransactionFromHex(req.TxHex)
+		signed, nextNonce, err := signer.Sign(received, base.Amount, req.Partial)
+		if err != nil {
+			t.Fatalf("server sign: %v", err)
+		}
+		var resp TwoPartyUpdateResponse
+		roundTrip(t, TwoPartyUpdateResponse{TxHex: signed.Hex(), Nonce: nextNonce}, &resp)
+		final, _ := tx.NewTransactionFromHex(resp.TxHex)
+		if err := VerifyTwoPartySpend(final, base.Amount, joint); err != nil {
+			t.Fatalf("verify spend: %v", err)
+		}
+		assertDualInputValid(t, final, 0, base.Tx.Outputs[0])
+		return final, resp.Nonce
+	}
+	signed, nonce := sign(spend.Tx, nonce)
+	// 开池时服务器金额为 0，只有客户端输出
+	if len(signed.Outputs) != 1 || spend.Fee != base.Amount-signed.Outputs[0].Satoshis {
+		t.Fatalf("fee mismatch")
+	}
+
+	update := UpdateParams{
+		TxHex:           signed.Hex(),
+		Sequence:        2,
+		ServerAmount:    10000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     base.Amount,
+	}
+	next, err := LoadTxV2(update)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	// 服务器输出重新出现，输出数量变化，按支付脚本校验
+	if err := ValidatePayoutUpdate(signed, next, update); err != nil {
+		t.Fatalf("transition: %v", err)
+	}
+	updated, nonce := sign(next, nonce)
+	if updated.Outputs[0].Satoshis != 10000 {
+		t.Fatalf("unexpected server amount %d", updated.Outputs[0].Satoshis)
+	}
+
+	// 部分签名针对另一笔交易时服务器拒绝，且该 nonce 作废
+	other, _ := LoadTxV2(UpdateParams{
+		TxHex:           updated.Hex(),
+		Sequence:        3,
+		ServerAmount:    20000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     base.Amount,
+	})
+	partial, err := ClientTwoPartySign(other, base.Amount, &restoredClient, nonce)
+	if err != nil {
+		t.Fatalf("client partial: %v", err)
+	}
+	forged, _ := LoadTxV2(UpdateParams{
+		TxHex:           updated.Hex(),
+		Sequence:        3,
+		ServerAmount:    40000,
+		ServerPublicKey: serverPriv.PubKey(),
+		ClientPublicKey: clientPriv.PubKey(),
+		TotalAmount:     base.Amount,
+	})
+	if _, _, err := signer.Sign(forged, base.Amount, partial); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for a partial signature over another tx, got %v", err)
+	}
+	if _, _, err := signer.Sign(other, base.Amount, partial); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("a used nonce must not be accepted again, got %v", err)
+	}
+	if signer.Nonce().Point.IsEqual(nonce.Point) {
+		t.Fatalf("signer must rotate its nonce")
+	}
+
+	// 单个签名会话只能完成一次
+	session, sessionNonce, err := restoredServer.NewSigningSession()
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+	digest, _ := TwoPartySighash(other, 0, base.Amount, joint)
+	partial, _ = restoredClient.SignPartial(digest, sessionNonce)
+	if _, err := session.Complete(digest, partial); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, err := session.Complete(digest, partial); !errors.Is(err, libs.ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState for a reused session, got %v", err)
+	}
+}
+
+func roundTrip(t *testing.T, in, out any) {
+	t.Helper()
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package pkg
 
 // Re-export commonly used types and functions from subpackages
 import (
+	batch "github.com/spycat55/KeymasterMultisigPool/pkg/batch_endpoint"
 	dual "github.com/spycat55/KeymasterMultisigPool/pkg/dual_endpoint"
 	"github.com/spycat55/KeymasterMultisigPool/pkg/libs"
 	triple "github.com/spycat55/KeymasterMultisigPool/pkg/triple_endpoint"
@@ -11,41 +12,438 @@ import (
 // Version of the KeymasterMultisigPool library
 const Version = "1.5.0"
 
+// DefaultFeeRate is applied when a v2 request struct leaves FeeRate at zero
+const DefaultFeeRate = libs.DefaultFeeRate
+
+// DefaultMaxExtension caps a single expiry extension when ExpiryPolicy leaves MaxExtension at zero
+const DefaultMaxExtension = libs.DefaultMaxExtension
+
 // Re-export multisig types and functions
 type MultiSig = libs.MultiSig
 type UTXO = libs.UTXO
 
+// ExpiryPolicy caps how far a pool's end height may be extended
+type ExpiryPolicy = libs.ExpiryPolicy
+
+// RolloverPolicy configures when a pool should be rolled over into a successor
+type RolloverPolicy = libs.RolloverPolicy
+type RolloverReason = libs.RolloverReason
+
+const (
+	RolloverNotDue   = libs.RolloverNotDue
+	RolloverSequence = libs.RolloverSequence
+	RolloverExpiry   = libs.RolloverExpiry
+)
+
+// FeePolicy selects which party bears transaction fees
+type FeePolicy = libs.FeePolicy
+type DustError = libs.DustError
+
+const (
+	FeeClientPays   = libs.FeeClientPays
+	FeeServerPays   = libs.FeeServerPays
+	FeeProportional = libs.FeeProportional
+	FeeSplitEven    = libs.FeeSplitEven
+)
+
+// DustPolicy controls how sub-dust payouts are laid out in a B-Tx
+type DustPolicy = libs.DustPolicy
+type DustAction = libs.DustAction
+type Payout = libs.Payout
+
+// PayoutKeyChain derives a fresh payout key per pool and per rollover
+type PayoutPath = libs.PayoutPath
+type PayoutState = libs.PayoutState
+type PayoutKeyChain = libs.PayoutKeyChain
+type PayoutScanner = libs.PayoutScanner
+type PayoutMatch = libs.PayoutMatch
+
+var (
+	NewPayoutKeyChain        = libs.NewPayoutKeyChain
+	NewPayoutKeyChainFromKey = libs.NewPayoutKeyChainFromKey
+	NewPayoutScanner         = libs.NewPayoutScanner
+	ParsePayoutPath          = libs.ParsePayoutPath
+	ResolvePayoutScript      = libs.ResolvePayoutScript
+	CheckPayoutRotation      = libs.CheckPayoutRotation
+)
+
+// Commitment is a 32-byte OP_RETURN commitment carried by a B-Tx
+type Commitment = libs.Commitment
+
+var (
+	HashCommitment     = libs.HashCommitment
+	ParseCommitmentHex = libs.ParseCommitmentHex
+	CommitmentOf       = libs.CommitmentOf
+	SetCommitment      = libs.SetCommitment
+	PayoutOutputs      = libs.PayoutOutputs
+)
+
+const (
+	DustKeep     = libs.DustKeep
+	DustDrop     = libs.DustDrop
+	DustMerge    = libs.DustMerge
+	DustKeepZero = libs.DustKeepZero
+)
+
+// Network selects mainnet, testnet, regtest or STN address encoding
+type Network = libs.Network
+
+const (
+	Mainnet = libs.Mainnet
+	Testnet = libs.Testnet
+	Regtest = libs.Regtest
+	STN     = libs.STN
+)
+
+var (
+	ParseNetwork      = libs.ParseNetwork
+	NetworkFromIsMain = libs.NetworkFromIsMain
+)
+
+// Re-export v2 request structs
+type DualPoolParams = dual.PoolParams
+type DualSpendParams = dual.SpendParams
+type DualSpendResult = dual.SpendResult
+type DualUpdateParams = dual.UpdateParams
+type DualFundedParams = dual.DualFundedParams
+type DualFundedResponse = dual.DualFundedResponse
+type DualSpliceInParams = dual.SpliceInParams
+type DualSpliceOutParams = dual.SpliceOutParams
+type DualSpliceOutResponse = dual.SpliceOutResponse
+type DualExtendExpiryParams = dual.ExtendExpiryParams
+type DualExtendExpiryAcceptParams = dual.ExtendExpiryAcceptParams
+type DualRolloverParams = dual.RolloverParams
+type DualRolloverResponse = dual.RolloverResponse
+type Direction = dual.Direction
+type DirectionLimit = dual.DirectionLimit
+type BidirectionalPolicy = dual.BidirectionalPolicy
+type BidirectionalUpdateParams = dual.BidirectionalUpdateParams
+type BidirectionalAcceptParams = dual.BidirectionalAcceptParams
+type ConditionalParams = dual.ConditionalParams
+type ConditionalProposal = dual.ConditionalProposal
+type ConditionalResolveParams = dual.ConditionalResolveParams
+type ConditionalOutput = libs.ConditionalOutput
+type ConditionalTerms = libs.ConditionalTerms
+type Hub = dual.Hub
+type HubStore = dual.HubStore
+type MemoryHubStore = dual.MemoryHubStore
+type HubPolicy = dual.HubPolicy
+type HubTransfer = dual.HubTransfer
+type HubTransferState = dual.HubTransferState
+type HubLeg = dual.HubLeg
+type HubPool = dual.HubPool
+type HubLegKind = dual.HubLegKind
+type HubLegParams = dual.HubLegParams
+type HubLegSignatures = dual.HubLegSignatures
+type HubAction = dual.HubAction
+type HubRecovery = dual.HubRecovery
+
+const (
+	HubTransferPending      = dual.HubTransferPending
+	HubIncomingLocked       = dual.HubIncomingLocked
+	HubOutgoingLocked       = dual.HubOutgoingLocked
+	HubPreimageKnown        = dual.HubPreimageKnown
+	HubSettled              = dual.HubSettled
+	HubCancelled            = dual.HubCancelled
+	HubIncoming             = dual.HubIncoming
+	HubOutgoing             = dual.HubOutgoing
+	HubActionWait           = dual.HubActionWait
+	HubActionAbort          = dual.HubActionAbort
+	HubActionCancelIncoming = dual.HubActionCancelIncoming
+	HubActionSettleIncoming = dual.HubActionSettleIncoming
+	HubActionSettleOutgoing = dual.HubActionSettleOutgoing
+)
+
+type TwoPartyKeyGen = libs.TwoPartyKeyGen
+type TwoPartyKeyGenOffer = libs.TwoPartyKeyGenOffer
+type TwoPartyKeyGenReply = libs.TwoPartyKeyGenReply
+type TwoPartyServerShare = libs.TwoPartyServerShare
+type TwoPartyClientShare = libs.TwoPartyClientShare
+type TwoPartyNonce = libs.TwoPartyNonce
+type TwoPartyPartialSignature = libs.TwoPartyPartialSignature
+type TwoPartySigningSession = libs.TwoPartySigningSession
+type TwoPartySigner = dual.TwoPartySigner
+type TwoPartyUpdateRequest = dual.TwoPartyUpdateRequest
+type TwoPartyUpdateResponse = dual.TwoPartyUpdateResponse
+type AdaptorSignature = libs.AdaptorSignature
+type DLEQProof = libs.DLEQProof
+type SwapLeg = dual.SwapLeg
+type CovenantTerms = libs.CovenantTerms
+
+const (
+	DirectionNone     = dual.DirectionNone
+	DirectionToServer = dual.DirectionToServer
+	DirectionToClient = dual.DirectionToClient
+)
+
+type BatchParams = batch.BatchParams
+type BatchPoolSpec = batch.PoolSpec
+type BatchPoolResult = batch.PoolResult
+type BatchResponse = batch.BatchResponse
+type BatchPoolKind = batch.PoolKind
+type SettlementParams = batch.SettlementParams
+type SettlementPool = batch.SettlementPool
+type SettlementResult = batch.SettlementResult
+type SignatureCollector = batch.SignatureCollector
+
+const (
+	BatchPoolDual   = batch.PoolDual
+	BatchPoolTriple = batch.PoolTriple
+)
+
+type TriplePoolParams = triple.PoolParams
+type TripleSpendParams = triple.SpendParams
+type TripleSpendResult = triple.SpendResult
+type TripleUpdateParams = triple.UpdateParams
+type TripleContribution = triple.Contribution
+type TripleSpliceOutParams = triple.SpliceOutParams
+type TripleSpliceOutResponse = triple.SpliceOutResponse
+type TripleExtendExpiryParams = triple.ExtendExpiryParams
+type TripleExtendExpiryAcceptParams = triple.ExtendExpiryAcceptParams
+type TripleSignature = triple.TripleSignature
+type TripleDispute = triple.Dispute
+type TripleDisputeClaim = triple.DisputeClaim
+type TripleDisputeResolution = triple.DisputeResolution
+type TripleDisputeEvent = triple.DisputeEvent
+type TripleDisputeStatus = triple.DisputeStatus
+type TripleOpenDisputeParams = triple.OpenDisputeParams
+type TripleProposeResolutionParams = triple.ProposeResolutionParams
+
+const (
+	TripleDisputeOpened   = triple.DisputeOpened
+	TripleDisputeProposed = triple.DisputeProposed
+	TripleDisputeResolved = triple.DisputeResolved
+)
+
 var (
 	// Multisig script creation
 	Lock   = libs.Lock
 	Unlock = libs.Unlock
 
+	// Logging hook, silent by default
+	SetLogger = libs.SetLogger
+
 	// Utility functions
 	GetAddressFromPublicKey = libs.GetAddressFromPublicKey
 	GetAddressFromPubKey    = libs.GetAddressFromPubKey
+	SelectUTXOs             = libs.SelectUTXOs
+
+	// Dual endpoint v2 API
+	BuildDualFeePoolBaseTxV2  = dual.BuildDualFeePoolBaseTxV2
+	BuildDualFeePoolSpendTXV2 = dual.BuildDualFeePoolSpendTXV2
+	DualLoadTxV2              = dual.LoadTxV2
+
+	// Batch opening
+	BuildBatchPools                = batch.BuildBatchPools
+	SubBuildDualFeePoolSpendTXAt   = dual.SubBuildDualFeePoolSpendTXAt
+	SubBuildTripleFeePoolSpendTXAt = triple.SubBuildTripleFeePoolSpendTXAt
+
+	// Batch settlement
+	SettleBatch          = batch.SettleBatch
+	ClientSignSettlement = batch.ClientSignSettlement
+
+	// Dual-funded opening
+	BuildDualFundedBaseTx        = dual.BuildDualFundedBaseTx
+	VerifyDualFundedBaseTx       = dual.VerifyDualFundedBaseTx
+	SignDualFundedBaseTx         = dual.SignDualFundedBaseTx
+	BuildDualFundedRefundTX      = dual.BuildDualFundedRefundTX
+	ServerVerifyDualFundedRefund = dual.ServerVerifyDualFundedRefund
+
+	// Splice-in
+	BuildDualSpliceInTx        = dual.BuildDualSpliceInTx
+	VerifyDualSpliceInTx       = dual.VerifyDualSpliceInTx
+	ServerSignSpliceIn         = dual.ServerSignSpliceIn
+	ClientSignSpliceIn         = dual.ClientSignSpliceIn
+	BuildSpliceInRefundTX      = dual.BuildSpliceInRefundTX
+	ServerVerifySpliceInRefund = dual.ServerVerifySpliceInRefund
+
+	// Splice-out
+	BuildDualSpliceOutTx        = dual.BuildDualSpliceOutTx
+	VerifyDualSpliceOutTx       = dual.VerifyDualSpliceOutTx
+	ServerSignSpliceOut         = dual.ServerSignSpliceOut
+	ClientSignSpliceOut         = dual.ClientSignSpliceOut
+	BuildSpliceOutRefundTX      = dual.BuildSpliceOutRefundTX
+	ServerVerifySpliceOutRefund = dual.ServerVerifySpliceOutRefund
+
+	// Rollover
+	PlanDualRollover           = dual.PlanDualRollover
+	BuildDualRolloverTx        = dual.BuildDualRolloverTx
+	VerifyDualRolloverTx       = dual.VerifyDualRolloverTx
+	ServerSignRollover         = dual.ServerSignRollover
+	ClientSignRollover         = dual.ClientSignRollover
+	BuildRolloverRefundTX      = dual.BuildRolloverRefundTX
+	ServerVerifyRolloverRefund = dual.ServerVerifyRolloverRefund
+
+	// Bidirectional updates
+	ClassifyUpdate             = dual.ClassifyUpdate
+	ProposeBidirectionalUpdate = dual.ProposeBidirectionalUpdate
+	AcceptBidirectionalUpdate  = dual.AcceptBidirectionalUpdate
+
+	// Conditional (hash-locked) payments
+	HashLock                      = libs.HashLock
+	CheckPreimage                 = libs.CheckPreimage
+	ConditionalLockingScript      = libs.ConditionalLockingScript
+	ConditionalOutputs            = libs.ConditionalOutputs
+	BuildConditionalClaimTx       = libs.BuildConditionalClaimTx
+	BuildConditionalRefundTx      = libs.BuildConditionalRefundTx
+	ValidateConditionalTransition = libs.ValidateConditionalTransition
+	AddConditionalPayment         = dual.AddConditionalPayment
+	VerifyConditionalPayment      = dual.VerifyConditionalPayment
+	SettleConditionalPayment      = dual.SettleConditionalPayment
+	CancelConditionalPayment      = dual.CancelConditionalPayment
+	VerifyConditionalResolution   = dual.VerifyConditionalResolution
+	ExtractPreimage               = libs.ExtractPreimage
+
+	// Hub routing
+	NewHub            = dual.NewHub
+	NewMemoryHubStore = dual.NewMemoryHubStore
+	NextHubAction     = dual.NextAction
+
+	// Two-party ECDSA
+	NewTwoPartyKeyGen    = libs.NewTwoPartyKeyGen
+	AcceptTwoPartyKeyGen = libs.AcceptTwoPartyKeyGen
+	TwoPartyPoolScript   = dual.TwoPartyPoolScript
+	BuildTwoPartyBaseTx  = dual.BuildTwoPartyBaseTx
+	BuildTwoPartySpendTx = dual.BuildTwoPartySpendTx
+	TwoPartySighash      = dual.TwoPartySighash
+	ClientTwoPartySign   = dual.ClientTwoPartySign
+	NewTwoPartySigner    = dual.NewTwoPartySigner
+	VerifyTwoPartySpend  = dual.VerifyTwoPartySpend
+
+	// Adaptor signatures and cross-pool swaps
+	AdaptorPreSign         = libs.AdaptorPreSign
+	VerifyAdaptorSignature = libs.VerifyAdaptorSignature
+	AdaptSignature         = libs.AdaptSignature
+	ExtractAdaptorSecret   = libs.ExtractAdaptorSecret
+	SwapPreSign            = dual.SwapPreSign
+	VerifySwapPreSignature = dual.VerifySwapPreSignature
+	CompleteSwapLeg        = dual.CompleteSwapLeg
+	ExtractSwapSecret      = dual.ExtractSwapSecret
+	ValidateSwapLocktimes  = dual.ValidateSwapLocktimes
+
+	// Covenant pools
+	CovenantLockingScript   = libs.CovenantLockingScript
+	CovenantUnlockingScript = libs.CovenantUnlockingScript
+	CheckCovenantOutputs    = libs.CheckCovenantOutputs
+	NewCovenantTerms        = dual.NewCovenantTerms
+	EstimateCovenantFee     = dual.EstimateCovenantFee
+	BuildCovenantBaseTx     = dual.BuildCovenantBaseTx
+	BuildCovenantSpendTx    = dual.BuildCovenantSpendTx
+	LoadCovenantTx          = dual.LoadCovenantTx
+	CovenantSign            = dual.CovenantSign
+	VerifyCovenantSig       = dual.VerifyCovenantSig
+	MergeCovenantSigs       = dual.MergeCovenantSigs
+
+	// Expiry extension
+	ValidateExpiryExtension       = libs.ValidateExpiryExtension
+	ValidatePayoutTransition      = libs.ValidatePayoutTransition
+	CheckPayoutOutputs            = libs.CheckPayoutOutputs
+	ProposeDualExpiryExtension    = dual.ProposeExpiryExtension
+	AcceptDualExpiryExtension     = dual.AcceptExpiryExtension
+	FinalizeDualExpiryExtension   = dual.FinalizeExpiryExtension
+	ProposeTripleExpiryExtension  = triple.ProposeExpiryExtension
+	AcceptTripleExpiryExtension   = triple.AcceptExpiryExtension
+	FinalizeTripleExpiryExtension = triple.FinalizeExpiryExtension
+
+	// Triple disputes
+	OpenTripleDispute           = triple.OpenDispute
+	ProposeTripleResolution     = triple.ProposeResolution
+	CountersignTripleResolution = triple.CountersignResolution
+	AuditTripleDispute          = triple.AuditDispute
+	MergeTripleFeePoolSigPairAt = triple.MergeTripleFeePoolSigPairAt
+	VerifyTripleSignerPairAt    = triple.VerifyTripleSignerPairAt
+
+	// Triple endpoint v2 API
+	BuildTripleFeePoolBaseTxV2    = triple.BuildTripleFeePoolBaseTxV2
+	BuildTripleFeePoolSpendTXV2   = triple.BuildTripleFeePoolSpendTXV2
+	TripleFeePoolLoadTxV2         = triple.TripleFeePoolLoadTxV2
+	SignTripleFeePoolContribution = triple.SignTripleFeePoolContribution
+
+	// Triple splice-out
+	BuildTripleSpliceOutTx       = triple.BuildTripleSpliceOutTx
+	VerifyTripleSpliceOutTx      = triple.VerifyTripleSpliceOutTx
+	TripleBSignSpliceOut         = triple.BSignSpliceOut
+	TripleASignSpliceOut         = triple.ASignSpliceOut
+	BuildTripleSpliceOutRefundTX = triple.BuildSpliceOutRefundTX
+	TripleBVerifySpliceOutRefund = triple.BVerifySpliceOutRefund
 
 	// Dual endpoint functions
 	DualPoolSpentScript        = dual.DualPoolSpentScript
 	MergeDualPoolSigForSpendTx = dual.MergeDualPoolSigForSpendTx
 	// Dual endpoint verify helpers
-	ServerVerifyClientSpendSig  = dual.ServerVerifyClientSpendSig
-	ClientVerifyServerSpendSig  = dual.ClientVerifyServerSpendSig
-	ServerVerifyClientUpdateSig = dual.ServerVerifyClientUpdateSig
-	ClientVerifyServerUpdateSig = dual.ClientVerifyServerUpdateSig
+	VerifyDualSignedState        = dual.VerifyDualSignedState
+	DualValidateUpdateTransition = dual.ValidateUpdateTransition
+	DualValidatePayoutUpdate     = dual.ValidatePayoutUpdate
+	DualPayoutScripts            = dual.PayoutScripts
+	VerifyDualOpening            = dual.VerifyDualOpening
+	ServerVerifyClientSpendSig   = dual.ServerVerifyClientSpendSig
+	ClientVerifyServerSpendSig   = dual.ClientVerifyServerSpendSig
+	ServerVerifyClientUpdateSig  = dual.ServerVerifyClientUpdateSig
+	ClientVerifyServerUpdateSig  = dual.ClientVerifyServerUpdateSig
 
 	// Triple endpoint functions
 	TripleFeePoolSpentScript        = triple.TripleFeePoolSpentScript
 	MergeTripleFeePoolSigForSpendTx = triple.MergeTripleFeePoolSigForSpendTx
 	VerifySignature                 = triple.VerifySignature
 	// Triple endpoint verify helpers
-	ServerVerifyClientASig = triple.ServerVerifyClientASig
-	ServerVerifyClientBSig = triple.ServerVerifyClientBSig
-	ClientVerifyServerSig  = triple.ClientVerifyServerSig
+	TripleValidateUpdateTransition = triple.ValidateUpdateTransition
+	TripleValidatePayoutUpdate     = triple.ValidatePayoutUpdate
+	TriplePayoutScripts            = triple.PayoutScripts
+	TripleArbiterPayoutScript      = triple.ArbiterPayoutScript
+	VerifyTripleOpening            = triple.VerifyTripleOpening
+	ServerVerifyClientASig         = triple.ServerVerifyClientASig
+	ServerVerifyClientBSig         = triple.ServerVerifyClientBSig
+	ClientVerifyServerSig          = triple.ClientVerifyServerSig
+
+	// Explicit input index variants (pool input not at index 0)
+	SpendTXDualFeePoolClientSignAt          = dual.SpendTXDualFeePoolClientSignAt
+	SpendTXServerSignAt                     = dual.SpendTXServerSignAt
+	ClientDualFeePoolSpendTXUpdateSignAt    = dual.ClientDualFeePoolSpendTXUpdateSignAt
+	ServerDualFeePoolSpendTXUpdateSignAt    = dual.ServerDualFeePoolSpendTXUpdateSignAt
+	ServerVerifyClientSpendSigAt            = dual.ServerVerifyClientSpendSigAt
+	ClientVerifyServerSpendSigAt            = dual.ClientVerifyServerSpendSigAt
+	ServerVerifyClientUpdateSigAt           = dual.ServerVerifyClientUpdateSigAt
+	ClientVerifyServerUpdateSigAt           = dual.ClientVerifyServerUpdateSigAt
+	MergeDualPoolSigForSpendTxAt            = dual.MergeDualPoolSigForSpendTxAt
+	SpendTXTripleFeePoolASignAt             = triple.SpendTXTripleFeePoolASignAt
+	SpendTXTripleFeePoolBSignAt             = triple.SpendTXTripleFeePoolBSignAt
+	ClientATripleFeePoolSpendTXUpdateSignAt = triple.ClientATripleFeePoolSpendTXUpdateSignAt
+	ClientBTripleFeePoolSpendTXUpdateSignAt = triple.ClientBTripleFeePoolSpendTXUpdateSignAt
+	ServerVerifyClientASigAt                = triple.ServerVerifyClientASigAt
+	ServerVerifyClientBSigAt                = triple.ServerVerifyClientBSigAt
+	ClientVerifyServerSigAt                 = triple.ClientVerifyServerSigAt
+	MergeTripleFeePoolSigForSpendTxAt       = triple.MergeTripleFeePoolSigForSpendTxAt
 )
 
 // Common errors
 var (
-	ErrInvalidPublicKeys = libs.ErrInvalidPublicKeys
-	ErrNoPrivateKeys     = libs.ErrNoPrivateKeys
-	ErrInvalidM          = libs.ErrInvalidM
+	ErrInvalidPublicKeys      = libs.ErrInvalidPublicKeys
+	ErrNoPrivateKeys          = libs.ErrNoPrivateKeys
+	ErrInvalidM               = libs.ErrInvalidM
+	ErrInsufficientFunds      = libs.ErrInsufficientFunds
+	ErrBadSignature           = libs.ErrBadSignature
+	ErrSequenceRegression     = libs.ErrSequenceRegression
+	ErrLocktimeOutOfRange     = libs.ErrLocktimeOutOfRange
+	ErrInvalidTransaction     = libs.ErrInvalidTransaction
+	ErrMissingSourceOutput    = libs.ErrMissingSourceOutput
+	ErrUnexpectedSighash      = libs.ErrUnexpectedSighash
+	ErrInvalidSignatureFormat = libs.ErrInvalidSignatureFormat
+	ErrSigningFailed          = libs.ErrSigningFailed
+	ErrTransitionMismatch     = libs.ErrTransitionMismatch
+	ErrInvalidParams          = libs.ErrInvalidParams
+	ErrNetworkMismatch        = libs.ErrNetworkMismatch
+	ErrDirectionNotAllowed    = libs.ErrDirectionNotAllowed
+	ErrLimitExceeded          = libs.ErrLimitExceeded
+	ErrPreimageMismatch       = libs.ErrPreimageMismatch
+	ErrInvalidState           = libs.ErrInvalidState
+	ErrInvalidProof           = libs.ErrInvalidProof
+	ErrCovenantViolation      = libs.ErrCovenantViolation
+	ErrAuditMismatch          = libs.ErrAuditMismatch
 )
+
+// Structured errors, use errors.As to inspect them
+type InsufficientFundsError = libs.InsufficientFundsError
+type SignatureError = libs.SignatureError
+type SequenceError = libs.SequenceError
+type LocktimeError = libs.LocktimeError
+type Party = libs.Party
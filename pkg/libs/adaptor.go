@@ -0,0 +1,167 @@
+package libs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+)
+
+// ECDSA 适配签名：签名方用私钥 x 对摘要 m 做一个以适配点 Y = y·G 加密的预签名，
+// 任何人都能验证预签名，但只有知道 y 的一方能把它变成普通 ECDSA 签名；
+// 反过来，拿到最终签名与预签名的一方可以算出 y。跨池原子互换用它把两次更新绑在一起。
+//
+// 预签名：R = k·G，R̂ = k·Y，r = R̂.x mod n，ŝ = k⁻¹(m + r·x) mod n，附 DLEQ 证明 log_G R = log_Y R̂。
+// 适配：s = ŝ·y⁻¹ mod n，(r, s) 是公钥 x·G 对 m 的签名（随后按 low-S 规范化）。
+// 提取：y = ŝ·s⁻¹ mod n，low-S 规范化可能翻转 s 的符号，因此取满足 y·G = Y 的 ±y。
+
+// AdaptorSignature 是以适配点加密的 ECDSA 预签名。
+type AdaptorSignature struct {
+	R     *ec.PublicKey `json:"r"`     // k·G
+	RHat  *ec.PublicKey `json:"r_hat"` // k·Y
+	S     *big.Int      `json:"s"`     // k⁻¹(m + r·x) mod n
+	Proof *DLEQProof    `json:"proof"`
+}
+
+// DLEQProof 是 Chaum-Pedersen 离散对数相等证明：log_G R = log_Y R̂。
+type DLEQProof struct {
+	Challenge *big.Int `json:"challenge"`
+	Response  *big.Int `json:"response"`
+}
+
+// AdaptorPreSign 用 priv 对 32 字节摘要 digest 做以 adaptor 加密的预签名。
+func AdaptorPreSign(priv *ec.PrivateKey, digest []byte, adaptor *ec.PublicKey) (*AdaptorSignature, error) {
+	if priv == nil || !validScalar(priv.D) {
+		return nil, ErrNoPrivateKeys
+	}
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("%w: digest must be %d bytes", ErrInvalidParams, sha256.Size)
+	}
+	if !validPoint(adaptor) {
+		return nil, fmt.Errorf("%w: adaptor point is required", ErrInvalidParams)
+	}
+	n := ec.S256().N
+	for {
+		k, err := randomScalar()
+		if err != nil {
+			return nil, err
+		}
+		rHat := adaptor.Mul(k)
+		r := new(big.Int).Mod(rHat.X, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		s := new(big.Int).Mul(r, priv.D)
+		s.Add(s, new(big.Int).SetBytes(digest))
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+		R := scalarBaseMult(k)
+		proof, err := proveDLEQ(k, adaptor, R, rHat)
+		if err != nil {
+			return nil, err
+		}
+		return &AdaptorSignature{R: R, RHat: rHat, S: s, Proof: proof}, nil
+	}
+}
+
+// VerifyAdaptorSignature 检查 pre 是 pub 对 digest、以 adaptor 加密的有效预签名。
+// 通过后，知道 adaptor 离散对数的一方一定能用 AdaptSignature 得到有效签名。
+func VerifyAdaptorSignature(pre *AdaptorSignature, pub *ec.PublicKey, digest []byte, adaptor *ec.PublicKey) error {
+	if pre == nil || !validPoint(pre.R) || !validPoint(pre.RHat) || !validScalar(pre.S) {
+		return fmt.Errorf("%w: incomplete adaptor signature", ErrInvalidParams)
+	}
+	if !validPoint(pub) || !validPoint(adaptor) || len(digest) != sha256.Size {
+		return fmt.Errorf("%w: public key, adaptor point and 32-byte digest are required", ErrInvalidParams)
+	}
+	if err := pre.Proof.verify(adaptor, pre.R, pre.RHat); err != nil {
+		return err
+	}
+	// ŝ·R = m·G + r·X
+	r := new(big.Int).Mod(pre.RHat.X, ec.S256().N)
+	expected := addPoints(scalarBaseMult(new(big.Int).SetBytes(digest)), pub.Mul(r))
+	if !pre.R.Mul(pre.S).IsEqual(expected) {
+		return fmt.Errorf("%w: adaptor signature does not verify", ErrBadSignature)
+	}
+	return nil
+}
+
+// AdaptSignature 用适配点的离散对数 secret 把预签名变成 low-S 的普通 ECDSA 签名。
+func AdaptSignature(pre *AdaptorSignature, secret *ec.PrivateKey) (*ec.Signature, error) {
+	if pre == nil || !validPoint(pre.RHat) || !validScalar(pre.S) {
+		return nil, fmt.Errorf("%w: incomplete adaptor signature", ErrInvalidParams)
+	}
+	if secret == nil || !validScalar(secret.D) {
+		return nil, fmt.Errorf("%w: adaptor secret is required", ErrInvalidParams)
+	}
+	n := ec.S256().N
+	s := new(big.Int).Mul(pre.S, new(big.Int).ModInverse(secret.D, n))
+	s.Mod(s, n)
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+	return &ec.Signature{R: new(big.Int).Mod(pre.RHat.X, n), S: s}, nil
+}
+
+// ExtractAdaptorSecret 用最终签名与对应的预签名算出 adaptor 的离散对数。
+// 签名不是由该预签名适配而来时返回 ErrInvalidParams。
+func ExtractAdaptorSecret(pre *AdaptorSignature, sig *ec.Signature, adaptor *ec.PublicKey) (*ec.PrivateKey, error) {
+	if pre == nil || !validPoint(pre.RHat) || !validScalar(pre.S) || sig == nil || !validScalar(sig.S) || !validPoint(adaptor) {
+		return nil, fmt.Errorf("%w: adaptor signature, signature and adaptor point are required", ErrInvalidParams)
+	}
+	n := ec.S256().N
+	if sig.R == nil || sig.R.Cmp(new(big.Int).Mod(pre.RHat.X, n)) != 0 {
+		return nil, fmt.Errorf("%w: signature was not adapted from this adaptor signature", ErrInvalidParams)
+	}
+	y := new(big.Int).Mul(pre.S, new(big.Int).ModInverse(sig.S, n))
+	y.Mod(y, n)
+	for _, candidate := range []*big.Int{y, new(big.Int).Sub(n, y)} {
+		if scalarBaseMult(candidate).IsEqual(adaptor) {
+			secret, _ := ec.PrivateKeyFromBytes(paddedScalar(candidate))
+			return secret, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: signature was not adapted from this adaptor signature", ErrInvalidParams)
+}
+
+func proveDLEQ(k *big.Int, adaptor, R, rHat *ec.PublicKey) (*DLEQProof, error) {
+	a, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	e := dleqChallenge(adaptor, R, rHat, scalarBaseMult(a), adaptor.Mul(a))
+	z := new(big.Int).Mul(e, k)
+	z.Add(z, a)
+	z.Mod(z, ec.S256().N)
+	return &DLEQProof{Challenge: e, Response: z}, nil
+}
+
+func (proof *DLEQProof) verify(adaptor, R, rHat *ec.PublicKey) error {
+	if proof == nil || proof.Challenge == nil || !validScalar(proof.Response) {
+		return fmt.Errorf("%w: incomplete DLEQ proof", ErrInvalidProof)
+	}
+	// A1 = z·G - e·R，A2 = z·Y - e·R̂
+	negE := new(big.Int).Sub(ec.S256().N, new(big.Int).Mod(proof.Challenge, ec.S256().N))
+	a1 := addPoints(scalarBaseMult(proof.Response), R.Mul(negE))
+	a2 := addPoints(adaptor.Mul(proof.Response), rHat.Mul(negE))
+	if dleqChallenge(adaptor, R, rHat, a1, a2).Cmp(proof.Challenge) != 0 {
+		return fmt.Errorf("%w: DLEQ proof", ErrInvalidProof)
+	}
+	return nil
+}
+
+func dleqChallenge(adaptor, R, rHat, a1, a2 *ec.PublicKey) *big.Int {
+	h := newTranscript("adaptor/dleq")
+	for _, p := range []*ec.PublicKey{adaptor, R, rHat, a1, a2} {
+		h.write(p.Compressed())
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(h.sum()), ec.S256().N)
+}
+
+func paddedScalar(k *big.Int) []byte {
+	buf := make([]byte, 32)
+	return k.FillBytes(buf)
+}
@@ -0,0 +1,117 @@
+package libs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+)
+
+// 篡改 DLEQ 证明或 R̂ 的预签名被拒绝，适配后也得不到有效签名。
+func TestAdaptorSignatureTamperedDLEQ(t *testing.T) {
+	priv, _ := ec.NewPrivateKey()
+	secret, _ := ec.NewPrivateKey()
+	adaptor := secret.PubKey()
+	digest := sha256.Sum256([]byte("adaptor/dleq"))
+
+	pre, err := AdaptorPreSign(priv, digest[:], adaptor)
+	if err != nil {
+		t.Fatalf("pre-sign: %v", err)
+	}
+	if err := VerifyAdaptorSignature(pre, priv.PubKey(), digest[:], adaptor); err != nil {
+		t.Fatalf("honest pre-signature rejected: %v", err)
+	}
+
+	response := *pre
+	response.Proof = &DLEQProof{Challenge: pre.Proof.Challenge, Response: new(big.Int).Add(pre.Proof.Response, one)}
+	if err := VerifyAdaptorSignature(&response, priv.PubKey(), digest[:], adaptor); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a tampered response, got %v", err)
+	}
+	challenge := *pre
+	challenge.Proof = &DLEQProof{Challenge: new(big.Int).Add(pre.Proof.Challenge, one), Response: pre.Proof.Response}
+	if err := VerifyAdaptorSignature(&challenge, priv.PubKey(), digest[:], adaptor); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a tampered challenge, got %v", err)
+	}
+	missing := *pre
+	missing.Proof = nil
+	if err := VerifyAdaptorSignature(&missing, priv.PubKey(), digest[:], adaptor); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof without a proof, got %v", err)
+	}
+
+	// R̂ 换成另一个 Y 的倍数时 DLEQ 不成立，适配后的签名也无效
+	k, _ := randomScalar()
+	forged := *pre
+	forged.RHat = adaptor.Mul(k)
+	if err := VerifyAdaptorSignature(&forged, priv.PubKey(), digest[:], adaptor); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a forged R̂, got %v", err)
+	}
+	sig, err := AdaptSignature(&forged, secret)
+	if err != nil {
+		t.Fatalf("adapt: %v", err)
+	}
+	if sig.Verify(digest[:], priv.PubKey()) {
+		t.Fatalf("signature adapted from a forged R̂ must not verify")
+	}
+}
+
+// low-S 规范化会翻转 s 的符号，两种情况下都能提取出秘密；高 S 形式的签名同样可以提取。
+func TestExtractAdaptorSecretLowS(t *testing.T) {
+	priv, _ := ec.NewPrivateKey()
+	n := ec.S256().N
+	half := new(big.Int).Rsh(n, 1)
+
+	flipped, kept := 0, 0
+	for i := 0; i < 64 && (flipped == 0 || kept == 0); i++ {
+		secret, _ := ec.NewPrivateKey()
+		adaptor := secret.PubKey()
+		digest := sha256.Sum256([]byte{byte(i)})
+		pre, err := AdaptorPreSign(priv, digest[:], adaptor)
+		if err != nil {
+			t.Fatalf("pre-sign: %v", err)
+		}
+		sig, err := AdaptSignature(pre, secret)
+		if err != nil {
+			t.Fatalf("adapt: %v", err)
+		}
+		if sig.S.Cmp(half) > 0 || !sig.Verify(digest[:], priv.PubKey()) {
+			t.Fatalf("adapted signature must be a valid low-S signature")
+		}
+		raw := new(big.Int).Mul(pre.S, new(big.Int).ModInverse(secret.D, n))
+		raw.Mod(raw, n)
+		if raw.Cmp(sig.S) == 0 {
+			kept++
+		} else {
+			flipped++
+		}
+
+		high := &ec.Signature{R: sig.R, S: new(big.Int).Sub(n, sig.S)}
+		for _, candidate := range []*ec.Signature{sig, high} {
+			extracted, err := ExtractAdaptorSecret(pre, candidate, adaptor)
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+			if extracted.D.Cmp(secret.D) != 0 {
+				t.Fatalf("extracted secret differs from the adaptor secret")
+			}
+		}
+	}
+	if flipped == 0 || kept == 0 {
+		t.Fatalf("expected both low-S branches, got %d flipped and %d kept", flipped, kept)
+	}
+
+	// 签名不是由该预签名适配而来
+	secret, _ := ec.NewPrivateKey()
+	digest := sha256.Sum256([]byte("adaptor/extract"))
+	pre, _ := AdaptorPreSign(priv, digest[:], secret.PubKey())
+	sig, _ := AdaptSignature(pre, secret)
+	other, _ := ec.NewPrivateKey()
+	if _, err := ExtractAdaptorSecret(pre, sig, other.PubKey()); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for another adaptor point, got %v", err)
+	}
+	plain, _ := priv.Sign(digest[:])
+	if _, err := ExtractAdaptorSecret(pre, plain, secret.PubKey()); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for an unrelated signature, got %v", err)
+	}
+}
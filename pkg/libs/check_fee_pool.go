@@ -1,6 +1,8 @@
 package libs
 
 import (
+	"fmt"
+
 	"github.com/bsv-blockchain/go-sdk/transaction"
 )
 
@@ -17,6 +19,10 @@ func GetInfoFromTxOne(
 	// feePoolHeaderCount uint32,
 ) (info *FeePoolInfo, err error) {
 
+	if tx == nil || len(tx.Inputs) == 0 {
+		return nil, fmt.Errorf("%w: empty transaction or inputs", ErrInvalidTransaction)
+	}
+
 	info = &FeePoolInfo{}
 	// info.ServerAmount = tx.Outputs[0].Satoshis
 	// if info.ServerAmount < minFeePoolAmount {
@@ -0,0 +1,48 @@
+package libs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SelectUTXOs 按金额从大到小选择 UTXO，直到总额不小于 target。
+// 返回选中的 UTXO（保持原列表中的相对顺序）及其总额；余额不足时返回 InsufficientFundsError。
+func SelectUTXOs(utxos []UTXO, target uint64) ([]UTXO, uint64, error) {
+	order := make([]int, len(utxos))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return utxos[order[a]].Value > utxos[order[b]].Value
+	})
+
+	picked := make([]bool, len(utxos))
+	var total uint64
+	for _, i := range order {
+		if total >= target && total > 0 {
+			break
+		}
+		picked[i] = true
+		total += utxos[i].Value
+	}
+	if total < target {
+		return nil, 0, fmt.Errorf("coin selection: %w", &InsufficientFundsError{Need: target, Have: total})
+	}
+
+	selected := make([]UTXO, 0, len(utxos))
+	for i, u := range utxos {
+		if picked[i] {
+			selected = append(selected, u)
+		}
+	}
+	return selected, total, nil
+}
+
+// SumUTXOs 返回 UTXO 金额之和。
+func SumUTXOs(utxos []UTXO) uint64 {
+	var total uint64
+	for _, u := range utxos {
+		total += u.Value
+	}
+	return total
+}
@@ -0,0 +1,104 @@
+package libs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// Commitment 是 B-Tx 中 OP_RETURN 输出携带的 32 字节承诺，用于把池状态绑定到应用层收据
+// （发票号、使用计数或请求日志的哈希）。承诺输出固定为 0 聪、位于最后一个输出，
+// 锁定脚本为 OP_FALSE OP_RETURN <32 字节>。
+type Commitment [32]byte
+
+// commitmentPrefix 是承诺输出锁定脚本的前缀：OP_FALSE OP_RETURN OP_DATA_32。
+var commitmentPrefix = []byte{script.OpFALSE, script.OpRETURN, script.OpDATA32}
+
+// HashCommitment 返回各段数据依次拼接后的 SHA-256，作为承诺。
+func HashCommitment(parts ...[]byte) Commitment {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	var c Commitment
+	copy(c[:], h.Sum(nil))
+	return c
+}
+
+// ParseCommitmentHex 解析 64 个字符的 hex 承诺。
+func ParseCommitmentHex(s string) (Commitment, error) {
+	var c Commitment
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(c) {
+		return c, fmt.Errorf("%w: commitment must be 32 bytes of hex", ErrInvalidParams)
+	}
+	copy(c[:], b)
+	return c, nil
+}
+
+func (c Commitment) String() string {
+	return hex.EncodeToString(c[:])
+}
+
+// LockingScript 返回承诺输出的锁定脚本。
+func (c Commitment) LockingScript() *script.Script {
+	s := script.Script(append(append([]byte{}, commitmentPrefix...), c[:]...))
+	return &s
+}
+
+// Output 返回 0 聪的承诺输出。
+func (c Commitment) Output() *transaction.TransactionOutput {
+	return &transaction.TransactionOutput{Satoshis: 0, LockingScript: c.LockingScript()}
+}
+
+// ParseCommitment 判断锁定脚本是否为承诺脚本并取出承诺。
+func ParseCommitment(lockingScript *script.Script) (Commitment, bool) {
+	var c Commitment
+	if lockingScript == nil {
+		return c, false
+	}
+	b := lockingScript.Bytes()
+	if len(b) != len(commitmentPrefix)+len(c) || !bytes.HasPrefix(b, commitmentPrefix) {
+		return c, false
+	}
+	copy(c[:], b[len(commitmentPrefix):])
+	return c, true
+}
+
+// CommitmentOf 返回 B-Tx 最后一个输出携带的承诺。
+func CommitmentOf(t *transaction.Transaction) (Commitment, bool) {
+	if t == nil || len(t.Outputs) == 0 {
+		return Commitment{}, false
+	}
+	return ParseCommitment(t.Outputs[len(t.Outputs)-1].LockingScript)
+}
+
+// PayoutOutputs 返回去掉末尾承诺输出后的支付输出。
+func PayoutOutputs(t *transaction.Transaction) []*transaction.TransactionOutput {
+	if _, ok := CommitmentOf(t); ok {
+		return t.Outputs[:len(t.Outputs)-1]
+	}
+	return t.Outputs
+}
+
+// SetCommitment 设置 B-Tx 的承诺：已有承诺输出时替换，否则返回错误——
+// B-Tx 的手续费在开池时已确定，只有开池时就带承诺输出的池才能在更新中携带承诺。
+func SetCommitment(t *transaction.Transaction, c Commitment) error {
+	if _, ok := CommitmentOf(t); !ok {
+		return fmt.Errorf("%w: spend tx was opened without a commitment output", ErrInvalidParams)
+	}
+	t.Outputs[len(t.Outputs)-1] = c.Output()
+	return nil
+}
+
+// checkCommitmentOutput 校验承诺输出为 0 聪。
+func checkCommitmentOutput(t *transaction.Transaction) error {
+	if _, ok := CommitmentOf(t); ok && t.Outputs[len(t.Outputs)-1].Satoshis != 0 {
+		return fmt.Errorf("%w: commitment output must carry 0 satoshis", ErrTransitionMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,459 @@
+package libs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+)
+
+// 条件支付（哈希锁）：B-Tx 中位于支付输出之后、承诺输出之前的输出可以锁定为
+//
+//	OP_IF
+//	  OP_SHA256 <32 字节哈希> OP_EQUALVERIFY <收款方公钥> OP_CHECKSIG
+//	OP_ELSE
+//	  <OP_PUSH_TX> <locktime 不早于 Timeout 且为区块高度> <该输入序列号不是 final> <付款方公钥> OP_CHECKSIG
+//	OP_ENDIF
+//
+// 领取：收款方出示原像并签名，解锁脚本为 <签名> <原像> OP_1。
+// 退款：Genesis 之后 OP_CHECKLOCKTIMEVERIFY 按 NOP 执行，退款分支改用 OP_PUSH_TX（见 covenant.go）
+// 从花费交易的签名原像中读出 nLockTime 与该输入的 nSequence。序列号不是 final 时共识规则强制 nLockTime，
+// 因此退款交易在 Timeout 高度之前无法上链。解锁脚本为 <签名> <签名原像> OP_0，只需要付款方签名。
+
+// ConditionalTerms 是写入条件输出锁定脚本的条款。
+type ConditionalTerms struct {
+	Hash    [32]byte      // 原像的 SHA-256
+	Payee   *ec.PublicKey // 出示原像即可领取
+	Payer   *ec.PublicKey // Timeout 之后可以取回
+	Timeout uint32        // 退款交易最早的 nLockTime（区块高度）
+}
+
+// Validate 检查条款是否完整。
+func (c ConditionalTerms) Validate() error {
+	if c.Payee == nil || c.Payer == nil {
+		return fmt.Errorf("%w: payee and payer public keys are required", ErrInvalidParams)
+	}
+	if c.Payee.IsEqual(c.Payer) {
+		return fmt.Errorf("%w: payee and payer must differ", ErrInvalidParams)
+	}
+	if c.Timeout == 0 || c.Timeout >= MaxBlockHeightLocktime {
+		return &LocktimeError{Locktime: c.Timeout, Min: 1, Max: MaxBlockHeightLocktime - 1}
+	}
+	return nil
+}
+
+// conditionalTimeoutFromEnd 是 Timeout 在锁定脚本中距末尾的操作数个数：
+// <Timeout> 之后依次为 OP_GREATERTHANOREQUAL … <付款方公钥> OP_CHECKSIG OP_ENDIF 共 20 项。
+const conditionalTimeoutFromEnd = 21
+
+// HashLock 返回原像的 SHA-256，作为条件输出的哈希锁。
+func HashLock(preimage []byte) [32]byte {
+	return sha256.Sum256(preimage)
+}
+
+// CheckPreimage 校验原像与哈希锁一致。
+func CheckPreimage(hash [32]byte, preimage []byte) error {
+	if sha256.Sum256(preimage) != hash {
+		return fmt.Errorf("%w: sha256 %x", ErrPreimageMismatch, hash)
+	}
+	return nil
+}
+
+// ConditionalLockingScript 返回按 terms 锁定的条件输出脚本。
+func ConditionalLockingScript(terms ConditionalTerms) (*script.Script, error) {
+	if err := terms.Validate(); err != nil {
+		return nil, err
+	}
+	curve := ec.S256()
+	g := &ec.PublicKey{Curve: curve, X: curve.Gx, Y: curve.Gy}
+
+	s := &script.Script{}
+	b := covenantBuilder{s: s}
+	// 领取：… <签名> <原像>
+	b.ops(script.OpIF, script.OpSHA256)
+	b.push(terms.Hash[:])
+	b.ops(script.OpEQUALVERIFY)
+	b.push(terms.Payee.Compressed())
+	b.ops(script.OpCHECKSIG, script.OpELSE)
+
+	// 退款：… <签名> <签名原像>，先用 OP_PUSH_TX 确认原像属于当前花费交易
+	b.ops(script.OpDUP, script.OpHASH256)
+	b.pushTxSignature()
+	b.push(g.Compressed())
+	b.ops(script.OpCHECKSIGVERIFY)
+	// nLockTime 位于原像末尾 8 字节的前 4 字节，必须是不早于 Timeout 的区块高度
+	b.ops(script.OpDUP, script.OpSIZE)
+	b.number(big.NewInt(8))
+	b.ops(script.OpSUB, script.OpSPLIT, script.OpNIP)
+	b.number(big.NewInt(4))
+	b.ops(script.OpSPLIT, script.OpDROP)
+	b.push([]byte{0x00})
+	b.ops(script.OpCAT, script.OpBIN2NUM, script.OpDUP)
+	b.number(big.NewInt(int64(terms.Timeout)))
+	b.ops(script.OpGREATERTHANOREQUAL, script.OpVERIFY)
+	b.number(big.NewInt(int64(MaxBlockHeightLocktime)))
+	b.ops(script.OpLESSTHAN, script.OpVERIFY)
+	// nSequence 位于原像末尾 44 字节的前 4 字节，不能是 final，否则 nLockTime 不生效
+	b.ops(script.OpSIZE)
+	b.number(big.NewInt(44))
+	b.ops(script.OpSUB, script.OpSPLIT, script.OpNIP)
+	b.number(big.NewInt(4))
+	b.ops(script.OpSPLIT, script.OpDROP)
+	b.push([]byte{0xff, 0xff, 0xff, 0xff})
+	b.ops(script.OpEQUAL, script.OpNOT, script.OpVERIFY)
+	b.push(terms.Payer.Compressed())
+	b.ops(script.OpCHECKSIG, script.OpENDIF)
+	if b.err != nil {
+		return nil, b.err
+	}
+	return s, nil
+}
+
+// ConditionalOutputSize 返回按 terms 锁定的条件输出序列化后的字节数（金额 + 脚本长度 + 脚本）。
+func ConditionalOutputSize(terms ConditionalTerms) (int, error) {
+	lockingScript, err := ConditionalLockingScript(terms)
+	if err != nil {
+		return 0, err
+	}
+	return 8 + len(serializedScript(lockingScript)), nil
+}
+
+// ConditionalOutput 是 B-Tx 中的一个条件输出。
+type ConditionalOutput struct {
+	ConditionalTerms
+	Vout     uint32
+	Satoshis uint64
+}
+
+// ParseConditionalScript 判断锁定脚本是否为条件输出脚本，返回其中的条款。
+func ParseConditionalScript(lockingScript *script.Script) (ConditionalTerms, bool) {
+	var terms ConditionalTerms
+	if lockingScript == nil {
+		return terms, false
+	}
+	chunks, err := lockingScript.Chunks()
+	if err != nil || len(chunks) < conditionalTimeoutFromEnd+7 || chunks[0].Op != script.OpIF ||
+		len(chunks[2].Data) != 32 || len(chunks[4].Data) != 33 || len(chunks[len(chunks)-3].Data) != 33 {
+		return terms, false
+	}
+	timeout, ok := scriptUint32(chunks[len(chunks)-conditionalTimeoutFromEnd])
+	if !ok {
+		return terms, false
+	}
+	copy(terms.Hash[:], chunks[2].Data)
+	terms.Timeout = timeout
+	if terms.Payee, err = ec.PublicKeyFromBytes(chunks[4].Data); err != nil {
+		return terms, false
+	}
+	if terms.Payer, err = ec.PublicKeyFromBytes(chunks[len(chunks)-3].Data); err != nil {
+		return terms, false
+	}
+	// 按解析出的条款重建，逐字节一致才是条件输出
+	expected, err := ConditionalLockingScript(terms)
+	if err != nil || !bytes.Equal(expected.Bytes(), lockingScript.Bytes()) {
+		return ConditionalTerms{}, false
+	}
+	return terms, true
+}
+
+// scriptUint32 读取 OP_1..OP_16 或最多 5 字节的非负脚本数字。
+func scriptUint32(chunk *script.ScriptChunk) (uint32, bool) {
+	if chunk.Op >= script.Op1 && chunk.Op <= script.Op16 {
+		return uint32(chunk.Op-script.Op1) + 1, true
+	}
+	if len(chunk.Data) == 0 || len(chunk.Data) > 5 || chunk.Data[len(chunk.Data)-1]&0x80 != 0 {
+		return 0, false
+	}
+	var n uint64
+	for i := len(chunk.Data) - 1; i >= 0; i-- {
+		n = n<<8 | uint64(chunk.Data[i])
+	}
+	if n > uint64(^uint32(0)) {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+// ConditionalOutputs 按输出顺序返回交易中的条件输出。
+func ConditionalOutputs(t *transaction.Transaction) []ConditionalOutput {
+	var outputs []ConditionalOutput
+	if t == nil {
+		return nil
+	}
+	for vout, out := range t.Outputs {
+		if terms, ok := ParseConditionalScript(out.LockingScript); ok {
+			outputs = append(outputs, ConditionalOutput{ConditionalTerms: terms, Vout: uint32(vout), Satoshis: out.Satoshis})
+		}
+	}
+	return outputs
+}
+
+// BuildConditionalClaimTx 构建并签名领取交易：收款方出示原像，把 t 的第 vout 个条件输出（扣除手续费后）
+// 支付到 payoutScript；payoutScript 为空时使用收款方公钥的 P2PKH。用于带条件输出的状态已经上链、需要在链上领取时。
+// 收款方必须在 Timeout 之前领取，之后付款方的退款交易也可以上链。
+func BuildConditionalClaimTx(
+	t *transaction.Transaction,
+	vout uint32,
+	preimage []byte,
+	payeePrivateKey *ec.PrivateKey,
+	payoutScript *script.Script,
+	feeRate float64,
+) (*transaction.Transaction, error) {
+	if payeePrivateKey == nil {
+		return nil, fmt.Errorf("%w: payee private key is required", ErrInvalidParams)
+	}
+	source, terms, err := conditionalSource(t, vout)
+	if err != nil {
+		return nil, err
+	}
+	if !terms.Payee.IsEqual(payeePrivateKey.PubKey()) {
+		return nil, fmt.Errorf("%w: private key does not match the conditional payee", ErrInvalidParams)
+	}
+	if err := CheckPreimage(terms.Hash, preimage); err != nil {
+		return nil, err
+	}
+	claim := transaction.NewTransaction()
+	claim.AddInputWithOutput(&transaction.TransactionInput{
+		SourceTXID:       t.TxID(),
+		SourceTxOutIndex: vout,
+		SequenceNumber:   FinalSequence,
+	}, source)
+	unlock := func(sig []byte) (*script.Script, error) {
+		if sig == nil {
+			sig = make([]byte, 73)
+		}
+		return conditionalUnlockingScript(sig, preimage, true)
+	}
+	if err := signConditionalSpend(claim, payeePrivateKey, payoutScript, feeRate, unlock); err != nil {
+		return nil, fmt.Errorf("claim: %w", err)
+	}
+	return claim, nil
+}
+
+// BuildConditionalRefundTx 构建并签名退款交易：付款方在 Timeout 之后取回 t 的第 vout 个条件输出（扣除手续费后），
+// 支付到 payoutScript；payoutScript 为空时使用付款方公钥的 P2PKH。
+// 交易的 nLockTime 为 Timeout、输入序列号不是 final，在 Timeout 高度之前无法上链；只需要付款方签名，
+// 因此 t 的 txid 变化（例如对方重新签名 B-Tx）后付款方可以随时重建。
+func BuildConditionalRefundTx(
+	t *transaction.Transaction,
+	vout uint32,
+	payerPrivateKey *ec.PrivateKey,
+	payoutScript *script.Script,
+	feeRate float64,
+) (*transaction.Transaction, error) {
+	if payerPrivateKey == nil {
+		return nil, fmt.Errorf("%w: payer private key is required", ErrInvalidParams)
+	}
+	source, terms, err := conditionalSource(t, vout)
+	if err != nil {
+		return nil, err
+	}
+	if !terms.Payer.IsEqual(payerPrivateKey.PubKey()) {
+		return nil, fmt.Errorf("%w: private key does not match the conditional payer", ErrInvalidParams)
+	}
+	refund := transaction.NewTransaction()
+	refund.LockTime = terms.Timeout
+	refund.AddInputWithOutput(&transaction.TransactionInput{
+		SourceTXID:       t.TxID(),
+		SourceTxOutIndex: vout,
+		SequenceNumber:   FinalSequence - 1,
+	}, source)
+	unlock := func(sig []byte) (*script.Script, error) {
+		if sig == nil {
+			// 原像：版本 4 + hashPrevouts 32 + hashSequence 32 + outpoint 36 + scriptCode + 金额 8 + 序列号 4
+			// + hashOutputs 32 + locktime 4 + sighash 类型 4
+			return conditionalUnlockingScript(make([]byte, 73), make([]byte, 156+len(serializedScript(source.LockingScript))), false)
+		}
+		preimage, err := refund.CalcInputPreimage(0, sighash.Flag(covenantSighash))
+		if err != nil {
+			return nil, fmt.Errorf("%w: calc preimage: %w", ErrInvalidTransaction, err)
+		}
+		return conditionalUnlockingScript(sig, preimage, false)
+	}
+	if err := signConditionalSpend(refund, payerPrivateKey, payoutScript, feeRate, unlock); err != nil {
+		return nil, fmt.Errorf("refund: %w", err)
+	}
+	return refund, nil
+}
+
+// conditionalSource 返回 t 的第 vout 个输出及其条件条款。
+func conditionalSource(t *transaction.Transaction, vout uint32) (*transaction.TransactionOutput, ConditionalTerms, error) {
+	if t == nil || int(vout) >= len(t.Outputs) {
+		return nil, ConditionalTerms{}, fmt.Errorf("%w: no output %d", ErrInvalidTransaction, vout)
+	}
+	terms, ok := ParseConditionalScript(t.Outputs[vout].LockingScript)
+	if !ok {
+		return nil, ConditionalTerms{}, fmt.Errorf("%w: output %d is not a conditional output", ErrInvalidTransaction, vout)
+	}
+	return t.Outputs[vout], terms, nil
+}
+
+// signConditionalSpend 为只有一个条件输入的交易添加支付输出、扣除手续费并签名。
+// unlock 按签名构建解锁脚本，签名为 nil 时返回等长的占位脚本用于估算手续费。
+func signConditionalSpend(
+	spend *transaction.Transaction,
+	priv *ec.PrivateKey,
+	payoutScript *script.Script,
+	feeRate float64,
+	unlock func(sig []byte) (*script.Script, error),
+) error {
+	if payoutScript == nil {
+		address, err := script.NewAddressFromPublicKey(priv.PubKey(), true)
+		if err != nil {
+			return fmt.Errorf("failed to get payout address: %w", err)
+		}
+		if payoutScript, err = p2pkh.Lock(address); err != nil {
+			return fmt.Errorf("failed to create payout locking script: %w", err)
+		}
+	}
+	spend.AddOutput(&transaction.TransactionOutput{LockingScript: payoutScript})
+
+	placeholder, err := unlock(nil)
+	if err != nil {
+		return err
+	}
+	spend.Inputs[0].UnlockingScript = placeholder
+	fee := uint64(float64(spend.Size()) / 1000.0 * feeRate)
+	if fee == 0 {
+		fee = 1
+	}
+	amount := spend.Inputs[0].SourceTxOutput().Satoshis
+	if amount <= fee {
+		return fmt.Errorf("fee: %w", &InsufficientFundsError{Need: fee + 1, Have: amount})
+	}
+	spend.Outputs[0].Satoshis = amount - fee
+
+	flag := sighash.Flag(covenantSighash)
+	sh, err := spend.CalcInputSignatureHash(0, flag)
+	if err != nil {
+		return fmt.Errorf("%w: calc sighash: %w", ErrInvalidTransaction, err)
+	}
+	sig, err := priv.Sign(sh)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSigningFailed, err)
+	}
+	unlockingScript, err := unlock(append(sig.Serialize(), uint8(flag)))
+	if err != nil {
+		return err
+	}
+	spend.Inputs[0].UnlockingScript = unlockingScript
+	return nil
+}
+
+// conditionalUnlockingScript 返回 <签名> <数据> OP_1（领取，数据为原像）或 OP_0（退款，数据为签名原像）。
+func conditionalUnlockingScript(sig, data []byte, claim bool) (*script.Script, error) {
+	s := &script.Script{}
+	if err := s.AppendPushData(sig); err != nil {
+		return nil, err
+	}
+	if err := s.AppendPushData(data); err != nil {
+		return nil, err
+	}
+	if claim {
+		s.AppendOpcodes(script.Op1)
+	} else {
+		s.AppendOpcodes(script.Op0)
+	}
+	return s, nil
+}
+
+// removeOutput 返回去掉第 vout 个输出后的输出列表，不修改原列表。
+func removeOutput(outputs []*transaction.TransactionOutput, vout uint32) []*transaction.TransactionOutput {
+	kept := make([]*transaction.TransactionOutput, 0, len(outputs)-1)
+	kept = append(kept, outputs[:vout]...)
+	return append(kept, outputs[vout+1:]...)
+}
+
+// ValidateConditionalTransition 校验 B-Tx 从 prev 迁移到 next 时只增加或去掉了一个条件输出：
+// 除该输出外，其余输出的锁定脚本与顺序不变，序列号严格递增、locktime 不变；新增条件输出的 Timeout 必须晚于 locktime，
+// 否则 B-Tx 上链时退款已经生效，收款方来不及领取。
+// 金额为 0 的支付按粉尘策略省略，因此允许支付输出随金额变为 0 或从 0 变为正数而消失或出现。
+// 金额由调用方按参数重建交易后逐项比较。返回变化的条件输出及其是否为新增。
+func ValidateConditionalTransition(prev, next *transaction.Transaction) (ConditionalOutput, bool, error) {
+	if err := validateSpendInputs(prev, next); err != nil {
+		return ConditionalOutput{}, false, err
+	}
+	if next.LockTime != prev.LockTime {
+		return ConditionalOutput{}, false, &LocktimeError{Locktime: next.LockTime, Min: prev.LockTime, Max: prev.LockTime}
+	}
+	prevConditional, nextConditional := len(ConditionalOutputs(prev)), len(ConditionalOutputs(next))
+	added := nextConditional == prevConditional+1
+	if !added && nextConditional+1 != prevConditional {
+		return ConditionalOutput{}, false, fmt.Errorf("%w: no conditional output added or removed", ErrTransitionMismatch)
+	}
+	if _, prevCommitment := CommitmentOf(prev); prevCommitment {
+		if _, nextCommitment := CommitmentOf(next); !nextCommitment {
+			return ConditionalOutput{}, false, fmt.Errorf("%w: commitment output removed", ErrTransitionMismatch)
+		}
+	} else if _, nextCommitment := CommitmentOf(next); nextCommitment {
+		return ConditionalOutput{}, false, fmt.Errorf("%w: commitment output added", ErrTransitionMismatch)
+	}
+	longer, shorter := prev, next
+	if added {
+		longer, shorter = next, prev
+	}
+	// 去掉条件输出后其余输出的锁定脚本必须按顺序对应，只允许多出或少掉支付输出
+	for _, candidate := range ConditionalOutputs(longer) {
+		if !matchOutputScripts(removeOutput(longer.Outputs, candidate.Vout), shorter.Outputs) {
+			continue
+		}
+		if err := checkCommitmentOutput(next); err != nil {
+			return ConditionalOutput{}, false, err
+		}
+		if added && candidate.Timeout <= next.LockTime {
+			return ConditionalOutput{}, false, &LocktimeError{Locktime: candidate.Timeout, Min: next.LockTime + 1, Max: MaxBlockHeightLocktime - 1}
+		}
+		return candidate, added, nil
+	}
+	return ConditionalOutput{}, false, fmt.Errorf("%w: outputs other than the conditional output changed", ErrTransitionMismatch)
+}
+
+// matchOutputScripts 报告 a 与 b 中较短一方的锁定脚本是否按顺序出现在较长一方中，且较长一方多出的只有支付输出
+// （不是条件输出或承诺输出）。
+func matchOutputScripts(a, b []*transaction.TransactionOutput) bool {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	j := 0
+	for _, out := range a {
+		if j < len(b) && bytes.Equal(out.LockingScript.Bytes(), b[j].LockingScript.Bytes()) {
+			j++
+			continue
+		}
+		if _, ok := ParseConditionalScript(out.LockingScript); ok {
+			return false
+		}
+		if _, ok := ParseCommitment(out.LockingScript); ok {
+			return false
+		}
+	}
+	return j == len(b)
+}
+
+// ExtractPreimage 在交易各输入的解锁脚本中查找哈希锁的原像，用于从对方的链上领取交易中得知原像。
+func ExtractPreimage(t *transaction.Transaction, hash [32]byte) ([]byte, error) {
+	if t == nil {
+		return nil, fmt.Errorf("%w: nil transaction", ErrInvalidTransaction)
+	}
+	for _, input := range t.Inputs {
+		if input.UnlockingScript == nil {
+			continue
+		}
+		chunks, err := input.UnlockingScript.Chunks()
+		if err != nil {
+			continue
+		}
+		for _, chunk := range chunks {
+			if len(chunk.Data) > 0 && sha256.Sum256(chunk.Data) == hash {
+				return chunk.Data, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: no preimage for sha256 %x", ErrPreimageMismatch, hash)
+}
@@ -0,0 +1,99 @@
+package libs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+)
+
+// 条件输出的退款分支由脚本强制：nLockTime 早于 Timeout、不是区块高度或序列号为 final 的退款交易都无法通过脚本。
+func TestConditionalRefundTimeout(t *testing.T) {
+	payee, _ := ec.NewPrivateKey()
+	payer, _ := ec.NewPrivateKey()
+	preimage := []byte("conditional/refund")
+	terms := ConditionalTerms{Hash: HashLock(preimage), Payee: payee.PubKey(), Payer: payer.PubKey(), Timeout: 800144}
+	lockingScript, err := ConditionalLockingScript(terms)
+	if err != nil {
+		t.Fatalf("locking script: %v", err)
+	}
+	parsed, ok := ParseConditionalScript(lockingScript)
+	if !ok || parsed.Hash != terms.Hash || !parsed.Payee.IsEqual(terms.Payee) || !parsed.Payer.IsEqual(terms.Payer) || parsed.Timeout != terms.Timeout {
+		t.Fatalf("conditional script must round-trip: %+v", parsed)
+	}
+	if size, _ := ConditionalOutputSize(terms); size != 8+len(serializedScript(lockingScript)) {
+		t.Fatalf("unexpected output size %d", size)
+	}
+	tampered := script.Script(append([]byte(nil), *lockingScript...))
+	tampered[len(tampered)-40] ^= 0x01
+	if _, ok := ParseConditionalScript(&tampered); ok {
+		t.Fatalf("tampered script must not parse as a conditional output")
+	}
+	if _, err := ConditionalLockingScript(ConditionalTerms{Hash: terms.Hash, Payee: payee.PubKey(), Payer: payer.PubKey(), Timeout: MaxBlockHeightLocktime}); !errors.Is(err, ErrLocktimeOutOfRange) {
+		t.Fatalf("expected ErrLocktimeOutOfRange for a timestamp timeout, got %v", err)
+	}
+
+	txid := chainhash.DoubleHashH([]byte("conditional state"))
+	state := transaction.NewTransaction()
+	state.AddInput(&transaction.TransactionInput{SourceTXID: &txid, SequenceNumber: 3})
+	state.AddOutput(&transaction.TransactionOutput{Satoshis: 10000, LockingScript: lockingScript})
+
+	refund, err := BuildConditionalRefundTx(state, 0, payer, nil, 50)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	run := func(spend *transaction.Transaction) error {
+		return interpreter.NewEngine().Execute(
+			interpreter.WithTx(spend, 0, state.Outputs[0]),
+			interpreter.WithForkID(),
+			interpreter.WithAfterGenesis(),
+		)
+	}
+	if err := run(refund); err != nil {
+		t.Fatalf("refund must pass the script: %v", err)
+	}
+	// 改动 locktime 或序列号后重新签名，脚本拒绝
+	resign := func(locktime, sequence uint32) *transaction.Transaction {
+		spend, _ := transaction.NewTransactionFromHex(refund.Hex())
+		spend.LockTime = locktime
+		spend.Inputs[0].SequenceNumber = sequence
+		spend.Inputs[0].SetSourceTxOutput(state.Outputs[0])
+		sh, _ := spend.CalcInputSignatureHash(0, sighash.Flag(covenantSighash))
+		sig, _ := payer.Sign(sh)
+		txPreimage, _ := spend.CalcInputPreimage(0, sighash.Flag(covenantSighash))
+		spend.Inputs[0].UnlockingScript, _ = conditionalUnlockingScript(append(sig.Serialize(), byte(covenantSighash)), txPreimage, false)
+		return spend
+	}
+	if err := run(resign(terms.Timeout+10, 0)); err != nil {
+		t.Fatalf("refund after the timeout must pass: %v", err)
+	}
+	for _, c := range []struct {
+		name               string
+		locktime, sequence uint32
+	}{
+		{"before timeout", terms.Timeout - 1, FinalSequence - 1},
+		{"final sequence", terms.Timeout, FinalSequence},
+		{"timestamp locktime", MaxBlockHeightLocktime + 1, FinalSequence - 1},
+	} {
+		if err := run(resign(c.locktime, c.sequence)); err == nil {
+			t.Fatalf("%s: refund must fail the script", c.name)
+		}
+	}
+
+	// 领取分支只需要原像与收款方签名，不受 Timeout 限制
+	claim, err := BuildConditionalClaimTx(state, 0, preimage, payee, nil, 50)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if err := run(claim); err != nil {
+		t.Fatalf("claim must pass the script: %v", err)
+	}
+	if _, err := BuildConditionalRefundTx(state, 0, payee, nil, 50); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for the payee refunding, got %v", err)
+	}
+}
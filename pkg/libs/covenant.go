@@ -0,0 +1,253 @@
+package libs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	"github.com/bsv-blockchain/go-sdk/util"
+)
+
+// 契约池（OP_PUSH_TX）：池输出在 2-of-2 多签之前先检查花费交易本身，
+// 解锁脚本为 OP_0 <服务器签名> <客户端签名> <服务器金额> <客户端金额> <签名原像>：
+//  1. 用私钥 1、nonce 1 在脚本内对原像的 HASH256 算出签名 (G.x, HASH256(原像) + G.x mod n)，
+//     再以公钥 G 执行 OP_CHECKSIGVERIFY，只有原像确实是当前花费交易 SIGHASH_ALL|FORKID 的原像时才会通过。
+//  2. 原像中的 hashOutputs 必须等于 HASH256(<服务器金额> <服务器支付脚本> <客户端金额> <客户端支付脚本>)，
+//     即花费交易恰好有 [服务器, 客户端] 两个输出，支付脚本为开池时写入的脚本。
+//  3. 原像中的池金额不超过两个输出金额之和加 MaxFee，即花费最多付出 MaxFee 的手续费。
+//
+// 因此即使一方拿到了对方签名的任意交易，也只能广播符合上述布局的状态；金额的分配仍由双方签名约定。
+// 脚本使用 OP_CAT、OP_SPLIT、OP_NUM2BIN 与大数运算，只适用于 Genesis 之后的 BSV。
+
+// covenantSighash 是契约检查的签名类型，双方的多签签名也必须使用它。
+const covenantSighash = sighash.ForkID | sighash.All
+
+// CovenantTerms 是写入契约池锁定脚本的条款，开池后不可更改。
+type CovenantTerms struct {
+	ServerPublicKey    *ec.PublicKey
+	ClientPublicKey    *ec.PublicKey
+	ServerPayoutScript *script.Script // 0 号输出的锁定脚本
+	ClientPayoutScript *script.Script // 1 号输出的锁定脚本
+	MaxFee             uint64         // 花费交易允许的最大手续费
+}
+
+// Validate 检查条款是否完整。
+func (c CovenantTerms) Validate() error {
+	if c.ServerPublicKey == nil || c.ClientPublicKey == nil {
+		return fmt.Errorf("%w: covenant needs both public keys", ErrInvalidParams)
+	}
+	if c.ServerPayoutScript == nil || len(*c.ServerPayoutScript) == 0 || c.ClientPayoutScript == nil || len(*c.ClientPayoutScript) == 0 {
+		return fmt.Errorf("%w: covenant needs both payout scripts", ErrInvalidParams)
+	}
+	if bytes.Equal(c.ServerPayoutScript.Bytes(), c.ClientPayoutScript.Bytes()) {
+		return fmt.Errorf("%w: covenant payout scripts must differ", ErrInvalidParams)
+	}
+	return nil
+}
+
+// CovenantLockingScript 返回按 terms 约束花费交易的池锁定脚本。
+func CovenantLockingScript(terms CovenantTerms) (*script.Script, error) {
+	if err := terms.Validate(); err != nil {
+		return nil, err
+	}
+	curve := ec.S256()
+	g := &ec.PublicKey{Curve: curve, X: curve.Gx, Y: curve.Gy}
+
+	s := &script.Script{}
+	b := covenantBuilder{s: s}
+	// 1. OP_PUSH_TX：… <原像> -> … <原像>
+	b.ops(script.OpDUP, script.OpHASH256)
+	b.pushTxSignature()
+	b.push(g.Compressed())
+	b.ops(script.OpCHECKSIGVERIFY)
+
+	// 2. 输出布局：… <服务器金额> <客户端金额> <原像>
+	b.ops(script.Op2, script.OpPICK, script.OpSIZE)
+	b.number(big.NewInt(8))
+	b.ops(script.OpEQUALVERIFY)
+	b.push(serializedScript(terms.ServerPayoutScript))
+	b.ops(script.OpCAT, script.Op2, script.OpPICK, script.OpSIZE)
+	b.number(big.NewInt(8))
+	b.ops(script.OpEQUALVERIFY, script.OpCAT)
+	b.push(serializedScript(terms.ClientPayoutScript))
+	b.ops(script.OpCAT, script.OpHASH256, script.OpOVER, script.OpSIZE)
+	b.number(big.NewInt(40))
+	b.ops(script.OpSUB, script.OpSPLIT, script.OpNIP)
+	b.number(big.NewInt(32))
+	b.ops(script.OpSPLIT, script.OpDROP, script.OpEQUALVERIFY)
+
+	// 3. 金额：池金额 <= 服务器金额 + 客户端金额 + MaxFee，消耗原像与两个金额
+	b.ops(script.OpSIZE)
+	b.number(big.NewInt(52))
+	b.ops(script.OpSUB, script.OpSPLIT, script.OpNIP)
+	b.number(big.NewInt(8))
+	b.ops(script.OpSPLIT, script.OpDROP, script.OpBIN2NUM,
+		script.OpROT, script.OpBIN2NUM, script.OpROT, script.OpBIN2NUM, script.OpADD)
+	b.number(new(big.Int).SetUint64(terms.MaxFee))
+	b.ops(script.OpADD, script.OpLESSTHANOREQUAL, script.OpVERIFY)
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	// 4. 2-of-2 多签
+	multisig, err := Lock([]*ec.PublicKey{terms.ServerPublicKey, terms.ClientPublicKey}, 2)
+	if err != nil {
+		return nil, err
+	}
+	*s = append(*s, *multisig...)
+	return s, nil
+}
+
+// CovenantUnlockingScript 构建契约池输入的解锁脚本。t 的第 inputIndex 个输入必须已设置来源输出，
+// serverSig、clientSig 为带 SIGHASH_ALL|FORKID 标志的签名，金额取自 0、1 号输出。
+func CovenantUnlockingScript(t *transaction.Transaction, inputIndex uint32, serverSig, clientSig []byte) (*script.Script, error) {
+	if t == nil || int(inputIndex) >= len(t.Inputs) || len(t.Outputs) < 2 {
+		return nil, fmt.Errorf("%w: covenant spend needs input %d and two outputs", ErrInvalidTransaction, inputIndex)
+	}
+	if t.Inputs[inputIndex].SourceTxOutput() == nil {
+		return nil, fmt.Errorf("%w: input %d", ErrMissingSourceOutput, inputIndex)
+	}
+	preimage, err := t.CalcInputPreimage(inputIndex, sighash.Flag(covenantSighash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: calc preimage: %w", ErrInvalidTransaction, err)
+	}
+	return covenantUnlockingScript(serverSig, clientSig, t.Outputs[0].Satoshis, t.Outputs[1].Satoshis, preimage)
+}
+
+// CovenantPlaceholder 返回与 lockingScript 的真实解锁脚本等长（签名按最大长度计）的占位解锁脚本，用于估算手续费。
+func CovenantPlaceholder(lockingScript *script.Script) *script.Script {
+	// 原像：版本 4 + hashPrevouts 32 + hashSequence 32 + outpoint 36 + scriptCode + 金额 8 + 序列号 4
+	// + hashOutputs 32 + locktime 4 + sighash 类型 4
+	size := 156 + len(serializedScript(lockingScript))
+	s, _ := covenantUnlockingScript(make([]byte, 73), make([]byte, 73), 0, 0, make([]byte, size))
+	return s
+}
+
+// CheckCovenantOutputs 在链下按契约规则检查花费交易：恰好两个输出，锁定脚本依次为 terms 中的服务器与客户端支付脚本，
+// 手续费不超过 MaxFee。不符合时返回 ErrCovenantViolation，这样的交易在链上会被脚本拒绝。
+func CheckCovenantOutputs(t *transaction.Transaction, totalAmount uint64, terms CovenantTerms) error {
+	if err := terms.Validate(); err != nil {
+		return err
+	}
+	if t == nil || len(t.Outputs) != 2 {
+		return fmt.Errorf("%w: spend must have exactly two outputs", ErrCovenantViolation)
+	}
+	if !bytes.Equal(t.Outputs[0].LockingScript.Bytes(), terms.ServerPayoutScript.Bytes()) ||
+		!bytes.Equal(t.Outputs[1].LockingScript.Bytes(), terms.ClientPayoutScript.Bytes()) {
+		return fmt.Errorf("%w: outputs must pay the server then the client payout script", ErrCovenantViolation)
+	}
+	paid := t.Outputs[0].Satoshis + t.Outputs[1].Satoshis
+	if paid < t.Outputs[0].Satoshis || paid > totalAmount {
+		return fmt.Errorf("%w: outputs pay %d of pool amount %d", ErrCovenantViolation, paid, totalAmount)
+	}
+	if totalAmount-paid > terms.MaxFee {
+		return fmt.Errorf("%w: fee %d exceeds covenant maximum %d", ErrCovenantViolation, totalAmount-paid, terms.MaxFee)
+	}
+	return nil
+}
+
+// covenantUnlockingScript 返回 OP_0 <服务器签名> <客户端签名> <服务器金额> <客户端金额> <原像>。
+func covenantUnlockingScript(serverSig, clientSig []byte, serverAmount, clientAmount uint64, preimage []byte) (*script.Script, error) {
+	s := &script.Script{}
+	s.AppendOpcodes(script.Op0)
+	for _, data := range [][]byte{serverSig, clientSig, binary.LittleEndian.AppendUint64(nil, serverAmount), binary.LittleEndian.AppendUint64(nil, clientAmount), preimage} {
+		if err := s.AppendPushData(data); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// serializedScript 返回输出中锁定脚本的序列化形式（长度前缀 + 脚本）。
+func serializedScript(s *script.Script) []byte {
+	return append(util.VarInt(len(*s)).Bytes(), *s...)
+}
+
+// covenantBuilder 拼接锁定脚本并记住第一个错误。
+type covenantBuilder struct {
+	s   *script.Script
+	err error
+}
+
+func (b *covenantBuilder) ops(ops ...byte) {
+	if b.err == nil {
+		b.err = b.s.AppendOpcodes(ops...)
+	}
+}
+
+func (b *covenantBuilder) push(data []byte) {
+	if b.err == nil {
+		b.err = b.s.AppendPushData(data)
+	}
+}
+
+// number 以最短形式压入非负整数：0..16 用 OP_0..OP_16，其余为小端序的脚本数字。
+func (b *covenantBuilder) number(n *big.Int) {
+	switch {
+	case n.Sign() == 0:
+		b.ops(script.Op0)
+	case n.IsInt64() && n.Int64() <= 16:
+		b.ops(script.Op1 + byte(n.Int64()-1))
+	default:
+		le := n.Bytes()
+		for i, j := 0, len(le)-1; i < j; i, j = i+1, j-1 {
+			le[i], le[j] = le[j], le[i]
+		}
+		if le[len(le)-1]&0x80 != 0 {
+			le = append(le, 0x00)
+		}
+		b.push(le)
+	}
+}
+
+// pushTxSignature 把栈顶 32 字节的 HASH256(原像) 换成私钥 1、nonce 1 对它的签名：
+// r = G.x，s = HASH256(原像) + G.x mod n 取 low-S，编码为 DER 并附 SIGHASH_ALL|FORKID 类型字节。
+func (b *covenantBuilder) pushTxSignature() {
+	curve := ec.S256()
+	b.reverse(32)
+	b.push([]byte{0x00})
+	b.ops(script.OpCAT, script.OpBIN2NUM)
+	b.number(curve.Gx)
+	b.ops(script.OpADD)
+	b.number(curve.N)
+	b.ops(script.OpMOD)
+	// low-S：s > n/2 时取 n - s
+	b.ops(script.OpDUP)
+	b.number(new(big.Int).Rsh(curve.N, 1))
+	b.ops(script.OpGREATERTHAN, script.OpIF)
+	b.number(curve.N)
+	b.ops(script.OpSWAP, script.OpSUB, script.OpENDIF)
+	// 把 s 编码为 DER 整数：补齐到 33 字节、反转为大端序，再去掉多余的前导零
+	b.ops(script.OpSIZE, script.OpSWAP)
+	b.number(big.NewInt(33))
+	b.ops(script.OpNUM2BIN)
+	b.reverse(33)
+	b.ops(script.OpOVER)
+	b.number(big.NewInt(33))
+	b.ops(script.OpSWAP, script.OpSUB, script.OpSPLIT, script.OpNIP)
+	// 30 <36+len> 02 20 <G.x> 02 <len> <s> 41
+	b.ops(script.OpSWAP, script.OpDUP)
+	b.number(big.NewInt(36))
+	b.ops(script.OpADD)
+	b.push([]byte{0x30})
+	b.ops(script.OpSWAP, script.OpCAT)
+	b.push(append(append([]byte{0x02, 0x20}, paddedScalar(curve.Gx)...), 0x02))
+	b.ops(script.OpCAT, script.OpSWAP, script.OpCAT, script.OpSWAP, script.OpCAT)
+	b.push([]byte{byte(covenantSighash)})
+	b.ops(script.OpCAT)
+}
+
+// reverse 反转栈顶 size 字节的数据：逐字节拆开后倒序拼接。
+func (b *covenantBuilder) reverse(size int) {
+	for i := 1; i < size; i++ {
+		b.ops(script.Op1, script.OpSPLIT)
+	}
+	for i := 1; i < size; i++ {
+		b.ops(script.OpSWAP, script.OpCAT)
+	}
+}
@@ -0,0 +1,79 @@
+package libs
+
+import (
+	"math/big"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+)
+
+// OP_PUSH_TX 片段对固定的签名摘要给出与 DER 编码一致的 low-S 签名：覆盖 s 的各种 DER 长度、
+// 需要补 0x00 的情况以及 low-S 翻转前后的两个分支。
+func TestCovenantPushTxSignatureDER(t *testing.T) {
+	curve := ec.S256()
+	n := curve.N
+	half := new(big.Int).Rsh(n, 1)
+	g := &ec.PublicKey{Curve: curve, X: curve.Gx, Y: curve.Gy}
+	hexInt := func(s string) *big.Int {
+		v, _ := new(big.Int).SetString(s, 16)
+		return v
+	}
+
+	cases := []struct {
+		name string
+		s    *big.Int // 最终签名中的 s，不超过 n/2
+		size int      // DER 整数长度
+	}{
+		{"32 bytes", hexInt("5a0e6f2c3b1d4e8f9a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f"), 32},
+		{"half order", half, 32},
+		{"31 bytes", hexInt("7f112233445566778899aabbccddeeff00112233445566778899aabbccddee"), 31},
+		{"31 bytes padded", hexInt("80112233445566778899aabbccddeeff00112233445566778899aabbccddee"), 32},
+		{"30 bytes", hexInt("1234567890abcdef1234567890abcdef1234567890abcdef1234567890ab"), 30},
+		{"2 bytes padded", big.NewInt(0x80), 2},
+		{"1 byte", big.NewInt(1), 1},
+	}
+	for _, c := range cases {
+		// flipped 为 false 时脚本算出的 s 不超过 n/2，为 true 时算出 n - s 再翻转
+		for _, flipped := range []bool{false, true} {
+			raw := c.s
+			if flipped {
+				raw = new(big.Int).Sub(n, c.s)
+			}
+			// s = z + G.x mod n，反推出固定的签名摘要 z
+			z := new(big.Int).Sub(raw, curve.Gx)
+			z.Mod(z, n)
+			digest := paddedScalar(z)
+
+			sig := &ec.Signature{R: curve.Gx, S: c.s}
+			if !sig.Verify(digest, g) {
+				t.Fatalf("%s: (G.x, s) must be the signature of key 1 with nonce 1", c.name)
+			}
+			der := sig.Serialize()
+			// 30 <len> 02 20 <G.x> 02 <s 的长度> <s>
+			if int(der[37]) != c.size {
+				t.Fatalf("%s: DER integer length %d, want %d", c.name, der[37], c.size)
+			}
+			expected := append(der, byte(covenantSighash))
+
+			locking := &script.Script{}
+			b := covenantBuilder{s: locking}
+			b.pushTxSignature()
+			b.push(expected)
+			b.ops(script.OpEQUAL)
+			if b.err != nil {
+				t.Fatalf("build script: %v", b.err)
+			}
+			unlocking := &script.Script{}
+			_ = unlocking.AppendPushData(digest)
+			if err := interpreter.NewEngine().Execute(
+				interpreter.WithScripts(locking, unlocking),
+				interpreter.WithForkID(),
+				interpreter.WithAfterGenesis(),
+			); err != nil {
+				t.Fatalf("%s (flipped %v): script signature differs from DER %x: %v", c.name, flipped, expected, err)
+			}
+		}
+	}
+}
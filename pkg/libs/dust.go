@@ -0,0 +1,134 @@
+package libs
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// DustAction 决定低于粉尘限额的支付输出如何处理。
+type DustAction uint8
+
+const (
+	DustKeep     DustAction = iota // 默认：保留所有非零支付输出，省略金额为 0 的支付（0 聪 P2PKH 输出不是标准输出）
+	DustDrop                       // 省略低于限额的输出，其金额计入手续费
+	DustMerge                      // 把低于限额的金额并入金额最大的保留输出
+	DustKeepZero                   // 位置参数版本的原有布局：固定保留全部支付输出，金额可以为 0
+)
+
+func (a DustAction) String() string {
+	switch a {
+	case DustKeep:
+		return "keep"
+	case DustDrop:
+		return "drop"
+	case DustMerge:
+		return "merge"
+	case DustKeepZero:
+		return "keep-zero"
+	}
+	return fmt.Sprintf("dust(%d)", uint8(a))
+}
+
+// DustPolicy 配置支付输出的粉尘处理方式。零值只省略金额为 0 的支付，双方必须使用相同的策略才能构建出相同的交易。
+type DustPolicy struct {
+	Action DustAction
+	Limit  uint64 // 保留输出的最小金额；为 0 时使用 DustLimit
+}
+
+// Payout 是按固定顺序排列的一笔支付：双端池为 [服务器, 客户端]，三方池为 [B, A]。
+type Payout struct {
+	Party         Party
+	Amount        uint64
+	LockingScript *script.Script
+}
+
+// Validate 检查策略取值是否已定义。
+func (p DustPolicy) Validate() error {
+	if p.Action > DustKeepZero {
+		return fmt.Errorf("%w: unknown dust action %d", ErrInvalidParams, uint8(p.Action))
+	}
+	return nil
+}
+
+// Threshold 返回策略的粉尘限额，Limit 为 0 时为 DustLimit。
+func (p DustPolicy) Threshold() uint64 {
+	if p.Limit == 0 {
+		return DustLimit
+	}
+	return p.Limit
+}
+
+// Layout 按策略把支付列表确定性地转换为交易输出，保留输出的相对顺序不变：
+//   - DustKeep：去掉金额为 0 的支付，其余全部保留；
+//   - DustKeepZero：全部保留（位置参数版本的原有布局）；
+//   - DustDrop：去掉金额低于限额的支付；
+//   - DustMerge：去掉金额低于限额的支付，并把它们的金额加到保留支付中金额最大的一笔（相同时取靠前的）。
+//
+// 没有任何支付达到限额时返回 ErrBelowDust。
+func (p DustPolicy) Layout(payouts []Payout) ([]*transaction.TransactionOutput, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	limit := p.Threshold()
+	var (
+		outputs []*transaction.TransactionOutput
+		dust    uint64
+		largest = -1
+	)
+	for _, payout := range payouts {
+		if payout.Amount == 0 && p.Action != DustKeepZero {
+			continue
+		}
+		if (p.Action == DustDrop || p.Action == DustMerge) && payout.Amount < limit {
+			dust += payout.Amount
+			continue
+		}
+		if largest < 0 || payout.Amount > outputs[largest].Satoshis {
+			largest = len(outputs)
+		}
+		outputs = append(outputs, &transaction.TransactionOutput{Satoshis: payout.Amount, LockingScript: payout.LockingScript})
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("%w: no payout reaches dust limit %d", ErrBelowDust, limit)
+	}
+	if p.Action == DustMerge {
+		outputs[largest].Satoshis += dust
+	}
+	return outputs, nil
+}
+
+// FixedLayout 报告策略是否保持固定的支付输出布局（每一方一个输出，位置不变）。
+func (p DustPolicy) FixedLayout() bool {
+	return p.Action == DustKeepZero
+}
+
+// PayoutAmount 返回交易中使用指定锁定脚本的输出金额之和，输出被粉尘策略省略时为 0。
+func PayoutAmount(t *transaction.Transaction, lockingScript *script.Script) uint64 {
+	var amount uint64
+	for _, out := range t.Outputs {
+		if bytes.Equal(out.LockingScript.Bytes(), lockingScript.Bytes()) {
+			amount += out.Satoshis
+		}
+	}
+	return amount
+}
+
+// ValidatePayoutTransition 与 ValidateSpendTransition 相同，但允许输出因粉尘策略出现或消失：
+// next 的输出须满足 CheckPayoutOutputs，承诺输出的有无必须与 prev 一致，被省略的金额计入手续费，
+// 因此输出总额不与 prev 比较，而是不得超过 maxTotal（多签金额减 B-Tx 手续费）。
+func ValidatePayoutTransition(prev, next *transaction.Transaction, payoutScripts []*script.Script, maxTotal uint64) error {
+	if err := validateSpendInputs(prev, next); err != nil {
+		return err
+	}
+	if _, prevCommitment := CommitmentOf(prev); prevCommitment {
+		if _, nextCommitment := CommitmentOf(next); !nextCommitment {
+			return fmt.Errorf("%w: commitment output removed", ErrTransitionMismatch)
+		}
+	} else if _, nextCommitment := CommitmentOf(next); nextCommitment {
+		return fmt.Errorf("%w: commitment output added", ErrTransitionMismatch)
+	}
+	return CheckPayoutOutputs(next, payoutScripts, maxTotal)
+}
@@ -0,0 +1,148 @@
+package libs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 协议错误分类。
+// 所有 pool 包返回的错误都会包装下列哨兵错误之一，调用方可以用 errors.Is 映射协议响应，
+// 用 errors.As 取出结构化错误中的金额、签名方、序列号等细节，无需匹配错误字符串。
+var (
+	ErrInsufficientFunds      = errors.New("insufficient funds")
+	ErrBadSignature           = errors.New("bad signature")
+	ErrSequenceRegression     = errors.New("sequence number did not increase")
+	ErrLocktimeOutOfRange     = errors.New("locktime out of range")
+	ErrInvalidTransaction     = errors.New("invalid transaction")
+	ErrMissingSourceOutput    = errors.New("missing source tx output")
+	ErrUnexpectedSighash      = errors.New("unexpected sighash flag")
+	ErrInvalidSignatureFormat = errors.New("invalid signature encoding")
+	ErrSigningFailed          = errors.New("signing failed")
+	ErrTransitionMismatch     = errors.New("state transition changes a fixed field")
+	ErrInvalidParams          = errors.New("invalid parameters")
+	ErrNetworkMismatch        = errors.New("network mismatch")
+	ErrDirectionNotAllowed    = errors.New("payment direction not allowed for proposer")
+	ErrLimitExceeded          = errors.New("update exceeds configured limit")
+	ErrBelowDust              = errors.New("output below dust limit")
+	ErrPreimageMismatch       = errors.New("preimage does not match hash lock")
+	ErrInvalidState           = errors.New("operation not allowed in current state")
+	ErrInvalidProof           = errors.New("invalid zero-knowledge proof")
+	ErrCovenantViolation      = errors.New("spend violates pool covenant")
+	ErrAuditMismatch          = errors.New("audit record does not verify")
+)
+
+// DefaultFeeRate 是参数结构体未指定费率时使用的默认费率，单位与各构建函数的 feeRate 相同（sat/KB）。
+const DefaultFeeRate = 0.5
+
+// MaxBlockHeightLocktime 是按区块高度解释的 nLockTime 上限（不含），
+// 大于等于该值的 locktime 会被节点解释为 Unix 时间戳。
+const MaxBlockHeightLocktime uint32 = 500000000
+
+// Party 标识协议中的参与方，用于在错误和事件中指明责任方。
+type Party string
+
+const (
+	PartyClient Party = "client"
+	PartyServer Party = "server"
+	PartyA      Party = "a"
+	PartyB      Party = "b"
+)
+
+// InsufficientFundsError 表示可用金额不足以覆盖所需金额（含手续费）。
+type InsufficientFundsError struct {
+	Need uint64
+	Have uint64
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("insufficient funds: need %d, have %d", e.Need, e.Have)
+}
+
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+// DustError 表示某一方的金额扣除其承担的手续费后低于粉尘限额。
+// 该方金额不足以支付手续费时 Unwrap 返回描述整个池缺口的 *InsufficientFundsError。
+type DustError struct {
+	Party     Party
+	Amount    uint64 // 扣除手续费前的金额
+	Fee       uint64 // 该方承担的手续费
+	Limit     uint64
+	Shortfall *InsufficientFundsError
+}
+
+func (e *DustError) Error() string {
+	return fmt.Sprintf("%s amount %d minus fee share %d falls below dust limit %d", e.Party, e.Amount, e.Fee, e.Limit)
+}
+
+func (e *DustError) Is(target error) bool {
+	return target == ErrBelowDust
+}
+
+func (e *DustError) Unwrap() error {
+	if e.Shortfall == nil {
+		return nil
+	}
+	return e.Shortfall
+}
+
+// SignatureError 表示某一方提供的签名无法通过验证。
+// Err 为具体原因，例如 ErrUnexpectedSighash 或 ErrInvalidSignatureFormat。
+type SignatureError struct {
+	Party      Party
+	InputIndex uint32
+	Err        error
+}
+
+func (e *SignatureError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("bad signature from %s on input %d", e.Party, e.InputIndex)
+	}
+	return fmt.Sprintf("bad signature from %s on input %d: %v", e.Party, e.InputIndex, e.Err)
+}
+
+func (e *SignatureError) Is(target error) bool {
+	return target == ErrBadSignature
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// SequenceError 表示更新交易的序列号没有严格递增。
+type SequenceError struct {
+	Current  uint32
+	Proposed uint32
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("sequence number did not increase: current %d, proposed %d", e.Current, e.Proposed)
+}
+
+func (e *SequenceError) Is(target error) bool {
+	return target == ErrSequenceRegression
+}
+
+// LocktimeError 表示 locktime 超出允许的范围 [Min, Max]。
+type LocktimeError struct {
+	Locktime uint32
+	Min      uint32
+	Max      uint32
+}
+
+func (e *LocktimeError) Error() string {
+	return fmt.Sprintf("locktime %d out of range [%d, %d]", e.Locktime, e.Min, e.Max)
+}
+
+func (e *LocktimeError) Is(target error) bool {
+	return target == ErrLocktimeOutOfRange
+}
+
+// CheckBlockHeightLocktime 校验 locktime 是否为合法的区块高度，FINAL 值 0xffffffff 视为合法。
+func CheckBlockHeightLocktime(locktime uint32) error {
+	if locktime == 0xffffffff || locktime < MaxBlockHeightLocktime {
+		return nil
+	}
+	return &LocktimeError{Locktime: locktime, Min: 0, Max: MaxBlockHeightLocktime - 1}
+}
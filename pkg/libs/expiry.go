@@ -0,0 +1,89 @@
+package libs
+
+import (
+	"fmt"
+
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// DefaultMaxExtension 是 ExpiryPolicy.MaxExtension 为 0 时单次延期允许的最大区块数（约 30 天）。
+const DefaultMaxExtension uint32 = 4320
+
+// ExpiryPolicy 限制延长池到期高度（B-Tx 的 locktime）的幅度，防止一方无限期锁定对方资金。
+// 零值也有上限：MaxExtension 为 0 时使用 DefaultMaxExtension；MaxEndHeight 为 0 表示不设绝对上限。
+// Allow 为可选的自定义钩子，返回错误即拒绝本次延期。
+type ExpiryPolicy struct {
+	MaxExtension uint32 // 单次延长的最大区块数，为 0 时为 DefaultMaxExtension
+	MaxEndHeight uint32 // 到期高度的绝对上限
+	Allow        func(current, proposed uint32) error
+}
+
+// maxExtension 返回生效的单次延期上限。
+func (p ExpiryPolicy) maxExtension() uint32 {
+	if p.MaxExtension == 0 {
+		return DefaultMaxExtension
+	}
+	return p.MaxExtension
+}
+
+// Check 校验把到期高度从 current 延长到 proposed 是否允许：必须严格后移、是合法的区块高度，且不超过策略上限。
+func (p ExpiryPolicy) Check(current, proposed uint32) error {
+	if proposed == FinalSequence || proposed >= MaxBlockHeightLocktime {
+		return &LocktimeError{Locktime: proposed, Min: current + 1, Max: MaxBlockHeightLocktime - 1}
+	}
+	if proposed <= current {
+		return &LocktimeError{Locktime: proposed, Min: current + 1, Max: MaxBlockHeightLocktime - 1}
+	}
+	if limit := p.maxExtension(); proposed-current > limit {
+		return fmt.Errorf("%w: extension of %d blocks, max %d", ErrLimitExceeded, proposed-current, limit)
+	}
+	if p.MaxEndHeight > 0 && proposed > p.MaxEndHeight {
+		return fmt.Errorf("%w: end height %d, max %d", ErrLimitExceeded, proposed, p.MaxEndHeight)
+	}
+	if p.Allow != nil {
+		if err := p.Allow(current, proposed); err != nil {
+			return fmt.Errorf("%w: %w", ErrLimitExceeded, err)
+		}
+	}
+	return nil
+}
+
+// ValidateExpiryExtension 校验 B-Tx 从 prev 延期到 next：只允许 locktime 后移与序列号递增，
+// 输出金额必须逐项保持不变，新的 locktime 须满足 policy。
+func ValidateExpiryExtension(prev, next *transaction.Transaction, policy ExpiryPolicy) error {
+	if prev == nil || next == nil {
+		return fmt.Errorf("%w: nil transaction", ErrInvalidTransaction)
+	}
+	if err := policy.Check(prev.LockTime, next.LockTime); err != nil {
+		return err
+	}
+	// locktime 已单独校验，其余字段沿用普通更新的规则
+	shadow := *next
+	shadow.LockTime = prev.LockTime
+	if err := ValidateSpendTransition(prev, &shadow); err != nil {
+		return err
+	}
+	for i := range prev.Outputs {
+		if prev.Outputs[i].Satoshis != next.Outputs[i].Satoshis {
+			return fmt.Errorf("%w: output %d amount %d -> %d during expiry extension", ErrTransitionMismatch, i, prev.Outputs[i].Satoshis, next.Outputs[i].Satoshis)
+		}
+	}
+	return nil
+}
+
+// CheckRefundTimelock 校验对方提交的退款 B-Tx 确实受约定到期高度约束：locktime 必须等于 endHeight，
+// 且输入序列号不能是 FinalSequence（否则节点忽略 locktime，退款可以立即广播）。
+func CheckRefundTimelock(refundTx *transaction.Transaction, endHeight uint32) error {
+	if refundTx == nil {
+		return fmt.Errorf("%w: nil transaction", ErrInvalidTransaction)
+	}
+	if refundTx.LockTime != endHeight {
+		return &LocktimeError{Locktime: refundTx.LockTime, Min: endHeight, Max: endHeight}
+	}
+	for i, input := range refundTx.Inputs {
+		if input.SequenceNumber >= FinalSequence {
+			return fmt.Errorf("%w: refund input %d has final sequence, locktime would not apply", ErrInvalidTransaction, i)
+		}
+	}
+	return nil
+}
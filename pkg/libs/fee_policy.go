@@ -0,0 +1,184 @@
+package libs
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// DustLimit 是默认的粉尘限额（sat）：P2PKH 输出低于该金额时节点按粉尘拒绝转发。
+// DustPolicy.Limit 为 0 时也使用该值。
+const DustLimit uint64 = 546
+
+// FeePolicy 决定交易手续费由哪一方承担。
+// 双端池中“服务器方”为服务器、“客户端方”为客户端；三方池中分别对应 B 方（outputs[0]）与 A 方（outputs[1]）。
+type FeePolicy uint8
+
+const (
+	FeeClientPays   FeePolicy = iota // 默认：全部由客户端（A 方）承担
+	FeeServerPays                    // 全部由服务器（B 方）承担
+	FeeProportional                  // 按双方扣费前金额的比例分摊，零头由客户端承担
+	FeeSplitEven                     // 双方各承担一半，奇数零头由客户端承担
+)
+
+func (p FeePolicy) String() string {
+	switch p {
+	case FeeClientPays:
+		return "client-pays"
+	case FeeServerPays:
+		return "server-pays"
+	case FeeProportional:
+		return "proportional"
+	case FeeSplitEven:
+		return "split-even"
+	}
+	return fmt.Sprintf("fee-policy(%d)", uint8(p))
+}
+
+// Validate 检查策略取值是否已定义。
+func (p FeePolicy) Validate() error {
+	if p > FeeSplitEven {
+		return fmt.Errorf("%w: unknown fee policy %d", ErrInvalidParams, uint8(p))
+	}
+	return nil
+}
+
+// Shares 返回双方各自承担的手续费，两者之和等于 fee。
+func (p FeePolicy) Shares(serverAmount, clientAmount, fee uint64) (serverShare, clientShare uint64) {
+	switch p {
+	case FeeServerPays:
+		serverShare = fee
+	case FeeProportional:
+		if total := serverAmount + clientAmount; total > 0 {
+			// 128 位乘除避免溢出；serverAmount <= total 保证商不超过 fee
+			hi, lo := bits.Mul64(fee, serverAmount)
+			serverShare, _ = bits.Div64(hi, lo, total)
+		}
+	case FeeSplitEven:
+		serverShare = fee / 2
+	}
+	return serverShare, fee - serverShare
+}
+
+// Apply 按策略从双方扣费前的金额中扣除手续费，返回扣费后的金额。
+// 承担手续费的一方金额不足，或扣费后剩余金额低于 DustLimit（包括 0）时返回 *DustError；
+// 前者同时匹配 ErrInsufficientFunds。不承担手续费的一方金额原样返回。
+func (p FeePolicy) Apply(serverAmount, clientAmount, fee uint64) (uint64, uint64, error) {
+	return p.apply(serverAmount, clientAmount, fee, DustLimit, false)
+}
+
+// ApplyDust 与 Apply 相同，但按 dust 处理扣费后的余额：DustKeep 下余额为 0 的一方交由 Layout 省略，
+// 余额为正但低于 dust 限额时返回 *DustError；DustKeepZero 保留任意余额（包括 0）；
+// DustDrop 与 DustMerge 下低于限额的输出交由 Layout 省略或合并。后三者只检查金额是否足以支付手续费。
+func (p FeePolicy) ApplyDust(serverAmount, clientAmount, fee uint64, dust DustPolicy) (uint64, uint64, error) {
+	if dust.Action == DustKeep {
+		return p.apply(serverAmount, clientAmount, fee, dust.Threshold(), true)
+	}
+	return p.apply(serverAmount, clientAmount, fee, 0, false)
+}
+
+func (p FeePolicy) apply(serverAmount, clientAmount, fee, limit uint64, allowZero bool) (uint64, uint64, error) {
+	if err := p.Validate(); err != nil {
+		return 0, 0, err
+	}
+	serverShare, clientShare := p.Shares(serverAmount, clientAmount, fee)
+	total := serverAmount + clientAmount
+	server, err := deductFee(PartyServer, serverAmount, serverShare, total, limit, allowZero)
+	if err != nil {
+		return 0, 0, err
+	}
+	client, err := deductFee(PartyClient, clientAmount, clientShare, total, limit, allowZero)
+	if err != nil {
+		return 0, 0, err
+	}
+	return server, client, nil
+}
+
+// ApplyTriple 与 Apply 相同，但错误中的参与方标记为三方池的 B 方与 A 方。
+func (p FeePolicy) ApplyTriple(bAmount, aAmount, fee uint64) (uint64, uint64, error) {
+	return tripleDustParty(p.Apply(bAmount, aAmount, fee))
+}
+
+// ApplyTripleDust 与 ApplyDust 相同，但错误中的参与方标记为三方池的 B 方与 A 方。
+func (p FeePolicy) ApplyTripleDust(bAmount, aAmount, fee uint64, dust DustPolicy) (uint64, uint64, error) {
+	return tripleDustParty(p.ApplyDust(bAmount, aAmount, fee, dust))
+}
+
+func tripleDustParty(b, a uint64, err error) (uint64, uint64, error) {
+	if dustErr, ok := err.(*DustError); ok {
+		if dustErr.Party == PartyServer {
+			dustErr.Party = PartyB
+		} else {
+			dustErr.Party = PartyA
+		}
+	}
+	return b, a, err
+}
+
+// deductFee 从一方金额中扣除其手续费份额，total 为双方扣费前的总额，用于描述资金缺口；
+// 扣费后剩余金额低于 limit 时返回 *DustError，allowZero 时剩余恰为 0 不算粉尘（输出会被省略）。
+func deductFee(party Party, amount, share, total, limit uint64, allowZero bool) (uint64, error) {
+	if share == 0 {
+		return amount, nil
+	}
+	if amount < share {
+		return 0, &DustError{
+			Party:     party,
+			Amount:    amount,
+			Fee:       share,
+			Limit:     limit,
+			Shortfall: &InsufficientFundsError{Need: total - amount + share, Have: total},
+		}
+	}
+	rest := amount - share
+	if rest < limit && !(allowZero && rest == 0) {
+		return 0, &DustError{Party: party, Amount: amount, Fee: share, Limit: limit}
+	}
+	return rest, nil
+}
+
+// Resettle 以最近一次 B-Tx 的扣费后金额为基础重新结算：原 B-Tx 的手续费 oldFee 被释放，
+// 新交易的手续费为 newFee。新手续费更高时差额按策略扣除，更低时节省的部分按同样的策略退回。
+// 默认策略下等价于服务器金额不变、客户端得到 PoolAmount - 服务器金额 - newFee。
+func (p FeePolicy) Resettle(serverAmount, clientAmount, oldFee, newFee uint64) (uint64, uint64, error) {
+	if err := p.Validate(); err != nil {
+		return 0, 0, err
+	}
+	if newFee >= oldFee {
+		return p.Apply(serverAmount, clientAmount, newFee-oldFee)
+	}
+	serverRefund, clientRefund := p.Shares(serverAmount, clientAmount, oldFee-newFee)
+	return serverAmount + serverRefund, clientAmount + clientRefund, nil
+}
+
+// maxFeeAttempts 是 ConvergeFee 重新构建交易的最多次数。
+const maxFeeAttempts = 8
+
+// FeeForSize 按 feeRate（sat/KB）计算 size 字节交易的手续费，至少为 1 sat。
+func FeeForSize(size int, feeRate float64) uint64 {
+	fee := uint64(float64(size) / 1000.0 * feeRate)
+	if fee == 0 {
+		fee = 1
+	}
+	return fee
+}
+
+// ConvergeFee 以手续费 0 起反复调用 build 构建交易，直到交易所需手续费不超过构建时使用的手续费，返回该手续费。
+// 手续费取决于交易大小，而选币与找零又取决于手续费，因此需要迭代；
+// 多次构建后仍未收敛时返回错误，不会返回手续费不足的交易。build 最后一次构建的交易即对应返回的手续费。
+func ConvergeFee(feeRate float64, build func(fee uint64) (*transaction.Transaction, error)) (uint64, error) {
+	var fee uint64
+	for attempt := 0; attempt < maxFeeAttempts; attempt++ {
+		t, err := build(fee)
+		if err != nil {
+			return 0, err
+		}
+		need := FeeForSize(t.Size(), feeRate)
+		if need <= fee {
+			return fee, nil
+		}
+		fee = need
+	}
+	return 0, fmt.Errorf("%w: fee did not converge after %d attempts (last %d)", ErrInvalidTransaction, maxFeeAttempts, fee)
+}
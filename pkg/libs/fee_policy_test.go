@@ -0,0 +1,92 @@
+package libs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// 手续费收敛后返回的手续费覆盖最后一次构建的交易；一直增长的交易返回错误而不是少付手续费。
+func TestConvergeFee(t *testing.T) {
+	sized := func(n int) *transaction.Transaction {
+		s := script.Script(make([]byte, n))
+		tx := transaction.NewTransaction()
+		tx.AddOutput(&transaction.TransactionOutput{Satoshis: 1, LockingScript: &s})
+		return tx
+	}
+
+	var last *transaction.Transaction
+	fee, err := ConvergeFee(1000, func(fee uint64) (*transaction.Transaction, error) {
+		// 支付手续费后多出一个找零输出，交易变大一次
+		n := 100
+		if fee > 0 {
+			n = 150
+		}
+		last = sized(n)
+		return last, nil
+	})
+	if err != nil {
+		t.Fatalf("converge: %v", err)
+	}
+	if need := FeeForSize(last.Size(), 1000); fee < need {
+		t.Fatalf("fee %d does not cover the final tx (need %d)", fee, need)
+	}
+
+	_, err = ConvergeFee(1000, func(fee uint64) (*transaction.Transaction, error) {
+		return sized(int(fee) + 100), nil
+	})
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for a fee that never converges, got %v", err)
+	}
+}
+
+// 承担手续费的一方扣费后低于粉尘限额（包括 0）时报错；DustKeep 下限额取自 DustPolicy.Limit，余额恰为 0 时交给 Layout 省略；
+// DustKeepZero 不检查限额，DustDrop/DustMerge 下低于限额的金额交给 Layout 处理。
+func TestFeePolicyDust(t *testing.T) {
+	cases := []struct {
+		name                string
+		policy              FeePolicy
+		server, client, fee uint64
+	}{
+		{"client paid down to zero", FeeClientPays, 100, 50, 50},
+		{"server share leaves zero", FeeSplitEven, 1, 1000, 3},
+		{"client below default limit", FeeClientPays, 0, DustLimit + 10, 20},
+	}
+	for _, c := range cases {
+		var dustErr *DustError
+		if _, _, err := c.policy.Apply(c.server, c.client, c.fee); !errors.As(err, &dustErr) || dustErr.Limit != DustLimit {
+			t.Fatalf("%s: expected DustError with the default limit, got %v", c.name, err)
+		}
+	}
+	if s, c, err := FeeClientPays.Apply(0, 10000, 100); err != nil || s != 0 || c != 9900 {
+		t.Fatalf("unexpected client-pays result %d/%d (%v)", s, c, err)
+	}
+
+	keep := DustPolicy{Limit: 5000}
+	if _, _, err := FeeClientPays.ApplyDust(0, 5050, 100, keep); !errors.Is(err, ErrBelowDust) {
+		t.Fatalf("expected ErrBelowDust for the configured limit, got %v", err)
+	}
+	if _, c, err := FeeClientPays.ApplyDust(0, 5100, 100, keep); err != nil || c != 5000 {
+		t.Fatalf("unexpected result at the configured limit %d (%v)", c, err)
+	}
+	if _, c, err := FeeClientPays.ApplyDust(0, 100, 100, keep); err != nil || c != 0 {
+		t.Fatalf("keep policy must leave a zero payout to the layout, got %d (%v)", c, err)
+	}
+	keepZero := DustPolicy{Action: DustKeepZero}
+	for _, client := range []uint64{100, 101, DustLimit + 99} {
+		if _, c, err := FeeClientPays.ApplyDust(0, client, 100, keepZero); err != nil || c != client-100 {
+			t.Fatalf("keep-zero policy must not apply the dust limit to %d, got %d (%v)", client, c, err)
+		}
+	}
+	if _, _, err := FeeClientPays.ApplyDust(0, 99, 100, keepZero); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds under keep-zero, got %v", err)
+	}
+	if _, c, err := FeeClientPays.ApplyDust(0, 5050, 100, DustPolicy{Action: DustDrop, Limit: 5000}); err != nil || c != 4950 {
+		t.Fatalf("drop policy must leave dust to the layout, got %d (%v)", c, err)
+	}
+	if _, _, err := FeeClientPays.ApplyDust(0, 50, 100, DustPolicy{Action: DustDrop}); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds when the payer cannot cover the fee, got %v", err)
+	}
+}
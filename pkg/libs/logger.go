@@ -0,0 +1,26 @@
+package libs
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// 所有 pool 包共用的日志钩子。默认丢弃全部日志，生产环境不会输出任何内容；
+// 需要调试时通过 SetLogger 注入 slog.Logger，各协议步骤会以 Debug 级别输出结构化事件。
+// 事件中只记录 txid、金额、序列号等元数据，不会记录交易 hex 或签名。
+var logger atomic.Pointer[slog.Logger]
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// SetLogger 设置 pool 包使用的日志器，传入 nil 恢复为静默。
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// Logger 返回当前日志器，未设置时返回丢弃所有输出的日志器。
+func Logger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return discardLogger
+}
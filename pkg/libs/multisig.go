@@ -2,6 +2,7 @@ package libs
 
 import (
 	"errors"
+	"fmt"
 
 	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
 	script "github.com/bsv-blockchain/go-sdk/script"
@@ -75,31 +76,30 @@ func Unlock(privKeys []*ec.PrivateKey, pubKeys []*ec.PublicKey, m int, sigHashFl
 
 // Sign creates an unlocking script for the multisig
 func (ms *MultiSig) Sign(tx *transaction.Transaction, inputIndex uint32) (*script.Script, error) {
+	if int(inputIndex) >= len(tx.Inputs) {
+		return nil, fmt.Errorf("%w: input %d does not exist", ErrInvalidTransaction, inputIndex)
+	}
 	if tx.Inputs[inputIndex].SourceTxOutput() == nil {
-		return nil, transaction.ErrEmptyPreviousTx
+		return nil, fmt.Errorf("%w: %w", ErrMissingSourceOutput, transaction.ErrEmptyPreviousTx)
 	}
 
-
 	preimage, _ := tx.CalcInputPreimage(inputIndex, *ms.SigHashFlag)
 
-
 	if len(preimage) >= 68 {
 		hashPrevouts := preimage[4:36]
 		hashSequence := preimage[36:68]
 		// hashOutputs is located 40 bytes from the end (4 locktime + 4 sighash flag + 32 hashOutputs)
 		hashOutputs := preimage[len(preimage)-40-32 : len(preimage)-40]
-	_ = hashPrevouts
-	_ = hashSequence
-	_ = hashOutputs
-
-
+		_ = hashPrevouts
+		_ = hashSequence
+		_ = hashOutputs
 
 	}
 
 	sh, err := tx.CalcInputSignatureHash(inputIndex, *ms.SigHashFlag)
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: calc sighash: %w", ErrInvalidTransaction, err)
 	}
 
 	// Create unlocking script
@@ -108,11 +108,15 @@ func (ms *MultiSig) Sign(tx *transaction.Transaction, inputIndex uint32) (*scrip
 	// Add OP_0 for the bug in CHECKMULTISIG
 	s.AppendOpcodes(script.Op0)
 
+	if len(ms.PrivateKeys) < ms.M {
+		return nil, ErrNoPrivateKeys
+	}
+
 	// Sign with required number of private keys
 	for i := 0; i < ms.M; i++ {
 		sig, err := ms.PrivateKeys[i].Sign(sh)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: %w", ErrSigningFailed, err)
 		}
 
 		sigBuf := make([]byte, 0)
@@ -129,31 +133,30 @@ func (ms *MultiSig) Sign(tx *transaction.Transaction, inputIndex uint32) (*scrip
 
 // 分别签名
 func (ms *MultiSig) SignOne(tx *transaction.Transaction, inputIndex uint32, privateKey *ec.PrivateKey) (*[]byte, error) {
+	if int(inputIndex) >= len(tx.Inputs) {
+		return nil, fmt.Errorf("%w: input %d does not exist", ErrInvalidTransaction, inputIndex)
+	}
 	if tx.Inputs[inputIndex].SourceTxOutput() == nil {
-		return nil, transaction.ErrEmptyPreviousTx
+		return nil, fmt.Errorf("%w: %w", ErrMissingSourceOutput, transaction.ErrEmptyPreviousTx)
 	}
 
-
 	preimage, _ := tx.CalcInputPreimage(inputIndex, *ms.SigHashFlag)
 
-
 	if len(preimage) >= 68 {
 		hashPrevouts := preimage[4:36]
 		hashSequence := preimage[36:68]
 		// hashOutputs is located 40 bytes from the end (4 locktime + 4 sighash flag + 32 hashOutputs)
 		hashOutputs := preimage[len(preimage)-40-32 : len(preimage)-40]
-	_ = hashPrevouts
-	_ = hashSequence
-	_ = hashOutputs
-
-
+		_ = hashPrevouts
+		_ = hashSequence
+		_ = hashOutputs
 
 	}
 
 	sh, err := tx.CalcInputSignatureHash(inputIndex, *ms.SigHashFlag)
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: calc sighash: %w", ErrInvalidTransaction, err)
 	}
 
 	// Create unlocking script
@@ -164,9 +167,12 @@ func (ms *MultiSig) SignOne(tx *transaction.Transaction, inputIndex uint32, priv
 
 	// Sign with required number of private keys
 	// for i := 0; i < ms.M; i++ {
+	if privateKey == nil {
+		return nil, ErrNoPrivateKeys
+	}
 	sig, err := privateKey.Sign(sh)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrSigningFailed, err)
 	}
 
 	sigBuf := make([]byte, 0)
@@ -210,6 +216,15 @@ func FakeSign(m uint32) (*script.Script, error) {
 	return s, nil
 }
 
+// FakeP2PKHSign 创建一个假的 P2PKH 解锁脚本（签名 + 压缩公钥），方便计算长度
+func FakeP2PKHSign() *script.Script {
+	s := script.NewFromBytes([]byte{})
+	// 72字节最大DER签名 + 1字节SigHashFlag，以及33字节压缩公钥
+	_ = s.AppendPushData(make([]byte, 73))
+	_ = s.AppendPushData(make([]byte, 33))
+	return s
+}
+
 func BuildSignScript(signs *[][]byte) (*script.Script, error) {
 	// 创建解锁脚本
 	s := script.NewFromBytes([]byte{})
@@ -0,0 +1,156 @@
+package libs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	base58 "github.com/bsv-blockchain/go-sdk/compat/base58"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+)
+
+// Network 表示交易所在的网络。零值为主网，与 isMain 省略时默认主网的约定一致。
+type Network uint8
+
+const (
+	Mainnet Network = iota
+	Testnet
+	Regtest
+	STN
+)
+
+const (
+	mainnetP2PKHPrefix byte = 0x00
+	testnetP2PKHPrefix byte = 0x6f // testnet、regtest 与 STN 共用
+)
+
+// NetworkFromIsMain 把旧接口的 isMain 参数转换为 Network。
+func NetworkFromIsMain(isMain bool) Network {
+	if isMain {
+		return Mainnet
+	}
+	return Testnet
+}
+
+// ParseNetwork 解析网络名称，支持 main/mainnet、test/testnet、regtest 与 stn。
+func ParseNetwork(name string) (Network, error) {
+	switch strings.ToLower(name) {
+	case "main", "mainnet":
+		return Mainnet, nil
+	case "test", "testnet":
+		return Testnet, nil
+	case "regtest":
+		return Regtest, nil
+	case "stn":
+		return STN, nil
+	}
+	return 0, fmt.Errorf("%w: unknown network %q", ErrInvalidParams, name)
+}
+
+func (n Network) String() string {
+	switch n {
+	case Mainnet:
+		return "mainnet"
+	case Testnet:
+		return "testnet"
+	case Regtest:
+		return "regtest"
+	case STN:
+		return "stn"
+	}
+	return fmt.Sprintf("network(%d)", uint8(n))
+}
+
+// IsMain 返回是否为主网，用于调用仍接受 isMain 参数的函数。
+func (n Network) IsMain() bool {
+	return n == Mainnet
+}
+
+// Validate 检查 Network 是否为已知取值。
+func (n Network) Validate() error {
+	if n > STN {
+		return fmt.Errorf("%w: unknown network %d", ErrInvalidParams, uint8(n))
+	}
+	return nil
+}
+
+func (n Network) p2pkhPrefix() byte {
+	if n == Mainnet {
+		return mainnetP2PKHPrefix
+	}
+	return testnetP2PKHPrefix
+}
+
+// Address 从公钥派生该网络下的 P2PKH 地址。
+func (n Network) Address(pubKey *ec.PublicKey) (*script.Address, error) {
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+	return script.NewAddressFromPublicKey(pubKey, n.IsMain())
+}
+
+// ParseAddress 解析 P2PKH 地址，并拒绝属于其他网络的地址。
+func (n Network) ParseAddress(address string) (*script.Address, error) {
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+	decoded, err := base58.Decode(address)
+	if err != nil || len(decoded) != 25 {
+		return nil, fmt.Errorf("%w: malformed address %q", ErrInvalidParams, address)
+	}
+	if decoded[0] != n.p2pkhPrefix() {
+		return nil, fmt.Errorf("%w: address %s is not a %s address", ErrNetworkMismatch, address, n)
+	}
+	addr, err := script.NewAddressFromString(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+	}
+	if ok, err := script.ValidateAddress(address); !ok || err != nil {
+		return nil, fmt.Errorf("%w: invalid address checksum %q", ErrInvalidParams, address)
+	}
+	return addr, nil
+}
+
+// ValidateUTXOs 检查 UTXO 列表：txid 必须是 32 字节 hex、金额为正、不能重复；
+// 若 UTXO 带有 Address，则该地址必须属于当前网络且等于 owner 对应的地址。
+func (n Network) ValidateUTXOs(utxos []UTXO, owner *ec.PublicKey) error {
+	if err := n.Validate(); err != nil {
+		return err
+	}
+	var ownerAddress *script.Address
+	if owner != nil {
+		addr, err := n.Address(owner)
+		if err != nil {
+			return err
+		}
+		ownerAddress = addr
+	}
+
+	seen := make(map[string]struct{}, len(utxos))
+	for i, u := range utxos {
+		if raw, err := hex.DecodeString(u.TxID); err != nil || len(raw) != 32 {
+			return fmt.Errorf("%w: utxo %d has malformed txid %q", ErrInvalidParams, i, u.TxID)
+		}
+		if u.Value == 0 {
+			return fmt.Errorf("%w: utxo %d has zero value", ErrInvalidParams, i)
+		}
+		key := fmt.Sprintf("%s:%d", strings.ToLower(u.TxID), u.Vout)
+		if _, dup := seen[key]; dup {
+			return fmt.Errorf("%w: duplicate utxo %s", ErrInvalidParams, key)
+		}
+		seen[key] = struct{}{}
+
+		if u.Address == "" {
+			continue
+		}
+		addr, err := n.ParseAddress(u.Address)
+		if err != nil {
+			return fmt.Errorf("utxo %d: %w", i, err)
+		}
+		if ownerAddress != nil && addr.AddressString != ownerAddress.AddressString {
+			return fmt.Errorf("%w: utxo %d is locked to %s, not to the signing key %s", ErrInvalidParams, i, addr.AddressString, ownerAddress.AddressString)
+		}
+	}
+	return nil
+}
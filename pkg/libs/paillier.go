@@ -0,0 +1,196 @@
+package libs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// Paillier 加法同态加密，供两方 ECDSA 使用：g = N+1，Enc(m; r) = (1+N)^m · r^N mod N²。
+// 只实现协议需要的部分，不作为通用加密接口导出。
+
+// paillierMinBits 是接受对方 Paillier 模数的最小位数。
+const paillierMinBits = 2048
+
+// paillierKeyProofRounds 是模数正确性证明的轮数；配合小素数筛查，伪造证明的概率低于 2^-128。
+const paillierKeyProofRounds = 11
+
+// paillierSmallPrimeBound 以下的素数都不能整除 N。
+const paillierSmallPrimeBound = 6370
+
+type paillierPublicKey struct {
+	n, n2 *big.Int
+}
+
+type paillierPrivateKey struct {
+	paillierPublicKey
+	phi, mu *big.Int // φ(N) 与 φ(N)⁻¹ mod N
+}
+
+func newPaillierPublicKey(n *big.Int) *paillierPublicKey {
+	return &paillierPublicKey{n: new(big.Int).Set(n), n2: new(big.Int).Mul(n, n)}
+}
+
+// generatePaillierKey 生成两个等长素数构成的 bits 位模数。
+func generatePaillierKey(bits int) (*paillierPrivateKey, error) {
+	for {
+		p, err := rand.Prime(rand.Reader, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := rand.Prime(rand.Reader, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		n := new(big.Int).Mul(p, q)
+		if p.Cmp(q) == 0 || n.BitLen() != bits {
+			continue
+		}
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		return newPaillierPrivateKey(n, phi)
+	}
+}
+
+func newPaillierPrivateKey(n, phi *big.Int) (*paillierPrivateKey, error) {
+	mu := new(big.Int).ModInverse(phi, n)
+	if mu == nil {
+		return nil, fmt.Errorf("%w: paillier modulus shares a factor with phi", ErrInvalidParams)
+	}
+	return &paillierPrivateKey{paillierPublicKey: *newPaillierPublicKey(n), phi: new(big.Int).Set(phi), mu: mu}, nil
+}
+
+// encrypt 用随机数 r 加密 m，返回密文与 r。
+func (pk *paillierPublicKey) encrypt(m *big.Int) (*big.Int, *big.Int, error) {
+	r, err := randomUnit(pk.n)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pk.encryptWithNonce(m, r), r, nil
+}
+
+func (pk *paillierPublicKey) encryptWithNonce(m, r *big.Int) *big.Int {
+	// (1+N)^m = 1 + m·N mod N²
+	gm := new(big.Int).Mul(new(big.Int).Mod(m, pk.n), pk.n)
+	gm.Add(gm, one)
+	c := new(big.Int).Exp(r, pk.n, pk.n2)
+	c.Mul(c, gm)
+	return c.Mod(c, pk.n2)
+}
+
+// add 返回明文之和的密文。
+func (pk *paillierPublicKey) add(c1, c2 *big.Int) *big.Int {
+	c := new(big.Int).Mul(c1, c2)
+	return c.Mod(c, pk.n2)
+}
+
+// mul 返回明文乘以 k 的密文。
+func (pk *paillierPublicKey) mul(c, k *big.Int) *big.Int {
+	return new(big.Int).Exp(c, k, pk.n2)
+}
+
+// validCiphertext 检查 c 属于 Z*_{N²}。
+func (pk *paillierPublicKey) validCiphertext(c *big.Int) bool {
+	return c != nil && c.Sign() > 0 && c.Cmp(pk.n2) < 0 && new(big.Int).GCD(nil, nil, c, pk.n).Cmp(one) == 0
+}
+
+func (sk *paillierPrivateKey) decrypt(c *big.Int) *big.Int {
+	// L(c^φ mod N²) · φ⁻¹ mod N，其中 L(u) = (u-1)/N
+	u := new(big.Int).Exp(c, sk.phi, sk.n2)
+	u.Sub(u, one)
+	u.Div(u, sk.n)
+	u.Mul(u, sk.mu)
+	return u.Mod(u, sk.n)
+}
+
+// proveKey 证明 gcd(N, φ(N)) = 1：对由 N 派生的 ρ_i 给出 N 次方根 σ_i = ρ_i^(N⁻¹ mod φ(N))。
+func (sk *paillierPrivateKey) proveKey() ([]*big.Int, error) {
+	d := new(big.Int).ModInverse(sk.n, sk.phi)
+	if d == nil {
+		return nil, fmt.Errorf("%w: paillier modulus is not invertible mod phi", ErrInvalidParams)
+	}
+	roots := make([]*big.Int, paillierKeyProofRounds)
+	for i := range roots {
+		roots[i] = new(big.Int).Exp(paillierKeyChallenge(sk.n, i), d, sk.n)
+	}
+	return roots, nil
+}
+
+// verifyKey 检查模数位数、小素数因子与 proveKey 给出的 N 次方根。
+func (pk *paillierPublicKey) verifyKey(roots []*big.Int) error {
+	if pk.n.BitLen() < paillierMinBits {
+		return fmt.Errorf("%w: paillier modulus has %d bits, need %d", ErrInvalidProof, pk.n.BitLen(), paillierMinBits)
+	}
+	for _, p := range smallPrimes(paillierSmallPrimeBound) {
+		if new(big.Int).Mod(pk.n, big.NewInt(p)).Sign() == 0 {
+			return fmt.Errorf("%w: paillier modulus has small factor %d", ErrInvalidProof, p)
+		}
+	}
+	if len(roots) != paillierKeyProofRounds {
+		return fmt.Errorf("%w: paillier key proof has %d roots, need %d", ErrInvalidProof, len(roots), paillierKeyProofRounds)
+	}
+	for i, root := range roots {
+		if root == nil || root.Sign() <= 0 || root.Cmp(pk.n) >= 0 {
+			return fmt.Errorf("%w: paillier key proof root %d out of range", ErrInvalidProof, i)
+		}
+		if new(big.Int).Exp(root, pk.n, pk.n).Cmp(paillierKeyChallenge(pk.n, i)) != 0 {
+			return fmt.Errorf("%w: paillier key proof root %d", ErrInvalidProof, i)
+		}
+	}
+	return nil
+}
+
+// paillierKeyChallenge 由 N 与轮次确定性地派生 Z*_N 中的元素。
+func paillierKeyChallenge(n *big.Int, round int) *big.Int {
+	size := (n.BitLen() + 7) / 8
+	for counter := uint32(0); ; counter++ {
+		buf := make([]byte, 0, size+sha256.Size)
+		for block := uint32(0); len(buf) < size; block++ {
+			h := sha256.New()
+			h.Write([]byte("KeymasterMultisigPool/paillier-key"))
+			h.Write(n.Bytes())
+			var idx [12]byte
+			binary.BigEndian.PutUint32(idx[0:], uint32(round))
+			binary.BigEndian.PutUint32(idx[4:], counter)
+			binary.BigEndian.PutUint32(idx[8:], block)
+			h.Write(idx[:])
+			buf = h.Sum(buf)
+		}
+		rho := new(big.Int).SetBytes(buf[:size])
+		rho.Mod(rho, n)
+		if rho.Sign() > 0 && new(big.Int).GCD(nil, nil, rho, n).Cmp(one) == 0 {
+			return rho
+		}
+	}
+}
+
+// randomUnit 返回 Z*_n 中的随机元素。
+func randomUnit(n *big.Int) (*big.Int, error) {
+	for {
+		r, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		if r.Sign() > 0 && new(big.Int).GCD(nil, nil, r, n).Cmp(one) == 0 {
+			return r, nil
+		}
+	}
+}
+
+func smallPrimes(bound int64) []int64 {
+	composite := make([]bool, bound)
+	var primes []int64
+	for i := int64(2); i < bound; i++ {
+		if composite[i] {
+			continue
+		}
+		primes = append(primes, i)
+		for j := i * i; j < bound; j += i {
+			composite[j] = true
+		}
+	}
+	return primes
+}
+
+var one = big.NewInt(1)
@@ -0,0 +1,97 @@
+package libs
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// CheckPayoutOutputs 校验交易只支付到开池时声明的支付脚本：除末尾的承诺输出外，每个输出都必须使用 payoutScripts 中的脚本，
+// 每个脚本至多出现一次且保持 payoutScripts 中的顺序，输出总额不得超过 maxTotal。
+func CheckPayoutOutputs(t *transaction.Transaction, payoutScripts []*script.Script, maxTotal uint64) error {
+	if t == nil {
+		return fmt.Errorf("%w: nil transaction", ErrInvalidTransaction)
+	}
+	if err := checkCommitmentOutput(t); err != nil {
+		return err
+	}
+	want := 0
+	var total uint64
+	for i, out := range PayoutOutputs(t) {
+		for want < len(payoutScripts) && !bytes.Equal(payoutScripts[want].Bytes(), out.LockingScript.Bytes()) {
+			want++
+		}
+		if want == len(payoutScripts) {
+			return fmt.Errorf("%w: locking script of output %d is not a declared payout", ErrTransitionMismatch, i)
+		}
+		want++
+		total += out.Satoshis
+	}
+	if total > maxTotal {
+		return fmt.Errorf("output total: %w", &InsufficientFundsError{Need: total, Have: maxTotal})
+	}
+	return nil
+}
+
+// SplitPayouts 按固定顺序（双端池 [服务器, 客户端]，三方池 [B, A]）返回 B-Tx 中各方的支付金额与锁定脚本。
+// 支付输出齐全时按位置读取；金额为 0 的支付被粉尘策略省略时，用 defaults（各方的支付脚本）识别剩下的输出，
+// 被省略的一方金额为 0、脚本取 defaults 中的对应项。
+func SplitPayouts(t *transaction.Transaction, defaults []*script.Script) ([]uint64, []*script.Script, error) {
+	if t == nil {
+		return nil, nil, fmt.Errorf("%w: nil transaction", ErrInvalidTransaction)
+	}
+	outputs := PayoutOutputs(t)
+	if len(outputs) == 0 || len(outputs) > len(defaults) {
+		return nil, nil, fmt.Errorf("%w: expected 1 to %d payout outputs, got %d", ErrInvalidTransaction, len(defaults), len(outputs))
+	}
+	amounts := make([]uint64, len(defaults))
+	scripts := make([]*script.Script, len(defaults))
+	if len(outputs) == len(defaults) {
+		for i, out := range outputs {
+			amounts[i], scripts[i] = out.Satoshis, out.LockingScript
+		}
+		return amounts, scripts, nil
+	}
+	copy(scripts, defaults)
+	want := 0
+	for i, out := range outputs {
+		for want < len(defaults) && !bytes.Equal(defaults[want].Bytes(), out.LockingScript.Bytes()) {
+			want++
+		}
+		if want == len(defaults) {
+			return nil, nil, fmt.Errorf("%w: locking script of output %d is not a known payout", ErrTransitionMismatch, i)
+		}
+		amounts[want] = out.Satoshis
+		want++
+	}
+	return amounts, scripts, nil
+}
+
+// VerifyOpeningSpend 是签名初始 B-Tx 前对 A-Tx 的接受检查：baseTx 的第 poolVout 个输出必须由 poolScript 锁定，
+// spendTx 只有一个输入且花费该输出，输出满足 CheckPayoutOutputs（总额不超过多签金额）。
+// 返回多签输出金额。
+func VerifyOpeningSpend(baseTx, spendTx *transaction.Transaction, poolVout uint32, poolScript *script.Script, payoutScripts []*script.Script) (uint64, error) {
+	if baseTx == nil || spendTx == nil {
+		return 0, fmt.Errorf("%w: nil transaction", ErrInvalidTransaction)
+	}
+	if int(poolVout) >= len(baseTx.Outputs) {
+		return 0, fmt.Errorf("%w: base tx has no output %d", ErrInvalidTransaction, poolVout)
+	}
+	poolOutput := baseTx.Outputs[poolVout]
+	if !bytes.Equal(poolOutput.LockingScript.Bytes(), poolScript.Bytes()) {
+		return 0, fmt.Errorf("%w: base tx output %d is not the pool script", ErrTransitionMismatch, poolVout)
+	}
+	if len(spendTx.Inputs) != 1 {
+		return 0, fmt.Errorf("%w: expected exactly one input, got %d", ErrInvalidTransaction, len(spendTx.Inputs))
+	}
+	in := spendTx.Inputs[0]
+	if in.SourceTXID == nil || !in.SourceTXID.IsEqual(baseTx.TxID()) || in.SourceTxOutIndex != poolVout {
+		return 0, fmt.Errorf("%w: spend tx does not spend pool output %d", ErrTransitionMismatch, poolVout)
+	}
+	if err := CheckPayoutOutputs(spendTx, payoutScripts, poolOutput.Satoshis); err != nil {
+		return 0, err
+	}
+	return poolOutput.Satoshis, nil
+}
@@ -0,0 +1,266 @@
+package libs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	bip32 "github.com/bsv-blockchain/go-sdk/compat/bip32"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+)
+
+// 支付地址轮换：每个池、每次换池都从支付主密钥派生一个新的支付密钥，
+// 避免观察者通过相同的结算地址把同一方的多个池关联起来。
+// 派生路径为 <Pool>/<Generation>，均为非硬化序号，钱包只持有扩展公钥（xpub）也能派生地址并扫描结算。
+
+// PayoutPath 是支付密钥相对支付主密钥的派生路径。
+type PayoutPath struct {
+	Pool       uint32 `json:"pool"`       // 池序号，每开一个池加 1
+	Generation uint32 `json:"generation"` // 换池代数，开池为 0，每次换池加 1
+}
+
+func (p PayoutPath) String() string {
+	return fmt.Sprintf("%d/%d", p.Pool, p.Generation)
+}
+
+// Next 返回换池后后继池使用的路径。
+func (p PayoutPath) Next() PayoutPath {
+	return PayoutPath{Pool: p.Pool, Generation: p.Generation + 1}
+}
+
+// Validate 检查路径只包含非硬化序号。
+func (p PayoutPath) Validate() error {
+	if p.Pool >= bip32.HardenedKeyStart || p.Generation >= bip32.HardenedKeyStart {
+		return fmt.Errorf("%w: payout path %s must not be hardened", ErrInvalidParams, p)
+	}
+	return nil
+}
+
+// ParsePayoutPath 解析 String 输出的 "<Pool>/<Generation>" 路径。
+func ParsePayoutPath(s string) (PayoutPath, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return PayoutPath{}, fmt.Errorf("%w: invalid payout path %q", ErrInvalidParams, s)
+	}
+	pool, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return PayoutPath{}, fmt.Errorf("%w: invalid payout path %q", ErrInvalidParams, s)
+	}
+	generation, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return PayoutPath{}, fmt.Errorf("%w: invalid payout path %q", ErrInvalidParams, s)
+	}
+	path := PayoutPath{Pool: uint32(pool), Generation: uint32(generation)}
+	return path, path.Validate()
+}
+
+// PayoutState 是池状态中记录的支付轮换信息，与 B-Tx 一起持久化，用于之后找回支付私钥。
+type PayoutState struct {
+	Path          PayoutPath `json:"path"`
+	LockingScript string     `json:"locking_script"` // 支付锁定脚本 hex
+}
+
+// Script 解析记录的支付锁定脚本。
+func (s PayoutState) Script() (*script.Script, error) {
+	return script.NewFromHex(s.LockingScript)
+}
+
+// ResolvePayoutScript 返回池参数中声明的支付脚本：只给记录时取记录中的脚本，记录与脚本都给出时两者必须一致。
+func ResolvePayoutScript(state *PayoutState, declared *script.Script) (*script.Script, error) {
+	if state == nil {
+		return declared, nil
+	}
+	if err := state.Path.Validate(); err != nil {
+		return nil, err
+	}
+	recorded, err := state.Script()
+	if err != nil || len(recorded.Bytes()) == 0 {
+		return nil, fmt.Errorf("%w: payout state %s has an invalid locking script", ErrInvalidParams, state.Path)
+	}
+	if declared != nil && !declared.Equals(recorded) {
+		return nil, fmt.Errorf("%w: payout script does not match payout state %s", ErrInvalidParams, state.Path)
+	}
+	return recorded, nil
+}
+
+// CheckPayoutRotation 检查后继池的记录：当前池有记录时后继池也必须有，路径为当前路径的 Next，且不能沿用当前脚本。
+func CheckPayoutRotation(current, next *PayoutState) error {
+	if current == nil {
+		return nil
+	}
+	if next == nil {
+		return fmt.Errorf("%w: payout state %s requires a next state at %s", ErrInvalidParams, current.Path, current.Path.Next())
+	}
+	if next.Path != current.Path.Next() {
+		return fmt.Errorf("%w: next payout path %s, expected %s", ErrInvalidParams, next.Path, current.Path.Next())
+	}
+	if strings.EqualFold(next.LockingScript, current.LockingScript) {
+		return fmt.Errorf("%w: next payout state %s reuses the current locking script", ErrInvalidParams, next.Path)
+	}
+	return nil
+}
+
+// PayoutKeyChain 从支付主密钥派生各池的支付密钥。
+type PayoutKeyChain struct {
+	master *bip32.ExtendedKey
+}
+
+// NewPayoutKeyChain 从 base58 编码的扩展密钥创建支付密钥链；只给扩展公钥时只能派生公钥与地址。
+func NewPayoutKeyChain(extendedKey string) (*PayoutKeyChain, error) {
+	master, err := bip32.NewKeyFromString(extendedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid payout master key: %w", ErrInvalidParams, err)
+	}
+	return &PayoutKeyChain{master: master}, nil
+}
+
+// NewPayoutKeyChainFromKey 用已解析的扩展密钥创建支付密钥链。
+func NewPayoutKeyChainFromKey(master *bip32.ExtendedKey) (*PayoutKeyChain, error) {
+	if master == nil {
+		return nil, fmt.Errorf("%w: payout master key is required", ErrInvalidParams)
+	}
+	return &PayoutKeyChain{master: master}, nil
+}
+
+// CanSign 表示密钥链是否持有扩展私钥。
+func (c *PayoutKeyChain) CanSign() bool {
+	return c.master.IsPrivate()
+}
+
+func (c *PayoutKeyChain) derive(path PayoutPath) (*bip32.ExtendedKey, error) {
+	if err := path.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := c.master.Child(path.Pool)
+	if err != nil {
+		return nil, fmt.Errorf("derive payout key %s: %w", path, err)
+	}
+	key, err = key.Child(path.Generation)
+	if err != nil {
+		return nil, fmt.Errorf("derive payout key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// PublicKey 返回路径对应的支付公钥。
+func (c *PayoutKeyChain) PublicKey(path PayoutPath) (*ec.PublicKey, error) {
+	key, err := c.derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return key.ECPubKey()
+}
+
+// PrivateKey 返回路径对应的支付私钥，用于花费结算输出；需要扩展私钥。
+func (c *PayoutKeyChain) PrivateKey(path PayoutPath) (*ec.PrivateKey, error) {
+	if !c.CanSign() {
+		return nil, fmt.Errorf("%w: payout key chain holds no private key", ErrInvalidParams)
+	}
+	key, err := c.derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return key.ECPrivKey()
+}
+
+// LockingScript 返回路径对应的 P2PKH 支付锁定脚本，可直接作为开池时声明的支付脚本。
+func (c *PayoutKeyChain) LockingScript(path PayoutPath) (*script.Script, error) {
+	pub, err := c.PublicKey(path)
+	if err != nil {
+		return nil, err
+	}
+	address, err := script.NewAddressFromPublicKey(pub, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout address: %w", err)
+	}
+	return p2pkh.Lock(address)
+}
+
+// State 返回路径对应的池状态记录。
+func (c *PayoutKeyChain) State(path PayoutPath) (*PayoutState, error) {
+	lockingScript, err := c.LockingScript(path)
+	if err != nil {
+		return nil, err
+	}
+	return &PayoutState{Path: path, LockingScript: hex.EncodeToString(lockingScript.Bytes())}, nil
+}
+
+// Next 核对 state 由本密钥链派生，返回换池后后继池的记录，路径为 state.Path.Next()。
+func (c *PayoutKeyChain) Next(state PayoutState) (*PayoutState, error) {
+	current, err := c.State(state.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(current.LockingScript, state.LockingScript) {
+		return nil, fmt.Errorf("%w: payout state %s was not derived from this key chain", ErrInvalidParams, state.Path)
+	}
+	return c.State(state.Path.Next())
+}
+
+// PayoutMatch 是扫描到的一笔支付到派生地址的输出。
+type PayoutMatch struct {
+	Path     PayoutPath
+	TxID     string
+	Vout     uint32
+	Satoshis uint64
+}
+
+// PayoutScanner 是钱包侧的扫描器：预先派生池序号 [0, Pools)、代数 [0, Generations) 的全部支付脚本，
+// 在给定交易中查找支付到这些脚本的输出。
+type PayoutScanner struct {
+	scripts map[string]PayoutPath
+}
+
+// NewPayoutScanner 为 pools 个池、每池 generations 代派生支付脚本。
+func NewPayoutScanner(chain *PayoutKeyChain, pools, generations uint32) (*PayoutScanner, error) {
+	if chain == nil {
+		return nil, fmt.Errorf("%w: payout key chain is required", ErrInvalidParams)
+	}
+	s := &PayoutScanner{scripts: make(map[string]PayoutPath, int(pools)*int(generations))}
+	for pool := uint32(0); pool < pools; pool++ {
+		for generation := uint32(0); generation < generations; generation++ {
+			path := PayoutPath{Pool: pool, Generation: generation}
+			lockingScript, err := chain.LockingScript(path)
+			if err != nil {
+				return nil, err
+			}
+			s.scripts[string(lockingScript.Bytes())] = path
+		}
+	}
+	return s, nil
+}
+
+// Match 返回锁定脚本对应的派生路径。
+func (s *PayoutScanner) Match(lockingScript *script.Script) (PayoutPath, bool) {
+	if lockingScript == nil {
+		return PayoutPath{}, false
+	}
+	path, ok := s.scripts[string(lockingScript.Bytes())]
+	return path, ok
+}
+
+// Scan 按交易与输出顺序返回所有支付到派生地址的输出。
+func (s *PayoutScanner) Scan(txs ...*transaction.Transaction) []PayoutMatch {
+	var matches []PayoutMatch
+	for _, t := range txs {
+		if t == nil {
+			continue
+		}
+		var txid string
+		for vout, out := range t.Outputs {
+			path, ok := s.Match(out.LockingScript)
+			if !ok {
+				continue
+			}
+			if txid == "" {
+				txid = t.TxID().String()
+			}
+			matches = append(matches, PayoutMatch{Path: path, TxID: txid, Vout: uint32(vout), Satoshis: out.Satoshis})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,57 @@
+package libs
+
+import (
+	"fmt"
+
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// MaxNonFinalSequence 是 B-Tx 仍受 locktime 约束时可用的最大序列号。
+const MaxNonFinalSequence = FinalSequence - 1
+
+// RolloverReason 表示触发换池（rollover）的原因。
+type RolloverReason uint8
+
+const (
+	RolloverNotDue RolloverReason = iota
+	RolloverSequence
+	RolloverExpiry
+)
+
+func (r RolloverReason) String() string {
+	switch r {
+	case RolloverNotDue:
+		return "not-due"
+	case RolloverSequence:
+		return "sequence"
+	case RolloverExpiry:
+		return "expiry"
+	}
+	return fmt.Sprintf("rollover(%d)", uint8(r))
+}
+
+// RolloverPolicy 配置自动换池的阈值，字段为 0 表示不按该条件触发。
+type RolloverPolicy struct {
+	MinSequenceRemaining uint32 // 剩余可用序列号少于该值时触发
+	MinBlocksRemaining   uint32 // 距到期高度的剩余区块数少于该值时触发
+}
+
+// Due 根据最近一次双方签名的 B-Tx 与当前区块高度判断是否需要换池。
+// 两个条件同时满足时优先返回 RolloverSequence。
+func (p RolloverPolicy) Due(latest *transaction.Transaction, currentHeight uint32) RolloverReason {
+	if latest == nil || len(latest.Inputs) == 0 {
+		return RolloverNotDue
+	}
+	if p.MinSequenceRemaining > 0 {
+		sequence := latest.Inputs[0].SequenceNumber
+		if sequence >= MaxNonFinalSequence || MaxNonFinalSequence-sequence < p.MinSequenceRemaining {
+			return RolloverSequence
+		}
+	}
+	if p.MinBlocksRemaining > 0 {
+		if latest.LockTime <= currentHeight || latest.LockTime-currentHeight < p.MinBlocksRemaining {
+			return RolloverExpiry
+		}
+	}
+	return RolloverNotDue
+}
@@ -98,8 +98,8 @@ func (c *ChainUtils) OrganizeUnspent(
 	txSize := tempTx.Size()
 	fee := uint64(float64(txSize) / 1000.0 * float64(c.feeRate))
 
-	if totalValue-fee < standardSatoshi {
-		return nil, 0, fmt.Errorf("not enough balance, need %d, have %d", standardSatoshi, totalValue-fee)
+	if totalValue < standardSatoshi+fee {
+		return nil, 0, &InsufficientFundsError{Need: standardSatoshi + fee, Have: totalValue}
 	}
 
 	// 正式做 tx
@@ -155,7 +155,7 @@ func (c *ChainUtils) OrganizeUnspent(
 	}
 
 	if txHex != thisTx.TxID().String() {
-		return nil, 0, fmt.Errorf("failed to broadcast transaction, txHex: %s, txId: %s", txHex, thisTx.TxID().String())
+		return nil, 0, fmt.Errorf("%w: broadcast returned txid %s, expected %s", ErrInvalidTransaction, txHex, thisTx.TxID().String())
 	}
 
 	retUtxo := &[]chain.UTXO{}
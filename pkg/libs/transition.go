@@ -0,0 +1,126 @@
+package libs
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// FinalSequence 是 nSequence 的最终值，所有输入都为该值时交易不再受 locktime 约束。
+const FinalSequence uint32 = 0xffffffff
+
+// FinalLocktime 是关闭池时 B-Tx 使用的 locktime，只能与 FinalSequence 一起出现。
+const FinalLocktime uint32 = 0xffffffff
+
+// ValidateSpendTransition 校验 B-Tx 从 prev 更新到 next 时只修改了允许变化的字段。
+// 允许变化的只有输出金额、序列号、末尾承诺输出携带的承诺，以及关闭时把 locktime 与序列号同时设为最终值；
+// 输入的 outpoint、输出数量与锁定脚本必须保持不变，输出总额不得增加，序列号必须严格递增。
+func ValidateSpendTransition(prev, next *transaction.Transaction) error {
+	if err := validateSpendInputs(prev, next); err != nil {
+		return err
+	}
+	if len(prev.Outputs) != len(next.Outputs) {
+		return fmt.Errorf("%w: output count %d -> %d", ErrTransitionMismatch, len(prev.Outputs), len(next.Outputs))
+	}
+	for i := range prev.Outputs {
+		if bytes.Equal(prev.Outputs[i].LockingScript.Bytes(), next.Outputs[i].LockingScript.Bytes()) {
+			continue
+		}
+		// 承诺输出只能是最后一个输出，前后都是承诺时允许承诺变化
+		_, prevCommitment := ParseCommitment(prev.Outputs[i].LockingScript)
+		_, nextCommitment := ParseCommitment(next.Outputs[i].LockingScript)
+		if i != len(prev.Outputs)-1 || !prevCommitment || !nextCommitment {
+			return fmt.Errorf("%w: locking script of output %d", ErrTransitionMismatch, i)
+		}
+	}
+	if err := checkCommitmentOutput(next); err != nil {
+		return err
+	}
+	return checkOutputTotal(prev, next)
+}
+
+// validateSpendInputs 校验输入 outpoint 不变，再按 next 是普通更新还是关闭分别校验序列号与 locktime。
+func validateSpendInputs(prev, next *transaction.Transaction) error {
+	if prev == nil || next == nil {
+		return fmt.Errorf("%w: nil transaction", ErrInvalidTransaction)
+	}
+	if len(prev.Inputs) != 1 || len(next.Inputs) != 1 {
+		return fmt.Errorf("%w: expected exactly one input, got %d and %d", ErrInvalidTransaction, len(prev.Inputs), len(next.Inputs))
+	}
+
+	prevIn, nextIn := prev.Inputs[0], next.Inputs[0]
+	if prevIn.SourceTXID == nil || nextIn.SourceTXID == nil ||
+		!prevIn.SourceTXID.IsEqual(nextIn.SourceTXID) || prevIn.SourceTxOutIndex != nextIn.SourceTxOutIndex {
+		return fmt.Errorf("%w: input outpoint", ErrTransitionMismatch)
+	}
+	if IsCloseState(next) {
+		return validateCloseInputs(prev, next)
+	}
+	return validateUpdateInputs(prev, next)
+}
+
+// IsCloseState 报告 t 是否为关闭池的 B-Tx：locktime 或唯一输入的序列号取了最终值。
+// 两者必须同时取最终值，由 validateCloseInputs 校验。
+func IsCloseState(t *transaction.Transaction) bool {
+	return t != nil && (t.LockTime == FinalLocktime || (len(t.Inputs) == 1 && t.Inputs[0].SequenceNumber == FinalSequence))
+}
+
+// validateUpdateInputs 校验普通更新：序列号严格递增且不是 FinalSequence，locktime 保持不变。
+// locktime 改变的更新可能晚于上一状态才能上链（例如 0xffffffff 要到 2106 年），让对方抢先广播旧状态。
+func validateUpdateInputs(prev, next *transaction.Transaction) error {
+	prevSeq, nextSeq := prev.Inputs[0].SequenceNumber, next.Inputs[0].SequenceNumber
+	if nextSeq <= prevSeq {
+		return &SequenceError{Current: prevSeq, Proposed: nextSeq}
+	}
+	if next.LockTime != prev.LockTime {
+		return &LocktimeError{Locktime: next.LockTime, Min: prev.LockTime, Max: prev.LockTime}
+	}
+	return nil
+}
+
+// validateCloseInputs 校验关闭：locktime 为 FinalLocktime 且序列号为 FinalSequence，交易可以立即上链；
+// 只取其中一个最终值的状态要么立即可广播、要么永远无法及时上链，一律拒绝。已经关闭的状态不能再更新。
+func validateCloseInputs(prev, next *transaction.Transaction) error {
+	prevSeq, nextSeq := prev.Inputs[0].SequenceNumber, next.Inputs[0].SequenceNumber
+	if prevSeq == FinalSequence {
+		return &SequenceError{Current: prevSeq, Proposed: nextSeq}
+	}
+	if nextSeq != FinalSequence {
+		// 非最终序列号的更新 locktime 必须保持不变
+		return &LocktimeError{Locktime: next.LockTime, Min: prev.LockTime, Max: prev.LockTime}
+	}
+	if next.LockTime != FinalLocktime {
+		return fmt.Errorf("%w: sequence %d is final, a close must also set locktime %d", ErrInvalidTransaction, nextSeq, FinalLocktime)
+	}
+	return nil
+}
+
+// checkOutputTotal 校验 next 的输出总额不超过 prev。
+func checkOutputTotal(prev, next *transaction.Transaction) error {
+	var prevTotal, nextTotal uint64
+	for _, out := range prev.Outputs {
+		prevTotal += out.Satoshis
+	}
+	for _, out := range next.Outputs {
+		nextTotal += out.Satoshis
+	}
+	if nextTotal > prevTotal {
+		return fmt.Errorf("output total: %w", &InsufficientFundsError{Need: nextTotal, Have: prevTotal})
+	}
+	return nil
+}
+
+// UnsignedBytes 返回去掉所有解锁脚本后的交易序列化结果，不修改原交易。
+// 双方各自重建交易后用它比较，签名进度不同也不影响结果。
+func UnsignedBytes(t *transaction.Transaction) []byte {
+	clone := &transaction.Transaction{Version: t.Version, LockTime: t.LockTime, Outputs: t.Outputs}
+	for _, input := range t.Inputs {
+		clone.Inputs = append(clone.Inputs, &transaction.TransactionInput{
+			SourceTXID:       input.SourceTXID,
+			SourceTxOutIndex: input.SourceTxOutIndex,
+			SequenceNumber:   input.SequenceNumber,
+		})
+	}
+	return clone.Bytes()
+}
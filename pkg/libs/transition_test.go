@@ -0,0 +1,48 @@
+package libs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// 普通更新保持 locktime、序列号递增且非最终；关闭必须同时取 FinalLocktime 与 FinalSequence。
+func TestValidateSpendInputsLocktime(t *testing.T) {
+	txid := chainhash.DoubleHashH([]byte("pool"))
+	state := func(locktime, sequence uint32) *transaction.Transaction {
+		t := transaction.NewTransaction()
+		t.LockTime = locktime
+		t.AddInput(&transaction.TransactionInput{SourceTXID: &txid, SequenceNumber: sequence})
+		return t
+	}
+	prev := state(800000, 1)
+
+	cases := []struct {
+		name string
+		next *transaction.Transaction
+		want error
+	}{
+		{"update", state(800000, 2), nil},
+		{"close", state(FinalLocktime, FinalSequence), nil},
+		{"final locktime without final sequence", state(FinalLocktime, 2), ErrLocktimeOutOfRange},
+		{"earlier locktime", state(799000, 2), ErrLocktimeOutOfRange},
+		{"final sequence without final locktime", state(800000, FinalSequence), ErrInvalidTransaction},
+		{"sequence regression", state(800000, 1), ErrSequenceRegression},
+	}
+	for _, c := range cases {
+		err := validateSpendInputs(prev, c.next)
+		if c.want == nil && err != nil {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		if c.want != nil && !errors.Is(err, c.want) {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+
+	// 关闭后不能再有新状态
+	if err := validateSpendInputs(state(FinalLocktime, FinalSequence), state(FinalLocktime, FinalSequence)); !errors.Is(err, ErrSequenceRegression) {
+		t.Fatalf("expected ErrSequenceRegression after close, got %v", err)
+	}
+}
@@ -0,0 +1,533 @@
+package libs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sync"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+)
+
+// 两方 ECDSA（Lindell 2017）：私钥 x = x1·x2 mod n 由服务器（x1，同时持有 Paillier 私钥）与客户端（x2）分持，
+// 任何一方都不知道 x。联合公钥 Q = x1·x2·G 是普通的 secp256k1 公钥，池输出与 B-Tx 输入都是普通 P2PKH。
+//
+// 密钥生成（一个来回）：
+//  1. 服务器 NewTwoPartyKeyGen，发出 Offer：Q1 及其 Schnorr 证明、Paillier 模数及其正确性证明、
+//     Enc(x1) 及其与 Q1 一致且不超范围的证明。
+//  2. 客户端 AcceptTwoPartyKeyGen 验证全部证明，回复 Q2 及其 Schnorr 证明，得到 TwoPartyClientShare。
+//  3. 服务器 Complete 验证回复，得到 TwoPartyServerShare。双方算出相同的联合公钥。
+//
+// 签名（两轮）：
+//  1. 服务器 NewSigningSession，发出 nonce R1 = k1·G 及其证明。nonce 可以提前发出，例如附在上一次更新的回复里。
+//  2. 客户端 SignPartial：选 k2，用 Enc(x1) 同态算出 Enc(k2⁻¹·(m + r·x1·x2) + ρ·n)，连同 R2 = k2·G 发回。
+//  3. 服务器 Complete 解密并乘以 k1⁻¹ 得到完整签名，验证通过后才返回。
+//
+// 每个签名会话只能完成一次：同一个 k1 签两条消息会让服务器算出完整私钥。
+
+// twoPartyRangeSlack 是 Enc(x1) 范围证明的统计隐藏参数，证明只保证 |x1| < n·2^40。
+const twoPartyRangeSlack = 40
+
+// twoPartyRangeRounds 是 Enc(x1) 范围证明的二元挑战轮数。
+const twoPartyRangeRounds = 128
+
+// DLogProof 是离散对数知识的非交互 Schnorr 证明：Commitment = a·G，Response = a + e·x mod n，
+// 挑战 e 由上下文标签、公钥与 Commitment 哈希得到。
+type DLogProof struct {
+	Commitment *ec.PublicKey `json:"commitment"`
+	Response   *big.Int      `json:"response"`
+}
+
+// PaillierShareProof 证明 Paillier 密文加密的正是公钥份额的离散对数，且绝对值小于 n·2^40，
+// 保证客户端签名时的同态运算不会在 N 上回绕。第 i 轮的挑战位为 0 时公开 (α_i, β_i)，为 1 时公开 (α_i + x, β_i·r)。
+type PaillierShareProof struct {
+	Ciphertexts []*big.Int      `json:"ciphertexts"` // Enc(α_i; β_i)
+	Points      []*ec.PublicKey `json:"points"`      // α_i·G
+	Values      []*big.Int      `json:"values"`
+	Nonces      []*big.Int      `json:"nonces"`
+}
+
+// TwoPartyKeyGenOffer 是服务器发出的密钥生成消息。
+type TwoPartyKeyGenOffer struct {
+	PublicShare     *ec.PublicKey       `json:"public_share"` // Q1 = x1·G
+	ShareProof      *DLogProof          `json:"share_proof"`
+	PaillierN       *big.Int            `json:"paillier_n"`
+	PaillierProof   []*big.Int          `json:"paillier_proof"`
+	EncryptedShare  *big.Int            `json:"encrypted_share"` // Enc(x1)
+	EncryptionProof *PaillierShareProof `json:"encryption_proof"`
+}
+
+// TwoPartyKeyGenReply 是客户端回复的密钥生成消息。
+type TwoPartyKeyGenReply struct {
+	PublicShare *ec.PublicKey `json:"public_share"` // Q2 = x2·G
+	ShareProof  *DLogProof    `json:"share_proof"`
+}
+
+// TwoPartyServerShare 是服务器保存的密钥份额，可 JSON 序列化后持久化。
+type TwoPartyServerShare struct {
+	Secret            *big.Int      `json:"secret"` // x1
+	PaillierN         *big.Int      `json:"paillier_n"`
+	PaillierPhi       *big.Int      `json:"paillier_phi"`
+	ClientPublicShare *ec.PublicKey `json:"client_public_share"`
+	PublicKey         *ec.PublicKey `json:"public_key"` // 联合公钥
+}
+
+// TwoPartyClientShare 是客户端保存的密钥份额，可 JSON 序列化后持久化。
+type TwoPartyClientShare struct {
+	Secret            *big.Int      `json:"secret"` // x2
+	PaillierN         *big.Int      `json:"paillier_n"`
+	EncryptedShare    *big.Int      `json:"encrypted_share"`
+	ServerPublicShare *ec.PublicKey `json:"server_public_share"`
+	PublicKey         *ec.PublicKey `json:"public_key"` // 联合公钥
+}
+
+// TwoPartyNonce 是签名第一轮服务器发出的 nonce。
+type TwoPartyNonce struct {
+	Point *ec.PublicKey `json:"point"` // R1 = k1·G
+	Proof *DLogProof    `json:"proof"`
+}
+
+// TwoPartyPartialSignature 是签名第二轮客户端发回的部分签名。
+type TwoPartyPartialSignature struct {
+	Point      *ec.PublicKey `json:"point"` // R2 = k2·G
+	Proof      *DLogProof    `json:"proof"`
+	Ciphertext *big.Int      `json:"ciphertext"`
+}
+
+// TwoPartyKeyGen 是服务器一侧进行中的密钥生成。
+type TwoPartyKeyGen struct {
+	secret   *big.Int
+	paillier *paillierPrivateKey
+	offer    *TwoPartyKeyGenOffer
+}
+
+// NewTwoPartyKeyGen 生成服务器份额 x1 与 Paillier 密钥，并准备 Offer。
+func NewTwoPartyKeyGen() (*TwoPartyKeyGen, error) {
+	x1, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	paillier, err := generatePaillierKey(paillierMinBits)
+	if err != nil {
+		return nil, fmt.Errorf("generate paillier key: %w", err)
+	}
+	q1 := scalarBaseMult(x1)
+	shareProof, err := proveDLog(keyGenServerLabel(paillier.n), x1, q1)
+	if err != nil {
+		return nil, err
+	}
+	keyProof, err := paillier.proveKey()
+	if err != nil {
+		return nil, err
+	}
+	ckey, r, err := paillier.encrypt(x1)
+	if err != nil {
+		return nil, err
+	}
+	encryptionProof, err := provePaillierShare(&paillier.paillierPublicKey, ckey, x1, r, q1)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoPartyKeyGen{
+		secret:   x1,
+		paillier: paillier,
+		offer: &TwoPartyKeyGenOffer{
+			PublicShare:     q1,
+			ShareProof:      shareProof,
+			PaillierN:       new(big.Int).Set(paillier.n),
+			PaillierProof:   keyProof,
+			EncryptedShare:  ckey,
+			EncryptionProof: encryptionProof,
+		},
+	}, nil
+}
+
+// Offer 返回发给客户端的密钥生成消息。
+func (g *TwoPartyKeyGen) Offer() *TwoPartyKeyGenOffer {
+	return g.offer
+}
+
+// Complete 验证客户端的回复并返回服务器份额。
+func (g *TwoPartyKeyGen) Complete(reply *TwoPartyKeyGenReply) (*TwoPartyServerShare, error) {
+	if reply == nil || !validPoint(reply.PublicShare) {
+		return nil, fmt.Errorf("%w: client public share is required", ErrInvalidParams)
+	}
+	if err := reply.ShareProof.verify(keyGenClientLabel(g.offer.PublicShare), reply.PublicShare); err != nil {
+		return nil, fmt.Errorf("client public share: %w", err)
+	}
+	share := &TwoPartyServerShare{
+		Secret:            new(big.Int).Set(g.secret),
+		PaillierN:         new(big.Int).Set(g.paillier.n),
+		PaillierPhi:       new(big.Int).Set(g.paillier.phi),
+		ClientPublicShare: reply.PublicShare,
+		PublicKey:         reply.PublicShare.Mul(g.secret),
+	}
+	Logger().Debug("libs: two-party key generated", "role", PartyServer, "public_key", share.PublicKey.ToDERHex())
+	return share, nil
+}
+
+// AcceptTwoPartyKeyGen 由客户端验证服务器的 Offer，生成客户端份额 x2 并返回回复消息。
+func AcceptTwoPartyKeyGen(offer *TwoPartyKeyGenOffer) (*TwoPartyClientShare, *TwoPartyKeyGenReply, error) {
+	if offer == nil || !validPoint(offer.PublicShare) || offer.PaillierN == nil || offer.EncryptedShare == nil {
+		return nil, nil, fmt.Errorf("%w: incomplete key generation offer", ErrInvalidParams)
+	}
+	paillier := newPaillierPublicKey(offer.PaillierN)
+	if err := offer.ShareProof.verify(keyGenServerLabel(paillier.n), offer.PublicShare); err != nil {
+		return nil, nil, fmt.Errorf("server public share: %w", err)
+	}
+	if err := paillier.verifyKey(offer.PaillierProof); err != nil {
+		return nil, nil, err
+	}
+	if !paillier.validCiphertext(offer.EncryptedShare) {
+		return nil, nil, fmt.Errorf("%w: encrypted share is not a paillier ciphertext", ErrInvalidProof)
+	}
+	if err := offer.EncryptionProof.verify(paillier, offer.EncryptedShare, offer.PublicShare); err != nil {
+		return nil, nil, err
+	}
+
+	x2, err := randomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+	q2 := scalarBaseMult(x2)
+	proof, err := proveDLog(keyGenClientLabel(offer.PublicShare), x2, q2)
+	if err != nil {
+		return nil, nil, err
+	}
+	share := &TwoPartyClientShare{
+		Secret:            x2,
+		PaillierN:         new(big.Int).Set(paillier.n),
+		EncryptedShare:    new(big.Int).Set(offer.EncryptedShare),
+		ServerPublicShare: offer.PublicShare,
+		PublicKey:         offer.PublicShare.Mul(x2),
+	}
+	Logger().Debug("libs: two-party key generated", "role", PartyClient, "public_key", share.PublicKey.ToDERHex())
+	return share, &TwoPartyKeyGenReply{PublicShare: q2, ShareProof: proof}, nil
+}
+
+// Validate 检查服务器份额的字段完整且与联合公钥一致。
+func (s *TwoPartyServerShare) Validate() error {
+	if s == nil || !validScalar(s.Secret) || s.PaillierN == nil || s.PaillierPhi == nil ||
+		!validPoint(s.ClientPublicShare) || !validPoint(s.PublicKey) {
+		return fmt.Errorf("%w: incomplete server share", ErrInvalidParams)
+	}
+	if !s.ClientPublicShare.Mul(s.Secret).IsEqual(s.PublicKey) {
+		return fmt.Errorf("%w: server share does not match the joint public key", ErrInvalidParams)
+	}
+	return nil
+}
+
+// Validate 检查客户端份额的字段完整且与联合公钥一致。
+func (s *TwoPartyClientShare) Validate() error {
+	if s == nil || !validScalar(s.Secret) || s.PaillierN == nil || s.EncryptedShare == nil ||
+		!validPoint(s.ServerPublicShare) || !validPoint(s.PublicKey) {
+		return fmt.Errorf("%w: incomplete client share", ErrInvalidParams)
+	}
+	if !s.ServerPublicShare.Mul(s.Secret).IsEqual(s.PublicKey) {
+		return fmt.Errorf("%w: client share does not match the joint public key", ErrInvalidParams)
+	}
+	return nil
+}
+
+// TwoPartySigningSession 是服务器一侧的单次签名会话，持有 k1，只能完成一次。
+type TwoPartySigningSession struct {
+	mu       sync.Mutex
+	share    *TwoPartyServerShare
+	paillier *paillierPrivateKey
+	nonce    *big.Int
+	point    *ec.PublicKey
+}
+
+// NewSigningSession 开始一次签名：生成 k1 并返回发给客户端的 nonce。
+func (s *TwoPartyServerShare) NewSigningSession() (*TwoPartySigningSession, *TwoPartyNonce, error) {
+	if err := s.Validate(); err != nil {
+		return nil, nil, err
+	}
+	paillier, err := newPaillierPrivateKey(s.PaillierN, s.PaillierPhi)
+	if err != nil {
+		return nil, nil, err
+	}
+	k1, err := randomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+	r1 := scalarBaseMult(k1)
+	proof, err := proveDLog(signServerLabel(s.PublicKey), k1, r1)
+	if err != nil {
+		return nil, nil, err
+	}
+	session := &TwoPartySigningSession{share: s, paillier: paillier, nonce: k1, point: r1}
+	return session, &TwoPartyNonce{Point: r1, Proof: proof}, nil
+}
+
+// Complete 用客户端的部分签名算出 digest 的完整签名（low-S），验证通过后返回。
+// 无论成功与否，会话都会作废。
+func (ss *TwoPartySigningSession) Complete(digest []byte, partial *TwoPartyPartialSignature) (*ec.Signature, error) {
+	ss.mu.Lock()
+	k1 := ss.nonce
+	ss.nonce = nil
+	ss.mu.Unlock()
+	if k1 == nil {
+		return nil, fmt.Errorf("%w: signing session already used", ErrInvalidState)
+	}
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("%w: digest must be %d bytes", ErrInvalidParams, sha256.Size)
+	}
+	if partial == nil || !validPoint(partial.Point) {
+		return nil, fmt.Errorf("%w: client nonce is required", ErrInvalidParams)
+	}
+	if err := partial.Proof.verify(signClientLabel(ss.share.PublicKey, ss.point, digest), partial.Point); err != nil {
+		return nil, fmt.Errorf("client nonce: %w", err)
+	}
+	if !ss.paillier.validCiphertext(partial.Ciphertext) {
+		return nil, fmt.Errorf("%w: partial signature is not a paillier ciphertext", ErrInvalidParams)
+	}
+
+	n := ec.S256().N
+	r := new(big.Int).Mod(partial.Point.Mul(k1).X, n)
+	if r.Sign() == 0 {
+		return nil, fmt.Errorf("%w: degenerate nonce", ErrSigningFailed)
+	}
+	s := ss.paillier.decrypt(partial.Ciphertext)
+	s.Mul(s, new(big.Int).ModInverse(k1, n))
+	s.Mod(s, n)
+	if s.Sign() == 0 {
+		return nil, fmt.Errorf("%w: degenerate signature", ErrSigningFailed)
+	}
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+	sig := &ec.Signature{R: r, S: s}
+	if !sig.Verify(digest, ss.share.PublicKey) {
+		return nil, fmt.Errorf("%w: two-party signature does not verify", ErrBadSignature)
+	}
+	return sig, nil
+}
+
+// SignPartial 由客户端对 digest 计算部分签名。每次调用使用新的 k2。
+func (s *TwoPartyClientShare) SignPartial(digest []byte, nonce *TwoPartyNonce) (*TwoPartyPartialSignature, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("%w: digest must be %d bytes", ErrInvalidParams, sha256.Size)
+	}
+	if nonce == nil || !validPoint(nonce.Point) {
+		return nil, fmt.Errorf("%w: server nonce is required", ErrInvalidParams)
+	}
+	if err := nonce.Proof.verify(signServerLabel(s.PublicKey), nonce.Point); err != nil {
+		return nil, fmt.Errorf("server nonce: %w", err)
+	}
+	paillier := newPaillierPublicKey(s.PaillierN)
+
+	n := ec.S256().N
+	var k2, r *big.Int
+	for {
+		var err error
+		if k2, err = randomScalar(); err != nil {
+			return nil, err
+		}
+		if r = new(big.Int).Mod(nonce.Point.Mul(k2).X, n); r.Sign() != 0 {
+			break
+		}
+	}
+	r2 := scalarBaseMult(k2)
+	proof, err := proveDLog(signClientLabel(s.PublicKey, nonce.Point, digest), k2, r2)
+	if err != nil {
+		return nil, err
+	}
+
+	// c = Enc(ρ·n + k2⁻¹·m mod n) ⊕ Enc(x1) ⊗ (k2⁻¹·r·x2 mod n)，ρ 掩盖 mod n 之外的信息
+	k2Inv := new(big.Int).ModInverse(k2, n)
+	m := new(big.Int).SetBytes(digest)
+	plain := new(big.Int).Mul(k2Inv, m)
+	plain.Mod(plain, n)
+	rho, err := rand.Int(rand.Reader, new(big.Int).Mul(n, n))
+	if err != nil {
+		return nil, err
+	}
+	plain.Add(plain, rho.Mul(rho, n))
+	c1, _, err := paillier.encrypt(plain)
+	if err != nil {
+		return nil, err
+	}
+	v := new(big.Int).Mul(k2Inv, r)
+	v.Mul(v, s.Secret)
+	v.Mod(v, n)
+	c := paillier.add(c1, paillier.mul(s.EncryptedShare, v))
+	return &TwoPartyPartialSignature{Point: r2, Proof: proof, Ciphertext: c}, nil
+}
+
+func proveDLog(label []byte, x *big.Int, p *ec.PublicKey) (*DLogProof, error) {
+	a, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	commitment := scalarBaseMult(a)
+	e := dlogChallenge(label, p, commitment)
+	z := new(big.Int).Mul(e, x)
+	z.Add(z, a)
+	z.Mod(z, ec.S256().N)
+	return &DLogProof{Commitment: commitment, Response: z}, nil
+}
+
+func (proof *DLogProof) verify(label []byte, p *ec.PublicKey) error {
+	if proof == nil || !validPoint(proof.Commitment) || !validScalar(proof.Response) {
+		return fmt.Errorf("%w: incomplete discrete log proof", ErrInvalidProof)
+	}
+	e := dlogChallenge(label, p, proof.Commitment)
+	if !scalarBaseMult(proof.Response).IsEqual(addPoints(proof.Commitment, p.Mul(e))) {
+		return fmt.Errorf("%w: discrete log proof", ErrInvalidProof)
+	}
+	return nil
+}
+
+func dlogChallenge(label []byte, p, commitment *ec.PublicKey) *big.Int {
+	h := newTranscript("2p-ecdsa/dlog")
+	h.write(label)
+	h.write(p.Compressed())
+	h.write(commitment.Compressed())
+	return new(big.Int).Mod(new(big.Int).SetBytes(h.sum()), ec.S256().N)
+}
+
+func provePaillierShare(pk *paillierPublicKey, c, x, r *big.Int, q *ec.PublicKey) (*PaillierShareProof, error) {
+	bound := new(big.Int).Lsh(ec.S256().N, twoPartyRangeSlack)
+	proof := &PaillierShareProof{}
+	alphas := make([]*big.Int, twoPartyRangeRounds)
+	betas := make([]*big.Int, twoPartyRangeRounds)
+	for i := range alphas {
+		alpha, err := rand.Int(rand.Reader, bound)
+		if err != nil {
+			return nil, err
+		}
+		a, beta, err := pk.encrypt(alpha)
+		if err != nil {
+			return nil, err
+		}
+		alphas[i], betas[i] = alpha, beta
+		proof.Ciphertexts = append(proof.Ciphertexts, a)
+		proof.Points = append(proof.Points, scalarBaseMult(alpha))
+	}
+	bits := paillierShareChallenge(pk, c, q, proof)
+	for i := range alphas {
+		z, w := alphas[i], betas[i]
+		if bit(bits, i) {
+			z = new(big.Int).Add(z, x)
+			w = new(big.Int).Mul(w, r)
+			w.Mod(w, pk.n)
+		}
+		proof.Values = append(proof.Values, z)
+		proof.Nonces = append(proof.Nonces, w)
+	}
+	return proof, nil
+}
+
+func (proof *PaillierShareProof) verify(pk *paillierPublicKey, c *big.Int, q *ec.PublicKey) error {
+	if proof == nil || len(proof.Ciphertexts) != twoPartyRangeRounds || len(proof.Points) != twoPartyRangeRounds ||
+		len(proof.Values) != twoPartyRangeRounds || len(proof.Nonces) != twoPartyRangeRounds {
+		return fmt.Errorf("%w: encrypted share proof needs %d rounds", ErrInvalidProof, twoPartyRangeRounds)
+	}
+	n := ec.S256().N
+	bound := new(big.Int).Lsh(n, twoPartyRangeSlack)
+	bound.Add(bound, n)
+	bits := paillierShareChallenge(pk, c, q, proof)
+	for i := range proof.Values {
+		a, b, z, w := proof.Ciphertexts[i], proof.Points[i], proof.Values[i], proof.Nonces[i]
+		if !pk.validCiphertext(a) || !validPoint(b) || z == nil || z.Sign() < 0 || z.Cmp(bound) >= 0 ||
+			w == nil || w.Sign() <= 0 || w.Cmp(pk.n) >= 0 {
+			return fmt.Errorf("%w: encrypted share proof round %d out of range", ErrInvalidProof, i)
+		}
+		expectedCipher, expectedPoint := a, b
+		if bit(bits, i) {
+			expectedCipher = pk.add(a, c)
+			expectedPoint = addPoints(b, q)
+		}
+		if pk.encryptWithNonce(z, w).Cmp(expectedCipher) != 0 || !scalarBaseMult(z).IsEqual(expectedPoint) {
+			return fmt.Errorf("%w: encrypted share proof round %d", ErrInvalidProof, i)
+		}
+	}
+	return nil
+}
+
+func paillierShareChallenge(pk *paillierPublicKey, c *big.Int, q *ec.PublicKey, proof *PaillierShareProof) []byte {
+	h := newTranscript("2p-ecdsa/paillier-share")
+	h.write(pk.n.Bytes())
+	h.write(c.Bytes())
+	h.write(q.Compressed())
+	for i := range proof.Ciphertexts {
+		h.write(proof.Ciphertexts[i].Bytes())
+		h.write(proof.Points[i].Compressed())
+	}
+	return h.sum()
+}
+
+func keyGenServerLabel(paillierN *big.Int) []byte {
+	return append([]byte("keygen/server/"), paillierN.Bytes()...)
+}
+
+func keyGenClientLabel(serverShare *ec.PublicKey) []byte {
+	return append([]byte("keygen/client/"), serverShare.Compressed()...)
+}
+
+func signServerLabel(publicKey *ec.PublicKey) []byte {
+	return append([]byte("sign/server/"), publicKey.Compressed()...)
+}
+
+func signClientLabel(publicKey, serverNonce *ec.PublicKey, digest []byte) []byte {
+	label := append([]byte("sign/client/"), publicKey.Compressed()...)
+	label = append(label, serverNonce.Compressed()...)
+	return append(label, digest...)
+}
+
+// transcript 对带长度前缀的字段做 SHA-256，用于 Fiat-Shamir 挑战。
+type transcript struct {
+	buf []byte
+}
+
+func newTranscript(domain string) *transcript {
+	t := &transcript{}
+	t.write([]byte("KeymasterMultisigPool/" + domain))
+	return t
+}
+
+func (t *transcript) write(b []byte) {
+	t.buf = binary.BigEndian.AppendUint32(t.buf, uint32(len(b)))
+	t.buf = append(t.buf, b...)
+}
+
+func (t *transcript) sum() []byte {
+	h := sha256.Sum256(t.buf)
+	return h[:]
+}
+
+func bit(bits []byte, i int) bool {
+	return bits[i/8]>>(7-uint(i%8))&1 == 1
+}
+
+func randomScalar() (*big.Int, error) {
+	k, err := rand.Int(rand.Reader, new(big.Int).Sub(ec.S256().N, one))
+	if err != nil {
+		return nil, err
+	}
+	return k.Add(k, one), nil
+}
+
+func validScalar(k *big.Int) bool {
+	return k != nil && k.Sign() > 0 && k.Cmp(ec.S256().N) < 0
+}
+
+func validPoint(p *ec.PublicKey) bool {
+	return p != nil && p.X != nil && p.Y != nil && p.X.Sign() != 0 && ec.S256().IsOnCurve(p.X, p.Y)
+}
+
+func scalarBaseMult(k *big.Int) *ec.PublicKey {
+	x, y := ec.S256().ScalarBaseMult(new(big.Int).Mod(k, ec.S256().N).Bytes())
+	return &ec.PublicKey{Curve: ec.S256(), X: x, Y: y}
+}
+
+func addPoints(a, b *ec.PublicKey) *ec.PublicKey {
+	x, y := ec.S256().Add(a.X, a.Y, b.X, b.Y)
+	return &ec.PublicKey{Curve: ec.S256(), X: x, Y: y}
+}
@@ -0,0 +1,121 @@
+package libs
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+)
+
+// 伪造的 Paillier 模数证明被拒绝：位数不足、含小素数因子、根被篡改或轮数不足。
+func TestPaillierKeyProofForged(t *testing.T) {
+	sk, err := generatePaillierKey(paillierMinBits)
+	if err != nil {
+		t.Fatalf("generate paillier key: %v", err)
+	}
+	roots, err := sk.proveKey()
+	if err != nil {
+		t.Fatalf("prove key: %v", err)
+	}
+	if err := sk.paillierPublicKey.verifyKey(roots); err != nil {
+		t.Fatalf("honest key proof rejected: %v", err)
+	}
+
+	short, err := generatePaillierKey(1024)
+	if err != nil {
+		t.Fatalf("generate short key: %v", err)
+	}
+	shortRoots, _ := short.proveKey()
+	if err := short.paillierPublicKey.verifyKey(shortRoots); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a short modulus, got %v", err)
+	}
+
+	// N·3 有小素数因子，且 gcd(N, φ(N)) ≠ 1，无法给出合法证明
+	smallFactor := newPaillierPublicKey(new(big.Int).Mul(sk.n, big.NewInt(3)))
+	if err := smallFactor.verifyKey(roots); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a modulus with a small factor, got %v", err)
+	}
+
+	tampered := append([]*big.Int(nil), roots...)
+	tampered[3] = new(big.Int).Add(tampered[3], one)
+	if err := sk.paillierPublicKey.verifyKey(tampered); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a tampered root, got %v", err)
+	}
+	if err := sk.paillierPublicKey.verifyKey(roots[:paillierKeyProofRounds-1]); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a truncated proof, got %v", err)
+	}
+	outOfRange := append([]*big.Int(nil), roots...)
+	outOfRange[0] = new(big.Int).Add(roots[0], sk.n)
+	if err := sk.paillierPublicKey.verifyKey(outOfRange); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a root outside Z_N, got %v", err)
+	}
+
+	// Offer 中的伪造证明在客户端被拒绝
+	gen, err := NewTwoPartyKeyGen()
+	if err != nil {
+		t.Fatalf("new key gen: %v", err)
+	}
+	offer := *gen.Offer()
+	offer.PaillierProof = append([]*big.Int(nil), offer.PaillierProof...)
+	offer.PaillierProof[0] = new(big.Int).Add(offer.PaillierProof[0], one)
+	if _, _, err := AcceptTwoPartyKeyGen(&offer); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a forged offer key proof, got %v", err)
+	}
+}
+
+// 加密份额超出 n·2^40 时范围证明不成立；篡改证明字段同样被拒绝。
+func TestPaillierShareProofRange(t *testing.T) {
+	sk, err := generatePaillierKey(paillierMinBits)
+	if err != nil {
+		t.Fatalf("generate paillier key: %v", err)
+	}
+	pk := &sk.paillierPublicKey
+
+	x, _ := randomScalar()
+	c, r, _ := pk.encrypt(x)
+	q := scalarBaseMult(x)
+	proof, err := provePaillierShare(pk, c, x, r, q)
+	if err != nil {
+		t.Fatalf("prove share: %v", err)
+	}
+	if err := proof.verify(pk, c, q); err != nil {
+		t.Fatalf("honest share proof rejected: %v", err)
+	}
+
+	// x ≡ x1 mod n 但远超范围：同态运算会在 N 上回绕
+	big1 := new(big.Int).Lsh(ec.S256().N, twoPartyRangeSlack+8)
+	big1.Add(big1, x)
+	cBig, rBig, _ := pk.encrypt(big1)
+	bigProof, err := provePaillierShare(pk, cBig, big1, rBig, q)
+	if err != nil {
+		t.Fatalf("prove out-of-range share: %v", err)
+	}
+	if err := bigProof.verify(pk, cBig, q); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for an out-of-range share, got %v", err)
+	}
+
+	// 负的份额以 N - |x| 加密，同样超出范围
+	neg := new(big.Int).Sub(sk.n, x)
+	cNeg, rNeg, _ := pk.encrypt(neg)
+	negProof, _ := provePaillierShare(pk, cNeg, neg, rNeg, scalarBaseMult(neg))
+	if err := negProof.verify(pk, cNeg, scalarBaseMult(neg)); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a wrapped negative share, got %v", err)
+	}
+
+	tampered := *proof
+	tampered.Values = append([]*big.Int(nil), proof.Values...)
+	tampered.Values[5] = new(big.Int).Add(tampered.Values[5], one)
+	if err := tampered.verify(pk, c, q); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a tampered value, got %v", err)
+	}
+	wrongPoint := scalarBaseMult(new(big.Int).Add(x, one))
+	if err := proof.verify(pk, c, wrongPoint); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a mismatched public share, got %v", err)
+	}
+	truncated := *proof
+	truncated.Nonces = proof.Nonces[:twoPartyRangeRounds-1]
+	if err := truncated.verify(pk, c, q); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a truncated proof, got %v", err)
+	}
+}
@@ -5,4 +5,7 @@ type UTXO struct {
 	TxID  string `json:"txid"`
 	Vout  uint32 `json:"vout"`
 	Value uint64 `json:"satoshis"`
+	// Address is the optional P2PKH address the output is locked to.
+	// When set, it is checked against the pool's network and signing key.
+	Address string `json:"address,omitempty"`
 }
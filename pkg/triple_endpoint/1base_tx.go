@@ -23,9 +23,12 @@ type BuildStep1Response struct {
 	Tx     *tx.Transaction
 	Amount uint64
 	Index  int
+	Fee    uint64 // A-Tx 手续费，由 A 方承担
+	Change uint64 // A 方找零金额，为 0 时没有找零输出
 }
 
-// p2pkh to 2t2多签, 不找零
+// p2pkh to 2t3多签, 不找零（V2 可指定 PoolAmount 并找零）
+// 位置参数版本，保留兼容：不做 V2 的参数校验，feeRate 原样使用（为 0 时手续费按 1 sat 计）。
 func BuildTripleFeePoolBaseTx(
 	clientUtxo *[]libs.UTXO, // 发起者 utxos, 我提供的金额就是这个 utxo 的全额
 	// serverValue uint64, // 服务器提供金额
@@ -35,9 +38,101 @@ func BuildTripleFeePoolBaseTx(
 	isMain bool,
 	feeRate float64,
 ) (*BuildStep1Response, error) {
-	clientAddress, err := libs.GetAddressFromPubKey(aPrivateKey.PubKey(), true)
+	var utxos []libs.UTXO
+	if clientUtxo != nil {
+		utxos = *clientUtxo
+	}
+	if serverPublicKey == nil || aPrivateKey == nil || bPublicKey == nil {
+		return nil, invalidParams("server, a and b keys are required")
+	}
+	return buildTripleFeePoolBaseTx(PoolParams{
+		ClientUTXOs:     utxos,
+		ServerPublicKey: serverPublicKey,
+		APrivateKey:     aPrivateKey,
+		BPublicKey:      bPublicKey,
+		Network:         libs.NetworkFromIsMain(isMain),
+	}, feeRate)
+}
+
+// BuildTripleFeePoolBaseTxV2 构建三方池 A-Tx：A 方 UTXO（及可选的 B 方/仲裁方出资）-> 2-of-3 多签输出 + 找零。
+// PoolAmount 为 0 时保持旧行为：A 方 UTXO 全额扣除手续费后入池，不找零。
+// 返回的交易中只有 A 方输入已签名，出资方输入需要各自调用 SignTripleFeePoolContribution 补签。
+func BuildTripleFeePoolBaseTxV2(p PoolParams) (*BuildStep1Response, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return buildTripleFeePoolBaseTx(p, feeRateOrDefault(p.FeeRate))
+}
+
+// buildTripleFeePoolBaseTx 按给定费率构建三方池 A-Tx，不校验参数，p.FeeRate 不参与计算。
+func buildTripleFeePoolBaseTx(p PoolParams, feeRate float64) (*BuildStep1Response, error) {
+
+	var contributed uint64
+	for _, c := range p.Contributions {
+		contributed += c.Amount
+	}
+	aTarget := uint64(0)
+	if p.PoolAmount > 0 {
+		aTarget = p.PoolAmount - contributed
+	}
+
+	// 手续费取决于交易大小，而选币结果又取决于手续费，迭代直到手续费足以覆盖交易大小
+	var (
+		transactionData *tx.Transaction
+		poolAmount      uint64
+		change          uint64
+	)
+	fee, err := libs.ConvergeFee(float64(feeRate), func(fee uint64) (*tx.Transaction, error) {
+		aUtxos := p.ClientUTXOs
+		if p.SelectCoins {
+			selected, _, err := libs.SelectUTXOs(p.ClientUTXOs, aTarget+fee)
+			if err != nil {
+				return nil, fmt.Errorf("a utxos: %w", err)
+			}
+			aUtxos = selected
+		}
+
+		var err error
+		transactionData, poolAmount, change, err = assembleTripleBaseTx(&p, aUtxos, aTarget, fee)
+		return transactionData, err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get address: %w", err)
+		return nil, err
+	}
+
+	// 出资方输入的占位解锁脚本只用于估算大小
+	for i := range transactionData.Inputs {
+		if transactionData.Inputs[i].UnlockingScriptTemplate == nil {
+			transactionData.Inputs[i].UnlockingScript = nil
+		}
+	}
+
+	libs.Logger().Debug("triple_endpoint: base tx built",
+		"txid", transactionData.TxID().String(),
+		"inputs", len(transactionData.Inputs),
+		"pool_amount", poolAmount,
+		"change", change,
+		"contributions", len(p.Contributions),
+		"fee", fee,
+	)
+
+	return &BuildStep1Response{
+		Tx:     transactionData,
+		Amount: poolAmount,
+		Index:  0,
+		Fee:    fee,
+		Change: change,
+	}, nil
+}
+
+// assembleTripleBaseTx 按给定手续费组装并签名 A-Tx，返回入池金额与 A 方找零。
+// aTarget 为 0 表示旧行为：A 方输入全额扣除手续费后入池。
+func assembleTripleBaseTx(p *PoolParams, aUtxos []libs.UTXO, aTarget uint64, fee uint64) (*tx.Transaction, uint64, uint64, error) {
+	serverPublicKey, aPrivateKey, bPublicKey := p.ServerPublicKey, p.APrivateKey, p.BPublicKey
+
+	clientAddress, err := p.Network.Address(aPrivateKey.PubKey())
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to get address: %w", err)
 	}
 
 	// 创建交易对象
@@ -47,19 +142,19 @@ func BuildTripleFeePoolBaseTx(
 	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
 	aUnlockingScriptTemplate, err := p2pkh.Unlock(aPrivateKey, &sigHash)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create one unlocking script template: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create one unlocking script template: %w", err)
 	}
 
 	// 前序交易锁定脚本
 	prevScript, err := p2pkh.Lock(clientAddress)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create locking script: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create locking script: %w", err)
 	}
 	prevTxLockingScript := hex.EncodeToString(prevScript.Bytes())
 
 	// 添加我的输入
 	var totalValue uint64 = 0
-	for _, cUtxo := range *clientUtxo {
+	for _, cUtxo := range aUtxos {
 		err = transactionData.AddInputFrom(
 			cUtxo.TxID,
 			cUtxo.Vout,
@@ -68,56 +163,145 @@ func BuildTripleFeePoolBaseTx(
 			aUnlockingScriptTemplate,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to add input: %w", err)
+			return nil, 0, 0, fmt.Errorf("failed to add input: %w", err)
 		}
 		totalValue += cUtxo.Value
 	}
 
+	var poolAmount, change uint64
+	if aTarget == 0 && p.PoolAmount == 0 {
+		if totalValue <= fee {
+			return nil, 0, 0, fmt.Errorf("pool amount plus fee %d: %w", fee, &libs.InsufficientFundsError{Need: fee + 1, Have: totalValue})
+		}
+		poolAmount = totalValue - fee
+	} else {
+		if totalValue < aTarget+fee {
+			return nil, 0, 0, fmt.Errorf("a contribution plus fee %d: %w", fee, &libs.InsufficientFundsError{Need: aTarget + fee, Have: totalValue})
+		}
+		poolAmount = p.PoolAmount
+		change = totalValue - aTarget - fee
+	}
+
 	// 创建初始交易的锁定脚本
 	outputMultisigScript, err := libs.Lock([]*ec.PublicKey{serverPublicKey, aPrivateKey.PubKey(), bPublicKey}, 2)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create server locking script: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create server locking script: %w", err)
 	}
 
-	// 添加服务器输出
+	// 添加多签输出
 	transactionData.AddOutput(&tx.TransactionOutput{
-		Satoshis:      totalValue,
+		Satoshis:      poolAmount,
 		LockingScript: outputMultisigScript,
 	})
 
-	// 为每个输入签名，以便正确估计交易大小
-	for i := range transactionData.Inputs {
-		unlockingScript, err := aUnlockingScriptTemplate.Sign(transactionData, uint32(i))
+	// A 方找零
+	if change > 0 {
+		changeAddress := clientAddress
+		if p.ChangeAddress != "" {
+			changeAddress, err = p.Network.ParseAddress(p.ChangeAddress)
+			if err != nil {
+				return nil, 0, 0, fmt.Errorf("change address: %w", err)
+			}
+		}
+		changeScript, err := p2pkh.Lock(changeAddress)
 		if err != nil {
-			return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
+			return nil, 0, 0, fmt.Errorf("failed to create change locking script: %w", err)
 		}
-		transactionData.Inputs[i].UnlockingScript = unlockingScript
+		transactionData.AddOutput(&tx.TransactionOutput{
+			Satoshis:      change,
+			LockingScript: changeScript,
+		})
 	}
 
-	// 计算交易大小（字节）
-	txSize := transactionData.Size()
-	fee := uint64(float64(txSize) / 1000.0 * float64(feeRate))
-	if fee == 0 {
-		fee = 1
+	// 出资方输入与找零
+	for _, c := range p.Contributions {
+		contributorAddress, err := p.Network.Address(p.contributorKey(c.Party))
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to get %s address: %w", c.Party, err)
+		}
+		contributorScript, err := p2pkh.Lock(contributorAddress)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to create %s locking script: %w", c.Party, err)
+		}
+		for _, u := range c.UTXOs {
+			err = transactionData.AddInputFrom(u.TxID, u.Vout, hex.EncodeToString(contributorScript.Bytes()), u.Value, nil)
+			if err != nil {
+				return nil, 0, 0, fmt.Errorf("failed to add %s input: %w", c.Party, err)
+			}
+			transactionData.Inputs[len(transactionData.Inputs)-1].UnlockingScript = libs.FakeP2PKHSign()
+		}
+		if contributorChange := libs.SumUTXOs(c.UTXOs) - c.Amount; contributorChange > 0 {
+			transactionData.AddOutput(&tx.TransactionOutput{
+				Satoshis:      contributorChange,
+				LockingScript: contributorScript,
+			})
+		}
 	}
-	// fmt.Printf("fee: %d, txSize: %d, feeRate: %f\n", fee, txSize, c.feeRate)
-	// c.Logger.Debug("fee", zap.Int64("fee", int64(fee)), zap.Int64("txSize", int64(txSize)), zap.Float64("feeRate", c.feeRate))
 
-	// 更新找零输出
-	transactionData.Outputs[0].Satoshis = totalValue - fee
-
-	// 重新签名
+	// 为 A 方输入签名
 	for i := range transactionData.Inputs {
+		if transactionData.Inputs[i].UnlockingScriptTemplate == nil {
+			continue
+		}
 		unlockingScript, err := aUnlockingScriptTemplate.Sign(transactionData, uint32(i))
 		if err != nil {
-			return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
+			return nil, 0, 0, fmt.Errorf("failed to sign input %d: %w", i, err)
 		}
 		transactionData.Inputs[i].UnlockingScript = unlockingScript
 	}
 
-	return &BuildStep1Response{
-		Tx:     transactionData,
-		Amount: totalValue - fee,
-		Index:  0,
-	}, nil
+	return transactionData, poolAmount, change, nil
+}
+
+// SignTripleFeePoolContribution B 方为 A-Tx 中属于自己的出资输入签名。签名后 A-Tx 的 txid 才确定，
+// B 方只把 txid 交给 A 方构建退款 B-Tx，经 VerifyTripleOpening 核对后再交出完整 A-Tx。
+// utxos 为该出资方在开池时提供的 UTXO，用于恢复输入的前序输出；A 方已有的签名不受影响。
+func SignTripleFeePoolContribution(
+	baseTx *tx.Transaction,
+	utxos []libs.UTXO,
+	privateKey *ec.PrivateKey,
+	network libs.Network,
+) (*tx.Transaction, error) {
+	if baseTx == nil || privateKey == nil {
+		return nil, fmt.Errorf("%w: base tx and private key are required", libs.ErrInvalidParams)
+	}
+	address, err := network.Address(privateKey.PubKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address: %w", err)
+	}
+	lockingScript, err := p2pkh.Lock(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create locking script: %w", err)
+	}
+	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
+	unlocker, err := p2pkh.Unlock(privateKey, &sigHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unlocking script template: %w", err)
+	}
+
+	// ForkID sighash 只需要被签输入自身的前序输出，用 utxo 恢复即可
+	owned := make(map[string]libs.UTXO, len(utxos))
+	for _, u := range utxos {
+		owned[fmt.Sprintf("%s:%d", u.TxID, u.Vout)] = u
+	}
+	signed := 0
+	for i, input := range baseTx.Inputs {
+		u, ok := owned[fmt.Sprintf("%s:%d", input.SourceTXID.String(), input.SourceTxOutIndex)]
+		if !ok {
+			continue
+		}
+		input.SetSourceTxOutput(&tx.TransactionOutput{Satoshis: u.Value, LockingScript: lockingScript})
+		unlockingScript, err := unlocker.Sign(baseTx, uint32(i))
+		if err != nil {
+			return nil, fmt.Errorf("%w: contribution input %d: %w", libs.ErrSigningFailed, i, err)
+		}
+		input.UnlockingScript = unlockingScript
+		signed++
+	}
+	if signed != len(utxos) {
+		return nil, fmt.Errorf("%w: %d of %d contribution utxos found in base tx", libs.ErrInvalidTransaction, signed, len(utxos))
+	}
+
+	libs.Logger().Debug("triple_endpoint: contribution signed", "txid", baseTx.TxID().String(), "inputs", signed)
+	return baseTx, nil
 }
@@ -3,7 +3,6 @@ package triple_endpoint
 import (
 	"encoding/hex"
 	"fmt"
-	"log"
 
 	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
 	multisig "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
@@ -26,45 +25,85 @@ func SubBuildTripleFeePoolSpendTX(
 	isMain bool,
 	feeRate float64,
 ) (*tx.Transaction, uint64, error) {
+	return SubBuildTripleFeePoolSpendTXAt(prevTxId, 0, serverValue, endHeight, serverPublicKey, aPrivateKey, bPublicKey, isMain, feeRate)
+}
+
+// SubBuildTripleFeePoolSpendTXAt 与 SubBuildTripleFeePoolSpendTX 相同，但花费 prevTxId 的第 vout 个输出，
+// 用于多签输出不在 0 号位置的 A-Tx（例如批量开池）。
+func SubBuildTripleFeePoolSpendTXAt(
+	prevTxId string,
+	vout uint32,
+	serverValue uint64,
+	endHeight uint32,
+	serverPublicKey *ec.PublicKey,
+	aPrivateKey *ec.PrivateKey,
+	bPublicKey *ec.PublicKey,
+	isMain bool,
+	feeRate float64,
+) (*tx.Transaction, uint64, error) {
+	transactionTwo, _, aAmount, err := subBuildTripleFeePoolSpendTX(&SpendParams{
+		PrevTxID:        prevTxId,
+		PoolVout:        vout,
+		PoolAmount:      serverValue,
+		EndHeight:       endHeight,
+		ServerPublicKey: serverPublicKey,
+		APrivateKey:     aPrivateKey,
+		BPublicKey:      bPublicKey,
+		Network:         libs.NetworkFromIsMain(isMain),
+		Dust:            libs.DustPolicy{Action: libs.DustKeepZero},
+	}, feeRate)
+	return transactionTwo, aAmount, err
+}
+
+// subBuildTripleFeePoolSpendTX 按给定费率构建初始 B-Tx，不校验参数，p.FeeRate 不参与计算。
+// B 方扣费前金额为 p.BContribution（B 方出资的退款）、A 方为扣除仲裁方出资后的其余部分，手续费按 p.FeePolicy 在 B、A 之间分摊，
+// 扣费后的支付输出按 p.Dust 布局。仲裁方出资时在支付输出之后附加等额的仲裁方退款输出；支付脚本为空时使用签名公钥的 P2PKH；
+// p.Commitment 不为空时在末尾附加承诺输出，其大小计入手续费。返回交易、手续费与 A 方输出金额。
+func subBuildTripleFeePoolSpendTX(p *SpendParams, feeRate float64) (*tx.Transaction, uint64, uint64, error) {
+	serverValue, bAmount, arbiterAmount := p.PoolAmount, p.BContribution, p.ArbiterContribution
+	serverPublicKey, aPrivateKey, bPublicKey := p.ServerPublicKey, p.APrivateKey, p.BPublicKey
+	if bAmount > serverValue || arbiterAmount > serverValue-bAmount {
+		return nil, 0, 0, fmt.Errorf("contributions: %w", &libs.InsufficientFundsError{Need: bAmount + arbiterAmount, Have: serverValue})
+	}
+	isMain := p.Network.IsMain()
 	aAddress, err := libs.GetAddressFromPublicKey(aPrivateKey.PubKey(), isMain)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get client address: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to get client address: %w", err)
 	}
 	bAddress, err := libs.GetAddressFromPublicKey(bPublicKey, isMain)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get server address: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to get server address: %w", err)
 	}
 
 	// 生成公钥
 	aPublicKey := aPrivateKey.PubKey()
 
 	transactionTwo := tx.NewTransaction()
-	transactionTwo.LockTime = endHeight
+	transactionTwo.LockTime = p.EndHeight
 
 	// 创建初始交易的锁定脚本
 	prevMultisigScript, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, aPublicKey, bPublicKey}, 2)
-	fmt.Printf("================================= prevMultisigScript: %s\n", prevMultisigScript.ToASM())
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create server locking script: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create server locking script: %w", err)
 	}
 	prevMultisigTxLockingAsm := hex.EncodeToString(prevMultisigScript.Bytes())
 
 	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
 	aMultisigUnlockingScriptTemplate, err := multisig.Unlock([]*ec.PrivateKey{}, []*ec.PublicKey{serverPublicKey, aPublicKey, bPublicKey}, 2, &sigHash)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create unlocking script template: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create unlocking script template: %w", err)
 	}
 
 	// 添加所有UTXO作为输入
 	err = transactionTwo.AddInputFrom(
-		prevTxId,
-		0,
+		p.prevTxID(),
+		p.PoolVout,
 		prevMultisigTxLockingAsm,
 		serverValue,
 		aMultisigUnlockingScriptTemplate,
 	)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to add input: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to add input: %w", err)
 	}
 	transactionTwo.Inputs[0].SequenceNumber = 1
 
@@ -75,12 +114,15 @@ func SubBuildTripleFeePoolSpendTX(
 	// }
 	serverChangeScript, err := p2pkh.Lock(bAddress)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create change locking script: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create change locking script: %w", err)
+	}
+	if p.BPayoutScript != nil {
+		serverChangeScript = p.BPayoutScript
 	}
 
 	// 添加服务器输出
 	transactionTwo.AddOutput(&tx.TransactionOutput{
-		Satoshis:      0,
+		Satoshis:      bAmount,
 		LockingScript: serverChangeScript,
 	})
 
@@ -91,19 +133,37 @@ func SubBuildTripleFeePoolSpendTX(
 	// }
 	clientChangeScript, err := p2pkh.Lock(aAddress)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create change locking script: %w", err)
+		return nil, 0, 0, fmt.Errorf("failed to create change locking script: %w", err)
+	}
+	if p.APayoutScript != nil {
+		clientChangeScript = p.APayoutScript
 	}
 
 	// 添加客户端输出
+	aAmount := serverValue - bAmount - arbiterAmount
 	transactionTwo.AddOutput(&tx.TransactionOutput{
-		Satoshis:      serverValue,
+		Satoshis:      aAmount,
 		LockingScript: clientChangeScript,
 	})
 
+	// 仲裁方退款与承诺输出在估算手续费前加入
+	var arbiterRefund *tx.TransactionOutput
+	if arbiterAmount > 0 {
+		arbiterScript, err := ArbiterPayoutScript(serverPublicKey)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		arbiterRefund = &tx.TransactionOutput{Satoshis: arbiterAmount, LockingScript: arbiterScript}
+		transactionTwo.AddOutput(arbiterRefund)
+	}
+	if p.Commitment != nil {
+		transactionTwo.AddOutput(p.Commitment.Output())
+	}
+
 	// 做一个假的签名script，方便计算 size
 	unlockingScript, err := multisig.FakeSign(2)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to sign input %d: %w", 1, err)
+		return nil, 0, 0, fmt.Errorf("failed to build placeholder unlocking script: %w", err)
 	}
 	transactionTwo.Inputs[0].UnlockingScript = unlockingScript
 
@@ -112,19 +172,45 @@ func SubBuildTripleFeePoolSpendTX(
 
 	// 基于大小计算费用（向上取整到最接近的KB）
 	fee := uint64(float64(txSize) / 1000.0 * feeRate)
-	if serverValue < fee {
-		return nil, 0, fmt.Errorf("not enough balance, need %d, have %d", fee, serverValue)
-	}
 	if fee == 0 {
 		fee = 1
 	}
+	bOut, aOut, err := p.FeePolicy.ApplyTripleDust(bAmount, aAmount, fee, p.Dust)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("fee %d (%s): %w", fee, p.FeePolicy, err)
+	}
 
-	// 更新找零输出的金额
-	transactionTwo.Outputs[1].Satoshis = serverValue - fee
+	// 按策略扣费后按粉尘策略重新布局双方输出，默认布局保持 [B, A] 两个输出
+	transactionTwo.Outputs, err = p.Dust.Layout([]libs.Payout{
+		{Party: libs.PartyB, Amount: bOut, LockingScript: serverChangeScript},
+		{Party: libs.PartyA, Amount: aOut, LockingScript: clientChangeScript},
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	aOut = libs.PayoutAmount(transactionTwo, clientChangeScript)
+	if arbiterRefund != nil {
+		transactionTwo.AddOutput(arbiterRefund)
+	}
+	if p.Commitment != nil {
+		transactionTwo.AddOutput(p.Commitment.Output())
+	}
 
 	// transactionTwo.Inputs[0].UnlockingScript = serverSignByte
 
-	return transactionTwo, serverValue - fee, nil
+	libs.Logger().Debug("triple_endpoint: spend tx built",
+		"prev_txid", p.prevTxID(),
+		"vout", p.PoolVout,
+		"locktime", p.EndHeight,
+		"sequence", transactionTwo.Inputs[0].SequenceNumber,
+		"a_amount", aOut,
+		"arbiter_refund", arbiterAmount,
+		"fee", fee,
+		"fee_policy", p.FeePolicy.String(),
+		"outputs", len(transactionTwo.Outputs),
+	)
+
+	return transactionTwo, fee, aOut, nil
 }
 
 func SpendTXTripleFeePoolASign(
@@ -134,14 +220,29 @@ func SpendTXTripleFeePoolASign(
 	aPrivKey *ec.PrivateKey,
 	bPublicKey *ec.PublicKey,
 ) (*[]byte, error) {
+	return SpendTXTripleFeePoolASignAt(B_Tx, 0, targetAmount, serverPublicKey, aPrivKey, bPublicKey)
+}
+
+// SpendTXTripleFeePoolASignAt 与 SpendTXTripleFeePoolASign 相同，但为第 inputIndex 个输入签名。
+func SpendTXTripleFeePoolASignAt(
+	B_Tx *tx.Transaction,
+	inputIndex uint32,
+	targetAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	aPrivKey *ec.PrivateKey,
+	bPublicKey *ec.PublicKey,
+) (*[]byte, error) {
+	if B_Tx == nil || int(inputIndex) >= len(B_Tx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", libs.ErrInvalidTransaction, inputIndex)
+	}
 	// 创建优先级脚本
 	priorityScript, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, aPrivKey.PubKey(), bPublicKey}, 2)
 	if err != nil {
-		return nil, fmt.Errorf("创建优先级脚本失败: %v", err)
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
 	}
 
 	// 设置输入的锁定脚本
-	B_Tx.Inputs[0].SetSourceTxOutput(
+	B_Tx.Inputs[inputIndex].SetSourceTxOutput(
 		&tx.TransactionOutput{
 			Satoshis:      targetAmount,
 			LockingScript: priorityScript,
@@ -152,20 +253,23 @@ func SpendTXTripleFeePoolASign(
 	sighash := sighash.Flag(sighash.ForkID | sighash.All)
 	aMultisigUnlockingScriptTemplate, err := multisig.Unlock([]*ec.PrivateKey{aPrivKey}, []*ec.PublicKey{serverPublicKey, aPrivKey.PubKey(), bPublicKey}, 2, &sighash)
 	if err != nil {
-		return nil, fmt.Errorf("创建解锁脚本失败: %v", err)
+		return nil, fmt.Errorf("failed to create unlocking script template: %w", err)
 	}
 
 	// 重新签名所有输入
-	aSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(B_Tx, 0, aPrivKey)
+	aSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(B_Tx, inputIndex, aPrivKey)
 	if err != nil {
-		return nil, fmt.Errorf("a 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: a input %d: %w", libs.ErrSigningFailed, inputIndex, err)
 	}
+
+	libs.Logger().Debug("triple_endpoint: a signed spend tx", "txid", B_Tx.TxID().String(), "input", inputIndex)
 	return aSignByte, nil
 }
 
-// 构建双端费用池花费交易
+// 构建三方费用池花费交易
 // 发起者 utxos, 服务器提供金额， 发起者私钥， 服务器地址
-// fee 是 server 提供，我只负责精确的金额
+// 手续费从 A 方输出中扣除；V2 可通过 SpendParams.FeePolicy 选择其他分摊方式
+// 位置参数版本，保留兼容：不做 V2 的参数校验，serverValue 与 feeRate 原样使用。
 func BuildTripleFeePoolSpendTX(
 	A_Tx *tx.Transaction,
 	serverValue uint64, // 服务器提供金额
@@ -176,21 +280,42 @@ func BuildTripleFeePoolSpendTX(
 	isMain bool,
 	feeRate float64,
 ) (*tx.Transaction, *[]byte, uint64, error) {
-
+	if A_Tx == nil || serverPublicKey == nil || aPrivateKey == nil || bPublicKey == nil {
+		return nil, nil, 0, invalidParams("base tx, server, a and b keys are required")
+	}
 	txTwo, amount, err := SubBuildTripleFeePoolSpendTX(A_Tx.TxID().String(), serverValue, endHeight, serverPublicKey, aPrivateKey, bPublicKey, isMain, feeRate)
 	if err != nil {
-		log.Printf("BuildOneB error: %v", err)
+		libs.Logger().Debug("triple_endpoint: build spend tx failed", "error", err)
 		return nil, nil, 0, err
 	}
 
-	// log.Printf("------------------------------- BuildOneB success: %v", txTwo.Hex())
-
 	// 重新签名
-	clientSignByte, err := SpendTXTripleFeePoolASign(txTwo, serverValue, serverPublicKey, aPrivateKey, bPublicKey)
+	aSignByte, err := SpendTXTripleFeePoolASign(txTwo, serverValue, serverPublicKey, aPrivateKey, bPublicKey)
 	if err != nil {
-		log.Printf("BuildOneC error: %v", err)
+		libs.Logger().Debug("triple_endpoint: a sign spend tx failed", "error", err)
 		return nil, nil, 0, err
 	}
+	return txTwo, aSignByte, amount, nil
+}
+
+// BuildTripleFeePoolSpendTXV2 构建初始 B-Tx 并返回 A 方签名。
+func BuildTripleFeePoolSpendTXV2(p SpendParams) (*SpendResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	txTwo, fee, amount, err := subBuildTripleFeePoolSpendTX(&p, feeRateOrDefault(p.FeeRate))
+	if err != nil {
+		libs.Logger().Debug("triple_endpoint: build spend tx failed", "error", err)
+		return nil, err
+	}
+
+	// 重新签名
+	aSignByte, err := SpendTXTripleFeePoolASign(txTwo, p.PoolAmount, p.ServerPublicKey, p.APrivateKey, p.BPublicKey)
+	if err != nil {
+		libs.Logger().Debug("triple_endpoint: a sign spend tx failed", "error", err)
+		return nil, err
+	}
 
-	return txTwo, clientSignByte, amount, nil
+	return &SpendResult{Tx: txTwo, ASignBytes: aSignByte, Amount: amount, Fee: fee, BPayout: p.BPayout, APayout: p.APayout}, nil
 }
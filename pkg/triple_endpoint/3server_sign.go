@@ -19,14 +19,29 @@ func SpendTXTripleFeePoolBSign(
 	aPublicKey *ec.PublicKey,
 	bPrivateKey *ec.PrivateKey,
 ) (*[]byte, error) {
+	return SpendTXTripleFeePoolBSignAt(transactionObject, 0, targetAmount, serverPublicKey, aPublicKey, bPrivateKey)
+}
+
+// SpendTXTripleFeePoolBSignAt 与 SpendTXTripleFeePoolBSign 相同，但为第 inputIndex 个输入签名。
+func SpendTXTripleFeePoolBSignAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	targetAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	aPublicKey *ec.PublicKey,
+	bPrivateKey *ec.PrivateKey,
+) (*[]byte, error) {
+	if transactionObject == nil || int(inputIndex) >= len(transactionObject.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
 	// 创建优先级脚本
 	priorityScript, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, aPublicKey, bPrivateKey.PubKey()}, 2)
 	if err != nil {
-		return nil, fmt.Errorf("创建优先级脚本失败: %v", err)
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
 	}
 
 	// 设置输入的锁定脚本
-	transactionObject.Inputs[0].SetSourceTxOutput(
+	transactionObject.Inputs[inputIndex].SetSourceTxOutput(
 		&tx.TransactionOutput{
 			Satoshis:      targetAmount,
 			LockingScript: priorityScript,
@@ -40,11 +55,11 @@ func SpendTXTripleFeePoolBSign(
 	}
 
 	// 重新签名所有输入
-	bSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(transactionObject, 0, bPrivateKey)
+	bSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(transactionObject, inputIndex, bPrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("b 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: b input %d: %w", multisig.ErrSigningFailed, inputIndex, err)
 	}
 
-	fmt.Println("b 重新签名输入 1 成功 hex:", transactionObject.Hex())
+	multisig.Logger().Debug("triple_endpoint: b signed spend tx", "txid", transactionObject.TxID().String(), "input", inputIndex)
 	return bSignByte, nil
 }
@@ -17,6 +17,7 @@ import (
 // const FINAL_LOCKTIME uint32 = 0xffffffff
 
 // 合成两个签名
+// 位置参数版本，保留兼容：不做 V2 的参数校验，序列号原样写入，targetAmount 只用于签名的来源输出金额。
 func TripleFeePoolLoadTx(
 	txHex string,
 	locktime *uint32,
@@ -27,23 +28,63 @@ func TripleFeePoolLoadTx(
 	bPublicKey *ec.PublicKey,
 	targetAmount uint64, // input 的金额
 ) (*transaction.Transaction, error) {
+	if serverPublicKey == nil || aPublicKey == nil || bPublicKey == nil {
+		return nil, invalidParams("server, a and b public keys are required")
+	}
+	return loadTx(UpdateParams{
+		TxHex:           txHex,
+		Locktime:        locktime,
+		Sequence:        sequenceNumber,
+		BAmount:         serverAmount,
+		ServerPublicKey: serverPublicKey,
+		APublicKey:      aPublicKey,
+		BPublicKey:      bPublicKey,
+		PoolAmount:      targetAmount,
+		Dust:            multisig.DustPolicy{Action: multisig.DustKeepZero},
+	})
+}
+
+// TripleFeePoolLoadTxV2 从 hex 恢复 B-Tx，设置新的序列号、locktime 与金额分配，返回待签名的交易。
+func TripleFeePoolLoadTxV2(p UpdateParams) (*transaction.Transaction, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return loadTx(p)
+}
+
+// loadTx 是 TripleFeePoolLoadTxV2 去掉参数校验的部分，供位置参数版本 TripleFeePoolLoadTx 复用。
+func loadTx(p UpdateParams) (*transaction.Transaction, error) {
+	txHex, locktime, sequenceNumber := p.TxHex, p.Locktime, p.Sequence
+	serverAmount, targetAmount := p.BAmount, p.PoolAmount
+	serverPublicKey, aPublicKey, bPublicKey := p.ServerPublicKey, p.APublicKey, p.BPublicKey
+
 	// 恢复 bTx
 	bTx, err := transaction.NewTransactionFromHex(txHex)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: decode tx hex: %w", multisig.ErrInvalidTransaction, err)
+	}
+	minOutputs := 2
+	if !p.Dust.FixedLayout() {
+		minOutputs = 1
+	}
+	if int(p.InputIndex) >= len(bTx.Inputs) || len(bTx.Outputs) < minOutputs {
+		return nil, fmt.Errorf("%w: expected input %d and %d outputs, got %d inputs and %d outputs", multisig.ErrInvalidTransaction, p.InputIndex, minOutputs, len(bTx.Inputs), len(bTx.Outputs))
 	}
 
 	if locktime != nil {
+		if err := multisig.CheckBlockHeightLocktime(*locktime); err != nil {
+			return nil, err
+		}
 		bTx.LockTime = *locktime
 	}
 
 	// 创建优先级脚本
 	priorityScript, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, aPublicKey, bPublicKey}, 2)
 	if err != nil {
-		return nil, fmt.Errorf("创建优先级脚本失败: %v", err)
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
 	}
 
-	bTx.Inputs[0].SetSourceTxOutput(
+	bTx.Inputs[p.InputIndex].SetSourceTxOutput(
 		&tx.TransactionOutput{
 			Satoshis:      targetAmount,
 			LockingScript: priorityScript,
@@ -57,22 +98,137 @@ func TripleFeePoolLoadTx(
 	// }
 
 	// 更新输入
-	// bTx.Inputs[0].UnlockingScript = unScript
-	bTx.Inputs[0].SequenceNumber = sequenceNumber
+	// bTx.Inputs[p.InputIndex].UnlockingScript = unScript
+	bTx.Inputs[p.InputIndex].SequenceNumber = sequenceNumber
 
 	// 更新输出金额
-	allAmount := bTx.Outputs[0].Satoshis + bTx.Outputs[1].Satoshis
-	// fmt.Printf("++++++++++++++++++++++++++++++++++++++++++ allAmount: %d\n", allAmount)
-	bTx.Outputs[0].Satoshis = serverAmount
-	bTx.Outputs[1].Satoshis = allAmount - serverAmount
-
-	// fmt.Printf("allamount: %d, ssatoshis 1: %d, satoshis 2: %d\n", allAmount, bTx.Outputs[0].Satoshis, bTx.Outputs[1].Satoshis)
+	// B-Tx 的手续费在开池时已确定，未显式给出时等于多签总额与输出之和的差，按策略重新分摊
+	fee := p.Fee
+	if fee == 0 {
+		var allAmount uint64
+		for _, out := range bTx.Outputs {
+			allAmount += out.Satoshis
+		}
+		if allAmount > targetAmount {
+			return nil, fmt.Errorf("%w: outputs %d exceed pool amount %d", multisig.ErrInvalidTransaction, allAmount, targetAmount)
+		}
+		fee = targetAmount - allAmount
+	}
+	scripts, err := p.payoutScripts()
+	if err != nil {
+		return nil, err
+	}
+	arbiterScript, err := ArbiterPayoutScript(serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	// 声明了支付脚本时，不接受支付到其他脚本的 B-Tx
+	if p.BPayoutScript != nil || p.APayoutScript != nil {
+		if err := multisig.CheckPayoutOutputs(bTx, append(scripts, arbiterScript), targetAmount); err != nil {
+			return nil, err
+		}
+	}
+	// 仲裁方退款不参与分配，A 方扣费前金额为多签总额减去 B 方金额与仲裁方退款
+	_, current, arbiterRefund, err := splitPayouts(bTx, scripts, arbiterScript)
+	if err != nil {
+		return nil, err
+	}
+	if serverAmount > targetAmount-arbiterRefund {
+		return nil, fmt.Errorf("b amount: %w", &multisig.InsufficientFundsError{Need: serverAmount, Have: targetAmount - arbiterRefund})
+	}
+	bOut, aOut, err := p.FeePolicy.ApplyTripleDust(serverAmount, targetAmount-arbiterRefund-serverAmount, fee, p.Dust)
+	if err != nil {
+		return nil, fmt.Errorf("b amount %d (%s): %w", serverAmount, p.FeePolicy, err)
+	}
+	if p.Dust.FixedLayout() {
+		bTx.Outputs[0].Satoshis = bOut
+		bTx.Outputs[1].Satoshis = aOut
+	} else {
+		// 粉尘布局会重建支付输出：沿用 B-Tx 中已有的支付脚本，被省略的一方取 scripts 中的脚本，
+		// 原有的仲裁方退款与承诺输出重新附加在末尾
+		commitment, hasCommitment := multisig.CommitmentOf(bTx)
+		bTx.Outputs, err = p.Dust.Layout([]multisig.Payout{
+			{Party: multisig.PartyB, Amount: bOut, LockingScript: current[0]},
+			{Party: multisig.PartyA, Amount: aOut, LockingScript: current[1]},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if arbiterRefund > 0 {
+			bTx.AddOutput(&tx.TransactionOutput{Satoshis: arbiterRefund, LockingScript: arbiterScript})
+		}
+		if hasCommitment {
+			bTx.AddOutput(commitment.Output())
+		}
+	}
+	if p.Commitment != nil {
+		if err := multisig.SetCommitment(bTx, *p.Commitment); err != nil {
+			return nil, err
+		}
+	}
 
-	// fmt.Printf("bTx 2: %s\n", bTx.Hex())
+	multisig.Logger().Debug("triple_endpoint: spend tx loaded for update",
+		"txid", bTx.TxID().String(),
+		"locktime", bTx.LockTime,
+		"sequence", sequenceNumber,
+		"b_amount", bOut,
+		"a_amount", aOut,
+		"outputs", len(bTx.Outputs),
+	)
 
 	return bTx, nil
 }
 
+// ValidateUpdateTransition 在签名前校验对方提出的更新：只允许金额与序列号变化，
+// 序列号必须严格递增，输出总额不得增加。它要求输出数量不变，金额为 0 的支付可能出现或消失时
+// （默认粉尘策略）应使用 ValidatePayoutUpdate。
+func ValidateUpdateTransition(prev, next *tx.Transaction) error {
+	return multisig.ValidateSpendTransition(prev, next)
+}
+
+// ValidatePayoutUpdate 校验更新只支付到开池时声明的 [B, A] 支付脚本（适用于任意粉尘策略），
+// 仲裁方退款保持不变，输出总额不得超过多签金额减 B-Tx 手续费。p 与构建 next 时传给 TripleFeePoolLoadTxV2 的参数相同，
+// p.Fee 为 0 时按 prev 推算手续费。
+func ValidatePayoutUpdate(prev, next *tx.Transaction, p UpdateParams) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	scripts, err := p.payoutScripts()
+	if err != nil {
+		return err
+	}
+	fee := p.Fee
+	if fee == 0 && prev != nil {
+		var prevTotal uint64
+		for _, out := range prev.Outputs {
+			prevTotal += out.Satoshis
+		}
+		if prevTotal > p.PoolAmount {
+			return fmt.Errorf("%w: outputs %d exceed pool amount %d", multisig.ErrInvalidTransaction, prevTotal, p.PoolAmount)
+		}
+		fee = p.PoolAmount - prevTotal
+	}
+	arbiterScript, err := ArbiterPayoutScript(p.ServerPublicKey)
+	if err != nil {
+		return err
+	}
+	if err := multisig.ValidatePayoutTransition(prev, next, append(scripts, arbiterScript), p.PoolAmount-fee); err != nil {
+		return err
+	}
+	_, _, prevRefund, err := splitPayouts(prev, scripts, arbiterScript)
+	if err != nil {
+		return err
+	}
+	_, _, nextRefund, err := splitPayouts(next, scripts, arbiterScript)
+	if err != nil {
+		return err
+	}
+	if prevRefund != nextRefund {
+		return fmt.Errorf("%w: arbiter refund changed from %d to %d", multisig.ErrTransitionMismatch, prevRefund, nextRefund)
+	}
+	return nil
+}
+
 // 双端费用池，分配资金, 客户端签名
 // client -> server 修改金额和版本号
 func ClientATripleFeePoolSpendTXUpdateSign(
@@ -81,6 +237,20 @@ func ClientATripleFeePoolSpendTXUpdateSign(
 	aPrivateKey *ec.PrivateKey,
 	bPublicKey *ec.PublicKey,
 ) (*[]byte, error) {
+	return ClientATripleFeePoolSpendTXUpdateSignAt(tx, 0, serverPublicKey, aPrivateKey, bPublicKey)
+}
+
+// ClientATripleFeePoolSpendTXUpdateSignAt 与 ClientATripleFeePoolSpendTXUpdateSign 相同，但为第 inputIndex 个输入签名。
+func ClientATripleFeePoolSpendTXUpdateSignAt(
+	tx *tx.Transaction,
+	inputIndex uint32,
+	serverPublicKey *ec.PublicKey,
+	aPrivateKey *ec.PrivateKey,
+	bPublicKey *ec.PublicKey,
+) (*[]byte, error) {
+	if tx == nil || int(inputIndex) >= len(tx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
 	// if locktime != nil {
 	// 	tx.LockTime = *locktime
 	// }
@@ -92,11 +262,13 @@ func ClientATripleFeePoolSpendTXUpdateSign(
 	}
 
 	// 重新签名所有输入
-	clientSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, 0, aPrivateKey)
+	clientSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, inputIndex, aPrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("c 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: a input %d: %w", multisig.ErrSigningFailed, inputIndex, err)
 	}
 
+	multisig.Logger().Debug("triple_endpoint: a signed update", "txid", tx.TxID().String(), "sequence", tx.Inputs[inputIndex].SequenceNumber)
+
 	return clientSignByte, nil
 }
 
@@ -108,6 +280,20 @@ func ClientTripleFeePoolSpendTXUpdateSign(
 	serverPublicKey *ec.PublicKey,
 	receiverPublicKey *ec.PublicKey,
 ) (*[]byte, error) {
+	return ClientTripleFeePoolSpendTXUpdateSignAt(tx, 0, clientPrivateKey, serverPublicKey, receiverPublicKey)
+}
+
+// ClientTripleFeePoolSpendTXUpdateSignAt 与 ClientTripleFeePoolSpendTXUpdateSign 相同，但为第 inputIndex 个输入签名。
+func ClientTripleFeePoolSpendTXUpdateSignAt(
+	tx *tx.Transaction,
+	inputIndex uint32,
+	clientPrivateKey *ec.PrivateKey,
+	serverPublicKey *ec.PublicKey,
+	receiverPublicKey *ec.PublicKey,
+) (*[]byte, error) {
+	if tx == nil || int(inputIndex) >= len(tx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
 	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
 	// 这里客户端作为 A 方签名，服务器和接收方作为其他两方
 	aMultisigUnlockingScriptTemplate, err := multisig.Unlock([]*ec.PrivateKey{clientPrivateKey}, []*ec.PublicKey{serverPublicKey, clientPrivateKey.PubKey(), receiverPublicKey}, 2, &sigHash)
@@ -116,10 +302,12 @@ func ClientTripleFeePoolSpendTXUpdateSign(
 	}
 
 	// 客户端签名
-	clientSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, 0, clientPrivateKey)
+	clientSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, inputIndex, clientPrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("client 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: client input %d: %w", multisig.ErrSigningFailed, inputIndex, err)
 	}
 
+	multisig.Logger().Debug("triple_endpoint: client signed update", "txid", tx.TxID().String(), "sequence", tx.Inputs[inputIndex].SequenceNumber)
+
 	return clientSignByte, nil
 }
@@ -19,6 +19,20 @@ func ClientBTripleFeePoolSpendTXUpdateSign(
 	aPublicKey *ec.PublicKey,
 	bPrivateKey *ec.PrivateKey,
 ) (*[]byte, error) {
+	return ClientBTripleFeePoolSpendTXUpdateSignAt(tx, 0, serverPublicKey, aPublicKey, bPrivateKey)
+}
+
+// ClientBTripleFeePoolSpendTXUpdateSignAt 与 ClientBTripleFeePoolSpendTXUpdateSign 相同，但为第 inputIndex 个输入签名。
+func ClientBTripleFeePoolSpendTXUpdateSignAt(
+	tx *tx.Transaction,
+	inputIndex uint32,
+	serverPublicKey *ec.PublicKey,
+	aPublicKey *ec.PublicKey,
+	bPrivateKey *ec.PrivateKey,
+) (*[]byte, error) {
+	if tx == nil || int(inputIndex) >= len(tx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
 	sigHash := sighash.Flag(sighash.ForkID | sighash.All)
 	aMultisigUnlockingScriptTemplate, err := multisig.Unlock([]*ec.PrivateKey{bPrivateKey}, []*ec.PublicKey{serverPublicKey, aPublicKey, bPrivateKey.PubKey()}, 2, &sigHash)
 	if err != nil {
@@ -26,10 +40,12 @@ func ClientBTripleFeePoolSpendTXUpdateSign(
 	}
 
 	// 重新签名所有输入
-	ClientBSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, 0, bPrivateKey)
+	ClientBSignByte, err := aMultisigUnlockingScriptTemplate.SignOne(tx, inputIndex, bPrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("d 重新签名输入 %d 失败: %v", 1, err)
+		return nil, fmt.Errorf("%w: b input %d: %w", multisig.ErrSigningFailed, inputIndex, err)
 	}
 
+	multisig.Logger().Debug("triple_endpoint: b signed update", "txid", tx.TxID().String(), "sequence", tx.Inputs[inputIndex].SequenceNumber)
+
 	return ClientBSignByte, nil
 }
@@ -13,44 +13,49 @@ import (
 )
 
 // verifyTripleSig 提供三方签名验证的公共实现。
+// 签名本身不合法时返回 *libs.SignatureError，交易上下文不完整时返回 libs.ErrInvalidTransaction。
 func verifyTripleSig(
 	transactionObject *tx.Transaction,
+	inputIndex uint32,
 	lockingScript *script.Script,
 	sourceSatoshis uint64,
+	party multisig.Party,
 	pub *ec.PublicKey,
 	signBytes *[]byte,
 ) (bool, error) {
-	if transactionObject == nil || len(transactionObject.Inputs) == 0 {
-		return false, fmt.Errorf("empty transaction or inputs")
+	if transactionObject == nil || int(inputIndex) >= len(transactionObject.Inputs) {
+		return false, fmt.Errorf("%w: empty transaction or inputs", multisig.ErrInvalidTransaction)
 	}
 	if signBytes == nil || len(*signBytes) < 10 {
-		return false, fmt.Errorf("invalid signature length")
+		return false, &multisig.SignatureError{Party: party, InputIndex: inputIndex, Err: multisig.ErrInvalidSignatureFormat}
 	}
 	flag := sighash.Flag(sighash.ForkID | sighash.All)
 	if (*signBytes)[len(*signBytes)-1] != byte(flag) {
-		return false, fmt.Errorf("unexpected sighash flag")
+		return false, &multisig.SignatureError{Party: party, InputIndex: inputIndex, Err: multisig.ErrUnexpectedSighash}
 	}
 
-	in := transactionObject.Inputs[0]
+	in := transactionObject.Inputs[inputIndex]
 	prev := in.SourceTxOutput()
 	in.SetSourceTxOutput(&tx.TransactionOutput{Satoshis: sourceSatoshis, LockingScript: lockingScript})
 
-	hash, err := transactionObject.CalcInputSignatureHash(0, flag)
+	hash, err := transactionObject.CalcInputSignatureHash(inputIndex, flag)
 	if err != nil {
 		in.SetSourceTxOutput(prev)
-		return false, fmt.Errorf("calc sighash failed: %w", err)
+		return false, fmt.Errorf("%w: calc sighash: %w", multisig.ErrInvalidTransaction, err)
 	}
 	sigDER := (*signBytes)[:len(*signBytes)-1]
 	sig, err := ec.ParseDERSignature(sigDER)
 	if err != nil {
 		in.SetSourceTxOutput(prev)
-		return false, fmt.Errorf("parse der failed: %w", err)
+		return false, &multisig.SignatureError{Party: party, InputIndex: inputIndex, Err: fmt.Errorf("%w: %w", multisig.ErrInvalidSignatureFormat, err)}
 	}
 	ok := ecdsa.Verify(hash, sig, pub.ToECDSA())
 	in.SetSourceTxOutput(prev)
 	if !ok {
-		return false, fmt.Errorf("signature verify failed")
+		multisig.Logger().Debug("triple_endpoint: signature rejected", "party", party)
+		return false, &multisig.SignatureError{Party: party, InputIndex: inputIndex}
 	}
+	multisig.Logger().Debug("triple_endpoint: signature verified", "party", party)
 	return true, nil
 }
 
@@ -62,12 +67,25 @@ func ServerVerifyClientASig(
 	aPublicKey *ec.PublicKey,
 	escrowPublicKey *ec.PublicKey,
 	aSignBytes *[]byte,
+) (bool, error) {
+	return ServerVerifyClientASigAt(transactionObject, 0, totalAmount, serverPublicKey, aPublicKey, escrowPublicKey, aSignBytes)
+}
+
+// ServerVerifyClientASigAt 与 ServerVerifyClientASig 相同，但验证第 inputIndex 个输入上的签名。
+func ServerVerifyClientASigAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	totalAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	aPublicKey *ec.PublicKey,
+	escrowPublicKey *ec.PublicKey,
+	aSignBytes *[]byte,
 ) (bool, error) {
 	redeem, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, aPublicKey, escrowPublicKey}, 2)
 	if err != nil {
-		return false, fmt.Errorf("build redeem script: %w", err)
+		return false, fmt.Errorf("failed to create redeem script: %w", err)
 	}
-	return verifyTripleSig(transactionObject, redeem, totalAmount, aPublicKey, aSignBytes)
+	return verifyTripleSig(transactionObject, inputIndex, redeem, totalAmount, multisig.PartyA, aPublicKey, aSignBytes)
 }
 
 // ClientVerifyServerSig 用于验证服务器在三方花费交易中的签名。
@@ -78,12 +96,25 @@ func ClientVerifyServerSig(
 	aPublicKey *ec.PublicKey,
 	escrowPublicKey *ec.PublicKey,
 	serverSignBytes *[]byte,
+) (bool, error) {
+	return ClientVerifyServerSigAt(transactionObject, 0, totalAmount, serverPublicKey, aPublicKey, escrowPublicKey, serverSignBytes)
+}
+
+// ClientVerifyServerSigAt 与 ClientVerifyServerSig 相同，但验证第 inputIndex 个输入上的签名。
+func ClientVerifyServerSigAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	totalAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	aPublicKey *ec.PublicKey,
+	escrowPublicKey *ec.PublicKey,
+	serverSignBytes *[]byte,
 ) (bool, error) {
 	redeem, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, aPublicKey, escrowPublicKey}, 2)
 	if err != nil {
-		return false, fmt.Errorf("build redeem script: %w", err)
+		return false, fmt.Errorf("failed to create redeem script: %w", err)
 	}
-	return verifyTripleSig(transactionObject, redeem, totalAmount, serverPublicKey, serverSignBytes)
+	return verifyTripleSig(transactionObject, inputIndex, redeem, totalAmount, multisig.PartyServer, serverPublicKey, serverSignBytes)
 }
 
 // ServerVerifyClientBSig 用于验证托管方（B 方）在三方花费交易中的签名。
@@ -94,10 +125,23 @@ func ServerVerifyClientBSig(
 	aPublicKey *ec.PublicKey,
 	escrowPublicKey *ec.PublicKey,
 	bSignBytes *[]byte,
+) (bool, error) {
+	return ServerVerifyClientBSigAt(transactionObject, 0, totalAmount, serverPublicKey, aPublicKey, escrowPublicKey, bSignBytes)
+}
+
+// ServerVerifyClientBSigAt 与 ServerVerifyClientBSig 相同，但验证第 inputIndex 个输入上的签名。
+func ServerVerifyClientBSigAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	totalAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	aPublicKey *ec.PublicKey,
+	escrowPublicKey *ec.PublicKey,
+	bSignBytes *[]byte,
 ) (bool, error) {
 	redeem, err := multisig.Lock([]*ec.PublicKey{serverPublicKey, aPublicKey, escrowPublicKey}, 2)
 	if err != nil {
-		return false, fmt.Errorf("build redeem script: %w", err)
+		return false, fmt.Errorf("failed to create redeem script: %w", err)
 	}
-	return verifyTripleSig(transactionObject, redeem, totalAmount, escrowPublicKey, bSignBytes)
+	return verifyTripleSig(transactionObject, inputIndex, redeem, totalAmount, multisig.PartyB, escrowPublicKey, bSignBytes)
 }
@@ -0,0 +1,64 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 三方池 B-Tx 的承诺输出位于 [B, A] 之后，更新可以更换承诺，但不能改动支付脚本。
+func TestTripleCommitment(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const pool = uint64(100000)
+
+	receipt := libs.HashCommitment([]byte("usage:0"))
+	res, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		PrevTxID:        "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		PoolAmount:      pool,
+		EndHeight:       900000,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		FeeRate:         50,
+		Commitment:      &receipt,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if got, ok := libs.CommitmentOf(res.Tx); !ok || got != receipt || len(res.Tx.Outputs) != 2 {
+		t.Fatalf("opening B-Tx must omit the 0-sat B payout and end with the commitment output")
+	}
+
+	next := libs.HashCommitment([]byte("usage:42"))
+	update := UpdateParams{
+		TxHex:           res.Tx.Hex(),
+		Sequence:        2,
+		BAmount:         40000,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      pool,
+		Commitment:      &next,
+	}
+	updated, err := TripleFeePoolLoadTxV2(update)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got, _ := libs.CommitmentOf(updated); got != next || len(updated.Outputs) != 3 || updated.Outputs[0].Satoshis != 40000 {
+		t.Fatalf("update must restore the B payout before the commitment output")
+	}
+	if err := ValidatePayoutUpdate(res.Tx, updated, update); err != nil {
+		t.Fatalf("transition: %v", err)
+	}
+	redirected, _ := tx.NewTransactionFromHex(updated.Hex())
+	redirected.Outputs[0].LockingScript = redirected.Outputs[1].LockingScript
+	if err := ValidatePayoutUpdate(res.Tx, redirected, update); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for redirected payout, got %v", err)
+	}
+}
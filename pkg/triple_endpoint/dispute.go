@@ -0,0 +1,408 @@
+package triple_endpoint
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	ecdsa "github.com/bsv-blockchain/go-sdk/primitives/ecdsa"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 仲裁：A、B 对最近一次双方签名的 B-Tx 之后的分配有争议时，由仲裁方（服务器）裁定，与胜方共同签名结算。
+//  1. 发起方（A 或 B）用 OpenDispute 提交争议：争议所针对的状态、主张的 B 方金额与证据，并对声明签名。
+//  2. 仲裁方核对后用 ProposeResolution 裁定 B 方金额与回签的胜方，构建结算交易并签名。
+//  3. 胜方用 CountersignResolution 核对裁定并回签，按 [server, A, B] 的顺序合并签名，得到可立即广播的结算交易。
+//
+// 结算交易基于争议状态，只改变金额，序列号为 libs.FinalSequence，因此不受 locktime 约束。
+// 每一步都向争议记录追加一条哈希链事件，Dispute 可 JSON 序列化后在各方之间传递，
+// 任何人都可以用 AuditDispute 核对记录中的签名、交易与事件链。
+
+// DisputeStatus 是争议的处理阶段。
+type DisputeStatus string
+
+const (
+	DisputeOpened   DisputeStatus = "opened"
+	DisputeProposed DisputeStatus = "proposed"
+	DisputeResolved DisputeStatus = "resolved"
+)
+
+// disputeSteps 是争议记录中事件的固定顺序。
+var disputeSteps = []DisputeStatus{DisputeOpened, DisputeProposed, DisputeResolved}
+
+// DisputeClaim 是发起方提交的争议声明。
+type DisputeClaim struct {
+	Claimant  libs.Party `json:"claimant"`
+	BAmount   uint64     `json:"b_amount"`  // 主张的 B 方输出金额
+	Evidence  []byte     `json:"evidence"`  // 证据原文
+	Signature []byte     `json:"signature"` // 发起方对声明摘要的 DER 签名
+}
+
+// DisputeResolution 是仲裁方的裁定与签名的结算交易。
+type DisputeResolution struct {
+	BAmount         uint64     `json:"b_amount"` // 裁定的 B 方输出金额
+	Winner          libs.Party `json:"winner"`
+	Reason          string     `json:"reason"`
+	TxHex           string     `json:"tx_hex"` // 结算交易，尚未合并签名
+	ServerSignBytes *[]byte    `json:"server_sign_bytes"`
+}
+
+// DisputeEvent 是争议记录中的一条事件，Hash 覆盖上一条事件的 Hash，构成哈希链。
+type DisputeEvent struct {
+	Status   DisputeStatus `json:"status"`
+	Party    libs.Party    `json:"party"`
+	Digest   string        `json:"digest"` // 本步材料的摘要（hex）
+	PrevHash string        `json:"prev_hash"`
+	Hash     string        `json:"hash"`
+}
+
+// Dispute 是一次争议的完整记录。
+type Dispute struct {
+	ID              string             `json:"id"` // 第一条事件的 Hash
+	Status          DisputeStatus      `json:"status"`
+	StateTxHex      string             `json:"state_tx_hex"` // 争议所针对的 A、B 双方签名的 B-Tx
+	PoolAmount      uint64             `json:"pool_amount"`
+	ServerPublicKey *ec.PublicKey      `json:"server_public_key"`
+	APublicKey      *ec.PublicKey      `json:"a_public_key"`
+	BPublicKey      *ec.PublicKey      `json:"b_public_key"`
+	Claim           DisputeClaim       `json:"claim"`
+	Resolution      *DisputeResolution `json:"resolution,omitempty"`
+	FinalTxHex      string             `json:"final_tx_hex,omitempty"` // 仲裁方与胜方签名的结算交易
+	Log             []DisputeEvent     `json:"log"`
+}
+
+// OpenDispute 由 A 方或 B 方发起争议：核对争议状态确实由 A、B 双方签名，对声明签名并创建争议记录。
+func OpenDispute(p OpenDisputeParams) (*Dispute, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	d := &Dispute{
+		StateTxHex:      p.State.Hex(),
+		PoolAmount:      p.PoolAmount,
+		ServerPublicKey: p.ServerPublicKey,
+		APublicKey:      p.APublicKey,
+		BPublicKey:      p.BPublicKey,
+		Claim:           DisputeClaim{Claimant: p.Claimant, BAmount: p.BAmount, Evidence: p.Evidence},
+	}
+	state, err := d.state()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.buildResolution(state, p.BAmount); err != nil {
+		return nil, err
+	}
+	digest := d.claimDigest()
+	sig, err := p.ClaimantPrivateKey.Sign(digest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dispute claim: %w", libs.ErrSigningFailed, err)
+	}
+	d.Claim.Signature = sig.Serialize()
+	d.appendEvent(DisputeOpened, p.Claimant, digest)
+	d.ID = d.Log[0].Hash
+
+	libs.Logger().Debug("triple_endpoint: dispute opened", "id", d.ID, "claimant", p.Claimant, "b_amount", p.BAmount)
+	return d, nil
+}
+
+// ProposeResolution 由仲裁方核对争议记录后给出裁定：按 BAmount 构建结算交易并签名，交由胜方回签。
+func ProposeResolution(d *Dispute, p ProposeResolutionParams) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if err := AuditDispute(d); err != nil {
+		return err
+	}
+	if d.Status != DisputeOpened {
+		return fmt.Errorf("%w: dispute %s is %s", libs.ErrInvalidState, d.ID, d.Status)
+	}
+	if !p.ServerPrivateKey.PubKey().IsEqual(d.ServerPublicKey) {
+		return invalidParams("server private key does not match the dispute")
+	}
+	state, _ := d.state()
+	resolution, err := d.buildResolution(state, p.BAmount)
+	if err != nil {
+		return err
+	}
+	serverSig, err := signTripleInput(resolution, d, p.ServerPrivateKey)
+	if err != nil {
+		return err
+	}
+	d.Resolution = &DisputeResolution{
+		BAmount:         p.BAmount,
+		Winner:          p.Winner,
+		Reason:          p.Reason,
+		TxHex:           resolution.Hex(),
+		ServerSignBytes: serverSig,
+	}
+	d.appendEvent(DisputeProposed, libs.PartyServer, d.resolutionDigest())
+
+	libs.Logger().Debug("triple_endpoint: dispute resolution proposed", "id", d.ID, "winner", p.Winner, "b_amount", p.BAmount)
+	return nil
+}
+
+// CountersignResolution 由胜方核对争议记录与仲裁方签名后回签，合并签名并返回可广播的结算交易。
+func CountersignResolution(d *Dispute, winnerPrivateKey *ec.PrivateKey) (*tx.Transaction, error) {
+	if winnerPrivateKey == nil {
+		return nil, invalidParams("winner private key is required")
+	}
+	if err := AuditDispute(d); err != nil {
+		return nil, err
+	}
+	if d.Status != DisputeProposed {
+		return nil, fmt.Errorf("%w: dispute %s is %s", libs.ErrInvalidState, d.ID, d.Status)
+	}
+	winner := d.Resolution.Winner
+	if !winnerPrivateKey.PubKey().IsEqual(d.partyKey(winner)) {
+		return nil, invalidParams("only the winner (%s) can countersign the resolution", winner)
+	}
+	resolution, err := tx.NewTransactionFromHex(d.Resolution.TxHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode resolution: %w", libs.ErrInvalidTransaction, err)
+	}
+	winnerSig, err := signTripleInput(resolution, d, winnerPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	final, err := MergeTripleFeePoolSigPairAt(d.Resolution.TxHex, 0,
+		TripleSignature{Party: winner, SignBytes: winnerSig},
+		TripleSignature{Party: libs.PartyServer, SignBytes: d.Resolution.ServerSignBytes},
+	)
+	if err != nil {
+		return nil, err
+	}
+	redeem, err := TripleFeePoolSpentScript(d.ServerPublicKey, d.APublicKey, d.BPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	final.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: d.PoolAmount, LockingScript: redeem})
+	d.FinalTxHex = final.Hex()
+	d.appendEvent(DisputeResolved, winner, disputeHash([]byte("final"), final.Bytes()))
+
+	libs.Logger().Debug("triple_endpoint: dispute resolved", "id", d.ID, "winner", winner, "txid", final.TxID().String())
+	return final, nil
+}
+
+// AuditDispute 核对争议记录：事件链与各阶段材料一致，声明签名有效、争议状态由 A、B 签名，
+// 结算交易与裁定金额一致且带有仲裁方（和胜方）的有效签名。签名无效时返回 *libs.SignatureError，
+// 记录被篡改时返回 libs.ErrAuditMismatch。
+func AuditDispute(d *Dispute) error {
+	if d == nil || d.ServerPublicKey == nil || d.APublicKey == nil || d.BPublicKey == nil || d.PoolAmount == 0 {
+		return fmt.Errorf("%w: dispute record is incomplete", libs.ErrAuditMismatch)
+	}
+	steps := 0
+	for i, status := range disputeSteps {
+		if d.Status == status {
+			steps = i + 1
+		}
+	}
+	if steps == 0 || len(d.Log) != steps || (steps >= 2) != (d.Resolution != nil) || (steps == 3) != (d.FinalTxHex != "") {
+		return fmt.Errorf("%w: dispute status %q does not match its record", libs.ErrAuditMismatch, d.Status)
+	}
+
+	// 1. 声明与争议状态
+	state, err := d.state()
+	if err != nil {
+		return err
+	}
+	claimantKey := d.partyKey(d.Claim.Claimant)
+	if claimantKey == nil || (d.Claim.Claimant != libs.PartyA && d.Claim.Claimant != libs.PartyB) {
+		return fmt.Errorf("%w: claimant %q", libs.ErrAuditMismatch, d.Claim.Claimant)
+	}
+	claimDigest := d.claimDigest()
+	if sig, err := ec.ParseDERSignature(d.Claim.Signature); err != nil || !ecdsa.Verify(claimDigest, sig, claimantKey.ToECDSA()) {
+		return &libs.SignatureError{Party: d.Claim.Claimant, Err: fmt.Errorf("dispute claim signature does not verify")}
+	}
+	digests := [][]byte{claimDigest}
+	parties := []libs.Party{d.Claim.Claimant}
+
+	// 2. 裁定：结算交易必须能由争议状态按裁定金额重建，并带有仲裁方签名
+	if steps >= 2 {
+		r := d.Resolution
+		if r.Winner != libs.PartyA && r.Winner != libs.PartyB {
+			return fmt.Errorf("%w: winner %q", libs.ErrAuditMismatch, r.Winner)
+		}
+		resolution, err := tx.NewTransactionFromHex(r.TxHex)
+		if err != nil {
+			return fmt.Errorf("%w: decode resolution: %w", libs.ErrAuditMismatch, err)
+		}
+		expected, err := d.buildResolution(state, r.BAmount)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(libs.UnsignedBytes(resolution), libs.UnsignedBytes(expected)) {
+			return fmt.Errorf("%w: resolution tx does not pay the ruled amounts", libs.ErrAuditMismatch)
+		}
+		redeem, err := TripleFeePoolSpentScript(d.ServerPublicKey, d.APublicKey, d.BPublicKey)
+		if err != nil {
+			return err
+		}
+		if _, err := verifyTripleSig(resolution, 0, redeem, d.PoolAmount, libs.PartyServer, d.ServerPublicKey, r.ServerSignBytes); err != nil {
+			return err
+		}
+		digests = append(digests, d.resolutionDigest())
+		parties = append(parties, libs.PartyServer)
+	}
+
+	// 3. 结算：最终交易由仲裁方与胜方签名
+	if steps == 3 {
+		final, err := tx.NewTransactionFromHex(d.FinalTxHex)
+		if err != nil {
+			return fmt.Errorf("%w: decode final tx: %w", libs.ErrAuditMismatch, err)
+		}
+		resolution, _ := tx.NewTransactionFromHex(d.Resolution.TxHex)
+		if !bytes.Equal(libs.UnsignedBytes(final), libs.UnsignedBytes(resolution)) {
+			return fmt.Errorf("%w: final tx differs from the resolution", libs.ErrAuditMismatch)
+		}
+		signers, err := VerifyTripleSignerPairAt(final, 0, d.PoolAmount, d.ServerPublicKey, d.APublicKey, d.BPublicKey)
+		if err != nil {
+			return err
+		}
+		if signers[0] != libs.PartyServer || signers[1] != d.Resolution.Winner {
+			return fmt.Errorf("%w: final tx is signed by %s and %s", libs.ErrAuditMismatch, signers[0], signers[1])
+		}
+		digests = append(digests, disputeHash([]byte("final"), final.Bytes()))
+		parties = append(parties, d.Resolution.Winner)
+	}
+
+	// 事件链
+	prev := ""
+	for i, event := range d.Log {
+		expected := newDisputeEvent(prev, disputeSteps[i], parties[i], digests[i])
+		if event != expected {
+			return fmt.Errorf("%w: event %d (%s)", libs.ErrAuditMismatch, i, event.Status)
+		}
+		prev = event.Hash
+	}
+	if d.ID != d.Log[0].Hash {
+		return fmt.Errorf("%w: dispute id", libs.ErrAuditMismatch)
+	}
+	return nil
+}
+
+// state 解析争议状态并核对其由 A、B 双方签名。
+func (d *Dispute) state() (*tx.Transaction, error) {
+	state, err := tx.NewTransactionFromHex(d.StateTxHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode dispute state: %w", libs.ErrInvalidTransaction, err)
+	}
+	if !spendState(state) {
+		return nil, invalidParams("dispute state must be a spend tx with one input and one or two payout outputs plus an optional arbiter refund")
+	}
+	signers, err := VerifyTripleSignerPairAt(state, 0, d.PoolAmount, d.ServerPublicKey, d.APublicKey, d.BPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if signers[0] != libs.PartyA || signers[1] != libs.PartyB {
+		return nil, invalidParams("dispute state must be signed by a and b, got %s and %s", signers[0], signers[1])
+	}
+	return state, nil
+}
+
+// buildResolution 由争议状态构建结算交易：B 方输出为 bAmount，其余扣除原手续费后归 A 方，序列号为 FinalSequence。
+func (d *Dispute) buildResolution(state *tx.Transaction, bAmount uint64) (*tx.Transaction, error) {
+	resolution, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex:           state.Hex(),
+		Sequence:        libs.FinalSequence,
+		BAmount:         bAmount,
+		ServerPublicKey: d.ServerPublicKey,
+		APublicKey:      d.APublicKey,
+		BPublicKey:      d.BPublicKey,
+		PoolAmount:      d.PoolAmount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resolution.Inputs[0].UnlockingScript = &script.Script{}
+	return resolution, nil
+}
+
+// claimDigest 是发起方签名的声明摘要，覆盖争议状态、三方公钥、主张金额与证据。
+func (d *Dispute) claimDigest() []byte {
+	return disputeHash([]byte("claim"), []byte(d.StateTxHex), uint64Bytes(d.PoolAmount),
+		d.ServerPublicKey.Compressed(), d.APublicKey.Compressed(), d.BPublicKey.Compressed(),
+		[]byte(d.Claim.Claimant), uint64Bytes(d.Claim.BAmount), d.Claim.Evidence)
+}
+
+func (d *Dispute) resolutionDigest() []byte {
+	r := d.Resolution
+	var serverSig []byte
+	if r.ServerSignBytes != nil {
+		serverSig = *r.ServerSignBytes
+	}
+	return disputeHash([]byte("resolution"), []byte(r.TxHex), uint64Bytes(r.BAmount), []byte(r.Winner), []byte(r.Reason), serverSig)
+}
+
+// partyKey 返回 party 在池中的公钥。
+func (d *Dispute) partyKey(party libs.Party) *ec.PublicKey {
+	switch party {
+	case libs.PartyServer:
+		return d.ServerPublicKey
+	case libs.PartyA:
+		return d.APublicKey
+	case libs.PartyB:
+		return d.BPublicKey
+	default:
+		return nil
+	}
+}
+
+func (d *Dispute) appendEvent(status DisputeStatus, party libs.Party, digest []byte) {
+	prev := ""
+	if len(d.Log) > 0 {
+		prev = d.Log[len(d.Log)-1].Hash
+	}
+	d.Log = append(d.Log, newDisputeEvent(prev, status, party, digest))
+	d.Status = status
+}
+
+func newDisputeEvent(prevHash string, status DisputeStatus, party libs.Party, digest []byte) DisputeEvent {
+	hash := disputeHash([]byte("event"), []byte(prevHash), []byte(status), []byte(party), digest)
+	return DisputeEvent{
+		Status:   status,
+		Party:    party,
+		Digest:   hex.EncodeToString(digest),
+		PrevHash: prevHash,
+		Hash:     hex.EncodeToString(hash),
+	}
+}
+
+// signTripleInput 由 privateKey 对结算交易的多签输入签名。
+func signTripleInput(t *tx.Transaction, d *Dispute, privateKey *ec.PrivateKey) (*[]byte, error) {
+	redeem, err := TripleFeePoolSpentScript(d.ServerPublicKey, d.APublicKey, d.BPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	t.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: d.PoolAmount, LockingScript: redeem})
+	flag := sighash.Flag(sighash.ForkID | sighash.All)
+	template, err := libs.Unlock([]*ec.PrivateKey{privateKey}, []*ec.PublicKey{d.ServerPublicKey, d.APublicKey, d.BPublicKey}, 2, &flag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unlocking script template: %w", err)
+	}
+	signBytes, err := template.SignOne(t, 0, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dispute resolution: %w", libs.ErrSigningFailed, err)
+	}
+	return signBytes, nil
+}
+
+// disputeHash 对带长度前缀的各部分做 SHA-256，域分隔前缀避免与其他摘要混用。
+func disputeHash(parts ...[]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("KeymasterMultisigPool/triple-dispute"))
+	for _, part := range parts {
+		h.Write(uint64Bytes(uint64(len(part))))
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+func uint64Bytes(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
@@ -0,0 +1,174 @@
+package triple_endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 任意两方的签名按 [server, A, B] 顺序合并后都能花费三方池，传入顺序无关。
+func TestTripleMergeSigPair(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const pool = uint64(100000)
+
+	spend, _, err := SubBuildTripleFeePoolSpendTX("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", pool, 900000, sPriv.PubKey(), aPriv, bPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	redeem, _ := TripleFeePoolSpentScript(sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey())
+	spend.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: pool, LockingScript: redeem})
+	flag := sighash.Flag(sighash.ForkID | sighash.All)
+	sigs := map[libs.Party]*[]byte{}
+	for party, priv := range map[libs.Party]*ec.PrivateKey{libs.PartyServer: sPriv, libs.PartyA: aPriv, libs.PartyB: bPriv} {
+		template, _ := libs.Unlock([]*ec.PrivateKey{priv}, []*ec.PublicKey{sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey()}, 2, &flag)
+		sigs[party], err = template.SignOne(spend, 0, priv)
+		if err != nil {
+			t.Fatalf("%s sign: %v", party, err)
+		}
+	}
+
+	for _, pair := range [][2]libs.Party{{libs.PartyB, libs.PartyServer}, {libs.PartyA, libs.PartyServer}, {libs.PartyB, libs.PartyA}} {
+		merged, err := MergeTripleFeePoolSigPairAt(spend.Hex(), 0,
+			TripleSignature{Party: pair[0], SignBytes: sigs[pair[0]]},
+			TripleSignature{Party: pair[1], SignBytes: sigs[pair[1]]},
+		)
+		if err != nil {
+			t.Fatalf("merge %v: %v", pair, err)
+		}
+		err = interpreter.NewEngine().Execute(
+			interpreter.WithTx(merged, 0, spend.Inputs[0].SourceTxOutput()),
+			interpreter.WithForkID(),
+			interpreter.WithAfterGenesis(),
+		)
+		if err != nil {
+			t.Fatalf("%v failed script check: %v", pair, err)
+		}
+		signers, err := VerifyTripleSignerPairAt(merged, 0, pool, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey())
+		if err != nil || signers[0] != pair[1] || signers[1] != pair[0] {
+			t.Fatalf("%v: unexpected signers %v (%v)", pair, signers, err)
+		}
+	}
+	if _, err := MergeTripleFeePoolSigPairAt(spend.Hex(), 0, TripleSignature{Party: libs.PartyA, SignBytes: sigs[libs.PartyA]}, TripleSignature{Party: libs.PartyA, SignBytes: sigs[libs.PartyA]}); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a duplicated party, got %v", err)
+	}
+}
+
+// 争议：B 发起争议，仲裁方裁定后由 B 回签结算；记录经 JSON 传递，篡改任何一步都无法通过审计。
+func TestTripleDispute(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const pool = uint64(100000)
+
+	// A、B 双方签名的最新状态：B 得到 30000
+	initial, _, err := SubBuildTripleFeePoolSpendTX("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", pool, 900000, sPriv.PubKey(), aPriv, bPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	next, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex: initial.Hex(), Sequence: 2, BAmount: 30000, PoolAmount: pool,
+		ServerPublicKey: sPriv.PubKey(), APublicKey: aPriv.PubKey(), BPublicKey: bPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	aSig, _ := ClientATripleFeePoolSpendTXUpdateSign(next, sPriv.PubKey(), aPriv, bPriv.PubKey())
+	bSig, _ := ClientBTripleFeePoolSpendTXUpdateSign(next, sPriv.PubKey(), aPriv.PubKey(), bPriv)
+	state, err := MergeTripleFeePoolSigForSpendTx(next.Hex(), aSig, bSig)
+	if err != nil {
+		t.Fatalf("merge state: %v", err)
+	}
+
+	open := OpenDisputeParams{
+		State: state, PoolAmount: pool, Claimant: libs.PartyB, ClaimantPrivateKey: bPriv, BAmount: 45000,
+		ServerPublicKey: sPriv.PubKey(), APublicKey: aPriv.PubKey(), BPublicKey: bPriv.PubKey(),
+		Evidence: []byte("delivery receipt #42"),
+	}
+	unsigned := open
+	unsigned.State = initial
+	if _, err := OpenDispute(unsigned); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for a state not signed by A and B, got %v", err)
+	}
+	opened, err := OpenDispute(open)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	// 仲裁方收到记录后裁定 B 得 40000，由 B 回签
+	var received Dispute
+	disputeRoundTrip(t, opened, &received)
+	if err := ProposeResolution(&received, ProposeResolutionParams{BAmount: 40000, Winner: libs.PartyB, Reason: "partial delivery", ServerPrivateKey: sPriv}); err != nil {
+		t.Fatalf("propose: %v", err)
+	}
+	var ruling Dispute
+	disputeRoundTrip(t, &received, &ruling)
+	if _, err := CountersignResolution(&ruling, aPriv); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams when the loser countersigns, got %v", err)
+	}
+	final, err := CountersignResolution(&ruling, bPriv)
+	if err != nil {
+		t.Fatalf("countersign: %v", err)
+	}
+	err = interpreter.NewEngine().Execute(
+		interpreter.WithTx(final, 0, final.Inputs[0].SourceTxOutput()),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("resolution failed script check: %v", err)
+	}
+	if final.Outputs[0].Satoshis != 40000 || final.Outputs[0].Satoshis+final.Outputs[1].Satoshis != state.Outputs[0].Satoshis+state.Outputs[1].Satoshis {
+		t.Fatalf("unexpected resolution outputs %d/%d", final.Outputs[0].Satoshis, final.Outputs[1].Satoshis)
+	}
+	if final.Inputs[0].SequenceNumber != libs.FinalSequence {
+		t.Fatalf("resolution must not wait for the locktime")
+	}
+	if err := ProposeResolution(&ruling, ProposeResolutionParams{BAmount: 0, Winner: libs.PartyA, ServerPrivateKey: sPriv}); !errors.Is(err, libs.ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState for a resolved dispute, got %v", err)
+	}
+
+	// 审计：完整记录通过，任何篡改都被发现
+	var audited Dispute
+	disputeRoundTrip(t, &ruling, &audited)
+	if err := AuditDispute(&audited); err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	tampers := map[string]struct {
+		mutate func(*Dispute)
+		want   error
+	}{
+		"evidence": {func(d *Dispute) { d.Claim.Evidence = []byte("forged receipt") }, libs.ErrBadSignature},
+		"reason":   {func(d *Dispute) { d.Resolution.Reason = "full delivery" }, libs.ErrAuditMismatch},
+		"ruling":   {func(d *Dispute) { d.Resolution.BAmount = 45000 }, libs.ErrAuditMismatch},
+		"log":      {func(d *Dispute) { d.Log = d.Log[:2] }, libs.ErrAuditMismatch},
+		"winner":   {func(d *Dispute) { d.Resolution.Winner = libs.PartyA }, libs.ErrAuditMismatch},
+	}
+	for name, tamper := range tampers {
+		var copied Dispute
+		disputeRoundTrip(t, &ruling, &copied)
+		tamper.mutate(&copied)
+		if err := AuditDispute(&copied); !errors.Is(err, tamper.want) {
+			t.Fatalf("%s: expected %v, got %v", name, tamper.want, err)
+		}
+	}
+}
+
+func disputeRoundTrip(t *testing.T, in *Dispute, out *Dispute) {
+	t.Helper()
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+}
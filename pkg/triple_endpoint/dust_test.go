@@ -0,0 +1,176 @@
+package triple_endpoint
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 三方池开池时 B 没有余额：DustDrop 只保留 A 的输出，更新后 B 的输出按 [B, A] 顺序重新出现。
+func TestTripleDustDrop(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const pool = uint64(100000)
+	drop := libs.DustPolicy{Action: libs.DustDrop}
+
+	res, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		PrevTxID:        "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		PoolAmount:      pool,
+		EndHeight:       900000,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		FeeRate:         50,
+		Dust:            drop,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	scripts, err := PayoutScripts(bPriv.PubKey(), aPriv.PubKey())
+	if err != nil {
+		t.Fatalf("payout scripts: %v", err)
+	}
+	if len(res.Tx.Outputs) != 1 || !res.Tx.Outputs[0].LockingScript.Equals(scripts[1]) || res.Amount+res.Fee != pool {
+		t.Fatalf("expected a single A output, got %d outputs", len(res.Tx.Outputs))
+	}
+	bSig, err := SpendTXTripleFeePoolBSign(res.Tx, pool, sPriv.PubKey(), aPriv.PubKey(), bPriv)
+	if err != nil {
+		t.Fatalf("b sign: %v", err)
+	}
+	if ok, err := ServerVerifyClientASig(res.Tx, pool, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), res.ASignBytes); !ok || err != nil {
+		t.Fatalf("verify a sig: %v", err)
+	}
+	if ok, err := ServerVerifyClientBSig(res.Tx, pool, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), bSig); !ok || err != nil {
+		t.Fatalf("verify b sig: %v", err)
+	}
+
+	update := UpdateParams{
+		TxHex:           res.Tx.Hex(),
+		Sequence:        2,
+		BAmount:         40000,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      pool,
+		Fee:             res.Fee,
+		Dust:            drop,
+	}
+	updated, err := TripleFeePoolLoadTxV2(update)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if len(updated.Outputs) != 2 || !updated.Outputs[0].LockingScript.Equals(scripts[0]) ||
+		updated.Outputs[0].Satoshis != 40000 || updated.Outputs[1].Satoshis != pool-40000-res.Fee {
+		t.Fatalf("unexpected update layout")
+	}
+	if err := ValidatePayoutUpdate(res.Tx, updated, update); err != nil {
+		t.Fatalf("payout transition: %v", err)
+	}
+}
+
+// 位置参数版本使用 DustKeepZero：B 分到几乎全部金额时，A 扣费后低于粉尘限额的输出照常保留。
+func TestTripleDustPositionalBoundary(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const pool = uint64(50000)
+
+	open, aAmount, err := SubBuildTripleFeePoolSpendTX("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", pool, 900000, sPriv.PubKey(), aPriv, bPriv.PubKey(), true, 50)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	fee := pool - aAmount
+	next, err := TripleFeePoolLoadTx(open.Hex(), nil, 2, 49800, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), pool)
+	if err != nil {
+		t.Fatalf("update near the boundary: %v", err)
+	}
+	if len(next.Outputs) != 2 || next.Outputs[0].Satoshis != 49800 || next.Outputs[1].Satoshis != 200-fee {
+		t.Fatalf("unexpected update outputs %d/%d", next.Outputs[0].Satoshis, next.Outputs[1].Satoshis)
+	}
+}
+
+// dustVector 是 tests/vectors/dust_layout.json 中的一项，TS 端的 tests/triple_endpoint/dust_layout.test.ts 使用同一文件。
+type dustVector struct {
+	Name     string `json:"name"`
+	Prev     string `json:"prev"`
+	Sequence uint32 `json:"sequence"`
+	BAmount  uint64 `json:"bAmount"`
+	Dust     struct {
+		Action libs.DustAction `json:"action"`
+		Limit  uint64          `json:"limit"`
+	} `json:"dust"`
+	Hex string `json:"hex"`
+}
+
+// 跨语言向量：Go 与 TS 按相同的粉尘策略开池与更新，得到逐字节相同的未签名 B-Tx。
+func TestTripleDustVectors(t *testing.T) {
+	data, err := os.ReadFile("../../tests/vectors/dust_layout.json")
+	if err != nil {
+		t.Fatalf("read vectors: %v", err)
+	}
+	var file struct {
+		Triple struct {
+			APrivHex      string       `json:"aPrivHex"`
+			ServerPrivHex string       `json:"serverPrivHex"`
+			BPrivHex      string       `json:"bPrivHex"`
+			PrevTxID      string       `json:"prevTxId"`
+			PoolAmount    uint64       `json:"poolAmount"`
+			EndHeight     uint32       `json:"endHeight"`
+			FeeRate       float64      `json:"feeRate"`
+			Open          []dustVector `json:"open"`
+			Update        []dustVector `json:"update"`
+		} `json:"triple"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("decode vectors: %v", err)
+	}
+	v := file.Triple
+	aPriv, _ := ec.PrivateKeyFromHex(v.APrivHex)
+	serverPriv, _ := ec.PrivateKeyFromHex(v.ServerPrivHex)
+	bPriv, _ := ec.PrivateKeyFromHex(v.BPrivHex)
+
+	built := map[string]string{}
+	for _, vec := range v.Open {
+		res, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+			PrevTxID:        v.PrevTxID,
+			PoolAmount:      v.PoolAmount,
+			EndHeight:       v.EndHeight,
+			ServerPublicKey: serverPriv.PubKey(),
+			APrivateKey:     aPriv,
+			BPublicKey:      bPriv.PubKey(),
+			FeeRate:         v.FeeRate,
+			Dust:            libs.DustPolicy{Action: vec.Dust.Action, Limit: vec.Dust.Limit},
+		})
+		if err != nil {
+			t.Fatalf("%s: open: %v", vec.Name, err)
+		}
+		if got := res.Tx.Hex(); got != vec.Hex {
+			t.Errorf("%s: open mismatch, got %s", vec.Name, got)
+		}
+		built[vec.Name] = res.Tx.Hex()
+	}
+	for _, vec := range v.Update {
+		next, err := TripleFeePoolLoadTxV2(UpdateParams{
+			TxHex:           built[vec.Prev],
+			Sequence:        vec.Sequence,
+			BAmount:         vec.BAmount,
+			ServerPublicKey: serverPriv.PubKey(),
+			APublicKey:      aPriv.PubKey(),
+			BPublicKey:      bPriv.PubKey(),
+			PoolAmount:      v.PoolAmount,
+			Dust:            libs.DustPolicy{Action: vec.Dust.Action, Limit: vec.Dust.Limit},
+		})
+		if err != nil {
+			t.Fatalf("%s: update: %v", vec.Name, err)
+		}
+		if got := next.Hex(); got != vec.Hex {
+			t.Errorf("%s: update mismatch, got %s", vec.Name, got)
+		}
+		built[vec.Name] = next.Hex()
+	}
+}
@@ -0,0 +1,52 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+func TestTripleTypedErrors(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	prevTxID := "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	poolValue := uint64(20000)
+
+	_, _, err := SubBuildTripleFeePoolSpendTX(prevTxID, 10, 800000, sPriv.PubKey(), aPriv, bPriv.PubKey(), true, 500)
+	var fundsErr *libs.InsufficientFundsError
+	if !errors.Is(err, libs.ErrInsufficientFunds) || !errors.As(err, &fundsErr) || fundsErr.Have != 10 {
+		t.Fatalf("expected InsufficientFundsError, got %v", err)
+	}
+
+	btx, _, err := SubBuildTripleFeePoolSpendTX(prevTxID, poolValue, 800000, sPriv.PubKey(), aPriv, bPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	aSig, err := SpendTXTripleFeePoolASign(btx, poolValue, sPriv.PubKey(), aPriv, bPriv.PubKey())
+	if err != nil {
+		t.Fatalf("a sign: %v", err)
+	}
+
+	_, err = ServerVerifyClientBSig(btx, poolValue, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), aSig)
+	var sigErr *libs.SignatureError
+	if !errors.Is(err, libs.ErrBadSignature) || !errors.As(err, &sigErr) || sigErr.Party != libs.PartyB {
+		t.Fatalf("expected SignatureError from b, got %v", err)
+	}
+
+	_, err = TripleFeePoolLoadTx(btx.Hex(), nil, 2, poolValue*2, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), poolValue)
+	if !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+
+	next, err := TripleFeePoolLoadTx(btx.Hex(), nil, 5, 100, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), poolValue)
+	if err != nil {
+		t.Fatalf("load tx: %v", err)
+	}
+	if err := ValidateUpdateTransition(next, btx); !errors.Is(err, libs.ErrSequenceRegression) {
+		t.Fatalf("expected ErrSequenceRegression, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package triple_endpoint
+
+import (
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 延期：A、B 约定新的到期高度，在最近一次双方签名的 B-Tx 上后移 locktime、递增序列号并重新签名。
+// 流程与双端池相同：ProposeExpiryExtension -> AcceptExpiryExtension -> FinalizeExpiryExtension，
+// 仲裁方（服务器）不参与，延期幅度由 ExpiryPolicy 限制。
+
+// ProposeExpiryExtension 发起方基于最近一次双方签名的 B-Tx 构建延期后的新状态并签名。
+func ProposeExpiryExtension(p ExtendExpiryParams) (*tx.Transaction, *[]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := p.Policy.Check(p.Prev.LockTime, p.EndHeight); err != nil {
+		return nil, nil, err
+	}
+
+	aPublicKey, bPublicKey := p.ProposerPrivateKey.PubKey(), p.CounterpartyPublicKey
+	if p.Proposer == libs.PartyB {
+		aPublicKey, bPublicKey = bPublicKey, aPublicKey
+	}
+
+	amounts, _, arbiterRefund, err := statePayouts(p.Prev, p.ServerPublicKey, bPublicKey, aPublicKey, p.BPayoutScript, p.APayoutScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 延期不改变金额：[B, A] 支付输出齐全时按位置改写（沿用位置参数版本开出的 0 聪输出），否则按默认策略重建；
+	// 仲裁方退款输出原样保留
+	payouts := len(libs.PayoutOutputs(p.Prev))
+	if arbiterRefund > 0 {
+		payouts--
+	}
+	var dust libs.DustPolicy
+	if payouts == 2 {
+		dust.Action = libs.DustKeepZero
+	}
+	endHeight := p.EndHeight
+	next, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex:           p.Prev.Hex(),
+		Locktime:        &endHeight,
+		Sequence:        p.Sequence,
+		BAmount:         amounts[0],
+		ServerPublicKey: p.ServerPublicKey,
+		APublicKey:      aPublicKey,
+		BPublicKey:      bPublicKey,
+		PoolAmount:      p.PoolAmount,
+		Dust:            dust,
+		BPayoutScript:   p.BPayoutScript,
+		APayoutScript:   p.APayoutScript,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := libs.ValidateExpiryExtension(p.Prev, next, p.Policy); err != nil {
+		return nil, nil, err
+	}
+
+	var signBytes *[]byte
+	if p.Proposer == libs.PartyA {
+		signBytes, err = ClientATripleFeePoolSpendTXUpdateSign(next, p.ServerPublicKey, p.ProposerPrivateKey, bPublicKey)
+	} else {
+		signBytes, err = ClientBTripleFeePoolSpendTXUpdateSign(next, p.ServerPublicKey, aPublicKey, p.ProposerPrivateKey)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	libs.Logger().Debug("triple_endpoint: expiry extension proposed",
+		"proposer", p.Proposer,
+		"end_height", p.Prev.LockTime,
+		"new_end_height", endHeight,
+		"sequence", p.Sequence,
+	)
+	return next, signBytes, nil
+}
+
+// AcceptExpiryExtension 接收方核对延期提案与策略上限，验证发起方签名后回签。
+func AcceptExpiryExtension(p ExtendExpiryAcceptParams) (*[]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := libs.ValidateExpiryExtension(p.Prev, p.Next, p.Policy); err != nil {
+		return nil, err
+	}
+
+	aPublicKey, bPublicKey := p.ProposerPublicKey, p.AcceptorPrivateKey.PubKey()
+	if p.Proposer == libs.PartyB {
+		aPublicKey, bPublicKey = bPublicKey, aPublicKey
+	}
+	redeem, err := libs.Lock([]*ec.PublicKey{p.ServerPublicKey, aPublicKey, bPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	p.Next.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: p.PoolAmount, LockingScript: redeem})
+	if _, err := verifyTripleSig(p.Next, 0, redeem, p.PoolAmount, p.Proposer, p.ProposerPublicKey, p.ProposerSignBytes); err != nil {
+		return nil, err
+	}
+
+	var signBytes *[]byte
+	if p.Proposer == libs.PartyA {
+		signBytes, err = ClientBTripleFeePoolSpendTXUpdateSign(p.Next, p.ServerPublicKey, aPublicKey, p.AcceptorPrivateKey)
+	} else {
+		signBytes, err = ClientATripleFeePoolSpendTXUpdateSign(p.Next, p.ServerPublicKey, p.AcceptorPrivateKey, bPublicKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	libs.Logger().Debug("triple_endpoint: expiry extension accepted",
+		"proposer", p.Proposer,
+		"new_end_height", p.Next.LockTime,
+		"sequence", p.Next.Inputs[0].SequenceNumber,
+	)
+	return signBytes, nil
+}
+
+// FinalizeExpiryExtension 验证 A、B 对延期后 B-Tx 的签名并合成解锁脚本，返回可持久化的完整交易。
+func FinalizeExpiryExtension(
+	next *tx.Transaction,
+	poolAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	aPublicKey *ec.PublicKey,
+	bPublicKey *ec.PublicKey,
+	aSignBytes *[]byte,
+	bSignBytes *[]byte,
+) (*tx.Transaction, error) {
+	if next == nil || len(next.Inputs) != 1 {
+		return nil, fmt.Errorf("%w: extended tx must have exactly one input", libs.ErrInvalidTransaction)
+	}
+	redeem, err := libs.Lock([]*ec.PublicKey{serverPublicKey, aPublicKey, bPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	if _, err := verifyTripleSig(next, 0, redeem, poolAmount, libs.PartyA, aPublicKey, aSignBytes); err != nil {
+		return nil, err
+	}
+	if _, err := verifyTripleSig(next, 0, redeem, poolAmount, libs.PartyB, bPublicKey, bSignBytes); err != nil {
+		return nil, err
+	}
+	// 签名顺序需与锁定脚本中的公钥顺序 [server, A, B] 一致
+	unlockingScript, err := libs.BuildSignScript(&[][]byte{*aSignBytes, *bSignBytes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build unlocking script: %w", err)
+	}
+	next.Inputs[0].UnlockingScript = unlockingScript
+	next.Inputs[0].SetSourceTxOutput(&tx.TransactionOutput{Satoshis: poolAmount, LockingScript: redeem})
+	return next, nil
+}
@@ -0,0 +1,62 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 三方池延期：B 方发起，A 方回签，仲裁方不参与。
+func TestTripleExtendExpiry(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const pool = uint64(100000)
+
+	prev, _, err := SubBuildTripleFeePoolSpendTX("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", pool, 900000, sPriv.PubKey(), aPriv, bPriv.PubKey(), true, 0.5)
+	if err != nil {
+		t.Fatalf("sub build: %v", err)
+	}
+	policy := libs.ExpiryPolicy{MaxExtension: 144}
+
+	next, bSig, err := ProposeExpiryExtension(ExtendExpiryParams{
+		Prev: prev, PoolAmount: pool, Proposer: libs.PartyB, EndHeight: 900144, ServerPublicKey: sPriv.PubKey(),
+		ProposerPrivateKey: bPriv, CounterpartyPublicKey: aPriv.PubKey(), Policy: policy,
+	})
+	if err != nil {
+		t.Fatalf("propose: %v", err)
+	}
+	wire, _ := tx.NewTransactionFromHex(next.Hex())
+	aSig, err := AcceptExpiryExtension(ExtendExpiryAcceptParams{
+		Prev: prev, Next: wire, PoolAmount: pool, Proposer: libs.PartyB, ProposerSignBytes: bSig,
+		ServerPublicKey: sPriv.PubKey(), ProposerPublicKey: bPriv.PubKey(), AcceptorPrivateKey: aPriv, Policy: policy,
+	})
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	final, err := FinalizeExpiryExtension(wire, pool, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), aSig, bSig)
+	if err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	err = interpreter.NewEngine().Execute(
+		interpreter.WithTx(final, 0, final.Inputs[0].SourceTxOutput()),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("extended tx failed script check: %v", err)
+	}
+
+	_, _, err = ProposeExpiryExtension(ExtendExpiryParams{
+		Prev: prev, PoolAmount: pool, Proposer: libs.PartyB, EndHeight: 900145, ServerPublicKey: sPriv.PubKey(),
+		ProposerPrivateKey: bPriv, CounterpartyPublicKey: aPriv.PubKey(), Policy: policy,
+	})
+	if !errors.Is(err, libs.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+}
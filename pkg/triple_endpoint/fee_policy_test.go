@@ -0,0 +1,62 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 三方池中服务器方对应 B、客户端方对应 A：开池时 B 没有余额，更新时手续费按策略在 B 与 A 之间分摊。
+func TestTripleFeePolicies(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const pool = uint64(100000)
+
+	p := SpendParams{
+		PrevTxID:        "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		PoolAmount:      pool,
+		EndHeight:       900000,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		FeeRate:         50,
+		FeePolicy:       libs.FeeSplitEven,
+	}
+	_, err := BuildTripleFeePoolSpendTXV2(p)
+	var dustErr *libs.DustError
+	if !errors.As(err, &dustErr) || dustErr.Party != libs.PartyB {
+		t.Fatalf("expected DustError for B at open, got %v", err)
+	}
+
+	p.FeePolicy = libs.FeeProportional
+	res, err := BuildTripleFeePoolSpendTXV2(p)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// B 方金额为 0，输出被省略，只有 A 方输出
+	fee := pool - res.Amount
+	if len(res.Tx.Outputs) != 1 || res.Tx.Outputs[0].Satoshis != res.Amount || fee != res.Fee {
+		t.Fatalf("proportional open must charge A only, got %d outputs, a %d fee %d", len(res.Tx.Outputs), res.Amount, res.Fee)
+	}
+
+	updated, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex:           res.Tx.Hex(),
+		Sequence:        2,
+		BAmount:         50000,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      pool,
+		FeePolicy:       libs.FeeSplitEven,
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Outputs[0].Satoshis != 50000-fee/2 || updated.Outputs[1].Satoshis != 50000-(fee-fee/2) {
+		t.Fatalf("unexpected split amounts %d/%d for fee %d", updated.Outputs[0].Satoshis, updated.Outputs[1].Satoshis, fee)
+	}
+}
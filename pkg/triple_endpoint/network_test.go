@@ -0,0 +1,59 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 测试网三方池使用测试网地址，并拒绝主网地址的 UTXO。
+func TestTripleNetwork(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+
+	testAddr, err := libs.Regtest.Address(aPriv.PubKey())
+	if err != nil {
+		t.Fatalf("derive regtest address: %v", err)
+	}
+	mainAddr, _ := libs.Mainnet.Address(aPriv.PubKey())
+	utxo := libs.UTXO{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 0, Value: 20000, Address: testAddr.AddressString}
+
+	params := PoolParams{
+		ClientUTXOs:     []libs.UTXO{utxo},
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		Network:         libs.Regtest,
+	}
+	if _, err := BuildTripleFeePoolBaseTxV2(params); err != nil {
+		t.Fatalf("regtest base tx: %v", err)
+	}
+
+	params.Network = libs.Mainnet
+	if _, err := BuildTripleFeePoolBaseTxV2(params); !errors.Is(err, libs.ErrNetworkMismatch) {
+		t.Fatalf("expected ErrNetworkMismatch for testnet utxo on mainnet, got %v", err)
+	}
+
+	utxo.Address = mainAddr.AddressString
+	params.ClientUTXOs = []libs.UTXO{utxo}
+	params.Network = libs.Testnet
+	if _, err := BuildTripleFeePoolBaseTxV2(params); !errors.Is(err, libs.ErrNetworkMismatch) {
+		t.Fatalf("expected ErrNetworkMismatch for mainnet utxo on testnet, got %v", err)
+	}
+
+	// 地址属于当前网络但不是 A 方密钥的地址。
+	otherAddr, _ := libs.Testnet.Address(bPriv.PubKey())
+	utxo.Address = otherAddr.AddressString
+	params.ClientUTXOs = []libs.UTXO{utxo}
+	if _, err := BuildTripleFeePoolBaseTxV2(params); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for foreign utxo address, got %v", err)
+	}
+
+	if n, err := libs.ParseNetwork("STN"); err != nil || n != libs.STN {
+		t.Fatalf("parse stn: %v %v", n, err)
+	}
+}
@@ -0,0 +1,301 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 指定 PoolAmount 时选币、找零，并支持 B 方出资。
+func TestTripleOpeningWithPoolAmount(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	aUtxos := []libs.UTXO{
+		{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 0, Value: 5000},
+		{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 1, Value: 50000},
+		{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 2, Value: 3000},
+	}
+	bUtxos := []libs.UTXO{{TxID: "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", Vout: 0, Value: 8000}}
+
+	res, err := BuildTripleFeePoolBaseTxV2(PoolParams{
+		ClientUTXOs:     aUtxos,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		Network:         libs.Testnet,
+		FeeRate:         50,
+		PoolAmount:      30000,
+		SelectCoins:     true,
+		Contributions:   []Contribution{{Party: libs.PartyB, UTXOs: bUtxos, Amount: 6000}},
+	})
+	if err != nil {
+		t.Fatalf("build base tx: %v", err)
+	}
+	if len(res.Tx.Inputs) != 2 {
+		t.Fatalf("expected 1 selected a input + 1 b input, got %d", len(res.Tx.Inputs))
+	}
+	if res.Amount != 30000 || res.Tx.Outputs[0].Satoshis != 30000 {
+		t.Fatalf("unexpected pool amount %d", res.Amount)
+	}
+	if res.Change != 50000-24000-res.Fee || res.Tx.Outputs[1].Satoshis != res.Change {
+		t.Fatalf("unexpected change %d with fee %d", res.Change, res.Fee)
+	}
+	if len(res.Tx.Outputs) != 3 || res.Tx.Outputs[2].Satoshis != 2000 {
+		t.Fatalf("expected b change output of 2000")
+	}
+	if res.Tx.Inputs[1].UnlockingScript != nil {
+		t.Fatalf("b input must be left unsigned")
+	}
+
+	signed, err := SignTripleFeePoolContribution(res.Tx, bUtxos, bPriv, libs.Testnet)
+	if err != nil {
+		t.Fatalf("b sign contribution: %v", err)
+	}
+	for i, in := range signed.Inputs {
+		if in.UnlockingScript == nil || len(*in.UnlockingScript) == 0 {
+			t.Fatalf("input %d unsigned", i)
+		}
+	}
+
+	// 初始 B-Tx 把 B 方出资退还给 B，B 方核对后才交出完整 A-Tx
+	refund, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		BaseTx: signed, EndHeight: 900000, BContribution: 6000,
+		ServerPublicKey: sPriv.PubKey(), APrivateKey: aPriv, BPublicKey: bPriv.PubKey(), Network: libs.Testnet,
+	})
+	if err != nil {
+		t.Fatalf("build refund: %v", err)
+	}
+	if refund.Tx.Outputs[0].Satoshis != 6000 || refund.Tx.Outputs[1].Satoshis != 24000-refund.Fee {
+		t.Fatalf("unexpected refund outputs %d/%d", refund.Tx.Outputs[0].Satoshis, refund.Tx.Outputs[1].Satoshis)
+	}
+	accept := OpenAcceptParams{
+		BaseTx: signed, SpendTx: refund.Tx, BContribution: 6000, ASignBytes: refund.ASignBytes,
+		ServerPublicKey: sPriv.PubKey(), APublicKey: aPriv.PubKey(), BPublicKey: bPriv.PubKey(),
+	}
+	if _, err := VerifyTripleOpening(accept); err != nil {
+		t.Fatalf("accept refund: %v", err)
+	}
+	allToA, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		BaseTx: signed, EndHeight: 900000,
+		ServerPublicKey: sPriv.PubKey(), APrivateKey: aPriv, BPublicKey: bPriv.PubKey(), Network: libs.Testnet,
+	})
+	if err != nil {
+		t.Fatalf("build refund without contribution: %v", err)
+	}
+	accept.SpendTx, accept.ASignBytes = allToA.Tx, allToA.ASignBytes
+	if _, err := VerifyTripleOpening(accept); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds for a refund paying all to a, got %v", err)
+	}
+	accept.SpendTx, accept.ASignBytes = refund.Tx, allToA.ASignBytes
+	if _, err := VerifyTripleOpening(accept); err == nil {
+		t.Fatalf("expected a bad a signature to be rejected")
+	}
+
+	// 只接受 B 方与仲裁方出资
+	_, err = BuildTripleFeePoolBaseTxV2(PoolParams{
+		ClientUTXOs:     aUtxos,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      30000,
+		Contributions:   []Contribution{{Party: libs.PartyA, UTXOs: bUtxos, Amount: 6000}},
+	})
+	if !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for an a contribution, got %v", err)
+	}
+
+	// 出资超过池金额会被拒绝
+	_, err = BuildTripleFeePoolBaseTxV2(PoolParams{
+		ClientUTXOs:     aUtxos,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      5000,
+		Contributions:   []Contribution{{Party: libs.PartyB, UTXOs: bUtxos, Amount: 6000}},
+	})
+	if !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams, got %v", err)
+	}
+
+	// 选币后余额不足
+	_, err = BuildTripleFeePoolBaseTxV2(PoolParams{
+		ClientUTXOs:     aUtxos,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      58000,
+		SelectCoins:     true,
+	})
+	if !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+}
+
+// 仲裁方出资：初始 B-Tx 在 [B, A] 之后附加仲裁方退款，之后的更新与 splice-out 都保留该输出，不能被 A、B 改动。
+func TestTripleArbiterContribution(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	aUtxos := []libs.UTXO{{TxID: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", Vout: 0, Value: 50000}}
+	bUtxos := []libs.UTXO{{TxID: "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", Vout: 0, Value: 6000}}
+	sUtxos := []libs.UTXO{{TxID: "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", Vout: 1, Value: 5000}}
+	const pool = uint64(30000)
+
+	base, err := BuildTripleFeePoolBaseTxV2(PoolParams{
+		ClientUTXOs:     aUtxos,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		Network:         libs.Testnet,
+		FeeRate:         50,
+		PoolAmount:      pool,
+		Contributions: []Contribution{
+			{Party: libs.PartyB, UTXOs: bUtxos, Amount: 6000},
+			{Party: libs.PartyServer, UTXOs: sUtxos, Amount: 4000},
+		},
+	})
+	if err != nil {
+		t.Fatalf("build base tx: %v", err)
+	}
+	arbiterScript, err := ArbiterPayoutScript(sPriv.PubKey())
+	if err != nil {
+		t.Fatalf("arbiter script: %v", err)
+	}
+	if len(base.Tx.Inputs) != 3 || libs.PayoutAmount(base.Tx, arbiterScript) != 1000 {
+		t.Fatalf("expected an arbiter input with 1000 change, got %d inputs", len(base.Tx.Inputs))
+	}
+	signed, err := SignTripleFeePoolContribution(base.Tx, bUtxos, bPriv, libs.Testnet)
+	if err != nil {
+		t.Fatalf("b sign contribution: %v", err)
+	}
+	if signed, err = SignTripleFeePoolContribution(signed, sUtxos, sPriv, libs.Testnet); err != nil {
+		t.Fatalf("arbiter sign contribution: %v", err)
+	}
+
+	refund, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		BaseTx: signed, EndHeight: 900000, BContribution: 6000, ArbiterContribution: 4000,
+		ServerPublicKey: sPriv.PubKey(), APrivateKey: aPriv, BPublicKey: bPriv.PubKey(), Network: libs.Testnet,
+	})
+	if err != nil {
+		t.Fatalf("build refund: %v", err)
+	}
+	outs := refund.Tx.Outputs
+	if len(outs) != 3 || outs[0].Satoshis != 6000 || outs[1].Satoshis != pool-10000-refund.Fee ||
+		outs[2].Satoshis != 4000 || !outs[2].LockingScript.Equals(arbiterScript) || refund.Amount != outs[1].Satoshis {
+		t.Fatalf("unexpected refund layout")
+	}
+
+	// B 方与仲裁方各自核对自己的退款
+	accept := OpenAcceptParams{
+		BaseTx: signed, SpendTx: refund.Tx, BContribution: 6000, ArbiterContribution: 4000, ASignBytes: refund.ASignBytes,
+		ServerPublicKey: sPriv.PubKey(), APublicKey: aPriv.PubKey(), BPublicKey: bPriv.PubKey(),
+	}
+	if _, err := VerifyTripleOpening(accept); err != nil {
+		t.Fatalf("accept refund: %v", err)
+	}
+	bOnly, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		BaseTx: signed, EndHeight: 900000, BContribution: 6000,
+		ServerPublicKey: sPriv.PubKey(), APrivateKey: aPriv, BPublicKey: bPriv.PubKey(), Network: libs.Testnet,
+	})
+	if err != nil {
+		t.Fatalf("build refund without arbiter: %v", err)
+	}
+	accept.SpendTx, accept.ASignBytes = bOnly.Tx, bOnly.ASignBytes
+	if _, err := VerifyTripleOpening(accept); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds for a refund without the arbiter output, got %v", err)
+	}
+
+	// 更新只在 B、A 之间分配，仲裁方退款保持不变；B 方金额为 0 时省略 B 方输出，之后重新出现
+	update := UpdateParams{
+		TxHex:           refund.Tx.Hex(),
+		Sequence:        2,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      pool,
+	}
+	prev := refund.Tx
+	for _, bAmount := range []uint64{0, 9000} {
+		update.TxHex, update.BAmount = prev.Hex(), bAmount
+		next, err := TripleFeePoolLoadTxV2(update)
+		if err != nil {
+			t.Fatalf("update to %d: %v", bAmount, err)
+		}
+		if err := ValidatePayoutUpdate(prev, next, update); err != nil {
+			t.Fatalf("update to %d: %v", bAmount, err)
+		}
+		amounts, _, arbiterRefund, err := statePayouts(next, sPriv.PubKey(), bPriv.PubKey(), aPriv.PubKey(), nil, nil)
+		if err != nil {
+			t.Fatalf("update to %d: %v", bAmount, err)
+		}
+		if amounts[0] != bAmount || amounts[1] != pool-4000-bAmount-refund.Fee || arbiterRefund != 4000 {
+			t.Fatalf("update to %d: unexpected amounts %v / %d", bAmount, amounts, arbiterRefund)
+		}
+		prev = next
+		update.Sequence++
+	}
+	if _, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex: prev.Hex(), Sequence: update.Sequence, BAmount: pool - 3000,
+		ServerPublicKey: sPriv.PubKey(), APublicKey: aPriv.PubKey(), BPublicKey: bPriv.PubKey(), PoolAmount: pool,
+	}); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds for a b amount reaching into the arbiter refund, got %v", err)
+	}
+	update.TxHex, update.BAmount = prev.Hex(), 10000
+	forged, err := TripleFeePoolLoadTxV2(update)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	forged.Outputs[1].Satoshis += 3000
+	forged.Outputs[2].Satoshis -= 3000
+	if err := ValidatePayoutUpdate(prev, forged, update); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for a reduced arbiter refund, got %v", err)
+	}
+
+	// splice-out 后新池的退款 B-Tx 仍带原金额的仲裁方退款
+	aSig, _ := ClientATripleFeePoolSpendTXUpdateSign(prev, sPriv.PubKey(), aPriv, bPriv.PubKey())
+	bSig, _ := ClientBTripleFeePoolSpendTXUpdateSign(prev, sPriv.PubKey(), aPriv.PubKey(), bPriv)
+	latest, err := MergeTripleFeePoolSigForSpendTx(prev.Hex(), aSig, bSig)
+	if err != nil {
+		t.Fatalf("merge latest: %v", err)
+	}
+	splice := SpliceOutParams{
+		Latest: latest, PoolAmount: pool, Withdraw: 5000, FeeRate: 5, Network: libs.Testnet,
+		ServerPublicKey: sPriv.PubKey(), APublicKey: aPriv.PubKey(), BPublicKey: bPriv.PubKey(),
+	}
+	spliceRes, err := BuildTripleSpliceOutTx(splice)
+	if err != nil {
+		t.Fatalf("build splice-out: %v", err)
+	}
+	if spliceRes.ArbiterRefund != 4000 {
+		t.Fatalf("unexpected arbiter refund %d", spliceRes.ArbiterRefund)
+	}
+	spliceSig, err := BSignSpliceOut(spliceRes.Tx, splice, bPriv)
+	if err != nil {
+		t.Fatalf("b sign splice-out: %v", err)
+	}
+	spliceTx, err := ASignSpliceOut(spliceRes.Tx, splice, aPriv, spliceSig)
+	if err != nil {
+		t.Fatalf("a sign splice-out: %v", err)
+	}
+	spliceRefund, err := BuildSpliceOutRefundTX(spliceTx, splice, 900000, aPriv)
+	if err != nil {
+		t.Fatalf("splice-out refund: %v", err)
+	}
+	if n := len(spliceRefund.Tx.Outputs); n != 3 || spliceRefund.Tx.Outputs[2].Satoshis != 4000 {
+		t.Fatalf("splice-out refund must keep the arbiter refund, got %d outputs", n)
+	}
+	if err := BVerifySpliceOutRefund(spliceRefund.Tx, spliceTx, splice, 900000, spliceRefund.ASignBytes); err != nil {
+		t.Fatalf("b verify splice-out refund: %v", err)
+	}
+
+	if _, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		BaseTx: signed, EndHeight: 900000, ArbiterContribution: libs.DustLimit - 1,
+		ServerPublicKey: sPriv.PubKey(), APrivateKey: aPriv, BPublicKey: bPriv.PubKey(), Network: libs.Testnet,
+	}); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for an arbiter refund below dust, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 多签输出位于 A-Tx 的 vout 2，且 B-Tx 中多签输入位于 1 号位置：构建、签名、验证、更新、合成全程使用显式位置。
+func TestTriplePoolAtNonZeroOutpoint(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const total = uint64(100000)
+	poolTxID := "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+
+	built, _, err := SubBuildTripleFeePoolSpendTXAt(poolTxID, 2, total, 900000, sPriv.PubKey(), aPriv, bPriv.PubKey(), false, 1)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if built.Inputs[0].SourceTxOutIndex != 2 {
+		t.Fatalf("expected pool outpoint vout 2, got %d", built.Inputs[0].SourceTxOutIndex)
+	}
+
+	// 在多签输入前插入一个无关输入，使多签输入位于 1 号位置
+	bTx := tx.NewTransaction()
+	if err := bTx.AddInputFrom("ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100", 0, built.Inputs[0].SourceTxOutput().LockingScript.String(), 1000, nil); err != nil {
+		t.Fatalf("add leading input: %v", err)
+	}
+	bTx.Inputs = append(bTx.Inputs, built.Inputs[0])
+	bTx.Outputs = built.Outputs
+	bTx.LockTime = built.LockTime
+	redeem := bTx.Inputs[1].SourceTxOutput()
+
+	aSig, err := SpendTXTripleFeePoolASignAt(bTx, 1, total, sPriv.PubKey(), aPriv, bPriv.PubKey())
+	if err != nil {
+		t.Fatalf("a sign: %v", err)
+	}
+	bSig, err := SpendTXTripleFeePoolBSignAt(bTx, 1, total, sPriv.PubKey(), aPriv.PubKey(), bPriv)
+	if err != nil {
+		t.Fatalf("b sign: %v", err)
+	}
+	if ok, err := ServerVerifyClientASigAt(bTx, 1, total, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), aSig); !ok || err != nil {
+		t.Fatalf("verify a sig at input 1: %v", err)
+	}
+	if ok, err := ServerVerifyClientBSigAt(bTx, 1, total, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), bSig); !ok || err != nil {
+		t.Fatalf("verify b sig at input 1: %v", err)
+	}
+	if ok, _ := ServerVerifyClientASig(bTx, total, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), aSig); ok {
+		t.Fatalf("signature for input 1 must not verify against input 0")
+	}
+
+	merged, err := MergeTripleFeePoolSigForSpendTxAt(bTx.Hex(), 1, aSig, bSig)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	assertTripleInputValid(t, merged, 1, redeem)
+
+	// 更新：加载时指定输入位置，后续签名与验证沿用同一位置
+	updated, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex:           bTx.Hex(),
+		Sequence:        2,
+		BAmount:         20000,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      total,
+		InputIndex:      1,
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if updated.Inputs[1].SequenceNumber != 2 || updated.Inputs[0].SequenceNumber == 2 {
+		t.Fatalf("sequence must be applied to input 1 only")
+	}
+	aSig, err = ClientATripleFeePoolSpendTXUpdateSignAt(updated, 1, sPriv.PubKey(), aPriv, bPriv.PubKey())
+	if err != nil {
+		t.Fatalf("a update sign: %v", err)
+	}
+	bSig, err = ClientBTripleFeePoolSpendTXUpdateSignAt(updated, 1, sPriv.PubKey(), aPriv.PubKey(), bPriv)
+	if err != nil {
+		t.Fatalf("b update sign: %v", err)
+	}
+	if ok, err := ServerVerifyClientBSigAt(updated, 1, total, sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey(), bSig); !ok || err != nil {
+		t.Fatalf("verify b update sig: %v", err)
+	}
+	merged, err = MergeTripleFeePoolSigForSpendTxAt(updated.Hex(), 1, aSig, bSig)
+	if err != nil {
+		t.Fatalf("merge update: %v", err)
+	}
+	assertTripleInputValid(t, merged, 1, redeem)
+
+	if _, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex:           bTx.Hex(),
+		Sequence:        3,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      total,
+		InputIndex:      2,
+	}); !errors.Is(err, libs.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for missing input, got %v", err)
+	}
+}
+
+func assertTripleInputValid(t *testing.T, transaction *tx.Transaction, inputIndex int, prevOut *tx.TransactionOutput) {
+	t.Helper()
+	err := interpreter.NewEngine().Execute(
+		interpreter.WithTx(transaction, inputIndex, prevOut),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("input %d failed script check: %v", inputIndex, err)
+	}
+}
@@ -0,0 +1,608 @@
+package triple_endpoint
+
+import (
+	"bytes"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// v2 API：用具名字段的参数结构体代替容易颠倒的位置参数。
+// 各结构体的 Validate 会在构建交易前检查必填字段和金额关系，零值字段按下列默认值处理：
+//   - FeeRate 为 0 时使用 libs.DefaultFeeRate
+//   - Network 为零值时使用主网（libs.Mainnet）
+
+// PoolParams 描述三方池开池（步骤1，A-Tx）所需的参数。
+type PoolParams struct {
+	ClientUTXOs     []libs.UTXO // A 方提供的 UTXO
+	ServerPublicKey *ec.PublicKey
+	APrivateKey     *ec.PrivateKey
+	BPublicKey      *ec.PublicKey
+	Network         libs.Network
+	FeeRate         float64
+
+	PoolAmount    uint64         // 多签输出金额；为 0 时 A 方 UTXO 全额扣除手续费后入池，不找零
+	ChangeAddress string         // A 方找零地址；为空时找零回 A 方地址
+	SelectCoins   bool           // 只选取足以覆盖出资与手续费的 A 方 UTXO，需要指定 PoolAmount
+	Contributions []Contribution // B 方与仲裁方的出资，计入 PoolAmount
+}
+
+// Contribution 描述 B 方或仲裁方（服务器）在开池时的出资。
+// 出资方的 UTXO 全部作为输入，超出 Amount 的部分找零回出资方地址；A-Tx 手续费由 A 方承担。
+// 初始 B-Tx（退款）按 SpendParams.BContribution 把 B 方出资作为 B 方扣费前金额退还，
+// 按 SpendParams.ArbiterContribution 在 [B, A] 之后附加仲裁方退款输出；出资方用 VerifyTripleOpening 核对后才交出完整的 A-Tx。
+type Contribution struct {
+	Party  libs.Party // libs.PartyB 或 libs.PartyServer（仲裁方）
+	UTXOs  []libs.UTXO
+	Amount uint64
+}
+
+// SpendParams 描述构建初始 B-Tx（步骤2）所需的参数。
+type SpendParams struct {
+	BaseTx          *tx.Transaction // 步骤1产生的 A-Tx；为空时使用 PrevTxID
+	PrevTxID        string
+	PoolVout        uint32 // 多签输出在 A-Tx 中的序号，默认 0
+	PoolAmount      uint64 // 多签输出金额；为 0 时取 BaseTx.Outputs[PoolVout]
+	EndHeight       uint32
+	ServerPublicKey *ec.PublicKey
+	APrivateKey     *ec.PrivateKey
+	BPublicKey      *ec.PublicKey
+	Network         libs.Network
+	FeeRate         float64
+	FeePolicy       libs.FeePolicy  // 手续费分摊方式：客户端方为 A、服务器方为 B，默认由 A 承担
+	Dust            libs.DustPolicy // 扣费后支付输出的粉尘处理方式，默认省略金额为 0 的支付
+	BContribution   uint64          // B 方在 A-Tx 中的出资，初始 B-Tx 把它作为 B 方扣费前金额退还
+	// 仲裁方在 A-Tx 中的出资，初始 B-Tx 在 [B, A] 之后附加等额的仲裁方退款输出（不分摊手续费），之后的更新保持该输出不变
+	ArbiterContribution uint64
+	// 双方在开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；之后的更新只能支付到这两个脚本
+	BPayoutScript *script.Script
+	APayoutScript *script.Script
+	// 支付地址轮换记录，不为空时支付脚本取自记录（与上面的脚本同时给出时两者必须一致），并随 SpendResult 返回与池状态一起保存
+	BPayout    *libs.PayoutState
+	APayout    *libs.PayoutState
+	Commitment *libs.Commitment // 不为空时 B-Tx 末尾带 OP_RETURN 承诺输出，之后的更新才能更换承诺
+}
+
+// SpendResult 是 BuildTripleFeePoolSpendTXV2 的返回值。
+type SpendResult struct {
+	Tx         *tx.Transaction
+	ASignBytes *[]byte
+	Amount     uint64 // A 方输出金额
+	Fee        uint64 // B-Tx 手续费，不含被粉尘策略省略的金额
+	// 池使用的支付轮换记录，取自 SpendParams，splice-out 时作为 SpliceOutParams 的当前记录
+	BPayout *libs.PayoutState
+	APayout *libs.PayoutState
+}
+
+// UpdateParams 描述加载并更新 B-Tx 所需的参数。
+type UpdateParams struct {
+	TxHex           string
+	Locktime        *uint32 // 为空时保持原 locktime
+	Sequence        uint32
+	BAmount         uint64 // 分配给 B 方（接收方）的金额，即 outputs[0]
+	ServerPublicKey *ec.PublicKey
+	APublicKey      *ec.PublicKey
+	BPublicKey      *ec.PublicKey
+	PoolAmount      uint64          // 多签输出金额
+	InputIndex      uint32          // 多签输入在 B-Tx 中的位置，默认 0
+	FeePolicy       libs.FeePolicy  // BAmount 为扣费前金额，B-Tx 手续费按该策略在 B 与 A 之间分摊，默认由 A 承担
+	Fee             uint64          // B-Tx 手续费；为 0 时取多签金额与输出之和的差。DustDrop 省略过输出时应传入开池时的手续费
+	Dust            libs.DustPolicy // 扣费后支付输出的粉尘处理方式，必须与开池时一致
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH
+	BPayoutScript *script.Script
+	APayoutScript *script.Script
+	Commitment    *libs.Commitment // 新的承诺，为空时保留 B-Tx 中原有的承诺；开池时没有承诺输出的池不能设置
+}
+
+// OpenAcceptParams 描述 B 方签名初始 B-Tx 前对 A-Tx 的接受检查所需的参数。
+type OpenAcceptParams struct {
+	BaseTx          *tx.Transaction // A 方构建的 A-Tx
+	SpendTx         *tx.Transaction // A 方构建并签名的初始 B-Tx
+	PoolVout        uint32          // 多签输出在 A-Tx 中的序号，默认 0
+	ServerPublicKey *ec.PublicKey
+	APublicKey      *ec.PublicKey
+	BPublicKey      *ec.PublicKey
+	// 双方声明的支付锁定脚本，必须与开池时 SpendParams 中的一致
+	BPayoutScript *script.Script
+	APayoutScript *script.Script
+	// B 方出资时，初始 B-Tx 是 B 方的退款：B 方输出不得低于 BContribution，且必须附上 A 方对它的签名
+	BContribution uint64
+	// 仲裁方出资时，初始 B-Tx 的仲裁方退款输出不得低于 ArbiterContribution，同样必须附上 A 方的签名
+	ArbiterContribution uint64
+	ASignBytes          *[]byte
+}
+
+func invalidParams(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", libs.ErrInvalidParams, fmt.Sprintf(format, args...))
+}
+
+func feeRateOrDefault(feeRate float64) float64 {
+	if feeRate == 0 {
+		return libs.DefaultFeeRate
+	}
+	return feeRate
+}
+
+// Validate 检查开池参数。
+func (p *PoolParams) Validate() error {
+	if p.APrivateKey == nil {
+		return invalidParams("a private key is required")
+	}
+	if p.ServerPublicKey == nil || p.BPublicKey == nil {
+		return invalidParams("server and b public keys are required")
+	}
+	if len(p.ClientUTXOs) == 0 {
+		return invalidParams("at least one client utxo is required")
+	}
+	if err := p.Network.ValidateUTXOs(p.ClientUTXOs, p.APrivateKey.PubKey()); err != nil {
+		return err
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	if p.ChangeAddress != "" {
+		if _, err := p.Network.ParseAddress(p.ChangeAddress); err != nil {
+			return fmt.Errorf("change address: %w", err)
+		}
+	}
+	if p.PoolAmount == 0 {
+		if p.SelectCoins || len(p.Contributions) > 0 {
+			return invalidParams("pool amount is required for coin selection and contributions")
+		}
+		return nil
+	}
+
+	all := append([]libs.UTXO(nil), p.ClientUTXOs...)
+	var contributed uint64
+	for i, c := range p.Contributions {
+		key := p.contributorKey(c.Party)
+		if key == nil {
+			return invalidParams("contribution %d: party must be b or server, got %q", i, c.Party)
+		}
+		if c.Amount == 0 || len(c.UTXOs) == 0 {
+			return invalidParams("contribution %d: amount and utxos are required", i)
+		}
+		if err := p.Network.ValidateUTXOs(c.UTXOs, key); err != nil {
+			return fmt.Errorf("contribution %d: %w", i, err)
+		}
+		if have := libs.SumUTXOs(c.UTXOs); have < c.Amount {
+			return fmt.Errorf("contribution %d: %w", i, &libs.InsufficientFundsError{Need: c.Amount, Have: have})
+		}
+		contributed += c.Amount
+		all = append(all, c.UTXOs...)
+	}
+	if contributed > p.PoolAmount {
+		return invalidParams("contributions %d exceed pool amount %d", contributed, p.PoolAmount)
+	}
+	// 同一 UTXO 不能由多方重复提供
+	return p.Network.ValidateUTXOs(all, nil)
+}
+
+func (p *PoolParams) contributorKey(party libs.Party) *ec.PublicKey {
+	switch party {
+	case libs.PartyB:
+		return p.BPublicKey
+	case libs.PartyServer:
+		return p.ServerPublicKey
+	}
+	return nil
+}
+
+// Validate 检查 B-Tx 构建参数，并在 PoolAmount 为 0 时从 BaseTx 补全。
+func (p *SpendParams) Validate() error {
+	if p.APrivateKey == nil {
+		return invalidParams("a private key is required")
+	}
+	if p.ServerPublicKey == nil || p.BPublicKey == nil {
+		return invalidParams("server and b public keys are required")
+	}
+	if p.BaseTx == nil && p.PrevTxID == "" {
+		return invalidParams("base tx or prev txid is required")
+	}
+	if err := p.Network.Validate(); err != nil {
+		return err
+	}
+	if p.BaseTx != nil {
+		if int(p.PoolVout) >= len(p.BaseTx.Outputs) {
+			return fmt.Errorf("%w: base tx has no output %d", libs.ErrInvalidTransaction, p.PoolVout)
+		}
+		poolOutput := p.BaseTx.Outputs[p.PoolVout].Satoshis
+		if p.PoolAmount == 0 {
+			p.PoolAmount = poolOutput
+		} else if p.PoolAmount != poolOutput {
+			return invalidParams("pool amount %d does not match base tx output %d", p.PoolAmount, poolOutput)
+		}
+	}
+	if p.PoolAmount == 0 {
+		return invalidParams("pool amount must be positive")
+	}
+	if p.BContribution > p.PoolAmount || p.ArbiterContribution > p.PoolAmount-p.BContribution {
+		return invalidParams("b contribution %d and arbiter contribution %d exceed pool amount %d", p.BContribution, p.ArbiterContribution, p.PoolAmount)
+	}
+	if p.ArbiterContribution > 0 && p.ArbiterContribution < libs.DustLimit {
+		return invalidParams("arbiter contribution %d is below the dust limit %d", p.ArbiterContribution, libs.DustLimit)
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	if err := p.FeePolicy.Validate(); err != nil {
+		return err
+	}
+	if err := p.Dust.Validate(); err != nil {
+		return err
+	}
+	var err error
+	if p.BPayoutScript, err = libs.ResolvePayoutScript(p.BPayout, p.BPayoutScript); err != nil {
+		return fmt.Errorf("b payout: %w", err)
+	}
+	if p.APayoutScript, err = libs.ResolvePayoutScript(p.APayout, p.APayoutScript); err != nil {
+		return fmt.Errorf("a payout: %w", err)
+	}
+	if _, err := payoutScripts(p.BPublicKey, p.APrivateKey.PubKey(), p.BPayoutScript, p.APayoutScript); err != nil {
+		return err
+	}
+	return libs.CheckBlockHeightLocktime(p.EndHeight)
+}
+
+func (p *SpendParams) prevTxID() string {
+	if p.BaseTx != nil {
+		return p.BaseTx.TxID().String()
+	}
+	return p.PrevTxID
+}
+
+// Validate 检查更新参数。
+func (p *UpdateParams) Validate() error {
+	if p.TxHex == "" {
+		return invalidParams("tx hex is required")
+	}
+	if p.ServerPublicKey == nil || p.APublicKey == nil || p.BPublicKey == nil {
+		return invalidParams("server, a and b public keys are required")
+	}
+	if p.PoolAmount == 0 {
+		return invalidParams("pool amount must be positive")
+	}
+	if p.BAmount > p.PoolAmount {
+		return fmt.Errorf("b amount: %w", &libs.InsufficientFundsError{Need: p.BAmount, Have: p.PoolAmount})
+	}
+	if p.Sequence == 0 {
+		return invalidParams("sequence must be positive")
+	}
+	if p.Fee > p.PoolAmount {
+		return fmt.Errorf("fee: %w", &libs.InsufficientFundsError{Need: p.Fee, Have: p.PoolAmount})
+	}
+	if err := p.FeePolicy.Validate(); err != nil {
+		return err
+	}
+	if err := p.Dust.Validate(); err != nil {
+		return err
+	}
+	_, err := p.payoutScripts()
+	return err
+}
+
+// spendState 报告 t 是否为只有一个输入、一到两个支付输出（金额为 0 的支付可能被粉尘策略省略）
+// 并可能带有仲裁方退款输出的 B-Tx。
+func spendState(t *tx.Transaction) bool {
+	if t == nil || len(t.Inputs) != 1 {
+		return false
+	}
+	n := len(libs.PayoutOutputs(t))
+	return n >= 1 && n <= 3
+}
+
+// statePayouts 返回状态 t 中 [B, A] 的支付金额与锁定脚本以及仲裁方退款金额，被省略的一方金额为 0，
+// 脚本取声明的支付脚本或签名公钥的 P2PKH。
+func statePayouts(t *tx.Transaction, serverPublicKey, bPublicKey, aPublicKey *ec.PublicKey, bScript, aScript *script.Script) ([]uint64, []*script.Script, uint64, error) {
+	scripts, err := payoutScripts(bPublicKey, aPublicKey, bScript, aScript)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	arbiterScript, err := ArbiterPayoutScript(serverPublicKey)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return splitPayouts(t, scripts, arbiterScript)
+}
+
+// splitPayouts 与 libs.SplitPayouts 相同，但先拆出支付输出末尾的仲裁方退款（锁定到 arbiterScript），返回其金额，没有时为 0。
+func splitPayouts(t *tx.Transaction, scripts []*script.Script, arbiterScript *script.Script) ([]uint64, []*script.Script, uint64, error) {
+	payouts := libs.PayoutOutputs(t)
+	n := len(payouts)
+	if n < 2 || !bytes.Equal(payouts[n-1].LockingScript.Bytes(), arbiterScript.Bytes()) {
+		amounts, current, err := libs.SplitPayouts(t, scripts)
+		return amounts, current, 0, err
+	}
+	trimmed := *t
+	trimmed.Outputs = payouts[:n-1]
+	amounts, current, err := libs.SplitPayouts(&trimmed, scripts)
+	return amounts, current, payouts[n-1].Satoshis, err
+}
+
+// payoutScripts 返回 [B, A] 的支付锁定脚本，未声明的一方使用签名公钥的 P2PKH。
+func payoutScripts(bPublicKey, aPublicKey *ec.PublicKey, bScript, aScript *script.Script) ([]*script.Script, error) {
+	scripts, err := PayoutScripts(bPublicKey, aPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	for i, declared := range []*script.Script{bScript, aScript} {
+		if declared != nil {
+			if len(*declared) == 0 {
+				return nil, invalidParams("payout script %d is empty", i)
+			}
+			scripts[i] = declared
+		}
+	}
+	return scripts, nil
+}
+
+// payoutScripts 返回更新时允许的 [B, A] 支付锁定脚本。
+func (p *UpdateParams) payoutScripts() ([]*script.Script, error) {
+	return payoutScripts(p.BPublicKey, p.APublicKey, p.BPayoutScript, p.APayoutScript)
+}
+
+// Validate 检查开池接受参数。
+func (p *OpenAcceptParams) Validate() error {
+	if p.BaseTx == nil || p.SpendTx == nil {
+		return invalidParams("base tx and spend tx are required")
+	}
+	if p.ServerPublicKey == nil || p.APublicKey == nil || p.BPublicKey == nil {
+		return invalidParams("server, a and b public keys are required")
+	}
+	if (p.BContribution > 0 || p.ArbiterContribution > 0) && p.ASignBytes == nil {
+		return invalidParams("a signature on the refund is required when b or the arbiter contributes")
+	}
+	return nil
+}
+
+// SpliceOutParams 描述 B 方从现有三方池提取已赚取金额（splice-out）所需的参数。
+type SpliceOutParams struct {
+	Latest          *tx.Transaction // 最近一次 A、B 双方签名的 B-Tx（已合并签名），B 方的支付为已赚取的金额
+	PoolAmount      uint64          // 当前多签输出金额
+	Withdraw        uint64          // 提现金额，手续费另从已赚取金额中扣除
+	PayoutAddress   string          // 提现地址；为空时支付到 B 方地址
+	ServerPublicKey *ec.PublicKey
+	APublicKey      *ec.PublicKey
+	BPublicKey      *ec.PublicKey
+	Network         libs.Network
+	FeeRate         float64
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；用于读取 Latest 的余额，新 outpoint 上的退款 B-Tx 沿用这两个脚本
+	BPayoutScript *script.Script
+	APayoutScript *script.Script
+	// 当前池的支付轮换记录（开池 SpendResult 中的记录），不为空时支付脚本取自记录
+	BPayout *libs.PayoutState
+	APayout *libs.PayoutState
+	// 新 outpoint 上的支付轮换记录，由 PayoutKeyChain.Next 按 Path.Next() 派生；当前池有记录时必须给出，
+	// 不为空时退款 B-Tx 支付到记录中的脚本，并作为退款 SpendResult 的记录返回
+	NextBPayout *libs.PayoutState
+	NextAPayout *libs.PayoutState
+}
+
+// payoutScripts 返回当前池的 [B, A] 支付脚本。
+func (p *SpliceOutParams) payoutScripts() (*script.Script, *script.Script, error) {
+	b, err := libs.ResolvePayoutScript(p.BPayout, p.BPayoutScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("b payout: %w", err)
+	}
+	a, err := libs.ResolvePayoutScript(p.APayout, p.APayoutScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("a payout: %w", err)
+	}
+	return b, a, nil
+}
+
+// refundPayoutScripts 返回新 outpoint 上退款 B-Tx 的 [B, A] 支付脚本，没有后继记录时沿用当前脚本。
+func (p *SpliceOutParams) refundPayoutScripts() (*script.Script, *script.Script, error) {
+	b, a, err := p.payoutScripts()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.NextBPayout != nil {
+		if b, err = libs.ResolvePayoutScript(p.NextBPayout, nil); err != nil {
+			return nil, nil, fmt.Errorf("next b payout: %w", err)
+		}
+	}
+	if p.NextAPayout != nil {
+		if a, err = libs.ResolvePayoutScript(p.NextAPayout, nil); err != nil {
+			return nil, nil, fmt.Errorf("next a payout: %w", err)
+		}
+	}
+	return b, a, nil
+}
+
+// Validate 检查 splice-out 参数。
+func (p *SpliceOutParams) Validate() error {
+	if !spendState(p.Latest) {
+		return invalidParams("latest must be a spend tx with one input and one or two payout outputs plus an optional arbiter refund")
+	}
+	if p.ServerPublicKey == nil || p.APublicKey == nil || p.BPublicKey == nil {
+		return invalidParams("server, a and b public keys are required")
+	}
+	if p.PoolAmount == 0 || p.Withdraw == 0 {
+		return invalidParams("pool amount and withdraw must be positive")
+	}
+	if p.FeeRate < 0 {
+		return invalidParams("fee rate must not be negative")
+	}
+	// 已赚取金额取自 Latest，必须先确认它是 A、B 双方在当前多签输出上签过的状态
+	signers, err := VerifyTripleSignerPairAt(p.Latest, 0, p.PoolAmount, p.ServerPublicKey, p.APublicKey, p.BPublicKey)
+	if err != nil {
+		return fmt.Errorf("latest: %w", err)
+	}
+	if signers[0] != libs.PartyA || signers[1] != libs.PartyB {
+		return fmt.Errorf("latest: %w", &libs.SignatureError{Party: libs.PartyA, Err: fmt.Errorf("state signed by %s and %s, expected a and b", signers[0], signers[1])})
+	}
+	if err := libs.CheckPayoutRotation(p.BPayout, p.NextBPayout); err != nil {
+		return fmt.Errorf("b payout: %w", err)
+	}
+	if err := libs.CheckPayoutRotation(p.APayout, p.NextAPayout); err != nil {
+		return fmt.Errorf("a payout: %w", err)
+	}
+	if _, _, err := p.refundPayoutScripts(); err != nil {
+		return err
+	}
+	bScript, aScript, err := p.payoutScripts()
+	if err != nil {
+		return err
+	}
+	amounts, _, _, err := statePayouts(p.Latest, p.ServerPublicKey, p.BPublicKey, p.APublicKey, bScript, aScript)
+	if err != nil {
+		return fmt.Errorf("latest: %w", err)
+	}
+	if earned := amounts[0]; p.Withdraw > earned {
+		return fmt.Errorf("withdraw exceeds earned: %w", &libs.InsufficientFundsError{Need: p.Withdraw, Have: earned})
+	}
+	if _, err := p.payoutAddress(); err != nil {
+		return err
+	}
+	return p.Network.Validate()
+}
+
+func (p *SpliceOutParams) poolTxID() string {
+	return p.Latest.Inputs[0].SourceTXID.String()
+}
+
+func (p *SpliceOutParams) poolVout() uint32 {
+	return p.Latest.Inputs[0].SourceTxOutIndex
+}
+
+func (p *SpliceOutParams) payoutAddress() (*script.Address, error) {
+	if p.PayoutAddress == "" {
+		return p.Network.Address(p.BPublicKey)
+	}
+	addr, err := p.Network.ParseAddress(p.PayoutAddress)
+	if err != nil {
+		return nil, fmt.Errorf("payout address: %w", err)
+	}
+	return addr, nil
+}
+
+// ExtendExpiryParams 描述由 A 方或 B 方发起的延期提案：把最近一次双方签名的 B-Tx 的 locktime 后移到 EndHeight。
+type ExtendExpiryParams struct {
+	Prev                  *tx.Transaction // 最近一次 A、B 双方都已签名的 B-Tx
+	PoolAmount            uint64          // 多签输出金额
+	Proposer              libs.Party      // libs.PartyA 或 libs.PartyB
+	EndHeight             uint32          // 新的到期高度
+	Sequence              uint32          // 为 0 时取 Prev 的序列号 + 1
+	ServerPublicKey       *ec.PublicKey
+	ProposerPrivateKey    *ec.PrivateKey
+	CounterpartyPublicKey *ec.PublicKey
+	Policy                libs.ExpiryPolicy
+	// 开池时声明的支付锁定脚本，为空时为签名公钥的 P2PKH；用于识别 Prev 中的支付输出
+	BPayoutScript *script.Script
+	APayoutScript *script.Script
+}
+
+// Validate 检查延期提案参数。
+func (p *ExtendExpiryParams) Validate() error {
+	if !spendState(p.Prev) {
+		return invalidParams("prev must be a spend tx with one input and one or two payout outputs plus an optional arbiter refund")
+	}
+	if p.ServerPublicKey == nil || p.ProposerPrivateKey == nil || p.CounterpartyPublicKey == nil {
+		return invalidParams("server public key, proposer private key and counterparty public key are required")
+	}
+	if p.PoolAmount == 0 {
+		return invalidParams("pool amount must be positive")
+	}
+	if p.Proposer != libs.PartyA && p.Proposer != libs.PartyB {
+		return invalidParams("proposer must be a or b, got %q", p.Proposer)
+	}
+	if p.Sequence == 0 {
+		p.Sequence = p.Prev.Inputs[0].SequenceNumber + 1
+	}
+	if p.Sequence >= libs.FinalSequence {
+		return invalidParams("sequence %d is final, locktime would not apply", p.Sequence)
+	}
+	return nil
+}
+
+// ExtendExpiryAcceptParams 描述接收方核对并回签延期提案所需的参数。
+type ExtendExpiryAcceptParams struct {
+	Prev               *tx.Transaction
+	Next               *tx.Transaction
+	PoolAmount         uint64
+	Proposer           libs.Party
+	ProposerSignBytes  *[]byte
+	ServerPublicKey    *ec.PublicKey
+	ProposerPublicKey  *ec.PublicKey
+	AcceptorPrivateKey *ec.PrivateKey
+	Policy             libs.ExpiryPolicy
+}
+
+// Validate 检查延期回签参数。
+func (p *ExtendExpiryAcceptParams) Validate() error {
+	if p.Prev == nil || p.Next == nil {
+		return invalidParams("prev and next transactions are required")
+	}
+	if p.ServerPublicKey == nil || p.ProposerPublicKey == nil || p.AcceptorPrivateKey == nil {
+		return invalidParams("server public key, proposer public key and acceptor private key are required")
+	}
+	if p.Proposer != libs.PartyA && p.Proposer != libs.PartyB {
+		return invalidParams("proposer must be a or b, got %q", p.Proposer)
+	}
+	if p.PoolAmount == 0 {
+		return invalidParams("pool amount must be positive")
+	}
+	return nil
+}
+
+// OpenDisputeParams 描述 A 方或 B 方发起争议所需的参数。
+type OpenDisputeParams struct {
+	State              *tx.Transaction // 最近一次 A、B 双方都已签名的 B-Tx
+	PoolAmount         uint64          // 多签输出金额
+	Claimant           libs.Party      // libs.PartyA 或 libs.PartyB
+	ClaimantPrivateKey *ec.PrivateKey
+	ServerPublicKey    *ec.PublicKey
+	APublicKey         *ec.PublicKey
+	BPublicKey         *ec.PublicKey
+	BAmount            uint64 // 发起方主张的 B 方输出金额，手续费由 A 方承担
+	Evidence           []byte // 发起方提交的证据，原样记入争议记录
+}
+
+// Validate 检查发起争议的参数。
+func (p *OpenDisputeParams) Validate() error {
+	if !spendState(p.State) {
+		return invalidParams("state must be a spend tx with one input and one or two payout outputs plus an optional arbiter refund")
+	}
+	if p.ServerPublicKey == nil || p.APublicKey == nil || p.BPublicKey == nil || p.ClaimantPrivateKey == nil {
+		return invalidParams("server, a and b public keys and the claimant private key are required")
+	}
+	if p.PoolAmount == 0 {
+		return invalidParams("pool amount must be positive")
+	}
+	claimantKey := p.APublicKey
+	switch p.Claimant {
+	case libs.PartyA:
+	case libs.PartyB:
+		claimantKey = p.BPublicKey
+	default:
+		return invalidParams("claimant must be a or b, got %q", p.Claimant)
+	}
+	if !p.ClaimantPrivateKey.PubKey().IsEqual(claimantKey) {
+		return invalidParams("claimant private key does not match the %s public key", p.Claimant)
+	}
+	return nil
+}
+
+// ProposeResolutionParams 描述仲裁方（服务器）对争议给出的裁定。
+type ProposeResolutionParams struct {
+	BAmount          uint64     // 裁定的 B 方输出金额，手续费由 A 方承担
+	Winner           libs.Party // 回签结算交易的一方，libs.PartyA 或 libs.PartyB
+	Reason           string     // 裁定理由，记入争议记录
+	ServerPrivateKey *ec.PrivateKey
+}
+
+// Validate 检查裁定参数。
+func (p *ProposeResolutionParams) Validate() error {
+	if p.ServerPrivateKey == nil {
+		return invalidParams("server private key is required")
+	}
+	if p.Winner != libs.PartyA && p.Winner != libs.PartyB {
+		return invalidParams("winner must be a or b, got %q", p.Winner)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package triple_endpoint
+
+import (
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// VerifyTripleOpening 是 B 方签名初始 B-Tx 前的接受检查：A-Tx 的多签输出必须锁定到三方公钥，
+// B-Tx 只花费该输出，且只按 [B, A] 顺序支付到开池时声明的支付脚本（仲裁方出资时末尾另有仲裁方退款）。
+// 通过后这两个脚本即被双方确认，之后的更新由 TripleFeePoolLoadTxV2 与 ValidatePayoutUpdate 强制使用。
+// B 方出资时（BContribution 不为 0），BaseTx 应是 B 方签好出资输入后的完整 A-Tx（B-Tx 引用其 txid），
+// B-Tx 的 B 方输出不得低于出资额且 A 方签名有效，B 方凭此与自己的签名即可在到期后取回出资。
+// 仲裁方出资时（ArbiterContribution 不为 0）同理：B-Tx 末尾的仲裁方退款输出不得低于出资额，仲裁方用同样的方式核对。返回多签输出金额。
+func VerifyTripleOpening(p OpenAcceptParams) (uint64, error) {
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+	poolScript, err := libs.Lock([]*ec.PublicKey{p.ServerPublicKey, p.APublicKey, p.BPublicKey}, 2)
+	if err != nil {
+		return 0, err
+	}
+	scripts, err := payoutScripts(p.BPublicKey, p.APublicKey, p.BPayoutScript, p.APayoutScript)
+	if err != nil {
+		return 0, err
+	}
+	arbiterScript, err := ArbiterPayoutScript(p.ServerPublicKey)
+	if err != nil {
+		return 0, err
+	}
+	amount, err := libs.VerifyOpeningSpend(p.BaseTx, p.SpendTx, p.PoolVout, poolScript, append(scripts, arbiterScript))
+	if err != nil {
+		return 0, err
+	}
+	if p.BContribution > 0 || p.ArbiterContribution > 0 {
+		if refund := libs.PayoutAmount(p.SpendTx, scripts[0]); refund < p.BContribution {
+			return 0, fmt.Errorf("b refund: %w", &libs.InsufficientFundsError{Need: p.BContribution, Have: refund})
+		}
+		if refund := libs.PayoutAmount(p.SpendTx, arbiterScript); refund < p.ArbiterContribution {
+			return 0, fmt.Errorf("arbiter refund: %w", &libs.InsufficientFundsError{Need: p.ArbiterContribution, Have: refund})
+		}
+		if _, err := ServerVerifyClientASig(p.SpendTx, amount, p.ServerPublicKey, p.APublicKey, p.BPublicKey, p.ASignBytes); err != nil {
+			return 0, err
+		}
+	}
+	libs.Logger().Debug("triple_endpoint: opening accepted",
+		"base_txid", p.BaseTx.TxID().String(),
+		"pool_vout", p.PoolVout,
+		"pool_amount", amount,
+		"outputs", len(p.SpendTx.Outputs),
+	)
+	return amount, nil
+}
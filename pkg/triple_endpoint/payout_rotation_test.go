@@ -0,0 +1,124 @@
+package triple_endpoint
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	bip32 "github.com/bsv-blockchain/go-sdk/compat/bip32"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	chaincfg "github.com/bsv-blockchain/go-sdk/transaction/chaincfg"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// 支付地址轮换：开池记录随 SpendResult 返回，splice-out 后新 outpoint 上的退款支付到 Path.Next() 派生的地址。
+func TestTriplePayoutRotation(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	const total = uint64(100000)
+
+	newWatch := func(seed byte) *libs.PayoutKeyChain {
+		master, err := bip32.NewMaster(bytes.Repeat([]byte{seed}, 32), &chaincfg.MainNet)
+		if err != nil {
+			t.Fatalf("master: %v", err)
+		}
+		xpub, err := master.Neuter()
+		if err != nil {
+			t.Fatalf("neuter: %v", err)
+		}
+		chain, _ := libs.NewPayoutKeyChain(xpub.String())
+		return chain
+	}
+	bChain, aChain := newWatch(3), newWatch(4)
+	path := libs.PayoutPath{Pool: 7}
+	bState, _ := bChain.State(path)
+	aState, _ := aChain.State(path)
+	bScript, _ := bState.Script()
+	aScript, _ := aState.Script()
+
+	open, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		PrevTxID:        "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		PoolAmount:      total,
+		EndHeight:       900000,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		BPayout:         bState,
+		APayout:         aState,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if open.BPayout != bState || open.APayout != aState || !open.Tx.Outputs[0].LockingScript.Equals(aScript) {
+		t.Fatalf("open must pay the recorded scripts and return the payout states")
+	}
+	next, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex: open.Tx.Hex(), Sequence: 2, BAmount: 30000, PoolAmount: total,
+		ServerPublicKey: sPriv.PubKey(), APublicKey: aPriv.PubKey(), BPublicKey: bPriv.PubKey(),
+		BPayoutScript: bScript, APayoutScript: aScript,
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	aSig, _ := ClientATripleFeePoolSpendTXUpdateSign(next, sPriv.PubKey(), aPriv, bPriv.PubKey())
+	bSig, _ := ClientBTripleFeePoolSpendTXUpdateSign(next, sPriv.PubKey(), aPriv.PubKey(), bPriv)
+	latest, err := MergeTripleFeePoolSigForSpendTx(next.Hex(), aSig, bSig)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+
+	p := SpliceOutParams{
+		Latest:          latest,
+		PoolAmount:      total,
+		Withdraw:        20000,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		FeeRate:         5,
+		BPayout:         open.BPayout,
+		APayout:         open.APayout,
+	}
+	// 当前池有记录时必须给出后继记录
+	if _, err := BuildTripleSpliceOutTx(p); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams without next payout states, got %v", err)
+	}
+	nextB, err := bChain.Next(*open.BPayout)
+	if err != nil {
+		t.Fatalf("next b state: %v", err)
+	}
+	nextA, _ := aChain.Next(*open.APayout)
+	p.NextBPayout, p.NextAPayout = nextB, nextA
+
+	res, err := BuildTripleSpliceOutTx(p)
+	if err != nil {
+		t.Fatalf("build splice-out: %v", err)
+	}
+	bSpliceSig, err := BSignSpliceOut(res.Tx, p, bPriv)
+	if err != nil {
+		t.Fatalf("b sign: %v", err)
+	}
+	spliceTx, err := ASignSpliceOut(res.Tx, p, aPriv, bSpliceSig)
+	if err != nil {
+		t.Fatalf("a sign: %v", err)
+	}
+	refund, err := BuildSpliceOutRefundTX(spliceTx, p, 900000, aPriv)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	nextBScript, _ := nextB.Script()
+	if !refund.Tx.Outputs[0].LockingScript.Equals(nextBScript) || refund.BPayout != nextB || refund.APayout != nextA {
+		t.Fatalf("refund must pay and record the next generation payout states")
+	}
+	if err := BVerifySpliceOutRefund(refund.Tx, spliceTx, p, 900000, refund.ASignBytes); err != nil {
+		t.Fatalf("b verify refund: %v", err)
+	}
+
+	// 沿用当前一代的脚本会被拒绝
+	stale := p
+	stale.NextBPayout = open.BPayout
+	if err := BVerifySpliceOutRefund(refund.Tx, spliceTx, stale, 900000, refund.ASignBytes); !errors.Is(err, libs.ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams for a reused payout state, got %v", err)
+	}
+}
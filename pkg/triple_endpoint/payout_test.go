@@ -0,0 +1,83 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// B 方声明冷钱包支付脚本：接受检查确认后，更新不能把 B 的金额改付给其他脚本。
+func TestTripleDeclaredPayoutScripts(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+	coldPriv, _ := ec.PrivateKeyFromHex("903b1b2c396f17203fa83444d72bf5c666119d9d681eb715520f99ae6f92322c")
+	const pool = uint64(100000)
+
+	coldAddress, _ := script.NewAddressFromPublicKey(coldPriv.PubKey(), true)
+	coldScript, _ := p2pkh.Lock(coldAddress)
+	poolScript, _ := libs.Lock([]*ec.PublicKey{sPriv.PubKey(), aPriv.PubKey(), bPriv.PubKey()}, 2)
+	baseTx := tx.NewTransaction()
+	baseTx.AddOutput(&tx.TransactionOutput{Satoshis: pool, LockingScript: poolScript})
+
+	res, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		BaseTx:          baseTx,
+		EndHeight:       900000,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+		FeeRate:         50,
+		BContribution:   10000, // B 方有出资，初始 B-Tx 带 B 方输出
+		BPayoutScript:   coldScript,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if len(res.Tx.Outputs) != 2 || !res.Tx.Outputs[0].LockingScript.Equals(coldScript) {
+		t.Fatalf("B-Tx must pay b to the declared script")
+	}
+	accept := OpenAcceptParams{
+		BaseTx:          baseTx,
+		SpendTx:         res.Tx,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		BPayoutScript:   coldScript,
+	}
+	if _, err := VerifyTripleOpening(accept); err != nil {
+		t.Fatalf("accept opening: %v", err)
+	}
+	accept.BPayoutScript = nil
+	if _, err := VerifyTripleOpening(accept); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for undeclared b payout, got %v", err)
+	}
+
+	update := UpdateParams{
+		TxHex:           res.Tx.Hex(),
+		Sequence:        2,
+		BAmount:         40000,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		PoolAmount:      pool,
+		BPayoutScript:   coldScript,
+	}
+	next, err := TripleFeePoolLoadTxV2(update)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := ValidatePayoutUpdate(res.Tx, next, update); err != nil {
+		t.Fatalf("payout update: %v", err)
+	}
+	defaultScripts, _ := PayoutScripts(bPriv.PubKey(), aPriv.PubKey())
+	next.Outputs[0].LockingScript = defaultScripts[0]
+	if err := ValidatePayoutUpdate(res.Tx, next, update); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for redirected b payout, got %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/bsv-blockchain/go-sdk/script"
 	tx "github.com/bsv-blockchain/go-sdk/transaction"
 	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	p2pkh "github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
 )
 
 // 构建双端费用池的花费脚本
@@ -31,26 +32,135 @@ func MergeTripleFeePoolSigForSpendTx(
 	txHex string,
 	aSignByte *[]byte,
 	bSignByte *[]byte,
+) (*tx.Transaction, error) {
+	return MergeTripleFeePoolSigForSpendTxAt(txHex, 0, aSignByte, bSignByte)
+}
+
+// MergeTripleFeePoolSigForSpendTxAt 与 MergeTripleFeePoolSigForSpendTx 相同，但把解锁脚本写入第 inputIndex 个输入。
+func MergeTripleFeePoolSigForSpendTxAt(
+	txHex string,
+	inputIndex uint32,
+	aSignByte *[]byte,
+	bSignByte *[]byte,
 ) (*tx.Transaction, error) {
 	// 恢复 bTx
 	bTx, err := tx.NewTransactionFromHex(txHex)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: decode tx hex: %w", multisig.ErrInvalidTransaction, err)
+	}
+	if int(inputIndex) >= len(bTx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
+	if aSignByte == nil {
+		return nil, &multisig.SignatureError{Party: multisig.PartyA, Err: multisig.ErrInvalidSignatureFormat}
+	}
+	if bSignByte == nil {
+		return nil, &multisig.SignatureError{Party: multisig.PartyB, Err: multisig.ErrInvalidSignatureFormat}
 	}
 
 	signs := [][]byte{*aSignByte, *bSignByte}
 	unScript, err := multisig.BuildSignScript(&signs)
 	if err != nil {
-		return nil, fmt.Errorf("BuildSignScript error: %v", err)
+		return nil, fmt.Errorf("failed to build unlocking script: %w", err)
 	}
 
-	bTx.Inputs[0].UnlockingScript = unScript
-	// fmt.Printf("aTx: %s\n", aTx.Hex())
-	fmt.Printf("bTx 2: %s\n", bTx.Hex())
+	bTx.Inputs[inputIndex].UnlockingScript = unScript
+	multisig.Logger().Debug("triple_endpoint: signatures merged", "txid", bTx.TxID().String())
 
 	return bTx, nil
 }
 
+// TripleSignature 是某一方对三方池多签输入的签名（DER + SigHash 标志）。
+type TripleSignature struct {
+	Party     multisig.Party `json:"party"` // multisig.PartyServer、multisig.PartyA 或 multisig.PartyB
+	SignBytes *[]byte        `json:"sign_bytes"`
+}
+
+// tripleKeyOrder 是三方池锁定脚本中的公钥顺序，CHECKMULTISIG 要求签名按同样的顺序排列。
+var tripleKeyOrder = []multisig.Party{multisig.PartyServer, multisig.PartyA, multisig.PartyB}
+
+// MergeTripleFeePoolSigPairAt 把任意两方的签名按锁定脚本中的公钥顺序 [server, A, B] 排列后写入第 inputIndex 个输入，
+// 服务器+A、服务器+B、A+B 三种组合都能得到有效的解锁脚本，传入顺序无关。签名本身由调用方先行验证。
+func MergeTripleFeePoolSigPairAt(
+	txHex string,
+	inputIndex uint32,
+	first TripleSignature,
+	second TripleSignature,
+) (*tx.Transaction, error) {
+	bTx, err := tx.NewTransactionFromHex(txHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode tx hex: %w", multisig.ErrInvalidTransaction, err)
+	}
+	if int(inputIndex) >= len(bTx.Inputs) {
+		return nil, fmt.Errorf("%w: no input %d", multisig.ErrInvalidTransaction, inputIndex)
+	}
+	if first.Party == second.Party {
+		return nil, invalidParams("signatures must come from two different parties, got %q twice", first.Party)
+	}
+	signs := make([][]byte, 0, 2)
+	for _, party := range tripleKeyOrder {
+		for _, sig := range []TripleSignature{first, second} {
+			if sig.Party != party {
+				continue
+			}
+			if sig.SignBytes == nil {
+				return nil, &multisig.SignatureError{Party: party, InputIndex: inputIndex, Err: multisig.ErrInvalidSignatureFormat}
+			}
+			signs = append(signs, *sig.SignBytes)
+		}
+	}
+	if len(signs) != 2 {
+		return nil, invalidParams("signature parties must be server, a or b, got %q and %q", first.Party, second.Party)
+	}
+	unScript, err := multisig.BuildSignScript(&signs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build unlocking script: %w", err)
+	}
+	bTx.Inputs[inputIndex].UnlockingScript = unScript
+	multisig.Logger().Debug("triple_endpoint: signature pair merged", "txid", bTx.TxID().String(), "first", first.Party, "second", second.Party)
+	return bTx, nil
+}
+
+// VerifyTripleSignerPairAt 按 CHECKMULTISIG 的规则核对第 inputIndex 个输入解锁脚本中的两个签名，
+// 返回按公钥顺序签名的两方。签名不属于任何一方或顺序错误时返回 *libs.SignatureError。
+func VerifyTripleSignerPairAt(
+	transactionObject *tx.Transaction,
+	inputIndex uint32,
+	poolAmount uint64,
+	serverPublicKey *ec.PublicKey,
+	aPublicKey *ec.PublicKey,
+	bPublicKey *ec.PublicKey,
+) ([]multisig.Party, error) {
+	if transactionObject == nil || int(inputIndex) >= len(transactionObject.Inputs) || transactionObject.Inputs[inputIndex].UnlockingScript == nil {
+		return nil, fmt.Errorf("%w: input %d is not signed", multisig.ErrInvalidTransaction, inputIndex)
+	}
+	chunks, err := transactionObject.Inputs[inputIndex].UnlockingScript.Chunks()
+	if err != nil || len(chunks) != 3 || chunks[0].Op != script.Op0 {
+		return nil, fmt.Errorf("%w: input %d is not a 2-of-3 multisig spend", multisig.ErrInvalidTransaction, inputIndex)
+	}
+	redeem, err := TripleFeePoolSpentScript(serverPublicKey, aPublicKey, bPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	keys := []*ec.PublicKey{serverPublicKey, aPublicKey, bPublicKey}
+	parties := make([]multisig.Party, 0, 2)
+	next := 0
+	for _, chunk := range chunks[1:] {
+		sig := chunk.Data
+		matched := false
+		for ; next < len(keys) && !matched; next++ {
+			if _, err := verifyTripleSig(transactionObject, inputIndex, redeem, poolAmount, tripleKeyOrder[next], keys[next], &sig); err == nil {
+				parties = append(parties, tripleKeyOrder[next])
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, &multisig.SignatureError{InputIndex: inputIndex, Err: fmt.Errorf("signature %d matches no remaining key", len(parties)+1)}
+		}
+	}
+	return parties, nil
+}
+
 // VerifySignature 验证ClientB的签名是否正确
 func VerifySignature(
 	tx *tx.Transaction,
@@ -64,7 +174,11 @@ func VerifySignature(
 	// 计算交易的签名哈希值
 	hash, err := tx.CalcInputSignatureHash(inputIndex, sigHash)
 	if err != nil {
-		return false, fmt.Errorf("计算签名哈希失败: %w", err)
+		return false, fmt.Errorf("%w: calc sighash: %w", multisig.ErrInvalidTransaction, err)
+	}
+
+	if SignByte == nil || len(*SignByte) < 2 {
+		return false, &multisig.SignatureError{Party: multisig.PartyB, InputIndex: inputIndex, Err: multisig.ErrInvalidSignatureFormat}
 	}
 
 	// 从签名字节中提取签名（去掉最后一个字节的sighash标志）
@@ -73,14 +187,44 @@ func VerifySignature(
 	// 解析签名
 	signature, err := ec.ParseDERSignature(signatureBytes)
 	if err != nil {
-		return false, fmt.Errorf("解析签名失败: %w", err)
+		return false, &multisig.SignatureError{Party: multisig.PartyB, InputIndex: inputIndex, Err: fmt.Errorf("%w: %w", multisig.ErrInvalidSignatureFormat, err)}
 	}
 
 	// 使用B的公钥验证签名
 	isValid := ecdsa.Verify(hash, signature, publicKey.ToECDSA())
 	if !isValid {
-		return false, fmt.Errorf("VerifySignature failed")
+		return false, &multisig.SignatureError{Party: multisig.PartyB, InputIndex: inputIndex}
 	}
 
 	return true, nil
 }
+
+// ArbiterPayoutScript 返回仲裁方（服务器）出资退款的锁定脚本（P2PKH，与网络无关）。
+func ArbiterPayoutScript(serverPublicKey *ec.PublicKey) (*script.Script, error) {
+	address, err := script.NewAddressFromPublicKey(serverPublicKey, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get arbiter address: %w", err)
+	}
+	lockingScript, err := p2pkh.Lock(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create arbiter locking script: %w", err)
+	}
+	return lockingScript, nil
+}
+
+// PayoutScripts 返回三方池按固定顺序 [B, A] 排列的支付锁定脚本（P2PKH，与网络无关）。
+func PayoutScripts(bPublicKey, aPublicKey *ec.PublicKey) ([]*script.Script, error) {
+	scripts := make([]*script.Script, 0, 2)
+	for _, pub := range []*ec.PublicKey{bPublicKey, aPublicKey} {
+		address, err := script.NewAddressFromPublicKey(pub, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get payout address: %w", err)
+		}
+		lockingScript, err := p2pkh.Lock(address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create payout locking script: %w", err)
+		}
+		scripts = append(scripts, lockingScript)
+	}
+	return scripts, nil
+}
@@ -0,0 +1,274 @@
+package triple_endpoint
+
+import (
+	"bytes"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// Splice-out：B 方（接收方）在不关闭池的情况下提取已赚取的金额。
+//  1. A、B 按 SpliceOutParams 构建同一笔 splice 交易（BuildTripleSpliceOutTx）：
+//     输入为当前多签输出，输出 [新多签, B 方提现 P2PKH]，手续费从 B 方已赚取金额中扣除。
+//  2. B 方为多签输入签名（BSignSpliceOut），签名交给 A 方。
+//  3. A 方按自己保存的最近状态核对后完成签名（ASignSpliceOut），此时 txid 确定。
+//  4. A 方在新 outpoint 上构建退款 B-Tx（BuildSpliceOutRefundTX），序列号从 1 开始，
+//     B 方金额为提现后的剩余金额，支付轮换时支付到 Path.Next() 派生的后继脚本。B 方核对（BVerifySpliceOutRefund）后用 SpendTXTripleFeePoolBSign 回签。
+//  5. A 方拿到完整退款交易后才广播 splice 交易。
+
+// SpliceOutResponse 是 BuildTripleSpliceOutTx 的返回值。
+type SpliceOutResponse struct {
+	Tx        *tx.Transaction
+	Amount    uint64 // 新多签输出金额
+	Index     int
+	Fee       uint64
+	Withdrawn uint64 // 提现输出金额（outputs[1]）
+	BBalance  uint64 // 新池中 B 方的剩余金额 = 已赚取 - Withdraw - fee
+	// 仲裁方出资的退款金额，取自 Latest，新池的退款 B-Tx 原样保留
+	ArbiterRefund uint64
+}
+
+// BuildTripleSpliceOutTx 构建未签名的 splice-out 交易。
+func BuildTripleSpliceOutTx(p SpliceOutParams) (*SpliceOutResponse, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	bScript, aScript, err := p.payoutScripts()
+	if err != nil {
+		return nil, err
+	}
+	latest, _, arbiterRefund, err := statePayouts(p.Latest, p.ServerPublicKey, p.BPublicKey, p.APublicKey, bScript, aScript)
+	if err != nil {
+		return nil, err
+	}
+	earned := latest[0]
+
+	multisigScript, err := libs.Lock([]*ec.PublicKey{p.ServerPublicKey, p.APublicKey, p.BPublicKey}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multisig locking script: %w", err)
+	}
+	payoutAddress, err := p.payoutAddress()
+	if err != nil {
+		return nil, err
+	}
+	payoutScript, err := p2pkh.Lock(payoutAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payout locking script: %w", err)
+	}
+
+	transactionData := tx.NewTransaction()
+	if err := transactionData.AddInputFrom(p.poolTxID(), p.poolVout(), multisigScript.String(), p.PoolAmount, nil); err != nil {
+		return nil, fmt.Errorf("failed to add pool input: %w", err)
+	}
+	transactionData.AddOutput(&tx.TransactionOutput{Satoshis: p.PoolAmount - p.Withdraw, LockingScript: multisigScript})
+	transactionData.AddOutput(&tx.TransactionOutput{Satoshis: p.Withdraw, LockingScript: payoutScript})
+
+	fakeMultisig, err := libs.FakeSign(2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build placeholder unlocking script: %w", err)
+	}
+	transactionData.Inputs[0].UnlockingScript = fakeMultisig
+	fee := uint64(float64(transactionData.Size()) / 1000.0 * feeRateOrDefault(p.FeeRate))
+	if fee == 0 {
+		fee = 1
+	}
+	transactionData.Inputs[0].UnlockingScript = nil
+
+	// 只能提取已赚取的金额
+	if p.Withdraw+fee > earned {
+		return nil, fmt.Errorf("withdraw plus fee %d exceeds earned: %w", fee, &libs.InsufficientFundsError{Need: p.Withdraw + fee, Have: earned})
+	}
+	transactionData.Outputs[0].Satoshis = p.PoolAmount - p.Withdraw - fee
+
+	libs.Logger().Debug("triple_endpoint: splice-out tx built",
+		"prev_pool_txid", p.poolTxID(),
+		"pool_amount", transactionData.Outputs[0].Satoshis,
+		"withdrawn", p.Withdraw,
+		"fee", fee,
+	)
+	return &SpliceOutResponse{
+		Tx:            transactionData,
+		Amount:        transactionData.Outputs[0].Satoshis,
+		Index:         0,
+		Fee:           fee,
+		Withdrawn:     p.Withdraw,
+		BBalance:      earned - p.Withdraw - fee,
+		ArbiterRefund: arbiterRefund,
+	}, nil
+}
+
+// VerifyTripleSpliceOutTx 按参数重建 splice-out 交易并核对除解锁脚本外完全一致，并补全多签输入的前序输出。
+func VerifyTripleSpliceOutTx(spliceTx *tx.Transaction, p SpliceOutParams) (*SpliceOutResponse, error) {
+	if spliceTx == nil || len(spliceTx.Inputs) != 1 {
+		return nil, fmt.Errorf("%w: splice-out tx must have exactly one input", libs.ErrInvalidTransaction)
+	}
+	expected, err := BuildTripleSpliceOutTx(p)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(libs.UnsignedBytes(spliceTx), libs.UnsignedBytes(expected.Tx)) {
+		return nil, fmt.Errorf("%w: splice-out tx does not match the agreed parameters", libs.ErrTransitionMismatch)
+	}
+	spliceTx.Inputs[0].SetSourceTxOutput(expected.Tx.Inputs[0].SourceTxOutput())
+	return expected, nil
+}
+
+// BSignSpliceOut B 方核对 splice-out 交易后为多签输入签名。
+func BSignSpliceOut(spliceTx *tx.Transaction, p SpliceOutParams, bPrivateKey *ec.PrivateKey) (*[]byte, error) {
+	if bPrivateKey == nil || !bPrivateKey.PubKey().IsEqual(p.BPublicKey) {
+		return nil, invalidParams("b private key does not match b public key")
+	}
+	if _, err := VerifyTripleSpliceOutTx(spliceTx, p); err != nil {
+		return nil, err
+	}
+	bSignBytes, err := signTriplePoolInput(spliceTx, &p, bPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: b input 0: %w", libs.ErrSigningFailed, err)
+	}
+	libs.Logger().Debug("triple_endpoint: b signed splice-out", "prev_pool_txid", p.poolTxID())
+	return bSignBytes, nil
+}
+
+// ASignSpliceOut A 方按自己保存的最近状态核对提现金额与 B 方签名后完成签名，返回完整交易。
+func ASignSpliceOut(spliceTx *tx.Transaction, p SpliceOutParams, aPrivateKey *ec.PrivateKey, bSignBytes *[]byte) (*tx.Transaction, error) {
+	if aPrivateKey == nil || !aPrivateKey.PubKey().IsEqual(p.APublicKey) {
+		return nil, invalidParams("a private key does not match a public key")
+	}
+	if _, err := VerifyTripleSpliceOutTx(spliceTx, p); err != nil {
+		return nil, err
+	}
+	input := spliceTx.Inputs[0]
+	if _, err := verifyTripleSig(spliceTx, 0, input.SourceTxOutput().LockingScript, p.PoolAmount, libs.PartyB, p.BPublicKey, bSignBytes); err != nil {
+		return nil, err
+	}
+	aSignBytes, err := signTriplePoolInput(spliceTx, &p, aPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: a input 0: %w", libs.ErrSigningFailed, err)
+	}
+	// 签名顺序需与锁定脚本中的公钥顺序 [server, A, B] 一致
+	unlockingScript, err := libs.BuildSignScript(&[][]byte{*aSignBytes, *bSignBytes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build unlocking script: %w", err)
+	}
+	input.UnlockingScript = unlockingScript
+
+	libs.Logger().Debug("triple_endpoint: a signed splice-out", "txid", spliceTx.TxID().String())
+	return spliceTx, nil
+}
+
+// BuildSpliceOutRefundTX A 方在 splice-out 交易完整签名后，在新 outpoint 上构建退款 B-Tx（序列号从 1 开始），
+// B 方金额为提现后的剩余金额（为 0 时省略 B 方输出），仲裁方退款沿用 Latest 中的金额，手续费由 A 方承担，返回交易与 A 方签名。
+func BuildSpliceOutRefundTX(spliceTx *tx.Transaction, p SpliceOutParams, endHeight uint32, aPrivateKey *ec.PrivateKey) (*SpendResult, error) {
+	if err := requireFullySigned(spliceTx); err != nil {
+		return nil, err
+	}
+	if aPrivateKey == nil || !aPrivateKey.PubKey().IsEqual(p.APublicKey) {
+		return nil, invalidParams("a private key does not match a public key")
+	}
+	if err := libs.CheckBlockHeightLocktime(endHeight); err != nil {
+		return nil, err
+	}
+	expected, err := VerifyTripleSpliceOutTx(spliceTx, p)
+	if err != nil {
+		return nil, err
+	}
+	bScript, aScript, err := p.refundPayoutScripts()
+	if err != nil {
+		return nil, err
+	}
+	return BuildTripleFeePoolSpendTXV2(SpendParams{
+		BaseTx:          spliceTx,
+		EndHeight:       endHeight,
+		ServerPublicKey: p.ServerPublicKey,
+		APrivateKey:     aPrivateKey,
+		BPublicKey:      p.BPublicKey,
+		Network:         p.Network,
+		FeeRate:         p.FeeRate,
+		BContribution:   expected.BBalance,
+
+		ArbiterContribution: expected.ArbiterRefund,
+		BPayoutScript:       bScript,
+		APayoutScript:       aScript,
+		BPayout:             p.NextBPayout,
+		APayout:             p.NextAPayout,
+	})
+}
+
+// BVerifySpliceOutRefund B 方回签退款 B-Tx 前核对 splice-out 交易与退款交易：
+// 退款交易必须花费新多签输出、序列号为 1、locktime 等于 endHeight、只支付到声明的支付脚本（及仲裁方退款）、
+// B 方金额等于提现后的剩余金额、仲裁方退款保持不变，且 A 方签名有效。
+func BVerifySpliceOutRefund(refundTx *tx.Transaction, spliceTx *tx.Transaction, p SpliceOutParams, endHeight uint32, aSignBytes *[]byte) error {
+	expected, err := VerifyTripleSpliceOutTx(spliceTx, p)
+	if err != nil {
+		return err
+	}
+	if err := requireFullySigned(spliceTx); err != nil {
+		return err
+	}
+	if refundTx == nil || len(refundTx.Inputs) != 1 {
+		return fmt.Errorf("%w: refund tx must have exactly one input", libs.ErrInvalidTransaction)
+	}
+	input := refundTx.Inputs[0]
+	if input.SourceTXID.String() != spliceTx.TxID().String() || input.SourceTxOutIndex != 0 {
+		return fmt.Errorf("%w: refund tx does not spend the new pool output", libs.ErrTransitionMismatch)
+	}
+	if input.SequenceNumber != 1 {
+		return fmt.Errorf("%w: refund sequence must restart at 1, got %d", libs.ErrTransitionMismatch, input.SequenceNumber)
+	}
+	if err := libs.CheckRefundTimelock(refundTx, endHeight); err != nil {
+		return err
+	}
+	bScript, aScript, err := p.refundPayoutScripts()
+	if err != nil {
+		return err
+	}
+	scripts, err := payoutScripts(p.BPublicKey, p.APublicKey, bScript, aScript)
+	if err != nil {
+		return err
+	}
+	arbiterScript, err := ArbiterPayoutScript(p.ServerPublicKey)
+	if err != nil {
+		return err
+	}
+	if err := libs.CheckPayoutOutputs(refundTx, append(scripts, arbiterScript), expected.Amount); err != nil {
+		return err
+	}
+	amounts, _, arbiterRefund, err := splitPayouts(refundTx, scripts, arbiterScript)
+	if err != nil {
+		return err
+	}
+	if amounts[0] != expected.BBalance {
+		return fmt.Errorf("%w: refund pays b %d, expected %d", libs.ErrTransitionMismatch, amounts[0], expected.BBalance)
+	}
+	if arbiterRefund != expected.ArbiterRefund {
+		return fmt.Errorf("%w: refund pays the arbiter %d, expected %d", libs.ErrTransitionMismatch, arbiterRefund, expected.ArbiterRefund)
+	}
+	_, err = ServerVerifyClientASig(refundTx, expected.Amount, p.ServerPublicKey, p.APublicKey, p.BPublicKey, aSignBytes)
+	return err
+}
+
+func signTriplePoolInput(spliceTx *tx.Transaction, p *SpliceOutParams, privateKey *ec.PrivateKey) (*[]byte, error) {
+	flag := sighash.Flag(sighash.ForkID | sighash.All)
+	template, err := libs.Unlock([]*ec.PrivateKey{privateKey}, []*ec.PublicKey{p.ServerPublicKey, p.APublicKey, p.BPublicKey}, 2, &flag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unlocking script template: %w", err)
+	}
+	return template.SignOne(spliceTx, 0, privateKey)
+}
+
+func requireFullySigned(t *tx.Transaction) error {
+	if t == nil || len(t.Inputs) == 0 {
+		return fmt.Errorf("%w: empty transaction", libs.ErrInvalidTransaction)
+	}
+	for i, input := range t.Inputs {
+		if input.UnlockingScript == nil || len(*input.UnlockingScript) == 0 {
+			return fmt.Errorf("%w: input %d is not signed yet", libs.ErrInvalidTransaction, i)
+		}
+	}
+	return nil
+}
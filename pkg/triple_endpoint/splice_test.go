@@ -0,0 +1,144 @@
+package triple_endpoint
+
+import (
+	"errors"
+	"testing"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	tx "github.com/bsv-blockchain/go-sdk/transaction"
+
+	libs "github.com/spycat55/KeymasterMultisigPool/pkg/libs"
+)
+
+// splice-out：B 方提取已赚取金额，新退款交易中 B 方余额相应减少。
+func TestTripleSpliceOut(t *testing.T) {
+	aPriv, _ := ec.PrivateKeyFromHex("2796e78fad7d383fa5236607eba52d9a1904325daf9b4da3d77be5ad15ab1dae")
+	bPriv, _ := ec.PrivateKeyFromHex("a682814ac246ca65543197e593aa3b2633b891959c183416f54e2c63a8de1d8c")
+	sPriv, _ := ec.PrivateKeyFromHex("e6d4d7685894d2644d1f4bf31c0b87f3f6aa8a3d7d4091eaa375e81d6c9f9091")
+
+	latest, err := BuildTripleFeePoolSpendTXV2(SpendParams{
+		PrevTxID:        "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+		PoolAmount:      100000,
+		EndHeight:       900000,
+		ServerPublicKey: sPriv.PubKey(),
+		APrivateKey:     aPriv,
+		BPublicKey:      bPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	next, err := TripleFeePoolLoadTxV2(UpdateParams{
+		TxHex: latest.Tx.Hex(), Sequence: 2, BAmount: 30000, PoolAmount: 100000,
+		ServerPublicKey: sPriv.PubKey(), APublicKey: aPriv.PubKey(), BPublicKey: bPriv.PubKey(),
+	})
+	if err != nil {
+		t.Fatalf("update latest: %v", err)
+	}
+	aLatestSig, _ := ClientATripleFeePoolSpendTXUpdateSign(next, sPriv.PubKey(), aPriv, bPriv.PubKey())
+	bLatestSig, _ := ClientBTripleFeePoolSpendTXUpdateSign(next, sPriv.PubKey(), aPriv.PubKey(), bPriv)
+	signedLatest, err := MergeTripleFeePoolSigForSpendTx(next.Hex(), aLatestSig, bLatestSig)
+	if err != nil {
+		t.Fatalf("merge latest: %v", err)
+	}
+
+	p := SpliceOutParams{
+		Latest:          signedLatest,
+		PoolAmount:      100000,
+		Withdraw:        20000,
+		ServerPublicKey: sPriv.PubKey(),
+		APublicKey:      aPriv.PubKey(),
+		BPublicKey:      bPriv.PubKey(),
+		FeeRate:         5,
+	}
+	res, err := BuildTripleSpliceOutTx(p)
+	if err != nil {
+		t.Fatalf("build splice-out: %v", err)
+	}
+	if res.Amount != 80000-res.Fee || res.BBalance != 10000-res.Fee {
+		t.Fatalf("unexpected splice-out amounts %d/%d fee %d", res.Amount, res.BBalance, res.Fee)
+	}
+
+	wire, _ := tx.NewTransactionFromHex(res.Tx.Hex())
+	bSig, err := BSignSpliceOut(wire, p, bPriv)
+	if err != nil {
+		t.Fatalf("b sign: %v", err)
+	}
+	wire, _ = tx.NewTransactionFromHex(res.Tx.Hex())
+	spliceTx, err := ASignSpliceOut(wire, p, aPriv, bSig)
+	if err != nil {
+		t.Fatalf("a sign: %v", err)
+	}
+	err = interpreter.NewEngine().Execute(
+		interpreter.WithTx(spliceTx, 0, spliceTx.Inputs[0].SourceTxOutput()),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	)
+	if err != nil {
+		t.Fatalf("splice-out failed script check: %v", err)
+	}
+
+	refund, err := BuildSpliceOutRefundTX(spliceTx, p, 900000, aPriv)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if refund.Tx.Inputs[0].SequenceNumber != 1 || refund.Tx.Outputs[0].Satoshis != res.BBalance {
+		t.Fatalf("refund must restart sequence and carry the remaining b balance")
+	}
+	received, _ := tx.NewTransactionFromHex(spliceTx.Hex())
+	if err := BVerifySpliceOutRefund(refund.Tx, received, p, 900000, refund.ASignBytes); err != nil {
+		t.Fatalf("b verify refund: %v", err)
+	}
+	if _, err := SpendTXTripleFeePoolBSign(refund.Tx, res.Amount, sPriv.PubKey(), aPriv.PubKey(), bPriv); err != nil {
+		t.Fatalf("b co-sign refund: %v", err)
+	}
+
+	// A 方少算 B 方余额会被拒绝
+	refund.Tx.Outputs[0].Satoshis--
+	if err := BVerifySpliceOutRefund(refund.Tx, received, p, 900000, refund.ASignBytes); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch, got %v", err)
+	}
+
+	// 已赚取金额必须来自 A、B 双方签过的状态
+	unsigned := p
+	unsigned.Latest = next
+	if _, err := BuildTripleSpliceOutTx(unsigned); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for a latest without a and b signatures, got %v", err)
+	}
+	forged := p
+	forged.Latest = signedLatest.ShallowClone()
+	forged.Latest.Outputs[0].Satoshis += 20000
+	forged.Latest.Outputs[1].Satoshis -= 20000
+	if _, err := BuildTripleSpliceOutTx(forged); !errors.Is(err, libs.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature for a forged latest, got %v", err)
+	}
+
+	over := p
+	over.Withdraw = 30000
+	if _, err := BuildTripleSpliceOutTx(over); !errors.Is(err, libs.ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+
+	// 开池时声明的 B 方脚本沿用到新 outpoint 上的退款，A 方不能改回 P2PKH
+	coldPriv, _ := ec.PrivateKeyFromHex("1c4f0a2a6b5d3e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f7")
+	coldScripts, _ := PayoutScripts(coldPriv.PubKey(), aPriv.PubKey())
+	cold := p
+	cold.BPayoutScript = coldScripts[0]
+	coldRefund, err := BuildSpliceOutRefundTX(spliceTx, cold, 900000, aPriv)
+	if err != nil {
+		t.Fatalf("cold refund: %v", err)
+	}
+	if !coldRefund.Tx.Outputs[0].LockingScript.Equals(coldScripts[0]) {
+		t.Fatalf("refund must pay b to its declared script")
+	}
+	if err := BVerifySpliceOutRefund(coldRefund.Tx, received, cold, 900000, coldRefund.ASignBytes); err != nil {
+		t.Fatalf("b verify cold refund: %v", err)
+	}
+	plain, err := BuildSpliceOutRefundTX(spliceTx, p, 900000, aPriv)
+	if err != nil {
+		t.Fatalf("plain refund: %v", err)
+	}
+	if err := BVerifySpliceOutRefund(plain.Tx, received, cold, 900000, plain.ASignBytes); !errors.Is(err, libs.ErrTransitionMismatch) {
+		t.Fatalf("expected ErrTransitionMismatch for a refund ignoring the declared script, got %v", err)
+	}
+}
@@ -13,6 +13,7 @@ import { hash256 } from '@bsv/sdk/primitives/Hash';
 import * as ECDSA from '@bsv/sdk/primitives/ECDSA';
 import BigNumber from '@bsv/sdk/primitives/BigNumber';
 import { createDualMultisigScript, createP2PKHScript } from './1base_tx';
+import { type DustPolicy, deductFee, layoutPayouts } from '../libs/DUST';
 
 // 定义 SigHash 常量，与 Go SDK 保持一致
 // const SigHash = {
@@ -73,6 +74,7 @@ interface DualSpendTxResponse {
 	 * @param endHeight 锁定到的区块高度
 	 * @param clientPrivateKey 客户端私钥
 	 * @param serverPublicKey 服务器公钥
+	 * @param dust 粉尘策略；省略时保持 [服务器, 客户端] 两个输出的原有布局，与 Go 端 DustKeepZero 相同
 	 * @returns 构建的交易和金额
 	 */
 	export async function subBuildDualFeePoolSpendTX(
@@ -83,6 +85,7 @@ interface DualSpendTxResponse {
 		clientPrivateKey: PrivateKey,
 		serverPublicKey: PublicKey,
 		feeRate: number,
+		dust?: DustPolicy,
 	): Promise<BuildDualSpendTxResponse> {
 		const clientPublicKey = clientPrivateKey.toPublicKey();
 		const clientAddress = clientPublicKey.toAddress();
@@ -143,14 +146,28 @@ interface DualSpendTxResponse {
 		}
 
 		// 更新客户端输出金额（扣除手续费）
-		tx.outputs[1].satoshis = totalAmount - serverAmount - fee;
+		let amount = totalAmount - serverAmount - fee;
+		tx.outputs[1].satoshis = amount;
+
+		// 给出粉尘策略时按 Go 端 BuildDualFeePoolSpendTXV2 的布局重排输出，客户端金额取其最终输出
+		if (dust != null) {
+			const clientOut = deductFee(dust, totalAmount - serverAmount, fee);
+			tx.outputs = layoutPayouts(dust, [
+				{ amount: serverAmount, lockingScript: serverLockingScript },
+				{ amount: clientOut, lockingScript: clientLockingScript },
+			]);
+			const clientHex = clientLockingScript.toHex();
+			amount = tx.outputs
+				.filter(out => out.lockingScript.toHex() === clientHex)
+				.reduce((sum, out) => sum + (out.satoshis || 0), 0);
+		}
 
 		// 清空假解锁脚本，防止广播时出现非规范 DER 签名错误，后续由真实签名填充
 		tx.inputs[0].unlockingScript = new UnlockingScript();
 
 		return {
 			tx,
-			amount: totalAmount - serverAmount - fee
+			amount
 		};
 	}
 
@@ -226,6 +243,7 @@ interface DualSpendTxResponse {
 	 * @param endHeight 锁定到的区块高度
 	 * @param clientPrivateKey 客户端私钥
 	 * @param serverPublicKey 服务器公钥
+	 * @param dust 粉尘策略，见 subBuildDualFeePoolSpendTX
 	 * @returns 完整的交易、客户端签名和金额
 	 */
 	export async function buildDualFeePoolSpendTX(
@@ -236,6 +254,7 @@ interface DualSpendTxResponse {
 		clientPrivateKey: PrivateKey,
 		serverPublicKey: PublicKey,
 		feeRate: number,
+		dust?: DustPolicy,
 	): Promise<DualSpendTxResponse> {
 		try {
 			// 构建交易
@@ -246,7 +265,8 @@ interface DualSpendTxResponse {
 				endHeight,
 				clientPrivateKey,
 				serverPublicKey,
-				feeRate
+				feeRate,
+				dust
 			);
 
 			console.log('BuildOneB success');
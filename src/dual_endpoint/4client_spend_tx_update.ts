@@ -7,12 +7,15 @@ import { hash256 } from '@bsv/sdk/primitives/Hash';
 import * as ECDSA from '@bsv/sdk/primitives/ECDSA';
 import BigNumber from '@bsv/sdk/primitives/BigNumber';
 import { createDualMultisigScript } from './1base_tx';
+import P2PKH from '../libs/P2PKH';
+import { type DustPolicy, DustAction, deductFee, layoutPayouts, splitPayouts } from '../libs/DUST';
 
 export const FINAL_LOCKTIME = 0xffffffff;
 
 /**
  * 载入 B-Tx（hex）并修改金额 / sequence / locktime 等信息
- * 对应 Go: LoadTx
+ * 对应 Go: LoadTx；给出 dust 时对应 Go: LoadTxV2（Dust 相同、手续费由客户端承担），
+ * 被省略的一方按签名公钥的 P2PKH 识别，输出数量可以在 1 与 2 之间变化
  */
 export function loadTx(
   txHex: string,
@@ -22,6 +25,7 @@ export function loadTx(
   serverPublicKey: PublicKey,
   clientPublicKey: PublicKey,
   targetAmount: number,
+  dust?: DustPolicy,
 ): Transaction {
   const tx = Transaction.fromHex(txHex);
 
@@ -46,6 +50,22 @@ export function loadTx(
 
   tx.inputs[0].sequence = sequenceNumber;
 
+  if (dust != null && dust.action !== DustAction.KeepZero) {
+    const p2pkh = new P2PKH();
+    const current = splitPayouts(tx.outputs.map(out => ({ satoshis: out.satoshis || 0, lockingScript: out.lockingScript })),
+      [p2pkh.lock(serverPublicKey), p2pkh.lock(clientPublicKey)]);
+    const fee = targetAmount - current[0].amount - current[1].amount;
+    if (fee < 0 || serverAmount > targetAmount) {
+      throw new Error(`insufficient funds: server amount ${serverAmount}, pool amount ${targetAmount}, fee ${fee}`);
+    }
+    const clientOut = deductFee(dust, targetAmount - serverAmount, fee);
+    tx.outputs = layoutPayouts(dust, [
+      { amount: serverAmount, lockingScript: current[0].lockingScript },
+      { amount: clientOut, lockingScript: current[1].lockingScript },
+    ]);
+    return tx;
+  }
+
   // 更新输出金额（index 0 server, index 1 client）
   const total = (tx.outputs[0].satoshis || 0) + (tx.outputs[1].satoshis || 0);
   tx.outputs[0].satoshis = serverAmount;
@@ -17,6 +17,7 @@ export * from './crypto/go_rfc6979';
 export { default as MultiSig } from './libs/MULTISIG';
 export { default as P2PK } from './libs/P2PK';
 export { default as P2PKH } from './libs/P2PKH';
+export * from './libs/DUST';
 
 // ============================================================================
 // 双端点模块导出
@@ -0,0 +1,124 @@
+/**
+ * 粉尘策略下的支付输出布局
+ *
+ * 与 Go 端 libs.DustPolicy.Layout 逐项一致，双方只要使用相同的策略就能得到逐字节相同的 B-Tx 输出。
+ */
+
+import type LockingScript from '@bsv/sdk/script/LockingScript'
+
+/** 默认粉尘限额，与 Go 端 libs.DustLimit 相同 */
+export const DUST_LIMIT = 546
+
+export enum DustAction {
+  /** 默认：省略金额为 0 的支付，其余全部保留 */
+  Keep = 0,
+  /** 省略低于限额的输出，其金额计入手续费 */
+  Drop = 1,
+  /** 把低于限额的金额并入金额最大的保留输出（相同时取靠前的） */
+  Merge = 2,
+  /** 保留所有支付输出，金额可以为 0（位置参数版本的原有布局） */
+  KeepZero = 3
+}
+
+export interface DustPolicy {
+  action: DustAction
+  /** 保留输出的最小金额；为 0 或省略时使用 DUST_LIMIT */
+  limit?: number
+}
+
+/** 按固定顺序排列的一笔支付：双端池为 [服务器, 客户端]，三方池为 [B, A] */
+export interface Payout {
+  amount: number
+  lockingScript: LockingScript
+}
+
+export interface PayoutOutput {
+  satoshis: number
+  lockingScript: LockingScript
+}
+
+/** 返回策略的粉尘限额，与 Go 端 DustPolicy.Threshold 相同 */
+export function dustThreshold (policy: DustPolicy): number {
+  return policy.limit != null && policy.limit > 0 ? policy.limit : DUST_LIMIT
+}
+
+/**
+ * 从支付方余额中扣除手续费，与 Go 端 deductFee 相同：
+ * Keep 下扣费后余额为正但低于限额时抛出错误，余额为 0 时交给 layoutPayouts 省略；
+ * KeepZero 不检查限额，Drop / Merge 交给 layoutPayouts 处理。
+ */
+export function deductFee (policy: DustPolicy, amount: number, fee: number): number {
+  if (fee === 0) {
+    return amount
+  }
+  if (amount < fee) {
+    throw new Error(`insufficient funds: need ${fee}, have ${amount}`)
+  }
+  const rest = amount - fee
+  const limit = policy.action === DustAction.Keep ? dustThreshold(policy) : 0
+  if (rest < limit && rest !== 0) {
+    throw new Error(`amount below dust limit: ${amount} - fee ${fee} is below ${limit}`)
+  }
+  return rest
+}
+
+/**
+ * 按默认脚本识别交易中的支付输出，与 Go 端 libs.SplitPayouts 相同：
+ * 输出数量与 defaults 相同时按位置读取，否则按顺序匹配 defaults，被省略的一方金额为 0、脚本取默认值。
+ */
+export function splitPayouts (outputs: PayoutOutput[], defaults: LockingScript[]): Payout[] {
+  if (outputs.length === 0 || outputs.length > defaults.length) {
+    throw new Error(`invalid transaction: expected 1 to ${defaults.length} payout outputs, got ${outputs.length}`)
+  }
+  if (outputs.length === defaults.length) {
+    return outputs.map(out => ({ amount: out.satoshis, lockingScript: out.lockingScript }))
+  }
+  const payouts: Payout[] = defaults.map(lockingScript => ({ amount: 0, lockingScript }))
+  let want = 0
+  outputs.forEach((out, i) => {
+    while (want < defaults.length && defaults[want].toHex() !== out.lockingScript.toHex()) {
+      want++
+    }
+    if (want === defaults.length) {
+      throw new Error(`transition mismatch: locking script of output ${i} is not a known payout`)
+    }
+    payouts[want].amount = out.satoshis
+    want++
+  })
+  return payouts
+}
+
+/**
+ * 按策略把支付列表转换为交易输出，保留输出的相对顺序不变。
+ * 没有任何支付达到限额时抛出错误。
+ */
+export function layoutPayouts (policy: DustPolicy, payouts: Payout[]): PayoutOutput[] {
+  if (policy.action !== DustAction.Keep && policy.action !== DustAction.Drop &&
+    policy.action !== DustAction.Merge && policy.action !== DustAction.KeepZero) {
+    throw new Error(`invalid params: unknown dust action ${String(policy.action)}`)
+  }
+  const limit = dustThreshold(policy)
+  const outputs: PayoutOutput[] = []
+  let dust = 0
+  let largest = -1
+  for (const payout of payouts) {
+    if (payout.amount === 0 && policy.action !== DustAction.KeepZero) {
+      continue
+    }
+    if ((policy.action === DustAction.Drop || policy.action === DustAction.Merge) && payout.amount < limit) {
+      dust += payout.amount
+      continue
+    }
+    if (largest < 0 || payout.amount > outputs[largest].satoshis) {
+      largest = outputs.length
+    }
+    outputs.push({ satoshis: payout.amount, lockingScript: payout.lockingScript })
+  }
+  if (outputs.length === 0) {
+    throw new Error(`amount below dust limit: no payout reaches dust limit ${limit}`)
+  }
+  if (policy.action === DustAction.Merge) {
+    outputs[largest].satoshis += dust
+  }
+  return outputs
+}
@@ -11,6 +11,7 @@ import TransactionSignature from '@bsv/sdk/primitives/TransactionSignature';
 // import { fromBase58Check } from '@bsv/sdk/primitives/utils';
 import MultiSig from '../libs/MULTISIG';
 import P2PKH from '../libs/P2PKH';
+import { type DustPolicy, deductFee, layoutPayouts } from '../libs/DUST';
 // import unlock from 'lucide-svelte/icons/unlock';
 
 // 定义 SigHash 常量，与 Go SDK 保持一致
@@ -46,6 +47,7 @@ interface TripleSpendTxResponse {
    * @param serverPublicKey 服务器公钥
    * @param aPrivateKey A方私钥
    * @param bPublicKey B方公钥
+   * @param dust 粉尘策略；省略时保持 [B, A] 两个输出的原有布局，与 Go 端 DustKeepZero 相同
    * @returns 完整的交易、客户端签名和金额
    */
   export async function tripleBuildFeePoolSpendTX(
@@ -56,6 +58,7 @@ interface TripleSpendTxResponse {
     aPrivateKey: PrivateKey,
     bPublicKey: PublicKey,
     feeRate: number,
+    dust?: DustPolicy,
   ): Promise<TripleSpendTxResponse> {
     try {
       // const prevTxId = aTx.id('hex');
@@ -119,6 +122,14 @@ interface TripleSpendTxResponse {
       // 更新客户端输出金额（扣除手续费）
       tx.outputs[1].satoshis = serverValue - fee;
 
+      // 给出粉尘策略时按 Go 端 BuildTripleFeePoolSpendTXV2 的布局重排输出，开池时 B 方金额为 0
+      if (dust != null) {
+        tx.outputs = layoutPayouts(dust, [
+          { amount: 0, lockingScript: serverChangeScript },
+          { amount: deductFee(dust, serverValue, fee), lockingScript: clientChangeScript },
+        ]);
+      }
+
       console.log('------------------------------- BuildOneB success');
       console.log('交易:', tx.toHex());
       
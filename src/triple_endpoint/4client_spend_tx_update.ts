@@ -8,6 +8,8 @@ import TransactionSignature from '@bsv/sdk/primitives/TransactionSignature';
 // import LockingScript from '@bsv/sdk/script/LockingScript';
 // import UnlockingScript from '@bsv/sdk/script/UnlockingScript';
 import MultiSig from '../libs/MULTISIG';
+import P2PKH from '../libs/P2PKH';
+import { type DustPolicy, DustAction, deductFee, layoutPayouts, splitPayouts } from '../libs/DUST';
 
 // 定义 SigHash 常量，与 Go SDK 保持一致
 const SigHash = {
@@ -45,6 +47,8 @@ const SigHash = {
 	 * @param locktime 可选的锁定时间
 	 * @param sequenceNumber 序列号
 	 * @param serverAmount 服务器分配的金额
+	 * @param dust 粉尘策略；给出时与 Go 端 TripleFeePoolLoadTxV2 相同，按 [B, A] 的 P2PKH 识别输出并重新布局，
+	 *             输出数量可以在 1 与 2 之间变化
 	 * @returns 更新后的交易对象
 	 */
 	export async function tripleFeePoolLoadTx(
@@ -55,7 +59,8 @@ const SigHash = {
 		targetAmount: number,
 		locktime?: number,
 		sequenceNumber: number = 0xffffffff,
-		serverAmount: number = 0
+		serverAmount: number = 0,
+		dust?: DustPolicy
 	): Promise<Transaction> {
 		try {
 			// 从 hex 恢复交易
@@ -84,6 +89,21 @@ const SigHash = {
 			// 更新序列号
 			bTx.inputs[0].sequence = sequenceNumber;
 
+			if (dust != null && dust.action !== DustAction.KeepZero) {
+				const p2pkh = new P2PKH();
+				const current = splitPayouts(bTx.outputs.map(out => ({ satoshis: out.satoshis || 0, lockingScript: out.lockingScript })),
+					[p2pkh.lock(bPublicKey), p2pkh.lock(aPublicKey)]);
+				const fee = targetAmount - current[0].amount - current[1].amount;
+				if (fee < 0 || serverAmount > targetAmount) {
+					throw new Error(`insufficient funds: B amount ${serverAmount}, pool amount ${targetAmount}, fee ${fee}`);
+				}
+				bTx.outputs = layoutPayouts(dust, [
+					{ amount: serverAmount, lockingScript: current[0].lockingScript },
+					{ amount: deductFee(dust, targetAmount - serverAmount, fee), lockingScript: current[1].lockingScript },
+				]);
+				return bTx;
+			}
+
 			// 更新输出金额分配
 			if (bTx.outputs.length >= 2 && serverAmount > 0) {
 				const allAmount = (bTx.outputs[0].satoshis || 0) + (bTx.outputs[1].satoshis || 0);
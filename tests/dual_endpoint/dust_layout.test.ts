@@ -0,0 +1,77 @@
+import { readFileSync } from 'fs';
+import { join } from 'path';
+import { PrivateKey } from '@bsv/sdk/primitives';
+import { subBuildDualFeePoolSpendTX } from '../../src/dual_endpoint/2client_spend_tx';
+import { loadTx } from '../../src/dual_endpoint/4client_spend_tx_update';
+import type { DustPolicy } from '../../src/libs/DUST';
+
+// 与 Go 端 TestDualDustVectors 共用 tests/vectors/dust_layout.json，两端必须得到逐字节相同的未签名 B-Tx
+interface DualDustVector {
+  name: string;
+  prev?: string;
+  sequence?: number;
+  serverAmount: number;
+  dust: DustPolicy;
+  hex: string;
+}
+
+const vectors = JSON.parse(readFileSync(join(__dirname, '../vectors/dust_layout.json'), 'utf8')).dual as {
+  clientPrivHex: string;
+  serverPrivHex: string;
+  prevTxId: string;
+  totalAmount: number;
+  endHeight: number;
+  feeRate: number;
+  open: DualDustVector[];
+  update: DualDustVector[];
+};
+
+describe('Dual Endpoint dust layout vectors', () => {
+  const clientPriv = PrivateKey.fromHex(vectors.clientPrivHex);
+  const serverPriv = PrivateKey.fromHex(vectors.serverPrivHex);
+  const built = new Map<string, string>();
+
+  test.each(vectors.open)('open $name matches Go', async (vec) => {
+    const { tx } = await subBuildDualFeePoolSpendTX(
+      vectors.prevTxId,
+      vectors.totalAmount,
+      vec.serverAmount,
+      vectors.endHeight,
+      clientPriv,
+      serverPriv.toPublicKey(),
+      vectors.feeRate,
+      vec.dust,
+    );
+    expect(tx.toHex()).toBe(vec.hex);
+    built.set(vec.name, tx.toHex());
+  });
+
+  test.each(vectors.update)('update $name matches Go', (vec) => {
+    const tx = loadTx(
+      built.get(vec.prev as string) as string,
+      undefined,
+      vec.sequence as number,
+      vec.serverAmount,
+      serverPriv.toPublicKey(),
+      clientPriv.toPublicKey(),
+      vectors.totalAmount,
+      vec.dust,
+    );
+    expect(tx.toHex()).toBe(vec.hex);
+    built.set(vec.name, tx.toHex());
+  });
+
+  test('omitting the dust policy keeps the legacy two-output layout', async () => {
+    const { tx } = await subBuildDualFeePoolSpendTX(
+      vectors.prevTxId,
+      vectors.totalAmount,
+      0,
+      vectors.endHeight,
+      clientPriv,
+      serverPriv.toPublicKey(),
+      vectors.feeRate,
+    );
+    const keepZero = vectors.open.find(vec => vec.name === 'keep-zero') as DualDustVector;
+    expect(tx.toHex()).toBe(keepZero.hex);
+  });
+});
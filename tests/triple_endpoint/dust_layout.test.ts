@@ -0,0 +1,67 @@
+import { readFileSync } from 'fs';
+import { join } from 'path';
+import { PrivateKey } from '@bsv/sdk/primitives';
+import Transaction from '@bsv/sdk/transaction/Transaction';
+import { tripleBuildFeePoolSpendTX } from '../../src/triple_endpoint/2client_spend_tx';
+import { tripleFeePoolLoadTx } from '../../src/triple_endpoint/4client_spend_tx_update';
+import type { DustPolicy } from '../../src/libs/DUST';
+
+// 与 Go 端 TestTripleDustVectors 共用 tests/vectors/dust_layout.json，两端必须得到逐字节相同的未签名 B-Tx
+interface TripleDustVector {
+  name: string;
+  prev?: string;
+  sequence?: number;
+  bAmount?: number;
+  dust: DustPolicy;
+  hex: string;
+}
+
+const vectors = JSON.parse(readFileSync(join(__dirname, '../vectors/dust_layout.json'), 'utf8')).triple as {
+  aPrivHex: string;
+  serverPrivHex: string;
+  bPrivHex: string;
+  prevTxId: string;
+  poolAmount: number;
+  endHeight: number;
+  feeRate: number;
+  open: TripleDustVector[];
+  update: TripleDustVector[];
+};
+
+describe('Triple Endpoint dust layout vectors', () => {
+  const aPriv = PrivateKey.fromHex(vectors.aPrivHex);
+  const serverPriv = PrivateKey.fromHex(vectors.serverPrivHex);
+  const bPriv = PrivateKey.fromHex(vectors.bPrivHex);
+  const built = new Map<string, string>();
+
+  test.each(vectors.open)('open $name matches Go', async (vec) => {
+    const { tx } = await tripleBuildFeePoolSpendTX(
+      vectors.prevTxId,
+      vectors.poolAmount,
+      vectors.endHeight,
+      serverPriv.toPublicKey(),
+      aPriv,
+      bPriv.toPublicKey(),
+      vectors.feeRate,
+      vec.dust,
+    );
+    expect(tx.toHex()).toBe(vec.hex);
+    built.set(vec.name, tx.toHex());
+  });
+
+  test.each(vectors.update)('update $name matches Go', async (vec) => {
+    const tx = await tripleFeePoolLoadTx(
+      Transaction.fromHex(built.get(vec.prev as string) as string),
+      serverPriv.toPublicKey(),
+      aPriv.toPublicKey(),
+      bPriv.toPublicKey(),
+      vectors.poolAmount,
+      undefined,
+      vec.sequence as number,
+      vec.bAmount as number,
+      vec.dust,
+    );
+    expect(tx.toHex()).toBe(vec.hex);
+    built.set(vec.name, tx.toHex());
+  });
+});